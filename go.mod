@@ -17,6 +17,8 @@ require (
 	github.com/xhd2015/less-gen v0.0.19
 	github.com/xhd2015/lls v0.0.9
 	github.com/xhd2015/xgo v1.2.0
+	github.com/yuin/goldmark v1.7.11
+	golang.org/x/mod v0.36.0
 	golang.org/x/term v0.43.0
 	golang.org/x/tools v0.45.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -26,7 +28,6 @@ require (
 	github.com/JohannesKaufmann/dom v0.2.0 // indirect
 	github.com/xhd2015/go-coverage v1.0.41 // indirect
 	github.com/xhd2015/go-inspect v0.0.49 // indirect
-	golang.org/x/mod v0.36.0 // indirect
 	golang.org/x/net v0.54.0 // indirect
 	golang.org/x/sync v0.20.0 // indirect
 	golang.org/x/sys v0.44.0 // indirect
@@ -63,8 +63,11 @@ Commands category:
 Utility commands:
   kill-port <port>                   kill process on the given port
   check-port-ready <port>            check if the port is ready
+  debug attach <pid|:port|name>      attach headless dlv to a running go process
   watch <command> [args...]      watch files and restart command on changes
   preview <file>                     preview a file, currently supports .uml and .puml
+  preview export <path> [-o out]     export markdown and diagrams to html, svg, png or pdf
+  preview --diff <ref> [<dir>]       review the changes against a git ref with rendered diffs
   service                            manage background services (macOS/Linux)
   timeout <duration> <command> [args...]  run command with timeout (e.g., timeout 5s sleep 10)
   for-every [opts] <duration> <cmd>...  run command every interval (also for-every-<duration>)
@@ -99,16 +102,21 @@ Project:
     replace <dir>                    replace go module in the given directory
     replace --all                    replace all local modules that are dependencies
     update <dir>                     update to the latest tag of the module in dir
+    update --plan|--apply            review then apply updates of all local modules
     vendor link <dir>                create symlink for local module in vendor
     vendor link --all                create symlinks for all local modules in vendor
     vendor unlink --all              remove symlinks for all local modules from vendor
+    vendor status|verify|repair      check symlinked vendor modules and restore backups
     inspect <pkg> <T>                inspect the given package and type
     modules                          list go modules under current directory
+    modules affected <range>         list modules affected by a git diff range
 	run --debug <flags> [args...]    run the given program with debug mode
     example
 	  parse-flag                     code snippet for parsing flag
   git
-    tag-next                         tag next
+    tag-next [--minor|--major|--auto] [--pre <id>]  tag next
+    changelog [<from>..<to>]         generate release notes between version tags
+    staged push|pop|list|show|drop   stash staged changes only, backup|restore to a file
 	show-tag [<dir>]                 show the tag of the given directory
 	show-exclude                     show the exclude rules
 	tmp-exclude|tmp-ignore <p>       temporarily add patterns to .git/info/exclude
@@ -117,8 +125,18 @@ Project:
   http
     serve [--port <port>] [DIR]      start a static HTTP server (default port: 8080)
                                      DIR is the directory to serve (default: current directory)
+                                     --spa --cors --no-cache --tls --basic-auth u:p --upload
+    proxy --route /api=URL --route /=URL
+                                     reverse proxy by path prefix, --capture FILE records the traffic
+    replay <capture> --target URL    replay captured requests and compare the responses
+    mock <routes.yaml>               fake backend with templates, latency and failure injection
+    request <file.http> [--env E]    run .http requests with captures and ?? assertions
   with
     goX.Y <commands>                install goX.Y and execute the given command
+  with-go
+    auto <commands>                  use the go version required by the nearest go.mod
+    prune [--keep N]                 remove installed go versions except the newest N
+    verify [goX.Y.Z...]              check installed go versions against SHA256 manifests
   with-goroot <GOROOT> <commands>   set GOROOT and execute the given command
   rule,rules
     add <file>                       add a rule file to ~/.kool/rules/files/
@@ -302,8 +320,7 @@ func handleWith(args []string) error {
 
 func handleWithCmd(cmd string, args []string) error {
 	if strings.HasPrefix(cmd, "go") {
-		// TODO: use current go if match
-		goroot, err := with_go.ResolveGoroot(cmd)
+		goroot, err := with_go.ResolveGorootPreferCurrent(cmd)
 		if err != nil {
 			return err
 		}
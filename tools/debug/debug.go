@@ -8,6 +8,8 @@ import (
 
 	"github.com/xhd2015/kool/tools/dlv"
 	"github.com/xhd2015/kool/tools/go/run"
+	"github.com/xhd2015/less-flags"
+	"github.com/xhd2015/xgo/support/netutil"
 )
 
 const help = `
@@ -15,8 +17,17 @@ kool debug
 
 Debug tools
 
+Usage: kool debug <cmd> [args...]
+
+Available commands:
+  go run [OPTIONS] <pkg> [args...] build and debug a go program
+  attach [OPTIONS] <pid|:port|name> attach to a running go process
+  <binary> [args...]               debug a go-built binary
+
 Examples:
   kool debug go run ./main.go
+  kool debug go run --restart-on-change ./
+  kool debug attach :8080
 `
 
 func Handle(args []string) error {
@@ -33,6 +44,8 @@ func Handle(args []string) error {
 	switch cmd {
 	case "go":
 		return handleGo(args)
+	case "attach":
+		return handleAttach(args)
 	default:
 		// check if cmd is a file
 		fileStat, err := os.Stat(cmd)
@@ -83,3 +96,50 @@ func handleGo(args []string) error {
 
 	return fmt.Errorf("unsupported command: %s", cmd)
 }
+
+const attachHelp = `
+kool debug attach runs a headless dlv attached to a running go process
+
+Usage: kool debug attach [OPTIONS] <pid|:port|name>
+
+The target is a pid, ':<port>' for the process listening on that TCP
+port, or the exact name of a single running process.
+
+Options:
+  --port <port>                    dlv listen port, the next free one is used if busy (default: 2345)
+  -h,--help                        show help message
+
+Examples:
+  kool debug attach 12345
+  kool debug attach :8080
+  kool debug attach my-server
+`
+
+func handleAttach(args []string) error {
+	listenPort := 2345
+	args, err := lessflags.
+		Int("--port", &listenPort).
+		Help("-h,--help", attachHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("requires <pid|:port|name>, try 'kool debug attach --help'")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args[1:], " "))
+	}
+	pid, err := dlv.ResolvePID(args[0])
+	if err != nil {
+		return err
+	}
+	port, err := netutil.FindListenablePort("localhost", listenPort)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "attaching to pid %d\n", pid)
+	return dlv.Attach(pid, dlv.AttachOptions{
+		Port: port,
+	})
+}
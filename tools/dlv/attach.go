@@ -0,0 +1,120 @@
+package dlv
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/kool/tools/port"
+	"github.com/xhd2015/xgo/support/cmd"
+)
+
+type AttachOptions struct {
+	Port          int
+	ExtraDlvFlags []string
+}
+
+// Attach runs a headless dlv attached to the running process pid.
+// --accept-multiclient keeps the session alive across client
+// reconnects, and the process keeps running once dlv exits.
+//
+// dlv attach <pid> --listen=:2345 --api-version=2 --headless --accept-multiclient
+func Attach(pid int, opts AttachOptions) error {
+	port := opts.Port
+	if port == 0 {
+		port = 2345
+	}
+	dlvArgs := []string{"attach", strconv.Itoa(pid),
+		fmt.Sprintf("--listen=:%d", port),
+		"--api-version=2",
+		"--check-go-version=false",
+		"--headless",
+		"--accept-multiclient",
+	}
+	dlvArgs = append(dlvArgs, opts.ExtraDlvFlags...)
+
+	binary := processBinary(pid)
+	go func() {
+		time.Sleep(1 * time.Second)
+		fmt.Print(formatPrompt(binary, port))
+	}()
+	return cmd.Debug().Run("dlv", dlvArgs...)
+}
+
+// ResolvePID finds the process to attach to. target is one of:
+//
+//	<pid>    the process id itself
+//	:<port>  the process listening on the TCP port, see kill-port
+//	<name>   the only process with that exact name
+func ResolvePID(target string) (int, error) {
+	if target == "" {
+		return 0, fmt.Errorf("requires <pid|:port|name>")
+	}
+	if strings.HasPrefix(target, ":") {
+		portNum, err := strconv.Atoi(target[1:])
+		if err != nil {
+			return 0, fmt.Errorf("port: %w", err)
+		}
+		pids, err := port.ListeningPIDs(portNum)
+		if err != nil {
+			return 0, err
+		}
+		return singlePID(pids, fmt.Sprintf("listening on port %d", portNum))
+	}
+	if pid, err := strconv.Atoi(target); err == nil {
+		return pid, nil
+	}
+	output, err := exec.Command("pgrep", "-x", target).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return 0, fmt.Errorf("no process named %s", target)
+		}
+		return 0, fmt.Errorf("pgrep: %w", err)
+	}
+	return singlePID(strings.Fields(string(output)), "named "+target)
+}
+
+func singlePID(pids []string, desc string) (int, error) {
+	// lsof may report the same pid once per listening socket
+	var unique []string
+	seen := make(map[string]bool, len(pids))
+	for _, pid := range pids {
+		if !seen[pid] {
+			seen[pid] = true
+			unique = append(unique, pid)
+		}
+	}
+	switch len(unique) {
+	case 0:
+		return 0, fmt.Errorf("no process %s", desc)
+	case 1:
+		return strconv.Atoi(unique[0])
+	default:
+		return 0, fmt.Errorf("multiple processes %s: %s, attach by pid instead", desc, strings.Join(unique, ", "))
+	}
+}
+
+// processBinary returns the executable of pid, or "" if unknown.
+// It is only used to suggest a breakpoint location in the prompt.
+func processBinary(pid int) string {
+	if runtime.GOOS == "linux" {
+		exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+		if err == nil {
+			return exe
+		}
+	}
+	// on darwin comm is the full path of the executable
+	output, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	exe := strings.TrimSpace(string(output))
+	if _, err := os.Stat(exe); err != nil {
+		return ""
+	}
+	return exe
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,20 +17,20 @@ const PROMPT_TEMPLATE = `
     {
         "configurations": [
                 {
-                        "name": "Debug dlv localhost:2345",
+                        "name": "Debug dlv localhost:__PORT__",
                         "type": "go",
                         "debugAdapter": "dlv-dap",
                         "request": "attach",
                         "mode": "remote",
-                        "port": 2345,
+                        "port": __PORT__,
                         "host": "127.0.0.1",
                         "cwd":"./"
                 }
         ]
     }
     And set breakpoint at: __DEBUG_POINT__
-  > GoLand: click Add Configuration > Go Remote > localhost:2345
-  > Terminal: dlv connect localhost:2345
+  > GoLand: click Add Configuration > Go Remote > localhost:__PORT__
+  > Terminal: dlv connect localhost:__PORT__
 `
 
 // dlv exec --listen=:2345 --api-version=2 --check-go-version=false --headless --
@@ -83,15 +84,68 @@ type DebugOptions struct {
 }
 
 func Debug(binary string, opts DebugOptions) error {
-	dir := opts.Dir
-	port := opts.Port
-	dlvFlags := opts.ExtraDlvFlags
-	args := opts.Args
+	binary, dlvArgs := execArgs(binary, opts)
+
+	// let dlv print first
+	go func() {
+		time.Sleep(1 * time.Second)
+		fmt.Print(formatPrompt(binary, opts.Port))
+	}()
+
+	c := cmd.Debug()
+	if opts.PassStdin {
+		c.Stdin(os.Stdin)
+	}
+	return c.Dir(opts.Dir).Run("dlv", dlvArgs...)
+}
+
+// Start is like Debug but does not wait for dlv to exit, so the
+// caller can stop it with Stop and launch a new one on the same port.
+func Start(binary string, opts DebugOptions) (*exec.Cmd, error) {
+	binary, dlvArgs := execArgs(binary, opts)
+	fmt.Fprintf(os.Stderr, "dlv %s\n", strings.Join(dlvArgs, " "))
+
+	execCmd := exec.Command("dlv", dlvArgs...)
+	execCmd.Dir = opts.Dir
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+	if opts.PassStdin {
+		execCmd.Stdin = os.Stdin
+	}
+	if err := execCmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		time.Sleep(1 * time.Second)
+		fmt.Print(formatPrompt(binary, opts.Port))
+	}()
+	return execCmd, nil
+}
+
+// Stop interrupts a dlv started by Start, which makes it kill the
+// debugged program, and waits for it to exit.
+func Stop(execCmd *exec.Cmd) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- execCmd.Wait()
+	}()
+	execCmd.Process.Signal(os.Interrupt)
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		execCmd.Process.Kill()
+		return <-done
+	}
+}
+
+func execArgs(binary string, opts DebugOptions) (string, []string) {
 	binPath, _ := exec.LookPath(binary)
 	if binPath != "" {
 		binary = binPath
 	}
 
+	port := opts.Port
 	if port == 0 {
 		port = 2345
 	}
@@ -103,26 +157,18 @@ func Debug(binary string, opts DebugOptions) error {
 		// "--tty=/dev/tty",
 		"--headless",
 	}
-	dlvArgs = append(dlvArgs, dlvFlags...)
+	dlvArgs = append(dlvArgs, opts.ExtraDlvFlags...)
 	dlvArgs = append(dlvArgs, "--")
 	dlvArgs = append(dlvArgs, binary)
-	dlvArgs = append(dlvArgs, args...)
-
-	// let dlv print first
-	go func() {
-		time.Sleep(1 * time.Second)
-		fmt.Print(formatPrompt(binary))
-	}()
-
-	c := cmd.Debug()
-	if opts.PassStdin {
-		c.Stdin(os.Stdin)
-	}
-	return c.Dir(dir).Run("dlv", dlvArgs...)
+	dlvArgs = append(dlvArgs, opts.Args...)
+	return binary, dlvArgs
 }
 
-func formatPrompt(binary string) string {
-	prompt := PROMPT_TEMPLATE
+func formatPrompt(binary string, port int) string {
+	if port == 0 {
+		port = 2345
+	}
+	prompt := strings.ReplaceAll(PROMPT_TEMPLATE, "__PORT__", strconv.Itoa(port))
 	debugPoint := "main"
 
 	mainFile := getBinaryMainFile(binary)
@@ -0,0 +1,395 @@
+package changelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/kool/tools/git/tag"
+	"github.com/xhd2015/less-flags"
+)
+
+const help = `
+kool git changelog generates release notes between two refs
+
+Usage: kool git changelog [OPTIONS] [<from>..<to>]
+
+The range defaults to <latest version tag>..HEAD. When run inside a module
+subdirectory, the version tag prefix of that module (e.g. sub/mod/v) is used
+and only commits touching the directory are listed.
+
+Commits are grouped by their conventional type (feat, fix, perf...), and PR
+numbers like (#123) in subjects are linked to the origin remote.
+
+Options:
+  --dir <dir>                      run in the given directory
+  --format <md|json>               output format (default: md)
+  --title <title>                  heading of the release (default: <to>, or Unreleased for HEAD)
+  --repo-url <url>                 base url for PR links (default: derived from origin)
+  --prepend <file>                 insert the notes at the top of file instead of printing
+  -h,--help                        show help message
+
+Examples:
+  kool git changelog
+  kool git changelog v1.2.0..v1.3.0
+  kool git changelog --format json
+  kool git changelog --prepend CHANGELOG.md --title v1.3.0
+`
+
+// Entry is one commit in the changelog
+type Entry struct {
+	Hash     string   `json:"hash"`
+	Type     string   `json:"type,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	Subject  string   `json:"subject"`
+	Breaking bool     `json:"breaking,omitempty"`
+	PRs      []string `json:"prs,omitempty"`
+}
+
+// Section groups entries of the same conventional type
+type Section struct {
+	Type    string   `json:"type"`
+	Title   string   `json:"title"`
+	Entries []*Entry `json:"entries"`
+}
+
+type Changelog struct {
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Title    string     `json:"title"`
+	Date     string     `json:"date"`
+	RepoURL  string     `json:"repo_url,omitempty"`
+	Sections []*Section `json:"sections"`
+}
+
+type Options struct {
+	Dir     string
+	Range   string
+	Title   string
+	RepoURL string
+}
+
+// section order and titles, other types go to "Other Changes"
+var sectionTitles = []struct {
+	Type  string
+	Title string
+}{
+	{"breaking", "Breaking Changes"},
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"refactor", "Code Refactoring"},
+	{"revert", "Reverts"},
+	{"docs", "Documentation"},
+	{"test", "Tests"},
+	{"build", "Build System"},
+	{"ci", "Continuous Integration"},
+	{"chore", "Chores"},
+	{"", "Other Changes"},
+}
+
+func Handle(args []string) error {
+	var opts Options
+	var format string
+	var prepend string
+	args, err := lessflags.
+		String("--dir", &opts.Dir).
+		String("--format", &format).
+		String("--title", &opts.Title).
+		String("--repo-url", &opts.RepoURL).
+		String("--prepend", &prepend).
+		Help("-h,--help", help).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args[1:], " "))
+	}
+	if len(args) == 1 {
+		opts.Range = args[0]
+	}
+	switch format {
+	case "", "md", "markdown":
+		format = "md"
+	case "json":
+		if prepend != "" {
+			return fmt.Errorf("--prepend only supports --format md")
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s, expect md or json", format)
+	}
+
+	changelog, err := Generate(opts)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		data, err := json.MarshalIndent(changelog, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	notes := changelog.Markdown()
+	if prepend != "" {
+		if err := PrependFile(prepend, notes); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "updated %s\n", prepend)
+		return nil
+	}
+	fmt.Print(notes)
+	return nil
+}
+
+// Generate collects the commits in opts.Range touching opts.Dir.
+func Generate(opts Options) (*Changelog, error) {
+	dir := opts.Dir
+	from, to, err := resolveRange(dir, opts.Range)
+	if err != nil {
+		return nil, err
+	}
+	revRange := to
+	if from != "" {
+		revRange = from + ".." + to
+	}
+	// %x1e separates records, %x1f separates fields
+	output, err := gitcmd.Output(dir, "log", "--no-merges", "--format=%H%x1f%s%x1f%b%x1e", revRange, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	repoURL := opts.RepoURL
+	if repoURL == "" {
+		remote, err := gitcmd.Output(dir, "remote", "get-url", "origin")
+		if err == nil {
+			repoURL = RemoteToWebURL(strings.TrimSpace(remote))
+		}
+	}
+	date, _ := gitcmd.Output(dir, "log", "-1", "--format=%cs", to)
+
+	title := opts.Title
+	if title == "" {
+		title = to
+		if to == "HEAD" {
+			title = "Unreleased"
+		}
+	}
+	changelog := &Changelog{
+		From:    from,
+		To:      to,
+		Title:   title,
+		Date:    strings.TrimSpace(date),
+		RepoURL: strings.TrimSuffix(repoURL, "/"),
+	}
+	var entries []*Entry
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x1f", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		entries = append(entries, ParseEntry(fields[0], fields[1], fields[2]))
+	}
+	changelog.Sections = groupEntries(entries)
+	return changelog, nil
+}
+
+// resolveRange defaults from to the latest version tag of the module at dir
+// and to to HEAD.
+func resolveRange(dir string, revRange string) (from string, to string, err error) {
+	if revRange != "" {
+		from, to, ok := strings.Cut(revRange, "..")
+		if !ok {
+			return revRange, "HEAD", nil
+		}
+		if strings.HasPrefix(to, ".") {
+			return "", "", fmt.Errorf("symmetric range %s is not supported, use <from>..<to>", revRange)
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+		return from, to, nil
+	}
+	versionPrefix, err := tag.GetVersionPrefix(dir)
+	if err != nil {
+		return "", "", err
+	}
+	latestTag, err := tag.GetLatestVersionTag(dir, versionPrefix)
+	if err != nil {
+		return "", "", fmt.Errorf("%w, specify <from>..<to> explicitly", err)
+	}
+	return latestTag, "HEAD", nil
+}
+
+// conventionalSubject matches "type(scope)!: description"
+var conventionalSubject = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?:\s+(.*)$`)
+
+var breakingFooter = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE:`)
+
+var prNumber = regexp.MustCompile(`#(\d+)\b`)
+
+// ParseEntry parses a commit following Conventional Commits, a subject
+// like "type(scope)!: description" and an optional "BREAKING CHANGE:" footer
+func ParseEntry(hash string, subject string, body string) *Entry {
+	entry := &Entry{Hash: hash, Subject: subject}
+	if m := conventionalSubject.FindStringSubmatch(subject); m != nil {
+		entry.Type = strings.ToLower(m[1])
+		entry.Scope = m[2]
+		entry.Breaking = m[3] == "!"
+		entry.Subject = m[4]
+	}
+	if HasBreakingFooter(body) {
+		entry.Breaking = true
+	}
+	for _, m := range prNumber.FindAllStringSubmatch(subject, -1) {
+		entry.PRs = append(entry.PRs, m[1])
+	}
+	return entry
+}
+
+// HasBreakingFooter tells whether the commit body has a "BREAKING CHANGE:" footer
+func HasBreakingFooter(body string) bool {
+	return breakingFooter.MatchString(body)
+}
+
+func groupEntries(entries []*Entry) []*Section {
+	byType := make(map[string]*Section)
+	known := make(map[string]bool, len(sectionTitles))
+	for _, st := range sectionTitles {
+		known[st.Type] = true
+	}
+	for _, entry := range entries {
+		sectionType := entry.Type
+		if entry.Breaking {
+			sectionType = "breaking"
+		} else if !known[sectionType] {
+			sectionType = ""
+		}
+		section := byType[sectionType]
+		if section == nil {
+			section = &Section{Type: sectionType}
+			byType[sectionType] = section
+		}
+		section.Entries = append(section.Entries, entry)
+	}
+	var sections []*Section
+	for _, st := range sectionTitles {
+		section := byType[st.Type]
+		if section == nil {
+			continue
+		}
+		section.Title = st.Title
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// Markdown renders the changelog as a release section:
+//
+//	## v1.3.0 (2024-05-01)
+//
+//	### Features
+//
+//	- **cli:** add flag ([#12](https://github.com/o/r/pull/12)) (abc1234)
+func (c *Changelog) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s", c.Title)
+	if c.Date != "" {
+		fmt.Fprintf(&b, " (%s)", c.Date)
+	}
+	b.WriteString("\n\n")
+	if len(c.Sections) == 0 {
+		b.WriteString("No changes.\n")
+		return b.String()
+	}
+	for _, section := range c.Sections {
+		fmt.Fprintf(&b, "### %s\n\n", section.Title)
+		for _, entry := range section.Entries {
+			b.WriteString("- ")
+			if entry.Scope != "" {
+				fmt.Fprintf(&b, "**%s:** ", entry.Scope)
+			}
+			b.WriteString(c.linkPRs(entry.Subject))
+			fmt.Fprintf(&b, " (%s)\n", ShortHash(entry.Hash))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (c *Changelog) linkPRs(subject string) string {
+	if c.RepoURL == "" {
+		return subject
+	}
+	return prNumber.ReplaceAllString(subject, fmt.Sprintf("[#$1](%s/pull/$1)", c.RepoURL))
+}
+
+// RemoteToWebURL turns a git remote into a browsable https url, e.g.
+// git@github.com:o/r.git -> https://github.com/o/r. Unknown forms give "".
+func RemoteToWebURL(remote string) string {
+	remote = strings.TrimSuffix(remote, ".git")
+	switch {
+	case strings.HasPrefix(remote, "https://"), strings.HasPrefix(remote, "http://"):
+		// drop credentials if any
+		scheme, rest, _ := strings.Cut(remote, "://")
+		if at := strings.Index(rest, "@"); at >= 0 && at < strings.Index(rest+"/", "/") {
+			rest = rest[at+1:]
+		}
+		return scheme + "://" + rest
+	case strings.HasPrefix(remote, "ssh://"):
+		rest := strings.TrimPrefix(remote, "ssh://")
+		if at := strings.Index(rest, "@"); at >= 0 {
+			rest = rest[at+1:]
+		}
+		host, path, ok := strings.Cut(rest, "/")
+		if !ok {
+			return ""
+		}
+		// strip port
+		host, _, _ = strings.Cut(host, ":")
+		return "https://" + host + "/" + path
+	case strings.Contains(remote, "@") && strings.Contains(remote, ":"):
+		rest := remote[strings.Index(remote, "@")+1:]
+		host, path, _ := strings.Cut(rest, ":")
+		return "https://" + host + "/" + path
+	}
+	return ""
+}
+
+// PrependFile inserts notes into file below its top "# " title, creating
+// the file with a "# Changelog" title if it does not exist.
+func PrependFile(file string, notes string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		return os.WriteFile(file, []byte("# Changelog\n\n"+notes), 0644)
+	}
+	content := string(data)
+	var head string
+	if strings.HasPrefix(content, "# ") {
+		idx := strings.Index(content, "\n")
+		if idx < 0 {
+			head, content = content+"\n", ""
+		} else {
+			head, content = content[:idx+1], content[idx+1:]
+		}
+		head += "\n"
+		content = strings.TrimLeft(content, "\n")
+	}
+	return os.WriteFile(file, []byte(head+notes+content), 0644)
+}
+
+// ShortHash abbreviates a commit hash to 7 characters, like git does by default
+func ShortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
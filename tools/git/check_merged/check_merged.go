@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/xhd2015/kool/tools/git/compare_branch"
 	"github.com/xhd2015/less-flags"
 )
 
@@ -14,8 +15,11 @@ Usage: kool git check-merged <commit1> <commit2>
 check if two commits are merged together.
 
 It runs git merge-base --is-ancestor between two commits and output the relation.
+With --effective, diverged commits are further checked for being effectively
+merged, i.e. cherry-picked, rebased or squash-merged.
 
 Options:
+  --effective          also accept patch-equivalent and squash-merged commits as merged
   -h,--help            show help message
   -v,--verbose         show verbose info
 `
@@ -24,7 +28,9 @@ func Handle(args []string) error {
 	// "github.com/xhd2015/less-flags"
 	var verbose bool
 	var dir string
+	var effective bool
 	args, err := lessflags.String("--dir", &dir).
+		Bool("--effective", &effective).
 		Help("-h,--help", help).
 		Bool("-v,--verbose", &verbose).
 		Parse(args)
@@ -53,6 +59,15 @@ func Handle(args []string) error {
 	}
 
 	if !isAncestor1 && !isAncestor2 {
+		if effective {
+			merged, err := reportEffectivelyMerged(dir, commit1, commit2)
+			if err != nil {
+				return err
+			}
+			if merged {
+				return nil
+			}
+		}
 		return fmt.Errorf("%s and %s are diverged", commit1, commit2)
 	}
 	if isAncestor1 && isAncestor2 {
@@ -83,6 +98,22 @@ func Handle(args []string) error {
 	return fmt.Errorf("unrecognized error")
 }
 
+// reportEffectivelyMerged checks both directions with the patch-id engine
+// of compare-branch
+func reportEffectivelyMerged(dir string, commit1 string, commit2 string) (bool, error) {
+	for _, pair := range [][2]string{{commit1, commit2}, {commit2, commit1}} {
+		state, err := compare_branch.EffectivelyMerged(dir, pair[0], pair[1])
+		if err != nil {
+			return false, err
+		}
+		if state != compare_branch.NotMerged {
+			fmt.Printf("%s is effectively merged into %s (%s)\n", pair[0], pair[1], state)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func isAncestor(dir string, commit1 string, commit2 string) (bool, error) {
 	cmd := exec.Command("git", "merge-base", "--is-ancestor", commit1, commit2)
 	cmd.Dir = dir
@@ -0,0 +1,303 @@
+package compare_branch
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+)
+
+// Commit is a non-merge commit reachable from one side only
+type Commit struct {
+	Hash    string `json:"hash"`
+	Subject string `json:"subject"`
+	PatchID string `json:"patch_id,omitempty"` // empty for commits without changes
+	// Equivalent is the commit on the other side with the same patch id
+	Equivalent string `json:"equivalent,omitempty"`
+}
+
+type FileChange struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`  // A, M, D, R...
+	Added   int    `json:"added"`   // -1 for binary files
+	Deleted int    `json:"deleted"` // -1 for binary files
+}
+
+// MergedState tells whether a ref is effectively merged into another
+type MergedState string
+
+const (
+	NotMerged MergedState = ""
+	// MergedAncestor: the ref is an ancestor, i.e. merged or fast-forwarded
+	MergedAncestor MergedState = "ancestor"
+	// MergedPatchEquivalent: every commit of the ref has a patch-equivalent
+	// commit on the other side, i.e. cherry-picked or rebased
+	MergedPatchEquivalent MergedState = "patch-equivalent"
+	// MergedContent: merging the ref would not change anything, e.g. it
+	// was squash-merged
+	MergedContent MergedState = "squash-merged"
+)
+
+// Analysis is the commit level comparison of A and B, like git cherry in
+// both directions.
+type Analysis struct {
+	A         string `json:"a"`
+	B         string `json:"b"`
+	MergeBase string `json:"merge_base"`
+	// OnlyA and OnlyB exclude the patch-equivalent commits
+	OnlyA []*Commit `json:"only_a"`
+	OnlyB []*Commit `json:"only_b"`
+	// Equivalent lists the commits of A that have an equivalent in B
+	Equivalent   []*Commit     `json:"equivalent"`
+	Files        []*FileChange `json:"files"`
+	AMergedIntoB MergedState   `json:"a_merged_into_b,omitempty"`
+	BMergedIntoA MergedState   `json:"b_merged_into_a,omitempty"`
+}
+
+// Analyze compares the commits unique to a and b by patch id, and the
+// files differing between them.
+func Analyze(dir string, a string, b string) (*Analysis, error) {
+	mergeBase, err := gitcmd.Output(dir, "merge-base", a, b)
+	if err != nil {
+		return nil, err
+	}
+	commitsA, err := listCommits(dir, b+".."+a)
+	if err != nil {
+		return nil, err
+	}
+	commitsB, err := listCommits(dir, a+".."+b)
+	if err != nil {
+		return nil, err
+	}
+	analysis := &Analysis{
+		A:          a,
+		B:          b,
+		MergeBase:  strings.TrimSpace(mergeBase),
+		OnlyA:      []*Commit{},
+		OnlyB:      []*Commit{},
+		Equivalent: []*Commit{},
+	}
+
+	byPatchB := make(map[string]*Commit, len(commitsB))
+	for _, c := range commitsB {
+		if c.PatchID != "" {
+			byPatchB[c.PatchID] = c
+		}
+	}
+	for _, c := range commitsA {
+		if other := byPatchB[c.PatchID]; c.PatchID != "" && other != nil {
+			c.Equivalent = other.Hash
+			other.Equivalent = c.Hash
+			analysis.Equivalent = append(analysis.Equivalent, c)
+			continue
+		}
+		analysis.OnlyA = append(analysis.OnlyA, c)
+	}
+	for _, c := range commitsB {
+		if c.Equivalent == "" {
+			analysis.OnlyB = append(analysis.OnlyB, c)
+		}
+	}
+
+	analysis.Files, err = diffFiles(dir, a, b)
+	if err != nil {
+		return nil, err
+	}
+	analysis.AMergedIntoB, err = effectivelyMerged(dir, a, b, len(commitsA), len(analysis.OnlyA))
+	if err != nil {
+		return nil, err
+	}
+	analysis.BMergedIntoA, err = effectivelyMerged(dir, b, a, len(commitsB), len(analysis.OnlyB))
+	if err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// EffectivelyMerged tells whether ref is merged into target, either by
+// ancestry, by patch-equivalent commits, or by content.
+func EffectivelyMerged(dir string, ref string, target string) (MergedState, error) {
+	commits, err := listCommits(dir, target+".."+ref)
+	if err != nil {
+		return NotMerged, err
+	}
+	targetCommits, err := listCommits(dir, ref+".."+target)
+	if err != nil {
+		return NotMerged, err
+	}
+	targetPatches := make(map[string]bool, len(targetCommits))
+	for _, c := range targetCommits {
+		targetPatches[c.PatchID] = true
+	}
+	unmatched := 0
+	for _, c := range commits {
+		if c.PatchID == "" || !targetPatches[c.PatchID] {
+			unmatched++
+		}
+	}
+	return effectivelyMerged(dir, ref, target, len(commits), unmatched)
+}
+
+func effectivelyMerged(dir string, ref string, target string, commits int, unmatched int) (MergedState, error) {
+	isAncestor, err := isAncestor(dir, ref, target)
+	if err != nil {
+		return NotMerged, err
+	}
+	if isAncestor {
+		return MergedAncestor, nil
+	}
+	// commits can be 0 when ref only has merge commits beyond target
+	if commits > 0 && unmatched == 0 {
+		return MergedPatchEquivalent, nil
+	}
+	noop, err := isNoopMerge(dir, ref, target)
+	if err != nil {
+		return NotMerged, err
+	}
+	if noop {
+		return MergedContent, nil
+	}
+	return NotMerged, nil
+}
+
+// isNoopMerge checks that merging ref into target keeps target's tree, it
+// needs git merge-tree --write-tree (git 2.38+), older git reports false.
+func isNoopMerge(dir string, ref string, target string) (bool, error) {
+	cmd := exec.Command("git", "merge-tree", "--write-tree", target, ref)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		// exit 1 means conflicts, others mean unsupported
+		return false, nil
+	}
+	mergedTree, _, _ := strings.Cut(string(output), "\n")
+	targetTree, err := gitcmd.Output(dir, "rev-parse", target+"^{tree}")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(mergedTree) == strings.TrimSpace(targetTree), nil
+}
+
+// listCommits lists the non-merge commits in revRange, oldest first, with
+// their stable patch ids.
+func listCommits(dir string, revRange string) ([]*Commit, error) {
+	output, err := gitcmd.Output(dir, "log", "--no-merges", "--reverse", "--format=%H%x1f%s", revRange)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*Commit
+	byHash := make(map[string]*Commit)
+	for _, line := range strings.Split(output, "\n") {
+		hash, subject, ok := strings.Cut(line, "\x1f")
+		if !ok {
+			continue
+		}
+		c := &Commit{Hash: hash, Subject: subject}
+		commits = append(commits, c)
+		byHash[hash] = c
+	}
+	if len(commits) == 0 {
+		return commits, nil
+	}
+
+	// git patch-id reads the "commit <hash>" headers followed by patches
+	logCmd := exec.Command("git", "log", "--no-merges", "-p", "--no-color", "--no-ext-diff", "--format=commit %H", revRange)
+	logCmd.Dir = dir
+	patches, err := logCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log -p %s: %w", revRange, err)
+	}
+	patchIDCmd := exec.Command("git", "patch-id", "--stable")
+	patchIDCmd.Dir = dir
+	patchIDCmd.Stdin = bytes.NewReader(patches)
+	ids, err := patchIDCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git patch-id: %w", err)
+	}
+	for _, line := range strings.Split(string(ids), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if c := byHash[fields[1]]; c != nil {
+			c.PatchID = fields[0]
+		}
+	}
+	return commits, nil
+}
+
+func diffFiles(dir string, a string, b string) ([]*FileChange, error) {
+	statusOutput, err := gitcmd.Output(dir, "diff", "--name-status", "-z", a, b)
+	if err != nil {
+		return nil, err
+	}
+	numstatOutput, err := gitcmd.Output(dir, "diff", "--numstat", "-z", a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*FileChange{}
+	byPath := make(map[string]*FileChange)
+	fields := strings.Split(statusOutput, "\x00")
+	for i := 0; i+1 < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+		i++
+		path := fields[i]
+		// renames and copies carry both paths, keep the new one
+		if (status[0] == 'R' || status[0] == 'C') && i+1 < len(fields) {
+			i++
+			path = fields[i]
+		}
+		f := &FileChange{Path: path, Status: status[:1]}
+		files = append(files, f)
+		byPath[path] = f
+	}
+
+	// -z numstat: "added\tdeleted\tpath\0", or for renames
+	// "added\tdeleted\t\0old\0new\0"
+	fields = strings.Split(numstatOutput, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		path := parts[2]
+		if path == "" && i+2 < len(fields) {
+			path = fields[i+2]
+			i += 2
+		}
+		if f := byPath[path]; f != nil {
+			f.Added = parseNumstat(parts[0])
+			f.Deleted = parseNumstat(parts[1])
+		}
+	}
+	return files, nil
+}
+
+func parseNumstat(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		// "-" for binary
+		return -1
+	}
+	return n
+}
+
+func isAncestor(dir string, commit string, target string) (bool, error) {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", commit, target)
+	cmd.Dir = dir
+	err := cmd.Run()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check if %s is ancestor of %s: %w", commit, target, err)
+	}
+	return true, nil
+}
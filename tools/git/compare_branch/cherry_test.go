@@ -0,0 +1,234 @@
+package compare_branch
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a repo with a main branch holding a.txt, and
+// returns helpers running git and writing files in it
+func newTestRepo(t *testing.T) (dir string, git func(args ...string), write func(file string, content string)) {
+	dir = t.TempDir()
+	git = func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write = func(file string, content string) {
+		t.Helper()
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "Test User")
+	write("a.txt", "a\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	return dir, git, write
+}
+
+func TestAnalyze(t *testing.T) {
+	dir, git, write := newTestRepo(t)
+
+	// feature: two commits, the first one is cherry-picked into main
+	git("checkout", "-q", "-b", "feature")
+	write("b.txt", "b\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add b")
+	write("c.txt", "c\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add c")
+
+	// squashed: squash-merged into main below
+	git("checkout", "-q", "-b", "squashed", "main")
+	write("d.txt", "d1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add d")
+	write("d.txt", "d2\n")
+	git("commit", "-q", "-am", "update d")
+
+	// diverge first, or the cherry-pick may recreate the very same commit
+	git("checkout", "-q", "main")
+	write("e.txt", "e\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add e")
+	git("cherry-pick", "feature~1")
+	git("merge", "-q", "--squash", "squashed")
+	git("commit", "-q", "-m", "squash d")
+
+	analysis, err := Analyze(dir, "feature", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Equivalent) != 1 || analysis.Equivalent[0].Subject != "add b" {
+		t.Errorf("expect add b to be equivalent, got %+v", analysis.Equivalent)
+	}
+	if len(analysis.OnlyA) != 1 || analysis.OnlyA[0].Subject != "add c" {
+		t.Errorf("expect only add c in feature, got %+v", analysis.OnlyA)
+	}
+	if len(analysis.OnlyB) != 2 || analysis.OnlyB[1].Subject != "squash d" {
+		t.Errorf("expect only add e and squash d in main, got %+v", analysis.OnlyB)
+	}
+	if analysis.AMergedIntoB != NotMerged {
+		t.Errorf("feature should not be merged, got %q", analysis.AMergedIntoB)
+	}
+	files := make(map[string]string)
+	for _, f := range analysis.Files {
+		files[f.Path] = f.Status
+	}
+	if files["c.txt"] != "D" || files["d.txt"] != "A" || files["e.txt"] != "A" || len(files) != 3 {
+		t.Errorf("unexpected files: %v", files)
+	}
+
+	state, err := EffectivelyMerged(dir, "squashed", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != MergedContent {
+		t.Errorf("expect squashed to be %q, got %q", MergedContent, state)
+	}
+
+	git("branch", "picked", "feature~1")
+	state, err = EffectivelyMerged(dir, "picked", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != MergedPatchEquivalent {
+		t.Errorf("expect picked to be %q, got %q", MergedPatchEquivalent, state)
+	}
+}
+
+func TestEffectivelyMerged(t *testing.T) {
+	dir, git, write := newTestRepo(t)
+
+	// merged: fast-forwarded into main
+	git("checkout", "-q", "-b", "merged")
+	write("m.txt", "m\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add m")
+	git("checkout", "-q", "main")
+	git("merge", "-q", "--ff-only", "merged")
+
+	// rebased: both commits replayed on main after main moved on
+	git("checkout", "-q", "-b", "rebased")
+	write("r1.txt", "r1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add r1")
+	write("r2.txt", "r2\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add r2")
+	git("checkout", "-q", "main")
+	write("e.txt", "e\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add e")
+	git("checkout", "-q", "-b", "rebased-copy", "rebased")
+	git("rebase", "-q", "main")
+	git("checkout", "-q", "main")
+	git("merge", "-q", "--ff-only", "rebased-copy")
+
+	// squashed: two commits squash-merged as one
+	git("checkout", "-q", "-b", "squashed")
+	write("s.txt", "s1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add s")
+	write("s.txt", "s2\n")
+	git("commit", "-q", "-am", "update s")
+	git("checkout", "-q", "main")
+	write("f.txt", "f\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add f")
+	git("merge", "-q", "--squash", "squashed")
+	git("commit", "-q", "-m", "squash s")
+
+	// partial: one of its two commits cherry-picked
+	git("checkout", "-q", "-b", "partial")
+	write("p1.txt", "p1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add p1")
+	write("p2.txt", "p2\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add p2")
+	git("checkout", "-q", "main")
+	write("g.txt", "g\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add g")
+	git("cherry-pick", "partial~1")
+
+	tests := []struct {
+		ref  string
+		want MergedState
+	}{
+		{"merged", MergedAncestor},
+		{"rebased", MergedPatchEquivalent},
+		{"squashed", MergedContent},
+		{"partial", NotMerged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			state, err := EffectivelyMerged(dir, tt.ref, "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != tt.want {
+				t.Errorf("EffectivelyMerged(%s) = %q, want %q", tt.ref, state, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	dir, git, write := newTestRepo(t)
+	content := strings.Repeat("line\n", 20)
+	write("old name.txt", content)
+	write("keep.txt", "keep\n")
+	write("gone.txt", "gone\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	git("branch", "base")
+
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	git("mv", "old name.txt", "dir/new name.txt")
+	write("dir/new name.txt", content+"more\n")
+	write("keep.txt", "keep\nchanged\n")
+	git("rm", "-q", "gone.txt")
+	write("bin.dat", "\x00\x01\x02")
+	write("tab\tname.txt", "tab\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "change")
+
+	files, err := diffFiles(dir, "base", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, fmt.Sprintf("%s %s +%d -%d", f.Status, f.Path, f.Added, f.Deleted))
+	}
+	sort.Strings(got)
+	want := []string{
+		"A bin.dat +-1 --1",
+		"A tab\tname.txt +1 -0",
+		"D gone.txt +0 -1",
+		"M keep.txt +1 -0",
+		"R dir/new name.txt +1 -0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diffFiles() mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -1,6 +1,7 @@
 package compare_branch
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -8,11 +9,30 @@ import (
 	git_tag_next "github.com/xhd2015/kool/tools/git/git_tag_next"
 )
 
+const help = `
+Usage: kool git compare-branch <refA> [refB] [OPTIONS]
+
+Compare two refs, refB defaults to the current branch. Diverged refs are
+compared commit by commit with patch ids like git cherry, so cherry-picked,
+rebased and squash-merged changes are recognized.
+
+Options:
+  -C <dir>             run in the given directory
+  --json               print the commit and file level analysis as json
+  -h,--help            show help message
+`
+
 func Handle(args []string) error {
 	var dir string
 	var refs []string
+	var jsonOutput bool
 	for i := 0; i < len(args); i++ {
-		if args[i] == "-C" {
+		if args[i] == "-h" || args[i] == "--help" {
+			fmt.Print(strings.TrimPrefix(help, "\n"))
+			return nil
+		} else if args[i] == "--json" {
+			jsonOutput = true
+		} else if args[i] == "-C" {
 			if i+1 >= len(args) {
 				return fmt.Errorf("-C requires a directory argument")
 			}
@@ -46,6 +66,19 @@ func Handle(args []string) error {
 		}
 	}
 
+	if jsonOutput {
+		analysis, err := Analyze(dir, refA, refB)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(analysis, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
 	result, err := git.CompareBranches(dir, refA, refB)
 	if err != nil {
 		return err
@@ -89,9 +122,63 @@ func Handle(args []string) error {
 		fmt.Printf("their most recent base is %s\n", result.MergeBase)
 		fmt.Printf("%s has %d unique %s\n", refA, result.CommitsAheadA, commitWordA)
 		fmt.Printf("%s has %d unique %s\n", refB, result.CommitsAheadB, commitWordB)
-		fmt.Println("They need to be merged")
+
+		analysis, err := Analyze(dir, refA, refB)
+		if err != nil {
+			return err
+		}
+		printAnalysis(analysis)
+		switch {
+		case analysis.AMergedIntoB != NotMerged:
+			fmt.Printf("%s is effectively merged into %s (%s)\n", refA, refB, analysis.AMergedIntoB)
+		case analysis.BMergedIntoA != NotMerged:
+			fmt.Printf("%s is effectively merged into %s (%s)\n", refB, refA, analysis.BMergedIntoA)
+		default:
+			fmt.Println("They need to be merged")
+		}
 		return nil
 	}
 
 	return nil
 }
+
+func printAnalysis(a *Analysis) {
+	fmt.Println()
+	fmt.Printf("%d only in %s, %d only in %s, %d patch-equivalent\n", len(a.OnlyA), a.A, len(a.OnlyB), a.B, len(a.Equivalent))
+	printCommits("only in "+a.A, a.OnlyA)
+	printCommits("only in "+a.B, a.OnlyB)
+	if len(a.Equivalent) > 0 {
+		fmt.Printf("patch-equivalent (%s = %s):\n", a.A, a.B)
+		for _, c := range a.Equivalent {
+			fmt.Printf("  %s = %s %s\n", shortHash(c.Hash), shortHash(c.Equivalent), c.Subject)
+		}
+	}
+	if len(a.Files) > 0 {
+		fmt.Printf("files differing between %s and %s:\n", a.A, a.B)
+		for _, f := range a.Files {
+			stat := "binary"
+			if f.Added >= 0 {
+				stat = fmt.Sprintf("+%d -%d", f.Added, f.Deleted)
+			}
+			fmt.Printf("  %s %s %s\n", f.Status, f.Path, stat)
+		}
+	}
+	fmt.Println()
+}
+
+func printCommits(title string, commits []*Commit) {
+	if len(commits) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, c := range commits {
+		fmt.Printf("  %s %s\n", shortHash(c.Hash), c.Subject)
+	}
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
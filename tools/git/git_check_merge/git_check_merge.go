@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/xhd2015/kool/pkgs/errs"
+	"github.com/xhd2015/kool/tools/git/compare_branch"
 )
 
 // MergeStatus represents the merge status of a reference relative to HEAD
@@ -18,6 +19,10 @@ type MergeStatus struct {
 
 	// CommitCount is the number of commits ahead of HEAD (if IsMerged is false)
 	CommitCount int
+
+	// Effective tells how a ref that is not an ancestor of HEAD was merged
+	// anyway, e.g. squash-merged, see compare_branch.EffectivelyMerged
+	Effective compare_branch.MergedState
 }
 
 // Handle processes the git check-merge command
@@ -25,6 +30,7 @@ func Handle(args []string) error {
 	// Parse flags
 	var dir string
 	var refs []string
+	var effective bool
 	n := len(args)
 	for i := 0; i < n; i++ {
 		arg := args[i]
@@ -42,6 +48,10 @@ func Handle(args []string) error {
 		} else if strings.HasPrefix(arg, "--dir=") {
 			dir = strings.TrimPrefix(arg, "--dir=")
 			continue
+		} else if arg == "--effective" {
+			// also accept cherry-picked, rebased or squash-merged refs
+			effective = true
+			continue
 		}
 		return fmt.Errorf("unrecognized %s", arg)
 	}
@@ -52,12 +62,14 @@ func Handle(args []string) error {
 
 	exitCode := 0
 	for _, ref := range refs {
-		status, err := checkMergeStatus(dir, ref)
+		status, err := checkMergeStatus(dir, ref, effective)
 		if err != nil {
 			return fmt.Errorf("failed to check merge status for %s: %w", ref, err)
 		}
 
-		if status.IsMerged {
+		if status.Effective != compare_branch.NotMerged {
+			fmt.Printf("%s is effectively merged into HEAD (%s)\n", ref, status.Effective)
+		} else if status.IsMerged {
 			fmt.Printf("%s is merged into HEAD at %s\n", ref, status.MergeCommit)
 		} else {
 			fmt.Printf("%s has %d commits ahead of HEAD\n", ref, status.CommitCount)
@@ -76,7 +88,7 @@ func Handle(args []string) error {
 // Returns:
 // - MergeStatus: struct containing merge status information
 // - error: any error that occurred
-func checkMergeStatus(dir string, ref string) (*MergeStatus, error) {
+func checkMergeStatus(dir string, ref string, effective bool) (*MergeStatus, error) {
 	// Normalize the ref
 	normalizeCmd := exec.Command("git", "rev-parse", ref)
 	normalizeCmd.Dir = dir
@@ -101,6 +113,20 @@ func checkMergeStatus(dir string, ref string) (*MergeStatus, error) {
 		count := strings.TrimSpace(string(countBytes))
 		countNum := 0
 		fmt.Sscanf(count, "%d", &countNum)
+		if effective {
+			// cherry-picked, rebased or squash-merged
+			state, err := compare_branch.EffectivelyMerged(dir, normalizedRef, "HEAD")
+			if err != nil {
+				return nil, err
+			}
+			if state != compare_branch.NotMerged {
+				return &MergeStatus{
+					IsMerged:    true,
+					CommitCount: countNum,
+					Effective:   state,
+				}, nil
+			}
+		}
 		return &MergeStatus{
 			IsMerged:    false,
 			CommitCount: countNum,
@@ -0,0 +1,69 @@
+package git_check_merge
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/kool/pkgs/errs"
+	"github.com/xhd2015/kool/tools/git/compare_branch"
+)
+
+func TestCheckMergeStatusEffective(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(file string, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "Test User")
+	write("a.txt", "a\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	git("checkout", "-q", "-b", "squashed")
+	write("s.txt", "s1\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "add s")
+	write("s.txt", "s2\n")
+	git("commit", "-q", "-am", "update s")
+	git("checkout", "-q", "main")
+	git("merge", "-q", "--squash", "squashed")
+	git("commit", "-q", "-m", "squash s")
+
+	// only ancestry counts by default
+	status, err := checkMergeStatus(dir, "squashed", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.IsMerged || status.Effective != compare_branch.NotMerged || status.CommitCount != 2 {
+		t.Errorf("expect 2 commits ahead by default, got %+v", status)
+	}
+
+	status, err = checkMergeStatus(dir, "squashed", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsMerged || status.Effective != compare_branch.MergedContent || status.CommitCount != 2 {
+		t.Errorf("expect --effective to report squashed as merged, got %+v", status)
+	}
+
+	err = Handle([]string{"--dir", dir, "squashed"})
+	if exitErr, ok := errs.IsSilenceExitCode(err); !ok || exitErr.SilenceExitCode() != 1 {
+		t.Errorf("expect check-merge to exit with 1 by default, got %v", err)
+	}
+	if err := Handle([]string{"--dir", dir, "--effective", "squashed"}); err != nil {
+		t.Errorf("expect check-merge --effective to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package git_tag_next
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/changelog"
+)
+
+type BumpLevel string
+
+const (
+	BumpPatch BumpLevel = "patch"
+	BumpMinor BumpLevel = "minor"
+	BumpMajor BumpLevel = "major"
+)
+
+func (l BumpLevel) rank() int {
+	switch l {
+	case BumpMajor:
+		return 2
+	case BumpMinor:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Commit is a commit considered by --auto
+type Commit struct {
+	Hash    string
+	Subject string
+	Body    string
+}
+
+// BumpReason records why a commit requires a bump level
+type BumpReason struct {
+	Commit Commit
+	Level  BumpLevel
+	Marker string // e.g. "feat", "!", "BREAKING CHANGE"
+}
+
+// ClassifyCommit returns the bump level a single commit asks for according
+// to Conventional Commits, as parsed by changelog.ParseEntry: "BREAKING
+// CHANGE" footers or "!" after the type are major, "feat" is minor,
+// anything else is patch.
+func ClassifyCommit(commit Commit) BumpReason {
+	reason := BumpReason{Commit: commit, Level: BumpPatch}
+	entry := changelog.ParseEntry(commit.Hash, commit.Subject, commit.Body)
+	prefix := entry.Type
+	if entry.Scope != "" {
+		prefix += "(" + entry.Scope + ")"
+	}
+	switch {
+	case entry.Breaking && !changelog.HasBreakingFooter(commit.Body):
+		reason.Level = BumpMajor
+		reason.Marker = prefix + "!"
+	case entry.Breaking:
+		reason.Level = BumpMajor
+		reason.Marker = "BREAKING CHANGE"
+	case entry.Type == "feat":
+		reason.Level = BumpMinor
+		reason.Marker = prefix
+	default:
+		reason.Marker = prefix
+	}
+	return reason
+}
+
+// DecideBump returns the highest level required by commits, together with
+// the reasons of the commits that asked for that level.
+func DecideBump(commits []Commit) (BumpLevel, []BumpReason) {
+	level := BumpPatch
+	var reasons []BumpReason
+	for _, commit := range commits {
+		reason := ClassifyCommit(commit)
+		switch {
+		case reason.Level.rank() > level.rank():
+			level = reason.Level
+			reasons = []BumpReason{reason}
+		case reason.Level == level:
+			reasons = append(reasons, reason)
+		}
+	}
+	return level, reasons
+}
+
+// BumpVersion bumps the version tag at the given level, resetting the lower
+// components. versionPrefix is the part before the numbers, e.g. "v" or
+// "sub/module/v", as returned by tag.GetVersionPrefix.
+func BumpVersion(versionTag string, versionPrefix string, level BumpLevel) (string, error) {
+	if !strings.HasPrefix(versionTag, versionPrefix) {
+		return "", fmt.Errorf("tag %s does not have prefix %s", versionTag, versionPrefix)
+	}
+	parts := strings.Split(strings.TrimPrefix(versionTag, versionPrefix), ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid version tag: %s", versionTag)
+	}
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid version tag: %s", versionTag)
+		}
+		nums[i] = n
+	}
+	switch level {
+	case BumpMajor:
+		nums[0], nums[1], nums[2] = nums[0]+1, 0, 0
+	case BumpMinor:
+		nums[1], nums[2] = nums[1]+1, 0
+	case BumpPatch:
+		nums[2]++
+	default:
+		return "", fmt.Errorf("unknown bump level: %s", level)
+	}
+	return fmt.Sprintf("%s%d.%d.%d", versionPrefix, nums[0], nums[1], nums[2]), nil
+}
+
+// NextPreReleaseTag returns baseTag-<pre>.N with N one more than the
+// highest existing one in tags, starting at 1.
+func NextPreReleaseTag(baseTag string, pre string, tags []string) string {
+	prefix := baseTag + "-" + pre + "."
+	var nums []int
+	for _, t := range tags {
+		if !strings.HasPrefix(t, prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(t, prefix))
+		if err == nil {
+			nums = append(nums, n)
+		}
+	}
+	next := 1
+	if len(nums) > 0 {
+		sort.Ints(nums)
+		next = nums[len(nums)-1] + 1
+	}
+	return prefix + strconv.Itoa(next)
+}
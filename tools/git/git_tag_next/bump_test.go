@@ -0,0 +1,90 @@
+package git_tag_next
+
+import "testing"
+
+func TestDecideBump(t *testing.T) {
+	tests := []struct {
+		name    string
+		commits []Commit
+		want    BumpLevel
+		reasons int
+	}{
+		{"no commits", nil, BumpPatch, 0},
+		{"fix only", []Commit{{Subject: "fix: nil pointer"}, {Subject: "update readme"}}, BumpPatch, 2},
+		{"feat", []Commit{{Subject: "fix: a"}, {Subject: "feat(cli): add flag"}}, BumpMinor, 1},
+		{"bang", []Commit{{Subject: "feat: a"}, {Subject: "refactor(api)!: drop Foo"}}, BumpMajor, 1},
+		{"footer", []Commit{{Subject: "fix: a", Body: "details\n\nBREAKING CHANGE: Foo removed"}}, BumpMajor, 1},
+		{"not a marker", []Commit{{Subject: "feature: looks like feat"}, {Subject: "feat:no space"}}, BumpPatch, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reasons := DecideBump(tt.commits)
+			if got != tt.want {
+				t.Errorf("DecideBump() = %s, want %s", got, tt.want)
+			}
+			if len(reasons) != tt.reasons {
+				t.Errorf("DecideBump() reasons = %d, want %d", len(reasons), tt.reasons)
+			}
+		})
+	}
+}
+
+func TestClassifyCommit(t *testing.T) {
+	tests := []struct {
+		commit Commit
+		level  BumpLevel
+		marker string
+	}{
+		{Commit{Subject: "fix: nil pointer"}, BumpPatch, "fix"},
+		{Commit{Subject: "update readme"}, BumpPatch, ""},
+		{Commit{Subject: "feat(cli): add flag"}, BumpMinor, "feat(cli)"},
+		{Commit{Subject: "Feat: upper case type"}, BumpMinor, "feat"},
+		{Commit{Subject: "refactor(api)!: drop Foo"}, BumpMajor, "refactor(api)!"},
+		{Commit{Subject: "fix: a", Body: "BREAKING-CHANGE: Foo removed"}, BumpMajor, "BREAKING CHANGE"},
+		{Commit{Subject: "feat:no space"}, BumpPatch, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.commit.Subject, func(t *testing.T) {
+			reason := ClassifyCommit(tt.commit)
+			if reason.Level != tt.level || reason.Marker != tt.marker {
+				t.Errorf("ClassifyCommit() = %s %q, want %s %q", reason.Level, reason.Marker, tt.level, tt.marker)
+			}
+		})
+	}
+}
+
+func TestBumpVersion(t *testing.T) {
+	tests := []struct {
+		tag    string
+		prefix string
+		level  BumpLevel
+		want   string
+	}{
+		{"v1.2.3", "v", BumpPatch, "v1.2.4"},
+		{"v1.2.3", "v", BumpMinor, "v1.3.0"},
+		{"v1.2.3", "v", BumpMajor, "v2.0.0"},
+		{"sub/mod/v0.9.9", "sub/mod/v", BumpMinor, "sub/mod/v0.10.0"},
+	}
+	for _, tt := range tests {
+		got, err := BumpVersion(tt.tag, tt.prefix, tt.level)
+		if err != nil {
+			t.Fatalf("BumpVersion(%s, %s): %v", tt.tag, tt.level, err)
+		}
+		if got != tt.want {
+			t.Errorf("BumpVersion(%s, %s) = %s, want %s", tt.tag, tt.level, got, tt.want)
+		}
+	}
+	if _, err := BumpVersion("other/v1.2.3", "v", BumpPatch); err == nil {
+		t.Errorf("expect error for mismatched prefix")
+	}
+}
+
+func TestNextPreReleaseTag(t *testing.T) {
+	tags := []string{"v1.3.0-rc.1", "v1.3.0-rc.10", "v1.3.0-rc.2", "v1.3.0-beta.5"}
+	if got := NextPreReleaseTag("v1.3.0", "rc", tags); got != "v1.3.0-rc.11" {
+		t.Errorf("NextPreReleaseTag() = %s, want v1.3.0-rc.11", got)
+	}
+	if got := NextPreReleaseTag("v1.3.0", "alpha", tags); got != "v1.3.0-alpha.1" {
+		t.Errorf("NextPreReleaseTag() = %s, want v1.3.0-alpha.1", got)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/xhd2015/gitops/git"
+	"github.com/xhd2015/kool/tools/git/changelog"
 	"github.com/xhd2015/kool/tools/git/tag"
 	"github.com/xhd2015/less-flags"
 )
@@ -18,10 +20,22 @@ usage: git-tag-next [OPTIONS]
 Options:
    --show       show the tag, no creating or pushing
    --push       push the tag
+   --minor      bump the minor version, e.g. v1.2.3 -> v1.3.0
+   --major      bump the major version, e.g. v1.2.3 -> v2.0.0
+   --auto       pick the level from conventional commits since the latest tag:
+                  "BREAKING CHANGE" or "type!:" -> major, "feat:" -> minor, else patch
+   --pre <id>   create a pre-release of the next version, e.g. --pre rc -> v1.2.4-rc.1
+   --notes      create an annotated tag whose message is the changelog since the latest tag
    --help,-h    help
 
+The patch version is bumped by default. With --auto, --show also explains
+which commits drove the decision.
+
 Example:
     $ git-tag-next --show
+    $ git-tag-next --auto --show
+    $ git-tag-next --minor --pre rc
+    $ git-tag-next --notes --push
 `
 
 type Options struct {
@@ -29,6 +43,11 @@ type Options struct {
 	Show    bool
 	Push    bool
 	Verbose bool
+	Minor   bool
+	Major   bool
+	Auto    bool
+	Pre     string
+	Notes   bool
 }
 
 func Handle(args []string) error {
@@ -36,6 +55,11 @@ func Handle(args []string) error {
 	args, err := lessflags.String("--dir", &opts.Dir).
 		Bool("--show", &opts.Show).
 		Bool("--push", &opts.Push).
+		Bool("--minor", &opts.Minor).
+		Bool("--major", &opts.Major).
+		Bool("--auto", &opts.Auto).
+		String("--pre", &opts.Pre).
+		Bool("--notes", &opts.Notes).
 		Help("-h,--help", help).
 		Bool("-v,--verbose", &opts.Verbose).
 		Parse(args)
@@ -46,6 +70,22 @@ func Handle(args []string) error {
 	if len(args) > 0 {
 		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
 	}
+	var levelFlags []string
+	if opts.Minor {
+		levelFlags = append(levelFlags, "--minor")
+	}
+	if opts.Major {
+		levelFlags = append(levelFlags, "--major")
+	}
+	if opts.Auto {
+		levelFlags = append(levelFlags, "--auto")
+	}
+	if len(levelFlags) > 1 {
+		return fmt.Errorf("%s cannot be used together", strings.Join(levelFlags, " and "))
+	}
+	if opts.Pre != "" && !preReleaseID.MatchString(opts.Pre) {
+		return fmt.Errorf("invalid --pre %q, expect letters and digits like rc or beta", opts.Pre)
+	}
 
 	return handleGitTag(opts)
 }
@@ -85,9 +125,36 @@ func handleGitTag(opts Options) error {
 	}
 
 	// Calculate next tag
-	nextTag, err := IncrementTag(latestTag)
-	if err != nil {
-		return fmt.Errorf("failed to increment tag: %v", err)
+	var nextTag string
+	if !opts.Minor && !opts.Major && !opts.Auto && opts.Pre == "" {
+		nextTag, err = IncrementTag(latestTag)
+		if err != nil {
+			return fmt.Errorf("failed to increment tag: %v", err)
+		}
+	} else {
+		level := BumpPatch
+		switch {
+		case opts.Major:
+			level = BumpMajor
+		case opts.Minor:
+			level = BumpMinor
+		case opts.Auto:
+			level, err = decideAutoBump(dir, latestTag, opts.Show)
+			if err != nil {
+				return err
+			}
+		}
+		nextTag, err = BumpVersion(latestTag, versionPrefix, level)
+		if err != nil {
+			return err
+		}
+		if opts.Pre != "" {
+			tags, err := execGit(dir, "tag", "-l", nextTag+"-"+opts.Pre+".*")
+			if err != nil {
+				return err
+			}
+			nextTag = NextPreReleaseTag(nextTag, opts.Pre, strings.Fields(tags))
+		}
 	}
 
 	if opts.Show {
@@ -96,7 +163,11 @@ func handleGitTag(opts Options) error {
 	}
 
 	// Create new tag
-	if err := runGitCmdPipeOutput(dir, "tag", nextTag); err != nil {
+	if opts.Notes {
+		if err := createAnnotatedTag(dir, nextTag, latestTag); err != nil {
+			return err
+		}
+	} else if err := runGitCmdPipeOutput(dir, "tag", nextTag); err != nil {
 		return fmt.Errorf("failed to create tag: %v", err)
 	}
 
@@ -120,6 +191,79 @@ func handleGitTag(opts Options) error {
 	return nil
 }
 
+// createAnnotatedTag tags HEAD with the changelog of latestTag..HEAD as message
+func createAnnotatedTag(dir string, nextTag string, latestTag string) error {
+	notes, err := changelog.Generate(changelog.Options{
+		Dir:   dir,
+		Range: latestTag + "..HEAD",
+		Title: nextTag,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate notes: %w", err)
+	}
+	msgFile, err := os.CreateTemp("", "kool-tag-notes-*.md")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(msgFile.Name())
+	_, err = msgFile.WriteString(notes.Markdown())
+	msgFile.Close()
+	if err != nil {
+		return err
+	}
+	// verbatim keeps the # headings of the markdown, which the default
+	// cleanup strips as comments
+	if err := runGitCmdPipeOutput(dir, "tag", "-a", nextTag, "--cleanup=verbatim", "-F", msgFile.Name()); err != nil {
+		return fmt.Errorf("failed to create tag: %v", err)
+	}
+	return nil
+}
+
+var preReleaseID = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+
+// decideAutoBump classifies the commits touching dir since latestTag.
+// The explanation goes to stderr so --show still prints only the tag on stdout.
+func decideAutoBump(dir string, latestTag string, explain bool) (BumpLevel, error) {
+	commits, err := commitsSince(dir, latestTag)
+	if err != nil {
+		return "", err
+	}
+	level, reasons := DecideBump(commits)
+	if explain {
+		fmt.Fprintf(os.Stderr, "%d commit(s) since %s, bump %s\n", len(commits), latestTag, level)
+		for _, reason := range reasons {
+			marker := reason.Marker
+			if marker == "" {
+				marker = "no conventional marker"
+			}
+			fmt.Fprintf(os.Stderr, "  %s %s (%s -> %s)\n", changelog.ShortHash(reason.Commit.Hash), reason.Commit.Subject, marker, reason.Level)
+		}
+	}
+	return level, nil
+}
+
+// commitsSince lists the commits in ref..HEAD that touch dir
+func commitsSince(dir string, ref string) ([]Commit, error) {
+	// %x1e separates records, %x1f separates fields
+	output, err := execGit(dir, "log", "--format=%H%x1f%s%x1f%b%x1e", ref+"..HEAD", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x1f", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Subject: fields[1],
+			Body:    strings.TrimSpace(fields[2]),
+		})
+	}
+	return commits, nil
+}
+
 func IncrementTag(tag string) (string, error) {
 	// Find the last numeric part
 	n := len(tag)
@@ -0,0 +1,53 @@
+package git_tag_next
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateAnnotatedTagKeepsHeadings(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "config", "user.name", "test")
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "init")
+	runGit(t, dir, "tag", "v1.0.0")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "feat(cli): add flag")
+
+	if err := createAnnotatedTag(dir, "v1.1.0", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	message := runGit(t, dir, "tag", "-l", "--format=%(contents)", "v1.1.0")
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	if !strings.HasPrefix(lines[0], "## v1.1.0") {
+		t.Fatalf("expect the message to start with ## v1.1.0, got:\n%s", message)
+	}
+	if !strings.Contains(message, "\n### Features\n") || !strings.Contains(message, "- **cli:** add flag") {
+		t.Fatalf("expect the features section in the message, got:\n%s", message)
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return string(output)
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/xhd2015/gitops/git"
+	"github.com/xhd2015/kool/tools/git/changelog"
 	"github.com/xhd2015/kool/tools/git/compare_branch"
 	"github.com/xhd2015/kool/tools/git/check_merged"
 	"github.com/xhd2015/kool/tools/git/git_check_merge"
@@ -14,6 +15,7 @@ import (
 	"github.com/xhd2015/kool/tools/git/grep"
 	"github.com/xhd2015/kool/tools/git/hooks"
 	"github.com/xhd2015/kool/tools/git/line"
+	"github.com/xhd2015/kool/tools/git/repos"
 	"github.com/xhd2015/kool/tools/git/ls"
 	"github.com/xhd2015/kool/tools/git/staged"
 	"github.com/xhd2015/kool/tools/git/worktree"
@@ -28,14 +30,20 @@ Usage: kool git <cmd> [OPTIONS]
 
 Available commands:
   ls                               list files that is able to be committed with git add -A
-  line                             line-related commands (history)
-  worktree                         worktree commands
+  line                             line-related commands (history, blame)
+  worktree                         worktree commands (ls, add, exec, sync, reclaim, merge-back)
   tag-next                         tag next version
+  changelog [<from>..<to>]         generate release notes grouped by conventional type
+  compare-branch <a> [b]           compare refs, recognizing cherry-picked and squash-merged commits
+  grep <string>                    find the commits that added or removed a string
+  staged                           backup, restore, push/pop or vet staged changes
   show-tag                         show tag of current commit
   show-exclude                     show exclude files
   tmp-exclude,tmp-ignore           temporarily add patterns to .git/info/exclude
-  init-hooks                       init git hooks
+  init-hooks                       create .kool/hooks.yaml and install the hooks
+  hooks                            install, run or list hooks configured in .kool/hooks.yaml
   scan-repos                       discover git repositories under filesystem roots
+  repos                            status, pull or exec across all repositories under a directory
   help                             show help message
 
 Options:
@@ -44,12 +52,18 @@ Options:
 
 Options for tag-next:
   --push                           tag and push to remote
+  --minor|--major|--auto           bump level, --auto reads conventional commits
+  --pre <id>                       tag a pre-release like v1.2.4-rc.1
+  --notes                          annotate the tag with the generated changelog
 
 Examples:
   kool git help                    show help message
   kool git ls                      list files
   kool git tag-next --push
+  kool git tag-next --auto --show
   kool git line history <file> 10  # show history of line 10
+  kool git line blame <file> 10-20 # show who last changed lines 10-20
+  kool git repos status --root ~/code
 `
 
 func Handle(args []string) error {
@@ -66,6 +80,8 @@ func Handle(args []string) error {
 		return worktree.Handle(args[1:])
 	case "tag-next":
 		return git_tag_next.Handle(args[1:])
+	case "changelog":
+		return changelog.Handle(args[1:])
 	case "show-tag":
 		isShowTag = true
 		remainArgs = args[1:]
@@ -75,6 +91,8 @@ func Handle(args []string) error {
 		return git_tmp_exclude.Handle(args[1:])
 	case "init-hooks":
 		return hooks.HandleInit(args[1:])
+	case "hooks":
+		return hooks.Handle(args[1:])
 	case "show":
 		if len(args) < 2 {
 			return fmt.Errorf("expected subcommand for show: exclude,tag,children")
@@ -108,6 +126,8 @@ func Handle(args []string) error {
 		return line.Handle(args[1:])
 	case "compare-branch":
 		return compare_branch.Handle(args[1:])
+	case "repos":
+		return repos.Handle(args[1:])
 	case "scan-repos":
 		return scan_repo.RunCLI(args[1:])
 	default:
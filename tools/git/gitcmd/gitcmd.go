@@ -0,0 +1,21 @@
+package gitcmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Output runs git with args in dir and returns its stdout. On failure the
+// error contains the command and the stderr of git.
+func Output(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
@@ -1,26 +1,93 @@
 package grep
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/xhd2015/kool/tools/cmd"
 	"github.com/xhd2015/less-flags"
+	"golang.org/x/term"
 )
 
 const help = `
-Find some commit that has a file containing string "invalid param"
+Find the commits that added or removed a string, e.g. "invalid param"
 
-Usage: kool git grep <string>
+Usage: kool git grep <string> [OPTIONS] [-- <path>...]
 
-git log -S "invalid param" --all --source -p
+By default this is git log -S <string> --all: commits where the number of
+occurrences of the string changed. Each commit is listed with only the
+matching added (+) and removed (-) lines, not the full patch.
+
+Options:
+  -G,--regex           treat <string> as a regular expression and match
+                       changed lines (git log -G)
+  --rev <rev>          search the history of rev instead of all refs
+  --added-only         only show lines where the string was added
+  --removed-only       only show lines where the string was removed
+  --first              only show the commit that first introduced it
+  --last               only show the commit that last removed it
+  --json               print results as json
+  --raw                print the raw patch of git log
+  -v,--verbose         show the git command
+  -h,--help            show help message
+
+Examples:
+  kool git grep "invalid param"
+  kool git grep "invalid param" --first
+  kool git grep -G 'func \w+Handler' -- '*.go'
+  kool git grep "old_flag" --removed-only --last --json
 `
 
-// find some commit that has a file containing string "invalid param":
-// git log -S "invalid param" --all --source -p
+type Options struct {
+	Dir         string
+	Regex       bool
+	Rev         string
+	Paths       []string
+	AddedOnly   bool
+	RemovedOnly bool
+	Verbose     bool
+}
+
+// Commit is a commit with the matching lines it changed
+type Commit struct {
+	Commit  string  `json:"commit"`
+	Source  string  `json:"source,omitempty"` // the ref the commit was reached from
+	Author  string  `json:"author"`
+	Date    string  `json:"date"`
+	Subject string  `json:"subject"`
+	Files   []*File `json:"files"`
+}
+
+type File struct {
+	File  string  `json:"file"`
+	Lines []*Line `json:"lines"`
+}
+
+type Line struct {
+	Kind    string `json:"kind"` // added or removed
+	Line    int    `json:"line"` // line number in the new file for added, old file for removed
+	Content string `json:"content"`
+}
+
 func Handle(args []string) error {
-	var verbose bool
-	args, err := lessflags.Bool("-v,--verbose", &verbose).
+	var opts Options
+	var first bool
+	var last bool
+	var jsonOutput bool
+	var raw bool
+	args, err := lessflags.Bool("-v,--verbose", &opts.Verbose).
+		Bool("-G,--regex", &opts.Regex).
+		String("--rev", &opts.Rev).
+		Bool("--added-only", &opts.AddedOnly).
+		Bool("--removed-only", &opts.RemovedOnly).
+		Bool("--first", &first).
+		Bool("--last", &last).
+		Bool("--json", &jsonOutput).
+		Bool("--raw", &raw).
 		Help("-h,--help", help).
 		Parse(args)
 	if err != nil {
@@ -32,10 +99,316 @@ func Handle(args []string) error {
 	}
 	search := args[0]
 	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	opts.Paths = args
+
+	if opts.AddedOnly && opts.RemovedOnly {
+		return fmt.Errorf("--added-only and --removed-only are exclusive")
+	}
+	if first && last {
+		return fmt.Errorf("--first and --last are exclusive")
+	}
+	if raw {
+		if opts.AddedOnly || opts.RemovedOnly || first || last || jsonOutput {
+			return fmt.Errorf("--raw cannot be used with other output options")
+		}
+		return cmd.Debug(opts.Verbose).Run("git", logArgs(search, opts, true)...)
+	}
+	// --first looks for an addition, --last for a removal
+	if first {
+		opts.AddedOnly = true
+	}
+	if last {
+		opts.RemovedOnly = true
+	}
+
+	commits, err := Search(search, opts)
+	if err != nil {
+		return err
+	}
+	commits = pickFirstLast(commits, first, last)
+	if jsonOutput {
+		if commits == nil {
+			commits = []*Commit{}
+		}
+		data, err := json.MarshalIndent(commits, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no commit found")
+	}
+	matcher, err := newMatcher(search, opts.Regex)
+	if err != nil {
+		return err
+	}
+	printCommits(commits, matcher, term.IsTerminal(int(os.Stdout.Fd())))
+	return nil
+}
+
+func logArgs(search string, opts Options, raw bool) []string {
+	args := []string{"log"}
+	if opts.Regex {
+		args = append(args, "-G", search)
+	} else {
+		args = append(args, "-S", search)
+	}
+	if opts.Rev != "" {
+		args = append(args, opts.Rev)
+	} else {
+		args = append(args, "--all")
+	}
+	args = append(args, "--source", "-p")
+	if !raw {
+		// %x1e starts a commit, %x1f separates fields; -U0 keeps only the
+		// changed lines in hunks
+		args = append(args, "--no-color", "--no-ext-diff", "-U0", "--format=%x1e%H%x1f%S%x1f%an%x1f%aI%x1f%s")
+	}
+	if len(opts.Paths) > 0 {
+		args = append(args, "--")
+		args = append(args, opts.Paths...)
+	}
+	return args
+}
+
+// Search returns the commits changing search, newest first, each with only
+// the changed lines matching search.
+func Search(search string, opts Options) ([]*Commit, error) {
+	matcher, err := newMatcher(search, opts.Regex)
+	if err != nil {
+		return nil, err
+	}
+	var stdout strings.Builder
+	err = cmd.Debug(opts.Verbose).Dir(opts.Dir).Stdout(&stdout).Run("git", logArgs(search, opts, false)...)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := parseLog(stdout.String(), matcher)
+	if err != nil {
+		return nil, err
+	}
+	return filterKind(commits, opts.AddedOnly, opts.RemovedOnly), nil
+}
+
+func newMatcher(search string, isRegex bool) (*regexp.Regexp, error) {
+	if !isRegex {
+		return regexp.MustCompile(regexp.QuoteMeta(search)), nil
+	}
+	re, err := regexp.Compile(search)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return re, nil
+}
+
+func parseLog(output string, matcher *regexp.Regexp) ([]*Commit, error) {
+	var commits []*Commit
+	for _, record := range strings.Split(output, "\x1e") {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		header, patch, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected git log header: %q", header)
+		}
+		commit := &Commit{
+			Commit:  fields[0],
+			Source:  fields[1],
+			Author:  fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+		}
+		files, err := parsePatch(patch, matcher)
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", commit.Commit, err)
+		}
+		commit.Files = files
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// parsePatch collects the changed lines matching matcher from a -U0 patch
+func parsePatch(patch string, matcher *regexp.Regexp) ([]*File, error) {
+	var files []*File
+	var current *File
+	var oldFile string
+	var oldLine, newLine int
+	inHunk := false
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			current = nil
+			inHunk = false
+			continue
+		case !inHunk && strings.HasPrefix(line, "--- "):
+			oldFile = strings.TrimPrefix(strings.TrimPrefix(line, "--- "), "a/")
+			continue
+		case !inHunk && strings.HasPrefix(line, "+++ "):
+			file := strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = oldFile
+			}
+			current = &File{File: file}
+			continue
+		case strings.HasPrefix(line, "@@ "):
+			var err error
+			oldLine, newLine, err = parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			inHunk = current != nil
+			continue
+		}
+		if !inHunk || line == "" {
+			continue
+		}
+		var kind string
+		var lineNum int
+		switch line[0] {
+		case '+':
+			kind, lineNum = "added", newLine
+			newLine++
+		case '-':
+			kind, lineNum = "removed", oldLine
+			oldLine++
+		default:
+			continue
+		}
+		content := line[1:]
+		if !matcher.MatchString(content) {
+			continue
+		}
+		if len(current.Lines) == 0 {
+			files = append(files, current)
+		}
+		current.Lines = append(current.Lines, &Line{Kind: kind, Line: lineNum, Content: content})
+	}
+	return files, nil
+}
+
+// parseHunkHeader extracts 3 and 5 from "@@ -3,2 +5 @@ func ..."
+func parseHunkHeader(line string) (oldStart int, newStart int, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	parseStart := func(field string, prefix string) (int, error) {
+		if !strings.HasPrefix(field, prefix) {
+			return 0, fmt.Errorf("invalid hunk header: %s", line)
+		}
+		start, _, _ := strings.Cut(strings.TrimPrefix(field, prefix), ",")
+		return strconv.Atoi(start)
+	}
+	oldStart, err = parseStart(fields[1], "-")
+	if err != nil {
+		return 0, 0, err
+	}
+	newStart, err = parseStart(fields[2], "+")
+	if err != nil {
+		return 0, 0, err
+	}
+	return oldStart, newStart, nil
+}
+
+// pickFirstLast keeps the oldest commit for --first and the newest for
+// --last, commits being newest first
+func pickFirstLast(commits []*Commit, first bool, last bool) []*Commit {
+	if len(commits) == 0 {
+		return commits
+	}
+	if first {
+		return commits[len(commits)-1:]
+	}
+	if last {
+		return commits[:1]
+	}
+	return commits
+}
 
-	if len(args) > 0 {
-		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+// filterKind drops lines of the other kind, and commits left without lines
+func filterKind(commits []*Commit, addedOnly bool, removedOnly bool) []*Commit {
+	if !addedOnly && !removedOnly {
+		return commits
+	}
+	keep := "added"
+	if removedOnly {
+		keep = "removed"
 	}
+	var result []*Commit
+	for _, commit := range commits {
+		var files []*File
+		for _, file := range commit.Files {
+			var lines []*Line
+			for _, line := range file.Lines {
+				if line.Kind == keep {
+					lines = append(lines, line)
+				}
+			}
+			if len(lines) > 0 {
+				files = append(files, &File{File: file.File, Lines: lines})
+			}
+		}
+		if len(files) > 0 {
+			result = append(result, &Commit{
+				Commit:  commit.Commit,
+				Source:  commit.Source,
+				Author:  commit.Author,
+				Date:    commit.Date,
+				Subject: commit.Subject,
+				Files:   files,
+			})
+		}
+	}
+	return result
+}
 
-	return cmd.Debug(verbose).Run("git", "log", "-S", search, "--all", "--source", "-p")
+const (
+	colorReset  = "\033[0m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorMatch  = "\033[1;4m" // bold underline, readable on both red and green
+)
+
+func printCommits(commits []*Commit, matcher *regexp.Regexp, color bool) {
+	paint := func(c string, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+	for i, commit := range commits {
+		if i > 0 {
+			fmt.Println()
+		}
+		date, _, _ := strings.Cut(commit.Date, "T")
+		header := "commit " + commit.Commit
+		if commit.Source != "" {
+			header += " (" + commit.Source + ")"
+		}
+		fmt.Printf("%s\n%s %s  %s\n", paint(colorYellow, header), date, commit.Author, commit.Subject)
+		for _, file := range commit.Files {
+			fmt.Printf("  %s\n", file.File)
+			for _, line := range file.Lines {
+				sign, c := "+", colorGreen
+				if line.Kind == "removed" {
+					sign, c = "-", colorRed
+				}
+				content := line.Content
+				if color {
+					content = matcher.ReplaceAllStringFunc(content, func(m string) string {
+						return colorMatch + m + colorReset + c
+					})
+				}
+				fmt.Printf("    %s\n", paint(c, fmt.Sprintf("%s%5d: %s", sign, line.Line, content)))
+			}
+		}
+	}
 }
@@ -0,0 +1,211 @@
+package grep
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		line     string
+		oldStart int
+		newStart int
+		wantErr  bool
+	}{
+		{"@@ -3,2 +5 @@ func main() {", 3, 5, false},
+		{"@@ -1 +1 @@", 1, 1, false},
+		{"@@ -0,0 +1,3 @@", 0, 1, false},
+		{"@@ -10,0 +11,2 @@", 10, 11, false},
+		{"@@ -7,3 +0,0 @@", 7, 0, false},
+		{"@@ +1 -1 @@", 0, 0, true},
+		{"@@ -x +1 @@", 0, 0, true},
+		{"@@", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			oldStart, newStart, err := parseHunkHeader(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHunkHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if oldStart != tt.oldStart || newStart != tt.newStart {
+				t.Errorf("parseHunkHeader() = %d, %d, want %d, %d", oldStart, newStart, tt.oldStart, tt.newStart)
+			}
+		})
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		patch  string
+		want   []string
+	}{
+		{
+			name:   "counts omitted",
+			search: "flag",
+			patch: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n" +
+				"@@ -1 +1 @@\n-old flag\n+new flag\n",
+			want: []string{"a.go removed 1 old flag", "a.go added 1 new flag"},
+		},
+		{
+			name:   "line numbers advance within a hunk",
+			search: "x",
+			patch: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n" +
+				"@@ -10,2 +20,3 @@ func f() {\n-x1\n-x2\n+x3\n+y\n+x4\n",
+			want: []string{"a.go removed 10 x1", "a.go removed 11 x2", "a.go added 20 x3", "a.go added 22 x4"},
+		},
+		{
+			name:   "no newline at end of file",
+			search: "end",
+			patch: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n" +
+				"@@ -3 +3 @@\n-the end\n\\ No newline at end of file\n+the end.\n\\ No newline at end of file\n",
+			want: []string{"a.txt removed 3 the end", "a.txt added 3 the end."},
+		},
+		{
+			name:   "added and deleted files",
+			search: "v",
+			patch: "diff --git a/new.txt b/new.txt\nnew file mode 100644\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+v1\n" +
+				"diff --git a/gone.txt b/gone.txt\ndeleted file mode 100644\n--- a/gone.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-v2\n",
+			want: []string{"new.txt added 1 v1", "gone.txt removed 1 v2"},
+		},
+		{
+			name:   "content looking like headers",
+			search: "--",
+			patch: "diff --git a/a.sh b/a.sh\n--- a/a.sh\n+++ b/a.sh\n" +
+				"@@ -1 +1 @@\n--- --force\n+++ --force\n",
+			want: []string{"a.sh removed 1 -- --force", "a.sh added 1 ++ --force"},
+		},
+		{
+			name:   "files without matching lines are dropped",
+			search: "match",
+			patch: "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n" +
+				"diff --git a/b.go b/b.go\nBinary files a/b.go and b/b.go differ\n" +
+				"diff --git a/c.go b/c.go\n--- a/c.go\n+++ b/c.go\n@@ -5 +5 @@\n-match\n+b\n",
+			want: []string{"c.go removed 5 match"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parsePatch(tt.patch, regexp.MustCompile(regexp.QuoteMeta(tt.search)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatFiles(files)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("parsePatch() mismatch\nwant:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestFilterKind(t *testing.T) {
+	commits := []*Commit{
+		{Commit: "c3", Files: []*File{
+			{File: "a.go", Lines: []*Line{{Kind: "removed", Line: 1, Content: "flag"}, {Kind: "added", Line: 1, Content: "flag2"}}},
+		}},
+		{Commit: "c2", Files: []*File{
+			{File: "a.go", Lines: []*Line{{Kind: "removed", Line: 4, Content: "flag"}}},
+			{File: "b.go", Lines: []*Line{{Kind: "added", Line: 2, Content: "flag"}}},
+		}},
+		{Commit: "c1", Files: []*File{
+			{File: "a.go", Lines: []*Line{{Kind: "added", Line: 4, Content: "flag"}}},
+		}},
+	}
+	tests := []struct {
+		name        string
+		addedOnly   bool
+		removedOnly bool
+		want        []string
+	}{
+		{"all", false, false, []string{"c3 a.go removed 1 flag", "c3 a.go added 1 flag2", "c2 a.go removed 4 flag", "c2 b.go added 2 flag", "c1 a.go added 4 flag"}},
+		{"added only", true, false, []string{"c3 a.go added 1 flag2", "c2 b.go added 2 flag", "c1 a.go added 4 flag"}},
+		{"removed only", false, true, []string{"c3 a.go removed 1 flag", "c2 a.go removed 4 flag"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatCommits(filterKind(commits, tt.addedOnly, tt.removedOnly))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("filterKind() mismatch\nwant:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+	// the input is left untouched
+	if len(commits[0].Files[0].Lines) != 2 {
+		t.Errorf("filterKind() modified its input")
+	}
+}
+
+func TestPickFirstLast(t *testing.T) {
+	// newest first, as returned by Search after filterKind
+	commits := []*Commit{{Commit: "c3"}, {Commit: "c2"}, {Commit: "c1"}}
+	tests := []struct {
+		name    string
+		commits []*Commit
+		first   bool
+		last    bool
+		want    string
+	}{
+		{"neither", commits, false, false, "c3,c2,c1"},
+		{"first is the oldest", commits, true, false, "c1"},
+		{"last is the newest", commits, false, true, "c3"},
+		{"single commit", commits[1:2], true, false, "c2"},
+		{"no commits", nil, true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, commit := range pickFirstLast(tt.commits, tt.first, tt.last) {
+				got = append(got, commit.Commit)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("pickFirstLast() = %s, want %s", strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLog(t *testing.T) {
+	output := "\x1eaaa\x1fHEAD\x1fA\x1f2024-05-01\x1fremove flag\n\n" +
+		"diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -2 +1,0 @@\n-flag\n" +
+		"\x1ebbb\x1fHEAD\x1fB\x1f2024-04-01\x1fadd flag\n\n" +
+		"diff --git a/a.go b/a.go\n--- /dev/null\n+++ b/a.go\n@@ -0,0 +1,2 @@\n+x\n+flag\n"
+	commits, err := parseLog(output, regexp.MustCompile("flag"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := formatCommits(commits)
+	want := []string{"aaa a.go removed 2 flag", "bbb a.go added 2 flag"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("parseLog() mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if commits[1].Author != "B" || commits[1].Subject != "add flag" {
+		t.Errorf("unexpected commit: %+v", commits[1])
+	}
+
+	if _, err := parseLog("\x1eaaa\x1fbroken\n", regexp.MustCompile("flag")); err == nil {
+		t.Errorf("expect error for a malformed header")
+	}
+}
+
+func formatFiles(files []*File) []string {
+	var lines []string
+	for _, file := range files {
+		for _, line := range file.Lines {
+			lines = append(lines, file.File+" "+line.Kind+" "+strconv.Itoa(line.Line)+" "+line.Content)
+		}
+	}
+	return lines
+}
+
+func formatCommits(commits []*Commit) []string {
+	var lines []string
+	for _, commit := range commits {
+		for _, line := range formatFiles(commit.Files) {
+			lines = append(lines, commit.Commit+" "+line)
+		}
+	}
+	return lines
+}
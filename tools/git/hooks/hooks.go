@@ -5,18 +5,88 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/less-flags"
 )
 
 //go:embed git-hooks/main.go
 var gitHooksMainGo string
 
+const initHelp = `
+kool git init-hooks installs the kool hook manager into the repository
+
+Usage: kool git init-hooks [OPTIONS]
+
+It creates .kool/hooks.yaml if missing, running kool git staged vet before
+each commit, then runs kool git hooks install. Existing hooks are kept and
+chained, see 'kool git hooks --help'.
+
+It also scaffolds script/git-hooks/main.go for hooks written in Go, unless
+the file already exists.
+
+Options:
+  --no-script          do not scaffold script/git-hooks/main.go
+  -h,--help            show help message
+`
+
+const defaultConfig = `# commands run by git hooks, see: kool git hooks --help
+pre-commit:
+  - name: vet
+    run: kool git staged vet
+# commit-msg:
+#   - name: msg
+#     run: ./script/check-commit-msg.sh   # $1 is the message file
+# pre-push:
+#   - name: test
+#     run: go test ./...
+#     files: ['*.go', 'go.mod']           # only run when these changed
+`
+
 func HandleInit(args []string) error {
+	var noScript bool
+	args, err := lessflags.Bool("--no-script", &noScript).
+		Help("-h,--help", initHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+
+	gitRoot, err := gitcmd.Output("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	configFile := filepath.Join(strings.TrimSpace(gitRoot), configFileName)
+	if _, err := os.Stat(configFile); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(configFile, []byte(defaultConfig), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\n", configFile)
+	}
+	if err := handleInstall(nil); err != nil {
+		return err
+	}
+
+	if noScript {
+		return nil
+	}
 	targetDir := filepath.Join("script", "git-hooks")
 	targetFile := filepath.Join(targetDir, "main.go")
 
 	// Check if target file already exists
 	if _, err := os.Stat(targetFile); err == nil {
-		return fmt.Errorf("file %s already exists", targetFile)
+		fmt.Printf("Skip %s, already exists\n", targetFile)
+		return nil
 	}
 
 	// Create directory if it doesn't exist
@@ -29,8 +99,8 @@ func HandleInit(args []string) error {
 		return fmt.Errorf("failed to write file %s: %w", targetFile, err)
 	}
 
-	fmt.Printf("Git hooks initialized successfully, you can run: \n")
-	fmt.Printf("  go run ./script/git-hooks install\n")
+	fmt.Printf("Scaffolded %s, call it from %s, e.g.:\n", targetFile, configFileName)
+	fmt.Printf("  pre-commit:\n    - name: script\n      run: go run ./script/git-hooks pre-commit\n")
 
 	return nil
 }
@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a git repository and changes into it
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+func TestRunSkipAfterHook(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, filepath.Join(dir, configFileName), `pre-commit:
+  - name: lint
+    run: exit 1
+  - name: record
+    run: echo "$1" >> record.txt
+`)
+
+	if err := handleRun([]string{"pre-commit"}); err == nil || !strings.Contains(err.Error(), "lint") {
+		t.Fatalf("expect lint to fail, got %v", err)
+	}
+	if err := handleRun([]string{"pre-commit", "--skip", "lint"}); err != nil {
+		t.Fatalf("expect --skip lint to pass, got %v", err)
+	}
+	if err := handleRun([]string{"pre-commit", "--skip=lint", "--", "msg-file"}); err != nil {
+		t.Fatalf("expect --skip=lint to pass, got %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "record.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "\n\nmsg-file\n" {
+		t.Fatalf("unexpected hook args: %q", data)
+	}
+}
+
+func TestInitHooksScaffoldsScript(t *testing.T) {
+	dir := newTestRepo(t)
+	scriptFile := filepath.Join(dir, "script", "git-hooks", "main.go")
+
+	if err := HandleInit([]string{"--no-script"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, configFileName)); err != nil {
+		t.Fatalf("expect %s to be created: %v", configFileName, err)
+	}
+	if !isInstalled(filepath.Join(dir, ".git", "hooks", "pre-commit")) {
+		t.Fatalf("expect pre-commit to be installed")
+	}
+	if _, err := os.Stat(scriptFile); !os.IsNotExist(err) {
+		t.Fatalf("expect no script with --no-script, stat: %v", err)
+	}
+
+	if err := HandleInit(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(scriptFile); err != nil {
+		t.Fatalf("expect script to be scaffolded: %v", err)
+	}
+
+	// an existing script is kept
+	writeFile(t, scriptFile, "package main\n")
+	if err := HandleInit(nil); err != nil {
+		t.Fatalf("expect init to skip the existing script, got %v", err)
+	}
+	data, err := os.ReadFile(scriptFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "package main\n" {
+		t.Fatalf("expect existing script to be kept, got %q", data)
+	}
+}
+
+func TestInstallRejectsUnknownHooks(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, filepath.Join(dir, configFileName), `../../escaped:
+  - name: x
+    run: "true"
+`)
+	if err := handleInstall(nil); err == nil || !strings.Contains(err.Error(), `unknown git hook: "../../escaped"`) {
+		t.Fatalf("expect unknown hook error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+		t.Fatalf("expect no file outside the hooks dir, stat: %v", err)
+	}
+
+	hooksDir := filepath.Join(dir, ".git", "hooks")
+	for _, hook := range []string{"../pre-commit", "pre-commit/x", "pre-commit.chained", "not-a-hook"} {
+		if _, err := installHook(hooksDir, hook); err == nil {
+			t.Errorf("expect installHook(%q) to fail", hook)
+		}
+	}
+	if err := handleUninstall([]string{"../config"}); err == nil {
+		t.Errorf("expect uninstall to reject ../config")
+	}
+	if _, err := installHook(hooksDir, "pre-push"); err != nil {
+		t.Fatal(err)
+	}
+	if !isInstalled(filepath.Join(hooksDir, "pre-push")) {
+		t.Errorf("expect pre-push to be installed")
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
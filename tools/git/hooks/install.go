@@ -0,0 +1,231 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+)
+
+// hookMarker identifies the hook files written by install
+const hookMarker = "# kool git hooks:"
+
+// chainedSuffix is appended to a hook that existed before install
+const chainedSuffix = ".chained"
+
+// legacyVetHead starts the block that older init-hooks inserted into
+// pre-commit, the hook manager replaces it.
+const legacyVetHead = "# kool git staged vet"
+
+// gitHookNames are the hooks git runs, see githooks(5)
+var gitHookNames = map[string]bool{
+	"applypatch-msg":        true,
+	"pre-applypatch":        true,
+	"post-applypatch":       true,
+	"pre-commit":            true,
+	"pre-merge-commit":      true,
+	"prepare-commit-msg":    true,
+	"commit-msg":            true,
+	"post-commit":           true,
+	"pre-rebase":            true,
+	"post-checkout":         true,
+	"post-merge":            true,
+	"pre-push":              true,
+	"pre-receive":           true,
+	"update":                true,
+	"proc-receive":          true,
+	"post-receive":          true,
+	"post-update":           true,
+	"reference-transaction": true,
+	"push-to-checkout":      true,
+	"pre-auto-gc":           true,
+	"post-rewrite":          true,
+	"sendemail-validate":    true,
+	"fsmonitor-watchman":    true,
+	"p4-changelist":         true,
+	"p4-prepare-changelist": true,
+	"p4-post-changelist":    true,
+	"p4-pre-submit":         true,
+	"post-index-change":     true,
+}
+
+// checkHookName rejects anything but a git hook name, as the name
+// becomes a file name in the hooks dir
+func checkHookName(hook string) error {
+	if strings.ContainsAny(hook, `/\`) || !gitHookNames[hook] {
+		return fmt.Errorf("unknown git hook: %q", hook)
+	}
+	return nil
+}
+
+const hookScriptTemplate = `#!/bin/sh
+` + hookMarker + ` installed by kool git hooks install, configured in .kool/hooks.yaml
+if command -v kool >/dev/null 2>&1; then
+    exec kool git hooks run __HOOK__ -- "$@"
+fi
+echo "kool not found, skip .kool/hooks.yaml" >&2
+chained="$(dirname "$0")/__HOOK__` + chainedSuffix + `"
+if [ -x "$chained" ]; then
+    exec "$chained" "$@"
+fi
+`
+
+func handleInstall(args []string) error {
+	gitRoot, err := getGitRoot()
+	if err != nil {
+		return err
+	}
+	hooks := args
+	if len(hooks) == 0 {
+		config, err := LoadConfig(gitRoot)
+		if err != nil {
+			return err
+		}
+		hooks = sortedHooks(config)
+	}
+	hooksDir, err := getHooksDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		chained, err := installHook(hooksDir, hook)
+		if err != nil {
+			return fmt.Errorf("%s: %w", hook, err)
+		}
+		if chained {
+			fmt.Printf("Installed %s, the existing hook is chained as %s%s\n", hook, hook, chainedSuffix)
+		} else {
+			fmt.Printf("Installed %s\n", hook)
+		}
+	}
+	return nil
+}
+
+// installHook writes the hook script, moving a foreign hook aside so that
+// it still runs first.
+func installHook(hooksDir string, hook string) (chained bool, err error) {
+	if err := checkHookName(hook); err != nil {
+		return false, err
+	}
+	hookFile := filepath.Join(hooksDir, hook)
+	data, err := os.ReadFile(hookFile)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	content := removeLegacyVetBlock(string(data))
+	if len(data) > 0 && !strings.Contains(content, hookMarker) && !isEmptyScript(content) {
+		chainedFile := hookFile + chainedSuffix
+		if _, err := os.Stat(chainedFile); err == nil {
+			return false, fmt.Errorf("both %s and %s exist, merge them manually", hookFile, chainedFile)
+		}
+		if content != string(data) {
+			if err := os.WriteFile(hookFile, []byte(content), 0755); err != nil {
+				return false, err
+			}
+		}
+		if err := os.Rename(hookFile, chainedFile); err != nil {
+			return false, err
+		}
+		chained = true
+	}
+	script := strings.ReplaceAll(hookScriptTemplate, "__HOOK__", hook)
+	if err := os.WriteFile(hookFile, []byte(script), 0755); err != nil {
+		return false, err
+	}
+	// WriteFile keeps the mode of an existing file
+	return chained, os.Chmod(hookFile, 0755)
+}
+
+func handleUninstall(args []string) error {
+	hooksDir, err := getHooksDir()
+	if err != nil {
+		return err
+	}
+	hooks := args
+	if len(hooks) == 0 {
+		entries, err := os.ReadDir(hooksDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isInstalled(filepath.Join(hooksDir, entry.Name())) {
+				hooks = append(hooks, entry.Name())
+			}
+		}
+	}
+	for _, hook := range hooks {
+		if err := checkHookName(hook); err != nil {
+			return err
+		}
+		hookFile := filepath.Join(hooksDir, hook)
+		if !isInstalled(hookFile) {
+			fmt.Printf("Skip %s, not installed by kool\n", hook)
+			continue
+		}
+		if err := os.Remove(hookFile); err != nil {
+			return err
+		}
+		chainedFile := hookFile + chainedSuffix
+		if _, err := os.Stat(chainedFile); err == nil {
+			if err := os.Rename(chainedFile, hookFile); err != nil {
+				return err
+			}
+			fmt.Printf("Uninstalled %s, restored the chained hook\n", hook)
+			continue
+		}
+		fmt.Printf("Uninstalled %s\n", hook)
+	}
+	return nil
+}
+
+func isInstalled(hookFile string) bool {
+	data, err := os.ReadFile(hookFile)
+	return err == nil && strings.Contains(string(data), hookMarker)
+}
+
+// removeLegacyVetBlock drops the block from its head to the next empty line
+func removeLegacyVetBlock(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, legacyVetHead) {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		if end < len(lines) {
+			end++
+		}
+		return strings.Join(append(lines[:i:i], lines[end:]...), "\n")
+	}
+	return content
+}
+
+// isEmptyScript tells a hook with only a shebang, comments and blank lines
+func isEmptyScript(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+func getHooksDir() (string, error) {
+	// respects core.hooksPath and worktrees
+	output, err := gitcmd.Output("", "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(strings.TrimSpace(output))
+}
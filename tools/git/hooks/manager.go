@@ -0,0 +1,386 @@
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/kool/tools/git/staged"
+	"github.com/xhd2015/less-flags"
+	"gopkg.in/yaml.v3"
+)
+
+const help = `
+kool git hooks manages git hooks from .kool/hooks.yaml
+
+Usage: kool git hooks <cmd> [OPTIONS]
+
+Available commands:
+  install [<hook>...]              install the configured hooks into the repository
+  uninstall [<hook>...]            remove the installed hooks, restoring the chained ones
+  run <hook> [-- args...]          run the commands of hook, as git does
+  list                             list the configured hooks and commands
+  help                             show help message
+
+Config (.kool/hooks.yaml), commands run in order from the repository root:
+
+  pre-commit:
+    - name: vet
+      run: kool git staged vet
+    - name: lint
+      run: ./script/lint.sh "$KOOL_HOOK_FILES"
+      files: ['*.ts', 'web/**']    # only run when matching files are involved
+  commit-msg:
+    - name: msg
+      run: ./script/check-msg.sh "$1"
+  pre-push:
+    - name: test
+      run: go test ./...
+      files: ['*.go']
+
+The git hook args are passed as $1, $2..., and the matching files, one per
+line, as $KOOL_HOOK_FILES. The files involved are the staged ones for
+pre-commit and commit-msg, and the pushed ones for pre-push. Without
+.kool/hooks.yaml, pre-commit runs kool git staged vet.
+
+A hook that already existed before install is kept as <hook>.chained and
+runs first with the same args and stdin.
+
+Skipping:
+  --skip <name>                    skip the command or hook named name, repeatable
+  KOOL_SKIP_HOOKS=<name>,...       same for hooks run by git, 'all' skips everything
+
+Examples:
+  kool git hooks install
+  kool git hooks run pre-commit --skip lint
+  KOOL_SKIP_HOOKS=test git push
+`
+
+const configFileName = ".kool/hooks.yaml"
+
+// skipEnv lists the command or hook names to skip when git runs the hooks
+const skipEnv = "KOOL_SKIP_HOOKS"
+
+// HookCommand is one command of a hook in .kool/hooks.yaml
+type HookCommand struct {
+	Name  string   `yaml:"name"`
+	Run   string   `yaml:"run"`
+	Files []string `yaml:"files"`
+}
+
+// Config maps hook names like pre-commit to their commands
+type Config map[string][]HookCommand
+
+var defaultHookConfig = Config{
+	"pre-commit": {{Name: "vet", Run: "kool git staged vet"}},
+}
+
+func Handle(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("requires subcommand: install, uninstall, run, list, help")
+	}
+	cmd := args[0]
+	args = args[1:]
+	switch cmd {
+	case "help", "-h", "--help":
+		fmt.Print(strings.TrimPrefix(help, "\n"))
+		return nil
+	case "install":
+		return handleInstall(args)
+	case "uninstall":
+		return handleUninstall(args)
+	case "run":
+		return handleRun(args)
+	case "list", "ls":
+		return handleList(args)
+	default:
+		return fmt.Errorf("unknown command: %s, available commands: install, uninstall, run, list", cmd)
+	}
+}
+
+// LoadConfig returns the default config if .kool/hooks.yaml does not exist
+func LoadConfig(gitRoot string) (Config, error) {
+	file := filepath.Join(gitRoot, configFileName)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return defaultHookConfig, nil
+		}
+		return nil, err
+	}
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	for hook, commands := range config {
+		if err := checkHookName(hook); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i, command := range commands {
+			if command.Run == "" {
+				return nil, fmt.Errorf("%s: %s[%d]: missing run", file, hook, i)
+			}
+		}
+	}
+	return config, nil
+}
+
+func handleList(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	gitRoot, err := getGitRoot()
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(gitRoot)
+	if err != nil {
+		return err
+	}
+	hooksDir, err := getHooksDir()
+	if err != nil {
+		return err
+	}
+	for _, hook := range sortedHooks(config) {
+		state := "not installed"
+		if isInstalled(filepath.Join(hooksDir, hook)) {
+			state = "installed"
+		}
+		if _, err := os.Stat(filepath.Join(hooksDir, hook+chainedSuffix)); err == nil {
+			state += ", chained " + hook + chainedSuffix
+		}
+		fmt.Printf("%s (%s)\n", hook, state)
+		for _, command := range config[hook] {
+			line := fmt.Sprintf("  %s: %s", commandName(command), command.Run)
+			if len(command.Files) > 0 {
+				line += fmt.Sprintf(" [files: %s]", strings.Join(command.Files, ", "))
+			}
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+func handleRun(args []string) error {
+	var skips []string
+	// flags may follow the hook name, the installed hooks pass git's
+	// args after --
+	args, err := lessflags.StringSlice("--skip", &skips).
+		Help("-h,--help", help).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: kool git hooks run <hook> [-- args...]")
+	}
+	hook := args[0]
+	hookArgs := args[1:]
+	return Run(hook, hookArgs, os.Stdin, skips)
+}
+
+// Run runs the chained hook and then the configured commands of hook. All
+// commands run even if one fails, the failures are summarized.
+func Run(hook string, hookArgs []string, stdin io.Reader, skips []string) error {
+	if err := checkHookName(hook); err != nil {
+		return err
+	}
+	skip := make(map[string]bool)
+	for _, name := range append(skips, strings.Split(os.Getenv(skipEnv), ",")...) {
+		if name = strings.TrimSpace(name); name != "" {
+			skip[name] = true
+		}
+	}
+	if skip["all"] || skip[hook] {
+		fmt.Fprintf(os.Stderr, "[hooks] skip %s\n", hook)
+		return nil
+	}
+
+	gitRoot, err := getGitRoot()
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(gitRoot)
+	if err != nil {
+		return err
+	}
+	// stdin is read once and replayed to every command, pre-push needs it
+	var input []byte
+	if stdin != nil && hook == "pre-push" {
+		input, err = io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	hooksDir, err := getHooksDir()
+	if err != nil {
+		return err
+	}
+	chained := filepath.Join(hooksDir, hook+chainedSuffix)
+	if info, err := os.Stat(chained); err == nil && info.Mode()&0111 != 0 && !skip[hook+chainedSuffix] {
+		cmd := exec.Command(chained, hookArgs...)
+		cmd.Dir = gitRoot
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", chained, err)
+		}
+	}
+
+	commands := config[hook]
+	if len(commands) == 0 {
+		return nil
+	}
+	var files []string
+	var filesLoaded bool
+	var failed []string
+	for _, command := range commands {
+		name := commandName(command)
+		if skip[name] {
+			fmt.Fprintf(os.Stderr, "[hooks] %s: skip %s\n", hook, name)
+			continue
+		}
+		var matched []string
+		if len(command.Files) > 0 {
+			if !filesLoaded {
+				files, err = hookFiles(gitRoot, hook, input)
+				if err != nil {
+					return err
+				}
+				filesLoaded = true
+			}
+			matched = matchFiles(files, command.Files)
+			if len(matched) == 0 {
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "[hooks] %s: %s\n", hook, name)
+		cmd := exec.Command("sh", append([]string{"-c", command.Run, hook}, hookArgs...)...)
+		cmd.Dir = gitRoot
+		cmd.Env = append(os.Environ(), "KOOL_HOOK="+hook, "KOOL_HOOK_FILES="+strings.Join(matched, "\n"))
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s failed: %s, set %s=%s to bypass", hook, strings.Join(failed, ", "), skipEnv, strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// hookFiles lists the files the hook is about
+func hookFiles(gitRoot string, hook string, input []byte) ([]string, error) {
+	switch hook {
+	case "pre-push":
+		return pushedFiles(gitRoot, input)
+	case "pre-commit", "commit-msg", "prepare-commit-msg":
+		output, err := gitcmd.Output(gitRoot, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR")
+		if err != nil {
+			return nil, err
+		}
+		return splitNul(output), nil
+	}
+	return nil, nil
+}
+
+// pushedFiles reads the pre-push stdin lines:
+//
+//	<local ref> <local sha> <remote ref> <remote sha>
+func pushedFiles(gitRoot string, input []byte) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		localSha, remoteSha := fields[1], fields[3]
+		if isZeroSha(localSha) {
+			// deleting a remote branch
+			continue
+		}
+		var output string
+		var err error
+		if isZeroSha(remoteSha) {
+			// a new branch: the commits not on any remote yet
+			output, err = gitcmd.Output(gitRoot, "log", "--name-only", "-z", "--format=", localSha, "--not", "--remotes")
+		} else {
+			output, err = gitcmd.Output(gitRoot, "diff", "--name-only", "-z", remoteSha, localSha)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range splitNul(output) {
+			file = strings.TrimSpace(file)
+			if file != "" && !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return files, scanner.Err()
+}
+
+func matchFiles(files []string, patterns []string) []string {
+	var matched []string
+	for _, file := range files {
+		for _, pattern := range patterns {
+			if staged.MatchPath(pattern, file) {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func commandName(command HookCommand) string {
+	if command.Name != "" {
+		return command.Name
+	}
+	return command.Run
+}
+
+func sortedHooks(config Config) []string {
+	hooks := make([]string, 0, len(config))
+	for hook := range config {
+		hooks = append(hooks, hook)
+	}
+	sort.Strings(hooks)
+	return hooks
+}
+
+func isZeroSha(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+func splitNul(s string) []string {
+	var result []string
+	for _, part := range strings.Split(s, "\x00") {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func getGitRoot() (string, error) {
+	output, err := gitcmd.Output("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,218 @@
+package line
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/less-flags"
+)
+
+const blameHelp = `
+Usage: kool git line blame <file> <line1> [line2] [OPTIONS]
+
+Show, for each line, the commit that last changed it together with the
+whole commit message. Consecutive lines from the same commit are grouped.
+Renames are followed.
+
+Options:
+  --rev <rev>                  blame as of rev (default: the worktree)
+  --format <text|json>         output format (default: text)
+  -h,--help                    show help message
+
+Examples:
+  kool git line blame src/main.go 10-20
+  kool git line blame src/main.go 10 20 --rev v1.2.0
+`
+
+// BlameCommit is a commit that last changed some of the blamed lines
+type BlameCommit struct {
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	File    string `json:"file"` // path of the file in that commit
+	Message string `json:"message"`
+}
+
+type BlameLine struct {
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Commit  string `json:"commit"`
+}
+
+type Blame struct {
+	Commits map[string]*BlameCommit `json:"commits"`
+	Lines   []*BlameLine            `json:"lines"`
+}
+
+func handleBlame(args []string) error {
+	var rev string
+	var format string
+	args, err := lessflags.Help("-h,--help", blameHelp).
+		String("--rev", &rev).
+		String("--format", &format).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: kool git line blame <file> <line1> [line2]")
+	}
+	file := args[0]
+	line1, line2, args, err := parseLineRange(args[1:])
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	switch format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unsupported format: %s, expect text or json", format)
+	}
+
+	blame, err := BlameLines("", file, line1, line2, rev)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return printJSON(blame)
+	}
+	printBlame(blame)
+	return nil
+}
+
+// BlameLines blames lines line1-line2 of file, with full commit messages
+func BlameLines(dir string, file string, line1 int, line2 int, rev string) (*Blame, error) {
+	args := []string{"blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", line1, line2)}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--", file)
+	output, err := gitcmd.Output(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	blame, err := parseBlamePorcelain(output)
+	if err != nil {
+		return nil, err
+	}
+	for hash, commit := range blame.Commits {
+		if isUncommitted(hash) {
+			commit.Message = "Not Committed Yet"
+			continue
+		}
+		message, err := gitcmd.Output(dir, "show", "-s", "--format=%B", hash)
+		if err != nil {
+			return nil, err
+		}
+		commit.Message = strings.TrimSpace(message)
+	}
+	return blame, nil
+}
+
+// parseBlamePorcelain parses git blame --porcelain, where commit headers
+// only follow the first line blamed to that commit:
+//
+//	<sha> <orig line> <final line> [<lines in group>]
+//	author A
+//	author-mail <a@b>
+//	author-time 1700000000
+//	author-tz +0800
+//	...
+//	filename path/to/file
+//	\t<content>
+func parseBlamePorcelain(output string) (*Blame, error) {
+	blame := &Blame{Commits: make(map[string]*BlameCommit)}
+	var current *BlameCommit
+	var currentLine int
+	var authorTime int64
+	var authorTZ string
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		if content, ok := strings.CutPrefix(line, "\t"); ok {
+			if current == nil {
+				return nil, fmt.Errorf("unexpected blame content: %q", line)
+			}
+			blame.Lines = append(blame.Lines, &BlameLine{Line: currentLine, Content: content, Commit: current.Commit})
+			current = nil
+			continue
+		}
+		if current == nil {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("unexpected blame header: %q", line)
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("unexpected blame header: %q", line)
+			}
+			currentLine = n
+			current = blame.Commits[fields[0]]
+			if current == nil {
+				current = &BlameCommit{Commit: fields[0]}
+				blame.Commits[fields[0]] = current
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.Author = value
+		case "author-mail":
+			current.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			authorTime, _ = strconv.ParseInt(value, 10, 64)
+		case "author-tz":
+			authorTZ = value
+			current.Date = formatAuthorTime(authorTime, authorTZ)
+		case "filename":
+			current.File = value
+		}
+	}
+	return blame, nil
+}
+
+// formatAuthorTime formats unix time in the author's zone like +0800
+func formatAuthorTime(unix int64, tz string) string {
+	t := time.Unix(unix, 0).UTC()
+	if zone, err := time.Parse("-0700", tz); err == nil {
+		_, offset := zone.Zone()
+		t = t.In(time.FixedZone(tz, offset))
+	}
+	return t.Format(time.RFC3339)
+}
+
+func isUncommitted(hash string) bool {
+	return strings.Trim(hash, "0") == ""
+}
+
+func printBlame(blame *Blame) {
+	var last string
+	for _, line := range blame.Lines {
+		if line.Commit != last {
+			if last != "" {
+				fmt.Println()
+			}
+			last = line.Commit
+			commit := blame.Commits[line.Commit]
+			date, _, _ := strings.Cut(commit.Date, "T")
+			fmt.Printf("%s %s <%s> %s %s\n", shortHash(commit.Commit), commit.Author, commit.Email, date, commit.File)
+			for _, msgLine := range strings.Split(commit.Message, "\n") {
+				if msgLine == "" {
+					fmt.Println()
+					continue
+				}
+				fmt.Printf("    %s\n", msgLine)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%6d | %s\n", line.Line, line.Content)
+	}
+}
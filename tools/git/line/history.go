@@ -0,0 +1,150 @@
+package line
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+)
+
+// Change is one commit touching the line range, as reported by git log -L
+type Change struct {
+	Commit  string   `json:"commit"`
+	Author  string   `json:"author"`
+	Email   string   `json:"email"`
+	Date    string   `json:"date"`
+	Subject string   `json:"subject"`
+	File    string   `json:"file"`
+	OldFile string   `json:"old_file,omitempty"` // set when the range moved from another file
+	Line    int      `json:"line"`               // first line of the range after the commit
+	Before  []string `json:"before"`
+	After   []string `json:"after"`
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+}
+
+// History lists the commits changing lines line1-line2 of file, newest
+// first. Renames are followed by git log -L itself.
+func History(dir string, file string, line1 int, line2 int, since string) ([]*Change, error) {
+	// %x1e starts a commit, %x1f separates fields
+	args := []string{"log", "-L", fmt.Sprintf("%d,%d:%s", line1, line2, file), "--format=%x1e%H%x1f%an%x1f%ae%x1f%aI%x1f%s"}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	output, err := gitcmd.Output(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseLogL(output)
+}
+
+func parseLogL(output string) ([]*Change, error) {
+	var changes []*Change
+	for _, record := range strings.Split(output, "\x1e") {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		header, patch, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected git log header: %q", header)
+		}
+		change := &Change{
+			Commit:  fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+			Before:  []string{},
+			After:   []string{},
+		}
+		if err := parseRangePatch(change, patch); err != nil {
+			return nil, fmt.Errorf("commit %s: %w", change.Commit, err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// parseRangePatch reads the single-hunk patch that git log -L prints:
+//
+//	diff --git a/old b/new
+//	--- a/old
+//	+++ b/new
+//	@@ -2,1 +2,1 @@
+//	-b
+//	+B
+func parseRangePatch(change *Change, patch string) error {
+	var oldFile string
+	inHunk := false
+	for _, line := range strings.Split(patch, "\n") {
+		if !inHunk {
+			switch {
+			case strings.HasPrefix(line, "--- "):
+				oldFile = strings.TrimPrefix(strings.TrimPrefix(line, "--- "), "a/")
+			case strings.HasPrefix(line, "+++ "):
+				change.File = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			case strings.HasPrefix(line, "@@ "):
+				inHunk = true
+				start, err := parseHunkNewStart(line)
+				if err != nil {
+					return err
+				}
+				change.Line = start
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case ' ':
+			change.Before = append(change.Before, line[1:])
+			change.After = append(change.After, line[1:])
+		case '-':
+			change.Before = append(change.Before, line[1:])
+			change.Removed++
+		case '+':
+			change.After = append(change.After, line[1:])
+			change.Added++
+		}
+	}
+	if oldFile != "/dev/null" && oldFile != "" && oldFile != change.File {
+		change.OldFile = oldFile
+	}
+	return nil
+}
+
+// parseHunkNewStart extracts 5 from "@@ -2,1 +5,3 @@"
+func parseHunkNewStart(line string) (int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+	return strconv.Atoi(start)
+}
+
+func printHistoryTable(changes []*Change) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMIT\tDATE\tAUTHOR\tFILE\tCHANGE\tSUBJECT")
+	for _, c := range changes {
+		file := c.File
+		if c.OldFile != "" {
+			file = c.OldFile + " -> " + c.File
+		}
+		date, _, _ := strings.Cut(c.Date, "T")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t+%d/-%d\t%s\n", shortHash(c.Commit), date, c.Author, file, c.Added, c.Removed, c.Subject)
+	}
+	w.Flush()
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
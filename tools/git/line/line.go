@@ -1,6 +1,7 @@
 package line
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,19 +12,24 @@ import (
 )
 
 const help = `
-Usage: kool git line history <file> <line1> [line2]
+Usage: kool git line <cmd> <file> <range>
 
-Show the history of specific lines in a file.
+Available commands:
+  history <file> <range>           show the commits that changed the lines
+  blame <file> <range>             show the commit that last changed each line
+
+<range> is <line>, <line1>-<line2> or <line1> <line2>.
 
 Examples:
   kool git line history src/main.go 10          # show history of line 10
   kool git line history src/main.go 10 20       # show history of lines 10-20
-  kool git line history src/main.go 10-20       # show history of lines 10-20
+  kool git line history src/main.go 10-20 --format table
+  kool git line blame src/main.go 10-20
 `
 
 func Handle(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("requires subcommand: history")
+		return fmt.Errorf("requires subcommand: history, blame")
 	}
 
 	subcmd := args[0]
@@ -35,27 +41,39 @@ func Handle(args []string) error {
 		return nil
 	case "history":
 		return handleHistory(subArgs)
+	case "blame":
+		return handleBlame(subArgs)
 	default:
 		return fmt.Errorf("unknown subcommand: %s", subcmd)
 	}
 }
 
 const historyHelp = `
-Usage: kool git line history <file> <line1> [line2]
+Usage: kool git line history <file> <line1> [line2] [OPTIONS]
 
-Show the history of specific lines in a file.
+Show the history of specific lines in a file, following renames.
+
+Options:
+  --format <text|json|table>   output format, text shows the raw git log -L
+                               patches (default: text)
+  --since <date>               only show commits more recent than date
+  -h,--help                    show help message
 
 Examples:
   kool git line history src/main.go 10          # show history of line 10
   kool git line history src/main.go 10 20       # show history of lines 10-20
   kool git line history src/main.go 10-20       # show history of lines 10-20
+  kool git line history src/main.go 10-20 --format json --since 2024-01-01
 `
 
 func handleHistory(args []string) error {
 	var verbose bool
-	// "github.com/xhd2015/less-flags"
+	var format string
+	var since string
 	args, err := lessflags.Help("-h,--help", historyHelp).
 		Bool("-v,--verbose", &verbose).
+		String("--format", &format).
+		String("--since", &since).
 		Parse(args)
 	if err != nil {
 		return err
@@ -63,58 +81,92 @@ func handleHistory(args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("usage: kool git line history <file> <line1> [line2]")
 	}
-
 	file := args[0]
-	lineSpec := args[1]
+	line1, line2, args, err := parseLineRange(args[1:])
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
 
-	args = args[2:]
+	switch format {
+	case "", "text":
+		gitArgs := []string{"log", "-L", fmt.Sprintf("%d,%d:%s", line1, line2, file), "-p"}
+		if since != "" {
+			gitArgs = append(gitArgs, "--since="+since)
+		}
+		cmd := exec.Command("git", gitArgs...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	case "json", "table":
+	default:
+		return fmt.Errorf("unsupported format: %s, expect text, json or table", format)
+	}
 
-	var line1, line2 int
+	changes, err := History("", file, line1, line2, since)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return printJSON(changes)
+	}
+	printHistoryTable(changes)
+	return nil
+}
+
+// parseLineRange parses "<line>", "<line1>-<line2>" or "<line1> <line2>"
+// from the head of args and returns the remaining args.
+func parseLineRange(args []string) (line1 int, line2 int, remain []string, err error) {
+	if len(args) == 0 {
+		return 0, 0, nil, fmt.Errorf("requires line range")
+	}
+	lineSpec := args[0]
+	args = args[1:]
 
 	// Check if lineSpec contains hyphen (e.g., "10-20")
 	if strings.Contains(lineSpec, "-") {
 		parts := strings.Split(lineSpec, "-")
 		if len(parts) != 2 {
-			return fmt.Errorf("invalid line range: %s", lineSpec)
+			return 0, 0, nil, fmt.Errorf("invalid line range: %s", lineSpec)
 		}
 		line1, err = strconv.Atoi(parts[0])
 		if err != nil {
-			return fmt.Errorf("invalid line number: %s", parts[0])
+			return 0, 0, nil, fmt.Errorf("invalid line number: %s", parts[0])
 		}
 		line2, err = strconv.Atoi(parts[1])
 		if err != nil {
-			return fmt.Errorf("invalid line number: %s", parts[1])
+			return 0, 0, nil, fmt.Errorf("invalid line number: %s", parts[1])
 		}
 	} else {
 		// Single line number
 		line1, err = strconv.Atoi(lineSpec)
 		if err != nil {
-			return fmt.Errorf("invalid line number: %s", lineSpec)
+			return 0, 0, nil, fmt.Errorf("invalid line number: %s", lineSpec)
 		}
+		line2 = line1
 		// Check if there's a second argument for line2
 		if len(args) > 0 {
-			line2, err = strconv.Atoi(args[0])
-			args = args[1:]
-			if err != nil {
-				return fmt.Errorf("invalid line number: %s", args[0])
+			n, err := strconv.Atoi(args[0])
+			if err == nil {
+				line2 = n
+				args = args[1:]
 			}
-		} else {
-			line2 = line1
 		}
 	}
-
-
-	if len(args) > 0 {
-		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	if line1 <= 0 || line2 < line1 {
+		return 0, 0, nil, fmt.Errorf("invalid line range: %d-%d", line1, line2)
 	}
+	return line1, line2, args, nil
+}
 
-	lineRange := fmt.Sprintf("%d,%d", line1, line2)
-
-	// Build git log -L command
-	cmd := exec.Command("git", "log", "-L", lineRange+":"+file, "-p")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	return cmd.Run()
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
 }
@@ -0,0 +1,69 @@
+package line
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogL(t *testing.T) {
+	output := "\x1eaaa\x1fA\x1fa@b\x1f2024-05-01T10:00:00+08:00\x1fchange b\n\n" +
+		"diff --git a/g.txt b/g.txt\n--- a/g.txt\n+++ b/g.txt\n@@ -2,2 +2,2 @@\n-b\n+B\n c\n" +
+		"\x1ebbb\x1fA\x1fa@b\x1f2024-04-01T10:00:00+08:00\x1finit\n\n" +
+		"diff --git a/f.txt b/f.txt\n--- /dev/null\n+++ b/f.txt\n@@ -0,0 +2,2 @@\n+b\n+c\n"
+	changes, err := parseLogL(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expect 2 changes, got %d", len(changes))
+	}
+	first := changes[0]
+	if first.File != "g.txt" || first.OldFile != "" || first.Line != 2 || first.Added != 1 || first.Removed != 1 {
+		t.Errorf("unexpected first change: %+v", first)
+	}
+	if !reflect.DeepEqual(first.Before, []string{"b", "c"}) || !reflect.DeepEqual(first.After, []string{"B", "c"}) {
+		t.Errorf("unexpected first content: %q -> %q", first.Before, first.After)
+	}
+	second := changes[1]
+	if second.File != "f.txt" || second.OldFile != "" || len(second.Before) != 0 || second.Subject != "init" {
+		t.Errorf("unexpected second change: %+v", second)
+	}
+}
+
+func TestParseBlamePorcelain(t *testing.T) {
+	output := "aaa 2 2 2\nauthor A\nauthor-mail <a@b>\nauthor-time 1700000000\nauthor-tz +0800\nsummary x\nfilename old.txt\n\tline two\n" +
+		"aaa 3 3\n\tline three\n"
+	blame, err := parseBlamePorcelain(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := blame.Commits["aaa"]
+	if commit == nil || commit.Author != "A" || commit.Email != "a@b" || commit.File != "old.txt" || commit.Date != "2023-11-15T06:13:20+08:00" {
+		t.Errorf("unexpected commit: %+v", commit)
+	}
+	if len(blame.Lines) != 2 || blame.Lines[1].Line != 3 || blame.Lines[1].Content != "line three" || blame.Lines[1].Commit != "aaa" {
+		t.Errorf("unexpected lines: %+v", blame.Lines)
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		args   []string
+		line1  int
+		line2  int
+		remain int
+	}{
+		{[]string{"10"}, 10, 10, 0},
+		{[]string{"10-20"}, 10, 20, 0},
+		{[]string{"10", "20", "x"}, 10, 20, 1},
+	}
+	for _, tt := range tests {
+		line1, line2, remain, err := parseLineRange(tt.args)
+		if err != nil || line1 != tt.line1 || line2 != tt.line2 || len(remain) != tt.remain {
+			t.Errorf("parseLineRange(%v) = %d, %d, %v, %v", tt.args, line1, line2, remain, err)
+		}
+	}
+	if _, _, _, err := parseLineRange([]string{"20-10"}); err == nil {
+		t.Errorf("expect error for reversed range")
+	}
+}
@@ -0,0 +1,81 @@
+package repos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xhd2015/kool/tools/config"
+)
+
+const cacheFileName = "git_repos.json"
+
+// Cache maps the absolute roots to the repositories discovered under them
+type Cache struct {
+	Roots map[string]*CacheEntry `json:"roots"`
+}
+
+type CacheEntry struct {
+	Depth     int       `json:"depth"`
+	ScannedAt time.Time `json:"scanned_at"`
+	Repos     []string  `json:"repos"`
+}
+
+func newCacheEntry(depth int, repos []string) *CacheEntry {
+	return &CacheEntry{
+		Depth:     depth,
+		ScannedAt: time.Now(),
+		Repos:     repos,
+	}
+}
+
+func getCachePath() (string, error) {
+	koolConfigDir, err := config.GetKoolConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get kool config directory: %w", err)
+	}
+	return filepath.Join(koolConfigDir, cacheFileName), nil
+}
+
+func readCache() (*Cache, error) {
+	cache := &Cache{Roots: make(map[string]*CacheEntry)}
+	cachePath, err := getCachePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		// a broken cache is rebuilt
+		return &Cache{Roots: make(map[string]*CacheEntry)}, nil
+	}
+	if cache.Roots == nil {
+		cache.Roots = make(map[string]*CacheEntry)
+	}
+	return cache, nil
+}
+
+func writeCache(cache *Cache) error {
+	cachePath, err := getCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %w", err)
+	}
+	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repos
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func handleExec(args []string) error {
+	var opts options
+	var failFast bool
+	args, err := commonFlags(&opts).
+		Bool("--fail-fast", &failFast).
+		StopOnFirstArg().
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires command, usage: kool git repos exec -- <cmd> [args...]")
+	}
+	repos, err := loadRepos(&opts)
+	if err != nil {
+		return err
+	}
+
+	// one after another, so the output is not interleaved
+	var failed []string
+	for _, repo := range repos {
+		fmt.Printf("==> %s\n", displayPath(repo))
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = repo
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "==> %s: %v\n", displayPath(repo), err)
+			failed = append(failed, displayPath(repo))
+			if failFast {
+				break
+			}
+		}
+		fmt.Println()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed in %d repositories:\n  %s", len(failed), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
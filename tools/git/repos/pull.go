@@ -0,0 +1,143 @@
+package repos
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+)
+
+// PullResult is the outcome of pulling one repository
+type PullResult struct {
+	Path   string
+	State  string // updated, up-to-date, skipped or failed
+	From   string
+	To     string
+	Reason string // why skipped or failed
+}
+
+const (
+	pullUpdated  = "updated"
+	pullUpToDate = "up-to-date"
+	pullSkipped  = "skipped"
+	pullFailed   = "failed"
+)
+
+func handlePull(args []string) error {
+	var opts options
+	args, err := commonFlags(&opts).Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	repos, err := loadRepos(&opts)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*PullResult, len(repos))
+	var mutex sync.Mutex
+	done := 0
+	forEach(repos, opts.parallel, func(i int, repo string) {
+		result := Pull(repo)
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[i] = result
+		done++
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", done, len(repos), displayPath(repo), result.State)
+	})
+
+	counts := make(map[string]int)
+	var failed []string
+	fmt.Println()
+	for _, r := range results {
+		counts[r.State]++
+		switch r.State {
+		case pullUpdated:
+			fmt.Printf("updated   %s %s..%s\n", displayPath(r.Path), shortHash(r.From), shortHash(r.To))
+		case pullSkipped:
+			fmt.Printf("skipped   %s: %s\n", displayPath(r.Path), r.Reason)
+		case pullFailed:
+			fmt.Printf("failed    %s: %s\n", displayPath(r.Path), r.Reason)
+			failed = append(failed, displayPath(r.Path))
+		}
+	}
+	fmt.Printf("%d updated, %d up to date, %d skipped, %d failed\n", counts[pullUpdated], counts[pullUpToDate], counts[pullSkipped], counts[pullFailed])
+	if len(failed) > 0 {
+		return fmt.Errorf("pull failed in %d repositories", len(failed))
+	}
+	return nil
+}
+
+// Pull fast-forwards the current branch of repo to its upstream. Detached
+// heads and branches without upstream are skipped.
+func Pull(repo string) *PullResult {
+	result := &PullResult{Path: repo}
+	status := GetStatus(repo)
+	if status.Error != "" {
+		result.State = pullFailed
+		result.Reason = status.Error
+		return result
+	}
+	if status.Branch == "" {
+		result.State = pullSkipped
+		result.Reason = "detached HEAD"
+		return result
+	}
+	if status.Upstream == "" {
+		result.State = pullSkipped
+		result.Reason = "no upstream for " + status.Branch
+		return result
+	}
+	from, err := gitcmd.Output(repo, "rev-parse", "HEAD")
+	if err != nil {
+		result.State = pullFailed
+		result.Reason = firstLine(err.Error())
+		return result
+	}
+	if _, err := gitcmd.Output(repo, "pull", "--ff-only", "--quiet"); err != nil {
+		result.State = pullFailed
+		result.Reason = pullFailure(err)
+		return result
+	}
+	to, err := gitcmd.Output(repo, "rev-parse", "HEAD")
+	if err != nil {
+		result.State = pullFailed
+		result.Reason = firstLine(err.Error())
+		return result
+	}
+	result.From = strings.TrimSpace(from)
+	result.To = strings.TrimSpace(to)
+	if result.From == result.To {
+		result.State = pullUpToDate
+	} else {
+		result.State = pullUpdated
+	}
+	return result
+}
+
+// pullFailure picks the fatal line of git pull, e.g. "Not possible to
+// fast-forward, aborting."
+func pullFailure(err error) string {
+	msg := err.Error()
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, "fatal: ") {
+			return strings.TrimPrefix(line, "fatal: ")
+		}
+	}
+	if i := strings.LastIndex(msg, ": "); i >= 0 && i+2 < len(msg) {
+		return strings.TrimSpace(msg[i+2:])
+	}
+	return msg
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
@@ -0,0 +1,237 @@
+package repos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/less-flags"
+)
+
+const help = `
+kool git repos runs git commands across all repositories under a directory
+
+Usage: kool git repos <cmd> [OPTIONS]
+
+Available commands:
+  ls                               list the discovered repositories
+  status                           show branch, dirty files, unpushed commits and stashes
+  pull                             git pull --ff-only every repository
+  exec -- <cmd> [args...]          run a command in every repository
+  help                             show help message
+
+Repositories are discovered under the roots and cached in ~/.kool/git_repos.json,
+later runs read the cache instead of walking the filesystem again, use
+--rescan after cloning or removing repositories.
+
+Options:
+  --root <dir>                     root directory to discover repositories, repeatable (default: current directory)
+  --depth <n>                      max directory depth to look for repositories (default: 5)
+  --rescan                         ignore the cache and walk the filesystem again
+  --parallel <n>                   repositories processed at the same time by status and pull (default: 8)
+
+Options for status:
+  --json                           print as json
+  --dirty                          only show repositories that are dirty, unpushed, behind or have stashes
+
+Options for exec:
+  --fail-fast                      stop at the first failure
+
+Examples:
+  kool git repos status --root ~/code
+  kool git repos pull --parallel 8
+  kool git repos exec -- git fetch --prune
+`
+
+const defaultDepth = 5
+const defaultParallel = 8
+
+type options struct {
+	roots    []string
+	depth    int
+	rescan   bool
+	parallel int
+}
+
+func Handle(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("requires subcommand: ls, status, pull, exec, help")
+	}
+	cmd := args[0]
+	args = args[1:]
+	switch cmd {
+	case "help", "-h", "--help":
+		fmt.Print(strings.TrimPrefix(help, "\n"))
+		return nil
+	case "ls", "list":
+		return handleList(args)
+	case "status":
+		return handleStatus(args)
+	case "pull":
+		return handlePull(args)
+	case "exec":
+		return handleExec(args)
+	default:
+		return fmt.Errorf("unknown command: %s, available commands: ls, status, pull, exec", cmd)
+	}
+}
+
+// commonFlags binds the options shared by all subcommands
+func commonFlags(opts *options) *lessflags.Builder {
+	opts.depth = defaultDepth
+	opts.parallel = defaultParallel
+	return lessflags.StringSlice("--root", &opts.roots).
+		Int("--depth", &opts.depth).
+		Bool("--rescan", &opts.rescan).
+		Int("--parallel", &opts.parallel).
+		Help("-h,--help", help)
+}
+
+func handleList(args []string) error {
+	var opts options
+	args, err := commonFlags(&opts).Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	repos, err := loadRepos(&opts)
+	if err != nil {
+		return err
+	}
+	for _, repo := range repos {
+		fmt.Println(displayPath(repo))
+	}
+	return nil
+}
+
+// loadRepos returns the repositories under the roots, from the cache
+// unless --rescan is set or a root has not been scanned yet.
+func loadRepos(opts *options) ([]string, error) {
+	roots := opts.roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	cache, err := readCache()
+	if err != nil {
+		return nil, err
+	}
+	var repos []string
+	seen := make(map[string]bool)
+	var cacheChanged bool
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		entry := cache.Roots[absRoot]
+		if opts.rescan || entry == nil || entry.Depth != opts.depth {
+			found, err := Discover(absRoot, opts.depth)
+			if err != nil {
+				return nil, err
+			}
+			entry = newCacheEntry(opts.depth, found)
+			cache.Roots[absRoot] = entry
+			cacheChanged = true
+		}
+		for _, repo := range entry.Repos {
+			if seen[repo] {
+				continue
+			}
+			// removed since the scan
+			if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+				continue
+			}
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	if cacheChanged {
+		if err := writeCache(cache); err != nil {
+			return nil, err
+		}
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("no git repositories found under %s, try --rescan or --depth", strings.Join(roots, ", "))
+	}
+	return repos, nil
+}
+
+// Discover walks root for directories containing .git, without
+// descending into the repositories found, except root itself.
+func Discover(root string, depth int) ([]string, error) {
+	root = filepath.Clean(root)
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	repos := []string{}
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			// unreadable directories are skipped
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+				return filepath.SkipDir
+			}
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			repos = append(repos, path)
+			if path != root {
+				return filepath.SkipDir
+			}
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel != "." && strings.Count(rel, string(filepath.Separator))+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// forEach calls fn for every repository with at most parallel running at
+// the same time.
+func forEach(repos []string, parallel int, fn func(i int, repo string)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, repo string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i, repo)
+		}(i, repo)
+	}
+	wg.Wait()
+}
+
+// displayPath shortens path relative to the current directory or home
+func displayPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, home+string(filepath.Separator)) {
+		return "~" + path[len(home):]
+	}
+	return path
+}
@@ -0,0 +1,100 @@
+package repos
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscoverAndStatus(t *testing.T) {
+	root := t.TempDir()
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(file string, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	initRepo := func(dir string) {
+		t.Helper()
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		git(dir, "init", "-q", "-b", "main")
+		git(dir, "config", "user.email", "test@example.com")
+		git(dir, "config", "user.name", "Test User")
+		write(filepath.Join(dir, "a.txt"), "a\n")
+		git(dir, "add", ".")
+		git(dir, "commit", "-q", "-m", "init")
+	}
+
+	upstream := filepath.Join(root, "upstream")
+	initRepo(upstream)
+	clone := filepath.Join(root, "group", "clone")
+	git(root, "clone", "-q", upstream, clone)
+	git(clone, "config", "user.email", "test@example.com")
+	git(clone, "config", "user.name", "Test User")
+	// not discovered: hidden, node_modules, and too deep
+	initRepo(filepath.Join(root, ".hidden", "repo"))
+	initRepo(filepath.Join(root, "node_modules", "repo"))
+	initRepo(filepath.Join(root, "a", "b", "c", "repo"))
+
+	repos, err := Discover(root, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || repos[0] != clone || repos[1] != upstream {
+		t.Fatalf("unexpected repos: %v", repos)
+	}
+
+	// clone: one unpushed commit, one dirty file and one stash
+	write(filepath.Join(clone, "b.txt"), "b\n")
+	git(clone, "add", ".")
+	git(clone, "commit", "-q", "-m", "add b")
+	write(filepath.Join(clone, "a.txt"), "stashed\n")
+	git(clone, "stash", "-q")
+	write(filepath.Join(clone, "c.txt"), "c\n")
+	// upstream moves ahead
+	write(filepath.Join(upstream, "d.txt"), "d\n")
+	git(upstream, "add", ".")
+	git(upstream, "commit", "-q", "-m", "add d")
+	git(clone, "fetch", "-q")
+
+	status := GetStatus(clone)
+	if status.Error != "" {
+		t.Fatal(status.Error)
+	}
+	if status.Branch != "main" || status.Upstream != "origin/main" || status.Dirty != 1 || status.Unpushed != 1 || status.Behind != 1 || status.Stashes != 1 {
+		t.Errorf("unexpected clone status: %+v", status)
+	}
+
+	// no upstream: unpushed counts the commits not on any remote
+	status = GetStatus(upstream)
+	if status.Error != "" {
+		t.Fatal(status.Error)
+	}
+	if status.Upstream != "" || status.Unpushed != 2 || !status.NeedsAttention() {
+		t.Errorf("unexpected upstream status: %+v", status)
+	}
+
+	result := Pull(clone)
+	if result.State != pullFailed {
+		t.Errorf("expect diverged pull to fail, got %+v", result)
+	}
+	git(clone, "reset", "-q", "--hard", "origin/main~1")
+	result = Pull(clone)
+	if result.State != pullUpdated {
+		t.Errorf("expect pull to update, got %+v", result)
+	}
+}
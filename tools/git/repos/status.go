@@ -0,0 +1,174 @@
+package repos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+)
+
+// RepoStatus is the state of one repository
+type RepoStatus struct {
+	Path     string `json:"path"`
+	Branch   string `json:"branch,omitempty"` // empty when detached
+	Upstream string `json:"upstream,omitempty"`
+	// Dirty counts the changed, unmerged and untracked files
+	Dirty int `json:"dirty"`
+	// Unpushed is ahead of the upstream, or the commits not on any remote
+	// when there is no upstream
+	Unpushed int    `json:"unpushed"`
+	Behind   int    `json:"behind"`
+	Stashes  int    `json:"stashes"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NeedsAttention tells whether the repository has anything not in sync
+func (s *RepoStatus) NeedsAttention() bool {
+	return s.Error != "" || s.Dirty > 0 || s.Unpushed > 0 || s.Behind > 0 || s.Stashes > 0
+}
+
+func handleStatus(args []string) error {
+	var opts options
+	var jsonOutput bool
+	var dirtyOnly bool
+	args, err := commonFlags(&opts).
+		Bool("--json", &jsonOutput).
+		Bool("--dirty", &dirtyOnly).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	repos, err := loadRepos(&opts)
+	if err != nil {
+		return err
+	}
+	statuses := make([]*RepoStatus, len(repos))
+	forEach(repos, opts.parallel, func(i int, repo string) {
+		statuses[i] = GetStatus(repo)
+	})
+	if dirtyOnly {
+		filtered := []*RepoStatus{}
+		for _, s := range statuses {
+			if s.NeedsAttention() {
+				filtered = append(filtered, s)
+			}
+		}
+		statuses = filtered
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tBRANCH\tDIRTY\tUNPUSHED\tBEHIND\tSTASHES")
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Fprintf(tw, "%s\terror: %s\t\t\t\t\n", displayPath(s.Path), s.Error)
+			continue
+		}
+		branch := s.Branch
+		if branch == "" {
+			branch = "(detached)"
+		}
+		behind := "-"
+		if s.Upstream != "" {
+			behind = countCell(s.Behind)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", displayPath(s.Path), branch, countCell(s.Dirty), countCell(s.Unpushed), behind, countCell(s.Stashes))
+	}
+	return tw.Flush()
+}
+
+// GetStatus reads the status of repo, failures are reported in Error
+func GetStatus(repo string) *RepoStatus {
+	status := &RepoStatus{Path: repo}
+	output, err := gitcmd.Output(repo, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		status.Error = firstLine(err.Error())
+		return status
+	}
+	initial := parsePorcelainStatus(status, output)
+
+	if status.Upstream == "" && !initial {
+		count, err := gitcmd.Output(repo, "rev-list", "--count", "HEAD", "--not", "--remotes")
+		if err != nil {
+			status.Error = firstLine(err.Error())
+			return status
+		}
+		status.Unpushed, _ = strconv.Atoi(strings.TrimSpace(count))
+	}
+
+	stashes, err := gitcmd.Output(repo, "stash", "list", "--format=%H")
+	if err != nil {
+		status.Error = firstLine(err.Error())
+		return status
+	}
+	status.Stashes = len(strings.Fields(stashes))
+	return status
+}
+
+// parsePorcelainStatus fills status from git status --porcelain=v2 --branch:
+//
+//	# branch.oid <commit> | (initial)
+//	# branch.head <branch> | (detached)
+//	# branch.upstream <upstream>
+//	# branch.ab +<ahead> -<behind>
+//	<one line per changed, unmerged or untracked file>
+//
+// It reports whether the branch has no commit yet.
+func parsePorcelainStatus(status *RepoStatus, output string) (initial bool) {
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "# ") {
+			status.Dirty++
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, "# "), " ")
+		switch key {
+		case "branch.oid":
+			initial = value == "(initial)"
+		case "branch.head":
+			if value != "(detached)" {
+				status.Branch = value
+			}
+		case "branch.upstream":
+			status.Upstream = value
+		case "branch.ab":
+			for _, field := range strings.Fields(value) {
+				n, _ := strconv.Atoi(field[1:])
+				if field[0] == '+' {
+					status.Unpushed = n
+				} else {
+					status.Behind = n
+				}
+			}
+		}
+	}
+	return initial
+}
+
+func countCell(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
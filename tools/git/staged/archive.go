@@ -0,0 +1,203 @@
+package staged
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// archive layout, a plain tar file:
+//
+//	manifest.json   archiveManifest
+//	files/<path>    staged content of each non-deleted entry, byte for byte;
+//	                for symlinks this is the link target
+const (
+	archiveManifestName = "manifest.json"
+	archiveFilesDir     = "files/"
+	archiveVersion      = 1
+)
+
+// git index modes
+const (
+	modeRegular    = "100644"
+	modeExecutable = "100755"
+	modeSymlink    = "120000"
+	modeGitlink    = "160000"
+)
+
+type archiveManifest struct {
+	Version   int            `json:"version"`
+	Message   string         `json:"message,omitempty"`
+	CreatedAt string         `json:"created_at"`
+	Head      string         `json:"head,omitempty"`
+	Files     []archiveEntry `json:"files"`
+}
+
+type archiveEntry struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	Status  string `json:"status"` // added, modified, deleted or renamed
+	Mode    string `json:"mode,omitempty"`
+	Blob    string `json:"blob,omitempty"`
+}
+
+func (f StagedFile) status() string {
+	switch {
+	case f.IsDeleted:
+		return "deleted"
+	case f.IsRenamed:
+		return "renamed"
+	case f.IsAdded:
+		return "added"
+	default:
+		return "modified"
+	}
+}
+
+func writeArchive(w io.Writer, files []StagedFile, message string, head string) error {
+	manifest := archiveManifest{
+		Version:   archiveVersion,
+		Message:   message,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Head:      head,
+	}
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, archiveEntry{
+			Path:    f.Path,
+			OldPath: f.OldPath,
+			Status:  f.status(),
+			Mode:    f.Mode,
+			Blob:    f.Blob,
+		})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	modTime := time.Now()
+	writeEntry := func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+	if err := writeEntry(archiveManifestName, manifestData); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDeleted || f.Mode == modeGitlink {
+			continue
+		}
+		if err := writeEntry(archiveFilesDir+f.Path, []byte(f.Content)); err != nil {
+			return fmt.Errorf("failed to write content for %s: %w", f.Path, err)
+		}
+	}
+	return tw.Close()
+}
+
+func readArchive(r io.Reader) (*archiveManifest, []StagedFile, error) {
+	tr := tar.NewReader(r)
+	var manifest *archiveManifest
+	contents := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Name == archiveManifestName {
+			manifest = &archiveManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+		if path, ok := strings.CutPrefix(hdr.Name, archiveFilesDir); ok {
+			contents[path] = data
+		}
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("missing %s", archiveManifestName)
+	}
+	if manifest.Version > archiveVersion {
+		return nil, nil, fmt.Errorf("unsupported archive version %d, please upgrade kool", manifest.Version)
+	}
+
+	files := make([]StagedFile, 0, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		f := StagedFile{
+			Path:      entry.Path,
+			OldPath:   entry.OldPath,
+			Mode:      entry.Mode,
+			Blob:      entry.Blob,
+			IsDeleted: entry.Status == "deleted",
+			IsRenamed: entry.Status == "renamed",
+			IsAdded:   entry.Status == "added",
+		}
+		if !f.IsDeleted && f.Mode != modeGitlink {
+			data, ok := contents[entry.Path]
+			if !ok {
+				return nil, nil, fmt.Errorf("missing content of %s", entry.Path)
+			}
+			f.Content = string(data)
+		}
+		files = append(files, f)
+	}
+	return manifest, files, nil
+}
+
+// isArchiveFile tells the tar format from the legacy "===== path =====" text
+// format by the ustar magic at offset 257.
+func isArchiveFile(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, 262)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return n == len(buf) && bytes.Equal(buf[257:262], []byte("ustar")), nil
+}
+
+// readBackupFile reads either format
+func readBackupFile(file string) (*archiveManifest, []StagedFile, error) {
+	isArchive, err := isArchiveFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isArchive {
+		files, err := parseBackupFile(file)
+		return nil, files, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return readArchive(f)
+}
@@ -0,0 +1,380 @@
+package staged
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/less-flags"
+)
+
+const pushHelp = `
+Save the staged changes onto the stack, then drop them from the index
+and the worktree, like git stash for staged changes only.
+
+Usage: kool git staged push [OPTIONS]
+
+Options:
+  -m,--message <msg>   describe the entry
+  --keep               keep the staged changes after saving
+  --dir <dir>          run in the given directory
+  -h,--help            show help message
+`
+
+// HandlePush refuses to run when a staged file also has unstaged changes,
+// since dropping it would lose them.
+func HandlePush(args []string) error {
+	var dir string
+	var message string
+	var keep bool
+	args, err := lessflags.String("--dir", &dir).
+		String("-m,--message", &message).
+		Bool("--keep", &keep).
+		Help("-h,--help", pushHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+
+	stagedFiles, err := collectStagedFiles(dir)
+	if err != nil {
+		return err
+	}
+	gitRoot, err := getGitRoot(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get git root: %w", err)
+	}
+	if !keep {
+		dirty, err := pathsWithUnstagedChanges(gitRoot, stagedPaths(stagedFiles))
+		if err != nil {
+			return err
+		}
+		if len(dirty) > 0 {
+			return fmt.Errorf("staged files also have unstaged changes, which push would discard:\n  %s\nstage them, or use --keep", strings.Join(dirty, "\n  "))
+		}
+	}
+
+	stackDir, err := getStackDir(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stackDir, 0755); err != nil {
+		return err
+	}
+	entryFile := filepath.Join(stackDir, fmt.Sprintf("%020d.tar", time.Now().UnixNano()))
+	if err := writeBackupFile(dir, entryFile, stagedFiles, message); err != nil {
+		return err
+	}
+	if !keep {
+		if err := dropStagedChanges(gitRoot, stagedFiles); err != nil {
+			return fmt.Errorf("saved to %s, but failed to drop staged changes: %w", entryFile, err)
+		}
+	}
+	fmt.Printf("Saved staged@{0} (%d files)\n", len(stagedFiles))
+	return nil
+}
+
+func HandlePop(args []string) error {
+	var dir string
+	args, err := lessflags.String("--dir", &dir).Parse(args)
+	if err != nil {
+		return err
+	}
+	entry, err := resolveStackEntry(dir, args)
+	if err != nil {
+		return err
+	}
+	gitRoot, err := getGitRoot(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get git root: %w", err)
+	}
+	_, files, err := readBackupFile(entry.File)
+	if err != nil {
+		return err
+	}
+	// unlike restore, only the paths about to be written must be clean
+	dirty, err := pathsWithChanges(gitRoot, stagedPaths(files))
+	if err != nil {
+		return err
+	}
+	if len(dirty) > 0 {
+		return fmt.Errorf("cannot pop %s, these paths have local changes:\n  %s", entry.Name, strings.Join(dirty, "\n  "))
+	}
+	for _, file := range files {
+		if err := restoreFile(gitRoot, file); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+	}
+	if err := os.Remove(entry.File); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s (%d files)\n", entry.Name, len(files))
+	return nil
+}
+
+func HandleDrop(args []string) error {
+	var dir string
+	args, err := lessflags.String("--dir", &dir).Parse(args)
+	if err != nil {
+		return err
+	}
+	entry, err := resolveStackEntry(dir, args)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(entry.File); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped %s\n", entry.Name)
+	return nil
+}
+
+func HandleList(args []string) error {
+	var dir string
+	args, err := lessflags.String("--dir", &dir).Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	entries, err := listStack(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		manifest, files, err := readStackEntry(entry)
+		if err != nil {
+			fmt.Printf("%s: <unreadable: %v>\n", entry.Name, err)
+			continue
+		}
+		message := manifest.Message
+		if message == "" {
+			message = "(no message)"
+		}
+		fmt.Printf("%s: %s %s (%d files)\n", entry.Name, formatCreatedAt(manifest.CreatedAt), message, len(files))
+	}
+	return nil
+}
+
+func HandleShow(args []string) error {
+	var dir string
+	args, err := lessflags.String("--dir", &dir).Parse(args)
+	if err != nil {
+		return err
+	}
+	entry, err := resolveStackEntry(dir, args)
+	if err != nil {
+		return err
+	}
+	manifest, files, err := readStackEntry(entry)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", entry.Name)
+	if manifest.Message != "" {
+		fmt.Printf("Message: %s\n", manifest.Message)
+	}
+	fmt.Printf("Created: %s\n", formatCreatedAt(manifest.CreatedAt))
+	if manifest.Head != "" {
+		fmt.Printf("Head:    %s\n", manifest.Head)
+	}
+	fmt.Println()
+	for _, file := range files {
+		switch {
+		case file.IsDeleted:
+			fmt.Printf("D        %s\n", file.Path)
+		case file.IsRenamed:
+			fmt.Printf("R %s %s -> %s\n", file.Mode, file.OldPath, file.Path)
+		case file.IsAdded:
+			fmt.Printf("A %s %s\n", file.Mode, file.Path)
+		default:
+			fmt.Printf("M %s %s\n", file.Mode, file.Path)
+		}
+	}
+	return nil
+}
+
+type stackEntry struct {
+	Name string // staged@{n}
+	File string
+}
+
+func readStackEntry(entry stackEntry) (*archiveManifest, []StagedFile, error) {
+	manifest, files, err := readBackupFile(entry.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("%s is not an archive", entry.File)
+	}
+	return manifest, files, nil
+}
+
+func getStackDir(dir string) (string, error) {
+	output, err := gitcmd.Output(dir, "rev-parse", "--git-path", "kool/staged")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %w", err)
+	}
+	stackDir := strings.TrimSpace(output)
+	if !filepath.IsAbs(stackDir) {
+		stackDir = filepath.Join(dir, stackDir)
+	}
+	return stackDir, nil
+}
+
+// listStack returns the entries newest first
+func listStack(dir string) ([]stackEntry, error) {
+	stackDir, err := getStackDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(stackDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && strings.HasSuffix(dirEntry.Name(), ".tar") {
+			names = append(names, dirEntry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	entries := make([]stackEntry, 0, len(names))
+	for i, name := range names {
+		entries = append(entries, stackEntry{
+			Name: fmt.Sprintf("staged@{%d}", i),
+			File: filepath.Join(stackDir, name),
+		})
+	}
+	return entries, nil
+}
+
+// resolveStackEntry accepts no argument, "<n>" or "staged@{<n>}"
+func resolveStackEntry(dir string, args []string) (stackEntry, error) {
+	if len(args) > 1 {
+		return stackEntry{}, fmt.Errorf("unrecognized extra args: %s", strings.Join(args[1:], " "))
+	}
+	index := 0
+	if len(args) == 1 {
+		arg := strings.TrimSuffix(strings.TrimPrefix(args[0], "staged@{"), "}")
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return stackEntry{}, fmt.Errorf("invalid entry: %s, expect <n> or staged@{<n>}", args[0])
+		}
+		index = n
+	}
+	entries, err := listStack(dir)
+	if err != nil {
+		return stackEntry{}, err
+	}
+	if len(entries) == 0 {
+		return stackEntry{}, fmt.Errorf("no entries in the staged stack")
+	}
+	if index >= len(entries) {
+		return stackEntry{}, fmt.Errorf("staged@{%d} does not exist, the stack has %d entries", index, len(entries))
+	}
+	return entries[index], nil
+}
+
+func formatCreatedAt(createdAt string) string {
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return createdAt
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func stagedPaths(files []StagedFile) []string {
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+		if file.OldPath != "" {
+			paths = append(paths, file.OldPath)
+		}
+	}
+	return paths
+}
+
+// pathsWithUnstagedChanges lists paths whose worktree differs from the index
+func pathsWithUnstagedChanges(gitRoot string, paths []string) ([]string, error) {
+	output, err := gitcmd.Output(gitRoot, append([]string{"diff", "--name-only", "-z", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(output), nil
+}
+
+// pathsWithChanges lists paths that are staged, modified or untracked
+func pathsWithChanges(gitRoot string, paths []string) ([]string, error) {
+	output, err := gitcmd.Output(gitRoot, append([]string{"status", "--porcelain", "-z", "--no-renames", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	var dirty []string
+	for _, record := range splitNul(output) {
+		// "XY path"
+		if len(record) > 3 {
+			dirty = append(dirty, record[3:])
+		}
+	}
+	return dirty, nil
+}
+
+// dropStagedChanges resets the staged files to HEAD in both the index and
+// the worktree.
+func dropStagedChanges(gitRoot string, files []StagedFile) error {
+	var removePaths, deleteFiles, checkoutPaths []string
+	for _, file := range files {
+		switch {
+		case file.IsAdded, file.IsRenamed:
+			removePaths = append(removePaths, file.Path)
+			// a submodule checkout is left in place
+			if file.Mode != modeGitlink {
+				deleteFiles = append(deleteFiles, file.Path)
+			}
+			if file.IsRenamed {
+				checkoutPaths = append(checkoutPaths, file.OldPath)
+			}
+		default:
+			checkoutPaths = append(checkoutPaths, file.Path)
+		}
+	}
+	if len(removePaths) > 0 {
+		if err := runGit(gitRoot, append([]string{"rm", "-q", "--cached", "--"}, removePaths...)...); err != nil {
+			return err
+		}
+		for _, path := range deleteFiles {
+			if err := os.Remove(filepath.Join(gitRoot, path)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if len(checkoutPaths) > 0 {
+		if err := runGit(gitRoot, append([]string{"checkout", "-q", "HEAD", "--"}, checkoutPaths...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitNul(s string) []string {
+	var result []string
+	for _, part := range strings.Split(s, "\x00") {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -9,37 +9,75 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/xhd2015/kool/tools/fs"
-	"github.com/xhd2015/kool/tools/git/ls"
-	"github.com/xhd2015/kool/tools/stringtool"
+	"github.com/xhd2015/kool/tools/git/gitcmd"
 	"github.com/xhd2015/less-flags"
 )
 
+const help = `
+kool git staged saves and restores staged changes
+
+Usage: kool git staged <cmd> [OPTIONS]
+
+Available commands:
+  backup <file>                    save staged changes into file
+  restore <file>                   restore and stage the changes saved in file
+  push [-m <msg>] [--keep]         save staged changes onto the stack, then drop them
+  pop [<n>]                        restore staged@{n} (default: 0) and remove it from the stack
+  list                             list the stack, newest first
+  show [<n>]                       show the files saved in staged@{n}
+  drop [<n>]                       remove staged@{n} without restoring it
+  vet                              run the checks in .kool/vet.yaml on the staged files
+
+Backups are tar archives with a JSON manifest. They keep file modes,
+symlinks, binary content, renames and deletes. The stack lives in
+.git/kool/staged/. restore still reads the legacy "===== path =====" text
+backups.
+
+Examples:
+  kool git staged backup /tmp/staged.tar
+  kool git staged restore /tmp/staged.tar
+  kool git staged push -m "wip: parser"
+  kool git staged pop
+`
+
 func Handle(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: kool git staged <backup|restore> <file>")
+		return fmt.Errorf("usage: kool git staged <backup|restore|push|pop|list|show|drop|vet>, try 'kool git staged --help'")
 	}
 
 	cmd := args[0]
 	args = args[1:]
 	switch cmd {
+	case "-h", "--help", "help":
+		fmt.Print(strings.TrimPrefix(help, "\n"))
+		return nil
 	case "backup":
 		return HandleBackup(args)
 	case "restore":
-		if len(args) != 2 {
-			return fmt.Errorf("usage: kool git staged restore <file.txt>")
-		}
 		return HandleRestore(args)
+	case "push":
+		return HandlePush(args)
+	case "pop":
+		return HandlePop(args)
+	case "list":
+		return HandleList(args)
+	case "show":
+		return HandleShow(args)
+	case "drop":
+		return HandleDrop(args)
 	case "vet":
 		return HandleVet(args)
 	default:
-		return fmt.Errorf("unknown command: %s, available commands: backup, restore", cmd)
+		return fmt.Errorf("unknown command: %s, available commands: backup, restore, push, pop, list, show, drop, vet", cmd)
 	}
 }
 
 func HandleBackup(args []string) error {
 	var dir string
-	args, err := lessflags.String("--dir", &dir).Parse(args)
+	var message string
+	args, err := lessflags.String("--dir", &dir).
+		String("-m,--message", &message).
+		Parse(args)
 	if err != nil {
 		return err
 	}
@@ -53,56 +91,12 @@ func HandleBackup(args []string) error {
 		return fmt.Errorf("unexpected extra args: %s", strings.Join(args, " "))
 	}
 
-	// Get staged files
-	stagedFiles, err := getStagedFiles(dir)
-	if err != nil {
-		return fmt.Errorf("failed to get staged files: %w", err)
-	}
-
-	if len(stagedFiles) == 0 {
-		return fmt.Errorf("no staged files found")
-	}
-
-	// Ensure we're in the git root directory
-	gitRoot, err := getGitRoot(dir)
-	if err != nil {
-		return fmt.Errorf("failed to get git root: %w", err)
-	}
-
-	// Create backup file
-	file, err := os.Create(backupFile)
+	stagedFiles, err := collectStagedFiles(dir)
 	if err != nil {
-		return fmt.Errorf("failed to create backup file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	for _, stagedFile := range stagedFiles {
-		// Write file header
-		header := fmt.Sprintf("===== %s =====\n", stagedFile.Path)
-		if stagedFile.IsDeleted {
-			header = fmt.Sprintf("===== %s [Deleted] =====\n", stagedFile.Path)
-		} else if stagedFile.IsRenamed {
-			header = fmt.Sprintf("===== %s -> %s =====\n", stagedFile.OldPath, stagedFile.Path)
-		}
-
-		if _, err := file.WriteString(header); err != nil {
-			return fmt.Errorf("failed to write header for %s: %w", stagedFile.Path, err)
-		}
-
-		// Write file content if not deleted
-		if !stagedFile.IsDeleted {
-			content, err := getStagedFileContent(gitRoot, stagedFile.Path)
-			if err != nil {
-				return fmt.Errorf("failed to get content for %s: %w", stagedFile.Path, err)
-			}
-			if _, err := file.WriteString(content); err != nil {
-				return fmt.Errorf("failed to write content for %s: %w", stagedFile.Path, err)
-			}
-		}
-
-		if _, err := file.WriteString("\n"); err != nil {
-			return fmt.Errorf("failed to write newline: %w", err)
-		}
+	if err := writeBackupFile(dir, backupFile, stagedFiles, message); err != nil {
+		return err
 	}
 
 	fmt.Printf("Backup created: %s (%d files)\n", backupFile, len(stagedFiles))
@@ -125,96 +119,99 @@ func HandleRestore(args []string) error {
 		return fmt.Errorf("unexpected extra args: %s", strings.Join(args, " "))
 	}
 
+	n, err := restoreBackupFile(dir, backupFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d files from backup\n", n)
+	return nil
+}
+
+// collectStagedFiles reads the staged files together with their index content
+func collectStagedFiles(dir string) ([]StagedFile, error) {
+	stagedFiles, err := getStagedFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staged files: %w", err)
+	}
+	if len(stagedFiles) == 0 {
+		return nil, fmt.Errorf("no staged files found")
+	}
+	for i, stagedFile := range stagedFiles {
+		if stagedFile.IsDeleted || stagedFile.Mode == modeGitlink {
+			continue
+		}
+		content, err := getBlobContent(dir, stagedFile.Blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get content for %s: %w", stagedFile.Path, err)
+		}
+		stagedFiles[i].Content = content
+	}
+	return stagedFiles, nil
+}
+
+func writeBackupFile(dir string, backupFile string, stagedFiles []StagedFile, message string) error {
+	head, _ := gitcmd.Output(dir, "rev-parse", "--verify", "--quiet", "HEAD")
+
+	file, err := os.Create(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer file.Close()
+	if err := writeArchive(file, stagedFiles, message, strings.TrimSpace(head)); err != nil {
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return file.Close()
+}
+
+// restoreBackupFile restores and stages a backup of either format into a
+// clean worktree, returning the number of files restored.
+func restoreBackupFile(dir string, backupFile string) (int, error) {
 	// Check if worktree is clean
 	if !isWorktreeClean(dir) {
-		return fmt.Errorf("worktree is not clean, please commit or stash your changes first")
+		return 0, fmt.Errorf("worktree is not clean, please commit or stash your changes first")
 	}
 
 	// Ensure we're in the git root directory
 	gitRoot, err := getGitRoot(dir)
 	if err != nil {
-		return fmt.Errorf("failed to get git root: %w", err)
+		return 0, fmt.Errorf("failed to get git root: %w", err)
 	}
 
-	// Parse backup file
-	files, err := parseBackupFile(backupFile)
+	_, files, err := readBackupFile(backupFile)
 	if err != nil {
-		return fmt.Errorf("failed to parse backup file: %w", err)
+		return 0, fmt.Errorf("failed to parse backup file: %w", err)
 	}
 
 	if len(files) == 0 {
-		return fmt.Errorf("no files found in backup")
+		return 0, fmt.Errorf("no files found in backup")
 	}
 
 	// Restore files
 	for _, file := range files {
 		if err := restoreFile(gitRoot, file); err != nil {
-			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+			return 0, fmt.Errorf("failed to restore %s: %w", file.Path, err)
 		}
 	}
-
-	fmt.Printf("Restored %d files from backup\n", len(files))
-	return nil
-}
-
-const vetHelp = `
-vet the staged files to check if there is any symlink
-
-Usage: kool git staged vet [OPTIONS]
-
-
-
-Options:
-  -h,--help            show help message
-  -v,--verbose         show verbose info
-`
-
-// Handle vet command checks there is no symlink in the staged files
-func HandleVet(args []string) error {
-	var dir string
-	var verbose bool
-	args, err := lessflags.String("--dir", &dir).
-		Help("-h,--help", vetHelp).Bool("-v,--verbose", &verbose).
-		Parse(args)
-	if err != nil {
-		return err
-	}
-	if len(args) > 0 {
-		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
-	}
-	stagedFiles, err := ls.GetStatedFiles(dir, verbose)
-	if err != nil {
-		return err
-	}
-	var symFiles []string
-	for _, file := range stagedFiles {
-		isSymlink, err := fs.IsSymbolicLink(file)
-		if err != nil {
-			return err
-		}
-		if isSymlink {
-			symFiles = append(symFiles, file)
-		}
-	}
-	if len(symFiles) > 0 {
-		return fmt.Errorf("symbolic link found in staged files:\n%s", strings.Join(stringtool.PrefixLines(symFiles, "- "), "\n"))
-	}
-
-	return nil
+	return len(files), nil
 }
 
 type StagedFile struct {
 	Path       string
 	OldPath    string // for renames
 	Content    string
+	Mode       string // git index mode like 100644, empty for legacy text backups
+	Blob       string // staged blob hash
+	IsAdded    bool
 	IsDeleted  bool
 	IsRenamed  bool
 	IsUnmerged bool
 }
 
 func getStagedFiles(dir string) ([]StagedFile, error) {
-	// Use git diff --cached --name-status to get staged files
-	cmd := exec.Command("git", "diff", "--cached", "--name-status")
+	// --raw shows modes and blob hashes, -z keeps unusual paths intact:
+	//   :100644 100755 <old sha> <new sha> M\0path\0
+	//   :100644 100644 <old sha> <new sha> R100\0old path\0new path\0
+	cmd := exec.Command("git", "diff", "--cached", "--raw", "-z", "--no-abbrev")
 	cmd.Dir = dir
 	output, err := cmd.Output()
 	if err != nil {
@@ -222,36 +219,47 @@ func getStagedFiles(dir string) ([]StagedFile, error) {
 	}
 
 	var files []StagedFile
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-
-	for _, line := range lines {
-		if line == "" {
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i < len(fields); i++ {
+		meta := fields[i]
+		if meta == "" {
 			continue
 		}
-
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
+		parts := strings.Fields(strings.TrimPrefix(meta, ":"))
+		if len(parts) < 5 || i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff output: %q", meta)
+		}
+		newMode, newBlob, status := parts[1], parts[3], parts[4]
+		i++
+		file := StagedFile{
+			Path: fields[i],
+			Mode: newMode,
+			Blob: newBlob,
 		}
-
-		status := parts[0]
-		path := parts[1]
-
-		file := StagedFile{Path: path}
 
 		// Handle different status codes
 		switch status[0] {
+		case 'A':
+			file.IsAdded = true
 		case 'D':
 			file.IsDeleted = true
+			file.Mode = ""
+			file.Blob = ""
 		case 'U':
 			file.IsUnmerged = true
-		case 'R':
-			file.IsRenamed = true
-			// For renames, git shows status like "R100" and we have oldpath newpath
-			if len(parts) >= 3 {
-				file.OldPath = parts[1]
-				file.Path = parts[2]
+		case 'R', 'C':
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff output: %q", meta)
+			}
+			i++
+			if status[0] == 'R' {
+				file.IsRenamed = true
+				file.OldPath = file.Path
+			} else {
+				// a copy leaves the source untouched
+				file.IsAdded = true
 			}
+			file.Path = fields[i]
 		}
 
 		if file.IsUnmerged {
@@ -264,10 +272,9 @@ func getStagedFiles(dir string) ([]StagedFile, error) {
 	return files, nil
 }
 
-func getStagedFileContent(gitRoot, filePath string) (string, error) {
-	// Use git show :filename to get staged content
-	cmd := exec.Command("git", "show", ":"+filePath)
-	cmd.Dir = gitRoot
+func getBlobContent(dir string, blob string) (string, error) {
+	cmd := exec.Command("git", "cat-file", "blob", blob)
+	cmd.Dir = dir
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -376,37 +383,113 @@ func parseBackupFile(backupFile string) ([]StagedFile, error) {
 }
 
 func restoreFile(dir string, file StagedFile) error {
+	// paths come from the backup file, never write outside of dir
+	filePath, err := joinRepoPath(dir, file.Path)
+	if err != nil {
+		return err
+	}
+	var oldPath string
+	if file.IsRenamed {
+		oldPath, err = joinRepoPath(dir, file.OldPath)
+		if err != nil {
+			return err
+		}
+	}
 	if file.IsDeleted {
 		// For deleted files, remove them from filesystem and stage the deletion
-		if err := os.Remove(filepath.Join(dir, file.Path)); err != nil && !os.IsNotExist(err) {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
 			return err
 		}
-		cmd := exec.Command("git", "add", file.Path)
-		cmd.Dir = dir
-		return cmd.Run()
+		return gitAdd(dir, file.Path)
+	}
+
+	if file.Mode == modeGitlink {
+		// submodule commit, only the index entry can be restored
+		return runGit(dir, "update-index", "--add", "--cacheinfo", file.Mode+","+file.Blob+","+file.Path)
 	}
 
+	if err := writeEntryContent(filePath, file); err != nil {
+		return err
+	}
 	if file.IsRenamed {
 		// For renamed files, first create the new file, then remove the old one
-		if err := writeFileContent(filepath.Join(dir, file.Path), file.Content); err != nil {
-			return err
-		}
-		if err := os.Remove(filepath.Join(dir, file.OldPath)); err != nil && !os.IsNotExist(err) {
+		if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
 			return err
 		}
 		// Stage both operations
-		cmd := exec.Command("git", "add", file.Path, file.OldPath)
-		cmd.Dir = dir
-		return cmd.Run()
+		return gitAdd(dir, file.Path, file.OldPath)
 	}
+	return gitAdd(dir, file.Path)
+}
 
-	// Regular file - write content and stage
-	if err := writeFileContent(filepath.Join(dir, file.Path), file.Content); err != nil {
-		return err
+// joinRepoPath joins a slash separated path relative to the repository
+// root, rejecting absolute paths, paths leaving the root and paths under
+// a symlink, which an earlier entry of the backup may have created
+func joinRepoPath(dir string, path string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(path))
+	if path == "" || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in backup: %q", path)
+	}
+	parent := dir
+	elems := strings.Split(rel, string(filepath.Separator))
+	for _, elem := range elems[:len(elems)-1] {
+		parent = filepath.Join(parent, elem)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid path in backup: %q, parent %s is a symlink", path, filepath.ToSlash(elem))
+		}
 	}
-	cmd := exec.Command("git", "add", file.Path)
+	return filepath.Join(dir, rel), nil
+}
+
+func gitAdd(dir string, paths ...string) error {
+	return runGit(dir, append([]string{"add", "-A", "--"}, paths...)...)
+}
+
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
 	cmd.Dir = dir
-	return cmd.Run()
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// writeEntryContent writes a regular file, executable or symlink
+// according to the git mode recorded for the entry.
+func writeEntryContent(filePath string, file StagedFile) error {
+	if file.Mode == "" {
+		return writeFileContent(filePath, file.Content)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	// never write through an existing symlink
+	if info, err := os.Lstat(filePath); err == nil && (file.Mode == modeSymlink || info.Mode()&os.ModeSymlink != 0) {
+		if err := os.Remove(filePath); err != nil {
+			return err
+		}
+	}
+	if file.Mode == modeSymlink {
+		return os.Symlink(file.Content, filePath)
+	}
+	perm := os.FileMode(0644)
+	if file.Mode == modeExecutable {
+		perm = 0755
+	}
+	if err := os.WriteFile(filePath, []byte(file.Content), perm); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(filePath, perm)
 }
 
 func writeFileContent(filePath, content string) error {
@@ -35,6 +35,8 @@ func TestStagedBackupAndRestore(t *testing.T) {
 		{"TestRestoreDirtyWorktree", testRestoreDirtyWorktree},
 		{"TestRestoreInvalidBackup", testRestoreInvalidBackup},
 		{"TestBackupRestoreRoundTrip", testBackupRestoreRoundTrip},
+		{"TestBackupRestoreBinaryModesSymlinks", testBackupRestoreBinaryModesSymlinks},
+		{"TestPushPop", testPushPop},
 	}
 
 	for _, tt := range tests {
@@ -74,7 +76,7 @@ func testBackupNoStagedFiles(t *testing.T, repoDir string) {
 
 	// Test backup with no staged files
 	err := runInDir(repoDir, func() error {
-		return HandleBackup(backupFile)
+		return HandleBackup([]string{backupFile})
 	})
 
 	if err == nil {
@@ -109,7 +111,7 @@ func testBackupRegularFiles(t *testing.T, repoDir string) {
 	// Test backup
 	backupFile := filepath.Join(repoDir, "backup.txt")
 	err := runInDir(repoDir, func() error {
-		return HandleBackup(backupFile)
+		return HandleBackup([]string{backupFile})
 	})
 
 	if err != nil {
@@ -117,22 +119,17 @@ func testBackupRegularFiles(t *testing.T, repoDir string) {
 	}
 
 	// Verify backup content
-	content, err := os.ReadFile(backupFile)
-	if err != nil {
-		t.Fatalf("Failed to read backup file: %v", err)
-	}
-
-	backupStr := string(content)
-	if !strings.Contains(backupStr, "===== file1.txt =====") {
-		t.Error("Backup missing file1.txt header")
+	backup := readTestBackup(t, backupFile)
+	if backup["file1.txt"] == nil {
+		t.Fatal("Backup missing file1.txt")
 	}
-	if !strings.Contains(backupStr, "===== subdir/file2.go =====") {
-		t.Error("Backup missing file2.go header")
+	if backup["subdir/file2.go"] == nil {
+		t.Fatal("Backup missing subdir/file2.go")
 	}
-	if !strings.Contains(backupStr, "content of file1") {
-		t.Error("Backup missing file1 content")
+	if backup["file1.txt"].Content != "content of file1\nline 2" {
+		t.Errorf("Backup file1 content mismatch: %q", backup["file1.txt"].Content)
 	}
-	if !strings.Contains(backupStr, "package main") {
+	if !strings.Contains(backup["subdir/file2.go"].Content, "package main") {
 		t.Error("Backup missing file2 content")
 	}
 }
@@ -159,7 +156,7 @@ func testBackupDeletedFiles(t *testing.T, repoDir string) {
 	// Test backup
 	backupFile := filepath.Join(repoDir, "backup.txt")
 	err := runInDir(repoDir, func() error {
-		return HandleBackup(backupFile)
+		return HandleBackup([]string{backupFile})
 	})
 
 	if err != nil {
@@ -167,14 +164,9 @@ func testBackupDeletedFiles(t *testing.T, repoDir string) {
 	}
 
 	// Verify backup content
-	content, err := os.ReadFile(backupFile)
-	if err != nil {
-		t.Fatalf("Failed to read backup file: %v", err)
-	}
-
-	backupStr := string(content)
-	if !strings.Contains(backupStr, "===== to-delete.txt [Deleted] =====") {
-		t.Error("Backup missing deleted file header")
+	backup := readTestBackup(t, backupFile)
+	if backup["to-delete.txt"] == nil || !backup["to-delete.txt"].IsDeleted {
+		t.Error("Backup missing deleted file")
 	}
 }
 
@@ -202,7 +194,7 @@ func testBackupRenamedFiles(t *testing.T, repoDir string) {
 	// Test backup
 	backupFile := filepath.Join(repoDir, "backup.txt")
 	err := runInDir(repoDir, func() error {
-		return HandleBackup(backupFile)
+		return HandleBackup([]string{backupFile})
 	})
 
 	if err != nil {
@@ -210,17 +202,13 @@ func testBackupRenamedFiles(t *testing.T, repoDir string) {
 	}
 
 	// Verify backup content
-	content, err := os.ReadFile(backupFile)
-	if err != nil {
-		t.Fatalf("Failed to read backup file: %v", err)
-	}
-
-	backupStr := string(content)
-	if !strings.Contains(backupStr, "===== old-name.txt -> new-name.txt =====") {
-		t.Error("Backup missing renamed file header")
+	backup := readTestBackup(t, backupFile)
+	renamed := backup["new-name.txt"]
+	if renamed == nil || !renamed.IsRenamed || renamed.OldPath != "old-name.txt" {
+		t.Fatalf("Backup missing renamed file: %+v", renamed)
 	}
-	if !strings.Contains(backupStr, "content to be renamed") {
-		t.Error("Backup missing renamed file content")
+	if renamed.Content != "content to be renamed" {
+		t.Errorf("Backup renamed file content mismatch: %q", renamed.Content)
 	}
 }
 
@@ -246,7 +234,7 @@ func test() {
 
 	// Test restore
 	err := runInDir(repoDir, func() error {
-		return HandleRestore(backupFile)
+		return HandleRestore([]string{backupFile})
 	})
 
 	if err != nil {
@@ -294,7 +282,7 @@ test content
 
 	// Test restore should fail
 	err := runInDir(repoDir, func() error {
-		return HandleRestore(backupFile)
+		return HandleRestore([]string{backupFile})
 	})
 
 	if err == nil {
@@ -318,7 +306,7 @@ no headers here
 
 	// Test restore
 	err := runInDir(repoDir, func() error {
-		return HandleRestore(backupFile)
+		return HandleRestore([]string{backupFile})
 	})
 
 	if err == nil {
@@ -358,7 +346,7 @@ func testBackupRestoreRoundTrip(t *testing.T, repoDir string) {
 	// Backup to external file
 	backupFile := filepath.Join(os.TempDir(), "roundtrip-backup-test.txt")
 	err := runInDir(repoDir, func() error {
-		return HandleBackup(backupFile)
+		return HandleBackup([]string{backupFile})
 	})
 	if err != nil {
 		t.Fatalf("Backup failed: %v", err)
@@ -375,7 +363,7 @@ func testBackupRestoreRoundTrip(t *testing.T, repoDir string) {
 
 	// Restore
 	err = runInDir(repoDir, func() error {
-		return HandleRestore(backupFile)
+		return HandleRestore([]string{backupFile})
 	})
 	if err != nil {
 		t.Fatalf("Restore failed: %v", err)
@@ -406,8 +394,125 @@ func testBackupRestoreRoundTrip(t *testing.T, repoDir string) {
 	}
 }
 
+func testBackupRestoreBinaryModesSymlinks(t *testing.T, repoDir string) {
+	binary := []byte{0, 1, 2, 0xff, '\n', '=', '=', '=', '=', '=', ' ', 'x', '\n'}
+	// content that looks like a legacy header must survive too
+	tricky := "before\n===== other.txt =====\nafter"
+	if err := os.WriteFile(filepath.Join(repoDir, "data.bin"), binary, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "tricky.txt"), []byte(tricky), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "run.sh"), []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("tricky.txt", filepath.Join(repoDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGitCommand(repoDir, "add", "."); err != nil {
+		t.Fatalf("Failed to stage files: %v", err)
+	}
+
+	backupFile := filepath.Join(t.TempDir(), "backup.tar")
+	if err := runInDir(repoDir, func() error { return HandleBackup([]string{backupFile}) }); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := runGitCommand(repoDir, "reset", "--hard"); err != nil {
+		t.Fatalf("Failed to reset: %v", err)
+	}
+	if err := runGitCommand(repoDir, "clean", "-fd"); err != nil {
+		t.Fatalf("Failed to clean: %v", err)
+	}
+	if err := runInDir(repoDir, func() error { return HandleRestore([]string{backupFile}) }); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(repoDir, "data.bin")); string(got) != string(binary) {
+		t.Errorf("binary content mismatch: %v", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(repoDir, "tricky.txt")); string(got) != tricky {
+		t.Errorf("tricky content mismatch: %q", got)
+	}
+	if info, err := os.Stat(filepath.Join(repoDir, "run.sh")); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("run.sh lost its executable bit: %v %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(repoDir, "link")); err != nil || target != "tricky.txt" {
+		t.Errorf("link not restored as symlink: %q %v", target, err)
+	}
+	output, err := runGitCommandOutput(repoDir, "diff", "--cached", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged := strings.Fields(output); len(staged) != 4 {
+		t.Errorf("Expected 4 staged files, got %v", staged)
+	}
+}
+
+func testPushPop(t *testing.T, repoDir string) {
+	if err := os.WriteFile(filepath.Join(repoDir, "base.txt"), []byte("base"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGitCommand(repoDir, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGitCommand(repoDir, "commit", "-m", "base"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, "base.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGitCommand(repoDir, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runInDir(repoDir, func() error { return HandlePush([]string{"-m", "wip"}) }); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if output, _ := runGitCommandOutput(repoDir, "status", "--porcelain"); strings.TrimSpace(output) != "" {
+		t.Fatalf("Expected clean worktree after push, got:\n%s", output)
+	}
+	entries, err := listStack(repoDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 stack entry, got %v %v", entries, err)
+	}
+
+	if err := runInDir(repoDir, func() error { return HandlePop(nil) }); err != nil {
+		t.Fatalf("Pop failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(repoDir, "base.txt")); string(got) != "changed" {
+		t.Errorf("base.txt not restored: %q", got)
+	}
+	output, err := runGitCommandOutput(repoDir, "diff", "--cached", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged := strings.Fields(output); len(staged) != 2 {
+		t.Errorf("Expected 2 staged files after pop, got %v", staged)
+	}
+	if entries, _ := listStack(repoDir); len(entries) != 0 {
+		t.Errorf("Expected empty stack after pop, got %v", entries)
+	}
+}
+
 // Helper functions
 
+func readTestBackup(t *testing.T, backupFile string) map[string]*StagedFile {
+	t.Helper()
+	_, files, err := readBackupFile(backupFile)
+	if err != nil {
+		t.Fatalf("Failed to read backup file: %v", err)
+	}
+	result := make(map[string]*StagedFile, len(files))
+	for i := range files {
+		result[files[i].Path] = &files[i]
+	}
+	return result
+}
+
 func runInDir(dir string, fn func() error) error {
 	oldDir, err := os.Getwd()
 	if err != nil {
@@ -434,3 +539,69 @@ func runGitCommandOutput(dir string, args ...string) (string, error) {
 	output, err := cmd.Output()
 	return string(output), err
 }
+
+func TestRestoreFileRejectsUnsafePaths(t *testing.T) {
+	root := t.TempDir()
+	repoDir := filepath.Join(root, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := initTestRepo(repoDir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file StagedFile
+	}{
+		{"parent", StagedFile{Path: "../escaped.txt", Content: "x"}},
+		{"nested parent", StagedFile{Path: "a/../../escaped.txt", Content: "x"}},
+		{"absolute", StagedFile{Path: filepath.Join(root, "escaped.txt"), Content: "x"}},
+		{"root itself", StagedFile{Path: ".", Content: "x"}},
+		{"deleted", StagedFile{Path: "../escaped.txt", IsDeleted: true}},
+		{"renamed from outside", StagedFile{Path: "ok.txt", OldPath: "../escaped.txt", IsRenamed: true, Content: "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(root, "escaped.txt"), []byte("keep"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := restoreFile(repoDir, tt.file)
+			if err == nil || !strings.Contains(err.Error(), "invalid path") {
+				t.Fatalf("expect invalid path error, got: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(root, "escaped.txt"))
+			if err != nil || string(content) != "keep" {
+				t.Fatalf("file outside the repo was touched: %q, %v", content, err)
+			}
+			if _, err := os.Stat(filepath.Join(repoDir, "ok.txt")); !os.IsNotExist(err) {
+				t.Fatalf("expect nothing restored, stat ok.txt: %v", err)
+			}
+		})
+	}
+
+	// a path that only looks like a parent is fine
+	if err := restoreFile(repoDir, StagedFile{Path: "..data/a.txt", Content: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// an earlier entry restores a symlink leaving the repo, a later one writes through it
+	if err := restoreFile(repoDir, StagedFile{Path: "link", Mode: modeSymlink, Content: root}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []StagedFile{
+		{Path: "link/escaped.txt", Mode: modeRegular, Content: "x"},
+		{Path: "link/escaped.txt", Content: "x"},
+		{Path: "link/escaped.txt", IsDeleted: true},
+		{Path: "ok.txt", OldPath: "link/escaped.txt", IsRenamed: true, Content: "x"},
+	} {
+		err := restoreFile(repoDir, file)
+		if err == nil || !strings.Contains(err.Error(), "parent link is a symlink") {
+			t.Fatalf("expect symlink parent error for %+v, got: %v", file, err)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(root, "escaped.txt"))
+	if err != nil || string(content) != "keep" {
+		t.Fatalf("file outside the repo was touched through a symlink: %q, %v", content, err)
+	}
+}
@@ -0,0 +1,426 @@
+package staged
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/kool/tools/stringtool"
+	"github.com/xhd2015/less-flags"
+	"gopkg.in/yaml.v3"
+)
+
+const vetHelp = `
+vet the staged files before committing
+
+Usage: kool git staged vet [OPTIONS]
+
+Checks are configured in .kool/vet.yaml at the repository root, all of them
+look at the staged content rather than the worktree. Without the file only
+the symlink check runs.
+
+  symlink: true              # reject symbolic links (default: true)
+  max_file_size_mb: 5        # reject files larger than this
+  secrets: true              # reject AWS keys and private key headers
+  secret_patterns:           # extra regular expressions treated as secrets
+    - 'xox[bp]-[0-9A-Za-z-]+'
+  conflict_markers: true     # reject <<<<<<< and >>>>>>> lines
+  gofmt: true                # reject Go files that are not gofmt-ed
+  go_vet: true               # run go vet on packages with staged Go files
+  forbidden_paths:           # reject staged paths matching these globs
+    - '*.pem'                #   without '/': matches the base name
+    - 'secrets/**'           #   '<dir>/**': matches everything under dir
+  commands:                  # custom checks, staged files are appended as args,
+                             #   or passed as $@ if run refers to it
+    - name: lint
+      run: ./script/lint.sh
+      files: ['*.ts']        # only pass matching files, skip if none
+
+Options:
+  --config <file>      use the given config instead of .kool/vet.yaml
+  --dir <dir>          run in the given directory
+  -h,--help            show help message
+  -v,--verbose         show verbose info
+`
+
+const vetConfigFile = ".kool/vet.yaml"
+
+type VetConfig struct {
+	Symlink         *bool        `yaml:"symlink"`
+	MaxFileSizeMB   float64      `yaml:"max_file_size_mb"`
+	Secrets         bool         `yaml:"secrets"`
+	SecretPatterns  []string     `yaml:"secret_patterns"`
+	ConflictMarkers bool         `yaml:"conflict_markers"`
+	Gofmt           bool         `yaml:"gofmt"`
+	GoVet           bool         `yaml:"go_vet"`
+	ForbiddenPaths  []string     `yaml:"forbidden_paths"`
+	Commands        []VetCommand `yaml:"commands"`
+}
+
+type VetCommand struct {
+	Name  string   `yaml:"name"`
+	Run   string   `yaml:"run"`
+	Files []string `yaml:"files"`
+}
+
+// VetProblem is one failed check
+type VetProblem struct {
+	Check  string
+	File   string
+	Detail string
+}
+
+func (p VetProblem) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("[%s] %s", p.Check, p.Detail)
+	}
+	if p.Detail == "" {
+		return fmt.Sprintf("[%s] %s", p.Check, p.File)
+	}
+	return fmt.Sprintf("[%s] %s: %s", p.Check, p.File, p.Detail)
+}
+
+var builtinSecretPatterns = []string{
+	`\b(AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`,
+}
+
+var conflictMarker = regexp.MustCompile(`^(<<<<<<<|>>>>>>>)( |$)`)
+
+// HandleVet runs the configured checks against the staged files
+func HandleVet(args []string) error {
+	var dir string
+	var configFile string
+	var verbose bool
+	args, err := lessflags.String("--dir", &dir).
+		String("--config", &configFile).
+		Help("-h,--help", vetHelp).Bool("-v,--verbose", &verbose).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	gitRoot, err := getGitRoot(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get git root: %w", err)
+	}
+	if configFile == "" {
+		configFile = filepath.Join(gitRoot, vetConfigFile)
+	}
+	config, err := LoadVetConfig(configFile)
+	if err != nil {
+		return err
+	}
+	problems, err := Vet(gitRoot, config, verbose)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		lines := make([]string, 0, len(problems))
+		for _, p := range problems {
+			lines = append(lines, p.String())
+		}
+		return fmt.Errorf("vet failed on staged files:\n%s", strings.Join(stringtool.PrefixLines(lines, "- "), "\n"))
+	}
+	return nil
+}
+
+// LoadVetConfig returns the default config if file does not exist
+func LoadVetConfig(file string) (*VetConfig, error) {
+	config := &VetConfig{}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return config, nil
+}
+
+// Vet runs the checks in config and returns the problems found
+func Vet(gitRoot string, config *VetConfig, verbose bool) ([]VetProblem, error) {
+	stagedFiles, err := getStagedFiles(gitRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get staged files: %w", err)
+	}
+	var files []StagedFile
+	for _, file := range stagedFiles {
+		// unmerged entries have no staged blob, git refuses to commit them anyway
+		if !file.IsDeleted && !file.IsUnmerged {
+			files = append(files, file)
+		}
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "vet %d staged files\n", len(files))
+	}
+
+	var secretPatterns []*regexp.Regexp
+	if config.Secrets {
+		for _, p := range builtinSecretPatterns {
+			secretPatterns = append(secretPatterns, regexp.MustCompile(p))
+		}
+	}
+	for _, p := range config.SecretPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %w", p, err)
+		}
+		secretPatterns = append(secretPatterns, re)
+	}
+	needContent := len(secretPatterns) > 0 || config.ConflictMarkers || config.Gofmt
+
+	var problems []VetProblem
+	var goFiles []string
+	for _, file := range files {
+		for _, pattern := range config.ForbiddenPaths {
+			if MatchPath(pattern, file.Path) {
+				problems = append(problems, VetProblem{Check: "forbidden-path", File: file.Path, Detail: "matches " + pattern})
+				break
+			}
+		}
+		if file.Mode == modeGitlink {
+			continue
+		}
+		if file.Mode == modeSymlink {
+			if config.Symlink == nil || *config.Symlink {
+				problems = append(problems, VetProblem{Check: "symlink", File: file.Path})
+			}
+			continue
+		}
+		if config.MaxFileSizeMB > 0 {
+			size, err := getBlobSize(gitRoot, file.Blob)
+			if err != nil {
+				return nil, err
+			}
+			if float64(size) > config.MaxFileSizeMB*1024*1024 {
+				problems = append(problems, VetProblem{Check: "large-file", File: file.Path, Detail: fmt.Sprintf("%.2f MB exceeds %v MB", float64(size)/1024/1024, config.MaxFileSizeMB)})
+			}
+		}
+		if strings.HasSuffix(file.Path, ".go") {
+			goFiles = append(goFiles, file.Path)
+		}
+		if !needContent {
+			continue
+		}
+		content, err := getBlobContent(gitRoot, file.Blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read staged %s: %w", file.Path, err)
+		}
+		// text checks make no sense on binary content
+		if strings.IndexByte(content, 0) >= 0 {
+			continue
+		}
+		problems = append(problems, checkContent(file.Path, content, secretPatterns, config.ConflictMarkers)...)
+		if config.Gofmt && strings.HasSuffix(file.Path, ".go") {
+			formatted, err := format.Source([]byte(content))
+			if err != nil {
+				problems = append(problems, VetProblem{Check: "gofmt", File: file.Path, Detail: err.Error()})
+			} else if !bytes.Equal(formatted, []byte(content)) {
+				problems = append(problems, VetProblem{Check: "gofmt", File: file.Path, Detail: "not formatted, run gofmt -w"})
+			}
+		}
+	}
+
+	if config.GoVet && len(goFiles) > 0 {
+		vetProblems, err := goVetStaged(gitRoot, goFiles, verbose)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, vetProblems...)
+	}
+	for _, command := range config.Commands {
+		problem, err := runVetCommand(gitRoot, command, files, verbose)
+		if err != nil {
+			return nil, err
+		}
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+	return problems, nil
+}
+
+func checkContent(file string, content string, secretPatterns []*regexp.Regexp, conflictMarkers bool) []VetProblem {
+	var problems []VetProblem
+	for i, line := range strings.Split(content, "\n") {
+		lineNum := strconv.Itoa(i + 1)
+		if conflictMarkers && conflictMarker.MatchString(line) {
+			problems = append(problems, VetProblem{Check: "conflict-marker", File: file + ":" + lineNum, Detail: strings.TrimSpace(line)})
+		}
+		for _, re := range secretPatterns {
+			if re.MatchString(line) {
+				// never echo the secret itself
+				problems = append(problems, VetProblem{Check: "secret", File: file + ":" + lineNum, Detail: "matches " + re.String()})
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// MatchPath matches a slash separated path against a glob: patterns without
+// '/' match the base name, '<dir>/**' matches everything under dir.
+func MatchPath(pattern string, file string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return file == prefix || strings.HasPrefix(file, prefix+"/")
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+	ok, _ := path.Match(pattern, file)
+	return ok
+}
+
+func getBlobSize(dir string, blob string) (int64, error) {
+	output, err := gitcmd.Output(dir, "cat-file", "-s", blob)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+}
+
+// goVetStaged exports the index into a temp dir so that go vet sees the
+// staged content, then vets each package containing a staged Go file.
+func goVetStaged(gitRoot string, goFiles []string, verbose bool) ([]VetProblem, error) {
+	tmpDir, err := os.MkdirTemp("", "kool-staged-vet")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := runGit(gitRoot, "checkout-index", "-a", "--prefix="+tmpDir+"/"); err != nil {
+		return nil, fmt.Errorf("failed to export staged files: %w", err)
+	}
+
+	// group package dirs by their module root
+	modulePkgs := make(map[string]map[string]bool)
+	for _, file := range goFiles {
+		pkgDir := filepath.Join(tmpDir, filepath.FromSlash(path.Dir(file)))
+		modRoot := findModRoot(tmpDir, pkgDir)
+		if modRoot == "" {
+			continue
+		}
+		rel, err := filepath.Rel(modRoot, pkgDir)
+		if err != nil {
+			return nil, err
+		}
+		if modulePkgs[modRoot] == nil {
+			modulePkgs[modRoot] = make(map[string]bool)
+		}
+		modulePkgs[modRoot]["./"+filepath.ToSlash(rel)] = true
+	}
+
+	modRoots := make([]string, 0, len(modulePkgs))
+	for modRoot := range modulePkgs {
+		modRoots = append(modRoots, modRoot)
+	}
+	sort.Strings(modRoots)
+	var problems []VetProblem
+	for _, modRoot := range modRoots {
+		var pkgs []string
+		for pkg := range modulePkgs[modRoot] {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Strings(pkgs)
+		if verbose {
+			fmt.Fprintf(os.Stderr, "go vet %s\n", strings.Join(pkgs, " "))
+		}
+		cmd := exec.Command("go", append([]string{"vet"}, pkgs...)...)
+		cmd.Dir = modRoot
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				return nil, fmt.Errorf("go vet: %w", err)
+			}
+			// report paths relative to the repository
+			detail := strings.ReplaceAll(strings.TrimSpace(string(output)), tmpDir+string(filepath.Separator), "")
+			modDir, _ := filepath.Rel(tmpDir, modRoot)
+			problems = append(problems, VetProblem{Check: "go-vet", File: filepath.ToSlash(modDir), Detail: "\n" + detail})
+		}
+	}
+	return problems, nil
+}
+
+// findModRoot walks up from dir to root looking for go.mod
+func findModRoot(root string, dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		if dir == root {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// runVetCommand runs command via sh with the staged files as "$@", appended
+// to the command unless it refers to "$@" itself. A non-zero exit is
+// reported as a problem.
+func runVetCommand(gitRoot string, command VetCommand, files []StagedFile, verbose bool) (*VetProblem, error) {
+	if command.Run == "" {
+		return nil, fmt.Errorf("vet command %q: missing run", command.Name)
+	}
+	name := command.Name
+	if name == "" {
+		name = command.Run
+	}
+	var paths []string
+	for _, file := range files {
+		if len(command.Files) == 0 {
+			paths = append(paths, file.Path)
+			continue
+		}
+		for _, pattern := range command.Files {
+			if MatchPath(pattern, file.Path) {
+				paths = append(paths, file.Path)
+				break
+			}
+		}
+	}
+	if len(command.Files) > 0 && len(paths) == 0 {
+		return nil, nil
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "run %s with %d files\n", name, len(paths))
+	}
+	script := command.Run
+	if !strings.Contains(script, "$@") && !strings.Contains(script, "$*") {
+		script += ` "$@"`
+	}
+	cmd := exec.Command("sh", append([]string{"-c", script, "sh"}, paths...)...)
+	cmd.Dir = gitRoot
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("vet command %s: %w", name, err)
+		}
+		detail := strings.TrimSpace(string(output))
+		if detail == "" {
+			detail = err.Error()
+		} else {
+			detail = "\n" + detail
+		}
+		return &VetProblem{Check: name, Detail: detail}, nil
+	}
+	return nil, nil
+}
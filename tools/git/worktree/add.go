@@ -13,7 +13,10 @@ kool git worktree facility
 Usage: kool git worktree <cmd> [OPTIONS]
 
 Available commands:
+  ls [--base <branch>] [--json]    list worktrees with branch, ahead/behind, dirty state and age
   add <path> [branch]              add a new worktree, with optional setting new branch
+  exec -- <cmd> [args...]          run a command in every worktree
+  sync [--base <branch>]           rebase every clean worktree onto the updated base branch
   reclaim <dir> [--dry-run]        reclaim a clean linked worktree merged into main
   reclaim --all [--dry-run]        reclaim all eligible linked worktrees
   merge-back [--to <path>] [--dry-run] [--rm] [--confirm-from-stdin]
@@ -27,17 +30,24 @@ Options:
 Examples:
   kool git worktree help                           show help message
   kool git worktree add ../working-v1.2.0 v1.2.0   create a new project named my_project
+  kool git worktree exec -- git status -s          show status of every worktree
 `
 
 func Handle(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("requires subcommands: help, add, reclaim, merge-back")
+		return fmt.Errorf("requires subcommands: help, ls, add, exec, sync, reclaim, merge-back")
 	}
 	commd := args[0]
 	args = args[1:]
 	switch commd {
+	case "ls", "list":
+		return list(args)
 	case "add":
 		return add(args)
+	case "exec":
+		return execAll(args)
+	case "sync":
+		return syncAll(args)
 	case "reclaim":
 		return reclaim(args)
 	case "merge-back":
@@ -0,0 +1,80 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xhd2015/less-flags"
+)
+
+const execHelp = `
+Run a command in every worktree, one after another.
+
+Usage: kool git worktree exec [OPTIONS] -- <cmd> [args...]
+
+Bare and prunable worktrees are skipped. A failing command does not stop
+the others, the failed worktrees are summarized at the end.
+
+Options:
+  --linked-only        skip the main worktree
+  --fail-fast          stop at the first failure
+  -h,--help            show help message
+
+Examples:
+  kool git worktree exec -- git status -s
+  kool git worktree exec --linked-only -- go test ./...
+`
+
+func execAll(args []string) error {
+	var linkedOnly bool
+	var failFast bool
+	args, err := lessflags.Bool("--linked-only", &linkedOnly).
+		Bool("--fail-fast", &failFast).
+		Help("-h,--help", execHelp).
+		StopOnFirstArg().
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires command, usage: kool git worktree exec -- <cmd> [args...]")
+	}
+
+	worktrees, err := listWorktrees("")
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, w := range worktrees {
+		if w.Bare || w.Prunable || (linkedOnly && w.Main) {
+			continue
+		}
+		branch := w.Branch
+		if branch == "" {
+			branch = "detached " + shortHash(w.Head)
+		}
+		fmt.Printf("==> %s (%s)\n", w.Path, branch)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = w.Path
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "==> %s: %v\n", w.Path, err)
+			failed = append(failed, w.Path)
+			if failFast {
+				break
+			}
+		}
+		fmt.Println()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed in %d worktrees:\n  %s", len(failed), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
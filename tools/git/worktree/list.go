@@ -0,0 +1,279 @@
+package worktree
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	wt "github.com/xhd2015/dot-pkgs/go-pkgs/git/worktree"
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/less-flags"
+)
+
+const lsHelp = `
+List all worktrees with their branch, ahead/behind the base branch, dirty
+state, last commit age and whether kool git worktree reclaim would remove it.
+
+Usage: kool git worktree ls [OPTIONS]
+
+Ahead/behind is counted against <remote>/<base> when it exists, the ref
+kool git worktree sync rebases onto, otherwise against the local <base>.
+
+Options:
+  --base <branch>      branch to compare with (default: origin's default branch, or main/master)
+  --remote <name>      remote of the base branch (default: origin)
+  --json               print as json
+  -h,--help            show help message
+`
+
+// Worktree is one entry of git worktree list, with its status
+type Worktree struct {
+	Path       string `json:"path"`
+	Head       string `json:"head"`
+	Branch     string `json:"branch,omitempty"` // empty when detached
+	Main       bool   `json:"main,omitempty"`   // the main worktree
+	Bare       bool   `json:"bare,omitempty"`
+	Locked     bool   `json:"locked,omitempty"`
+	Prunable   bool   `json:"prunable,omitempty"`
+	Ahead      int    `json:"ahead"`
+	Behind     int    `json:"behind"`
+	Dirty      bool   `json:"dirty"`
+	LastCommit int64  `json:"last_commit"` // unix seconds
+	Reclaim    string `json:"reclaim"`     // "yes", "no: <reason>", "main", or "-" if unknown
+}
+
+func list(args []string) error {
+	var base string
+	var remote string
+	var jsonOutput bool
+	args, err := lessflags.String("--base", &base).
+		String("--remote", &remote).
+		Bool("--json", &jsonOutput).
+		Help("-h,--help", lsHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	if base == "" {
+		base, err = detectBase("")
+		if err != nil {
+			return err
+		}
+	}
+	if remote == "" {
+		remote = "origin"
+	}
+	compareRef := baseRef("", remote, base)
+	worktrees, err := listWorktrees("")
+	if err != nil {
+		return err
+	}
+	for _, w := range worktrees {
+		fillStatus(w, compareRef)
+	}
+	fillReclaim(worktrees)
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(worktrees, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	cwd, _ := os.Getwd()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PATH\tBRANCH\tVS %s\tDIRTY\tLAST COMMIT\tRECLAIM\n", strings.ToUpper(compareRef))
+	for _, w := range worktrees {
+		path := displayPath(cwd, w.Path)
+		if w.Main {
+			path += " (main)"
+		}
+		branch := w.Branch
+		if branch == "" {
+			branch = "(detached " + shortHash(w.Head) + ")"
+		}
+		dirty := ""
+		if w.Dirty {
+			dirty = "dirty"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t+%d/-%d\t%s\t%s\t%s\n", path, branch, w.Ahead, w.Behind, dirty, formatAge(w.LastCommit), w.Reclaim)
+	}
+	return tw.Flush()
+}
+
+// listWorktrees parses git worktree list --porcelain:
+//
+//	worktree /path/to/main
+//	HEAD <sha>
+//	branch refs/heads/main
+//
+//	worktree /path/to/other
+//	HEAD <sha>
+//	detached
+//	locked <reason>
+func listWorktrees(dir string) ([]*Worktree, error) {
+	output, err := gitcmd.Output(dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	var worktrees []*Worktree
+	var current *Worktree
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "worktree":
+			current = &Worktree{Path: value, Main: len(worktrees) == 0}
+			worktrees = append(worktrees, current)
+		case "HEAD":
+			if current != nil {
+				current.Head = value
+			}
+		case "branch":
+			if current != nil {
+				current.Branch = strings.TrimPrefix(value, "refs/heads/")
+			}
+		case "bare":
+			if current != nil {
+				current.Bare = true
+			}
+		case "locked":
+			if current != nil {
+				current.Locked = true
+			}
+		case "prunable":
+			if current != nil {
+				current.Prunable = true
+			}
+		}
+	}
+	return worktrees, nil
+}
+
+// fillStatus is best effort, a broken worktree just shows zero values
+func fillStatus(w *Worktree, compareRef string) {
+	if w.Bare || w.Prunable {
+		return
+	}
+	if status, err := gitcmd.Output(w.Path, "status", "--porcelain"); err == nil {
+		w.Dirty = strings.TrimSpace(status) != ""
+	}
+	if counts, err := gitcmd.Output(w.Path, "rev-list", "--left-right", "--count", "HEAD..."+compareRef); err == nil {
+		fields := strings.Fields(counts)
+		if len(fields) == 2 {
+			w.Ahead, _ = strconv.Atoi(fields[0])
+			w.Behind, _ = strconv.Atoi(fields[1])
+		}
+	}
+	if ct, err := gitcmd.Output(w.Path, "log", "-1", "--format=%ct"); err == nil {
+		w.LastCommit, _ = strconv.ParseInt(strings.TrimSpace(ct), 10, 64)
+	}
+}
+
+// fillReclaim asks reclaim in dry-run mode which worktrees it would remove
+func fillReclaim(worktrees []*Worktree) {
+	for _, w := range worktrees {
+		if w.Main {
+			w.Reclaim = "main"
+		} else {
+			w.Reclaim = "-"
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	byPath := make(map[string]*Worktree, len(worktrees))
+	for _, w := range worktrees {
+		byPath[cleanPath(w.Path)] = w
+	}
+	_, _ = wt.Reclaim(wt.ReclaimOptions{
+		Cwd:    cwd,
+		All:    true,
+		DryRun: true,
+		OnOutcome: func(outcome wt.ReclaimOutcome) {
+			w := byPath[cleanPath(outcome.Path)]
+			if w == nil {
+				return
+			}
+			switch outcome.Action {
+			case wt.ActionDryRun:
+				w.Reclaim = "yes"
+			case wt.ActionSkipped, wt.ActionError:
+				w.Reclaim = "no: " + outcome.Reason
+			}
+		},
+	})
+}
+
+// detectBase returns origin's default branch, or the first of main and
+// master that exists.
+func detectBase(dir string) (string, error) {
+	if ref, err := gitcmd.Output(dir, "symbolic-ref", "--quiet", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(ref), "refs/remotes/origin/"), nil
+	}
+	for _, branch := range []string{"main", "master"} {
+		if _, err := gitcmd.Output(dir, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch, nil
+		}
+	}
+	return "", fmt.Errorf("cannot detect the base branch, specify --base")
+}
+
+// baseRef returns <remote>/<base> when that remote-tracking branch
+// exists, otherwise the local base branch.
+func baseRef(dir string, remote string, base string) string {
+	if _, err := gitcmd.Output(dir, "rev-parse", "--verify", "--quiet", "refs/remotes/"+remote+"/"+base); err == nil {
+		return remote + "/" + base
+	}
+	return base
+}
+
+func cleanPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Clean(path)
+}
+
+func displayPath(cwd string, path string) string {
+	if cwd != "" {
+		if rel, err := filepath.Rel(cwd, path); err == nil && len(rel) < len(path) {
+			return rel
+		}
+	}
+	return path
+}
+
+func formatAge(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	d := time.Since(time.Unix(unix, 0))
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	default:
+		return fmt.Sprintf("%dw ago", int(d.Hours()/24/7))
+	}
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
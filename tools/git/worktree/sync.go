@@ -0,0 +1,172 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"github.com/xhd2015/less-flags"
+)
+
+const syncHelp = `
+Fetch the base branch, then rebase every clean worktree onto it.
+
+Usage: kool git worktree sync [OPTIONS]
+
+Dirty and detached worktrees are skipped. A rebase that conflicts is
+aborted, leaving the worktree as it was, and its conflicting files are
+listed in the summary. The worktree holding the base branch itself is
+fast-forwarded when clean.
+
+Options:
+  --base <branch>      branch to rebase onto (default: origin's default branch, or main/master)
+  --remote <name>      remote to fetch the base from (default: origin, skipped if missing)
+  --no-fetch           do not fetch, use the current remote-tracking branch
+  --dry-run            only show what would be done
+  -h,--help            show help message
+`
+
+type syncResult struct {
+	Path      string
+	Branch    string
+	Status    string // rebased, up-to-date, fast-forwarded, skipped, conflict, error
+	Detail    string
+	Conflicts []string
+}
+
+func syncAll(args []string) error {
+	var base string
+	var remote string
+	var noFetch bool
+	var dryRun bool
+	args, err := lessflags.String("--base", &base).
+		String("--remote", &remote).
+		Bool("--no-fetch", &noFetch).
+		Bool("--dry-run", &dryRun).
+		Help("-h,--help", syncHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	if base == "" {
+		base, err = detectBase("")
+		if err != nil {
+			return err
+		}
+	}
+	if remote == "" {
+		remote = "origin"
+	}
+
+	if _, err := gitcmd.Output("", "remote", "get-url", remote); err == nil && !noFetch {
+		fmt.Printf("fetching %s %s\n", remote, base)
+		if _, err := gitcmd.Output("", "fetch", remote, base); err != nil {
+			return err
+		}
+	}
+	// rebase onto the remote-tracking branch when there is one, as ls compares with it
+	onto := baseRef("", remote, base)
+
+	worktrees, err := listWorktrees("")
+	if err != nil {
+		return err
+	}
+	var results []*syncResult
+	for _, w := range worktrees {
+		if w.Bare || w.Prunable {
+			continue
+		}
+		result := syncWorktree(w, base, onto, dryRun)
+		results = append(results, result)
+		printSyncResult(result)
+	}
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	fmt.Printf("\nsynced onto %s: %d rebased, %d fast-forwarded, %d up-to-date, %d skipped, %d conflict, %d error\n",
+		onto, counts["rebased"], counts["fast-forwarded"], counts["up-to-date"], counts["skipped"], counts["conflict"], counts["error"])
+	if failed := counts["conflict"] + counts["error"]; failed > 0 {
+		return fmt.Errorf("%d worktrees need manual rebase", failed)
+	}
+	return nil
+}
+
+func syncWorktree(w *Worktree, base string, onto string, dryRun bool) *syncResult {
+	result := &syncResult{Path: w.Path, Branch: w.Branch}
+	if w.Branch == "" {
+		result.Status, result.Detail = "skipped", "detached"
+		return result
+	}
+	status, err := gitcmd.Output(w.Path, "status", "--porcelain")
+	if err != nil {
+		result.Status, result.Detail = "error", err.Error()
+		return result
+	}
+	if strings.TrimSpace(status) != "" {
+		result.Status, result.Detail = "skipped", "dirty"
+		return result
+	}
+	// nothing to do if onto is already contained
+	if _, err := gitcmd.Output(w.Path, "merge-base", "--is-ancestor", onto, "HEAD"); err == nil {
+		result.Status = "up-to-date"
+		return result
+	}
+
+	if w.Branch == base {
+		if dryRun {
+			result.Status, result.Detail = "fast-forwarded", "dry-run"
+			return result
+		}
+		if _, err := gitcmd.Output(w.Path, "merge", "--ff-only", onto); err != nil {
+			result.Status, result.Detail = "error", "cannot fast-forward, "+base+" has diverged from "+onto
+			return result
+		}
+		result.Status = "fast-forwarded"
+		return result
+	}
+
+	if dryRun {
+		result.Status, result.Detail = "rebased", "dry-run"
+		return result
+	}
+	if _, err := gitcmd.Output(w.Path, "rebase", onto); err != nil {
+		conflicts, _ := gitcmd.Output(w.Path, "diff", "--name-only", "--diff-filter=U")
+		result.Conflicts = strings.Fields(conflicts)
+		if _, abortErr := gitcmd.Output(w.Path, "rebase", "--abort"); abortErr != nil {
+			result.Status, result.Detail = "error", "rebase failed and cannot be aborted: "+abortErr.Error()
+			return result
+		}
+		if len(result.Conflicts) == 0 {
+			result.Status, result.Detail = "error", err.Error()
+			return result
+		}
+		result.Status = "conflict"
+		return result
+	}
+	result.Status = "rebased"
+	return result
+}
+
+func printSyncResult(r *syncResult) {
+	line := fmt.Sprintf("%-15s %s", r.Status+":", r.Path)
+	if r.Branch != "" {
+		line += " (" + r.Branch + ")"
+	}
+	if r.Detail != "" {
+		line += " " + r.Detail
+	}
+	if r.Status == "conflict" || r.Status == "error" {
+		fmt.Fprintln(os.Stderr, line)
+		for _, file := range r.Conflicts {
+			fmt.Fprintf(os.Stderr, "    %s\n", file)
+		}
+		return
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,171 @@
+package worktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestClone creates an upstream repo holding main with a.txt, clones
+// it and adds a worktree of branch feature, one commit ahead of main.
+// Then upstream main moves one commit ahead, fetched but not merged.
+func newTestClone(t *testing.T) (repo string, feature string) {
+	root := t.TempDir()
+	upstream := filepath.Join(root, "upstream")
+	repo = filepath.Join(root, "repo")
+	feature = filepath.Join(root, "feature")
+
+	runGit(t, root, "init", "-q", "-b", "main", upstream)
+	configUser(t, upstream)
+	writeFile(t, filepath.Join(upstream, "a.txt"), "a\n")
+	runGit(t, upstream, "add", ".")
+	runGit(t, upstream, "commit", "-q", "-m", "init")
+
+	runGit(t, root, "clone", "-q", upstream, repo)
+	configUser(t, repo)
+	runGit(t, repo, "worktree", "add", "-q", "-b", "feature", feature)
+	writeFile(t, filepath.Join(feature, "b.txt"), "b\n")
+	runGit(t, feature, "add", ".")
+	runGit(t, feature, "commit", "-q", "-m", "add b")
+
+	writeFile(t, filepath.Join(upstream, "c.txt"), "c\n")
+	runGit(t, upstream, "add", ".")
+	runGit(t, upstream, "commit", "-q", "-m", "add c")
+	runGit(t, repo, "fetch", "-q", "origin")
+	return repo, feature
+}
+
+func TestListWorktrees(t *testing.T) {
+	repo, feature := newTestClone(t)
+
+	worktrees, err := listWorktrees(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(worktrees) != 2 {
+		t.Fatalf("expect 2 worktrees, got %d", len(worktrees))
+	}
+	if !worktrees[0].Main || worktrees[0].Branch != "main" || cleanPath(worktrees[0].Path) != cleanPath(repo) {
+		t.Errorf("expect main worktree at %s, got %+v", repo, worktrees[0])
+	}
+	if worktrees[1].Main || worktrees[1].Branch != "feature" || cleanPath(worktrees[1].Path) != cleanPath(feature) {
+		t.Errorf("expect feature worktree at %s, got %+v", feature, worktrees[1])
+	}
+}
+
+func TestFillStatusComparesWithRemoteBase(t *testing.T) {
+	repo, feature := newTestClone(t)
+
+	ref := baseRef(repo, "origin", "main")
+	if ref != "origin/main" {
+		t.Fatalf("expect origin/main, got %s", ref)
+	}
+	if ref := baseRef(repo, "missing", "main"); ref != "main" {
+		t.Errorf("expect main without the remote, got %s", ref)
+	}
+
+	// local main is not behind, origin/main has one more commit
+	w := &Worktree{Path: feature, Branch: "feature"}
+	fillStatus(w, ref)
+	if w.Ahead != 1 || w.Behind != 1 || w.Dirty || w.LastCommit == 0 {
+		t.Errorf("expect +1/-1 vs origin/main, got %+v", w)
+	}
+	writeFile(t, filepath.Join(feature, "a.txt"), "changed\n")
+	w = &Worktree{Path: feature, Branch: "feature"}
+	fillStatus(w, "main")
+	if w.Ahead != 1 || w.Behind != 0 || !w.Dirty {
+		t.Errorf("expect +1/-0 vs main and dirty, got %+v", w)
+	}
+}
+
+func TestSyncWorktree(t *testing.T) {
+	repo, feature := newTestClone(t)
+	onto := baseRef(repo, "origin", "main")
+
+	result := syncWorktree(&Worktree{Path: feature, Branch: "feature"}, "main", onto, true)
+	if result.Status != "rebased" || result.Detail != "dry-run" {
+		t.Errorf("expect dry-run rebase, got %+v", result)
+	}
+	result = syncWorktree(&Worktree{Path: feature, Branch: "feature"}, "main", onto, false)
+	if result.Status != "rebased" {
+		t.Fatalf("expect rebased, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(feature, "c.txt")); err != nil {
+		t.Errorf("expect c.txt after rebase: %v", err)
+	}
+	result = syncWorktree(&Worktree{Path: feature, Branch: "feature"}, "main", onto, false)
+	if result.Status != "up-to-date" {
+		t.Errorf("expect up-to-date, got %+v", result)
+	}
+
+	result = syncWorktree(&Worktree{Path: repo, Branch: "main"}, "main", onto, false)
+	if result.Status != "fast-forwarded" {
+		t.Fatalf("expect fast-forwarded, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "c.txt")); err != nil {
+		t.Errorf("expect c.txt after fast-forward: %v", err)
+	}
+
+	result = syncWorktree(&Worktree{Path: feature}, "main", onto, false)
+	if result.Status != "skipped" || result.Detail != "detached" {
+		t.Errorf("expect detached skipped, got %+v", result)
+	}
+	writeFile(t, filepath.Join(feature, "b.txt"), "dirty\n")
+	result = syncWorktree(&Worktree{Path: feature, Branch: "feature"}, "main", onto, false)
+	if result.Status != "skipped" || result.Detail != "dirty" {
+		t.Errorf("expect dirty skipped, got %+v", result)
+	}
+}
+
+func TestSyncWorktreeAbortsConflicts(t *testing.T) {
+	repo, feature := newTestClone(t)
+	writeFile(t, filepath.Join(feature, "c.txt"), "feature\n")
+	runGit(t, feature, "add", ".")
+	runGit(t, feature, "commit", "-q", "-m", "feature c")
+	head := strings.TrimSpace(gitOutput(t, feature, "rev-parse", "HEAD"))
+
+	result := syncWorktree(&Worktree{Path: feature, Branch: "feature"}, "main", baseRef(repo, "origin", "main"), false)
+	if result.Status != "conflict" || strings.Join(result.Conflicts, ",") != "c.txt" {
+		t.Fatalf("expect conflict on c.txt, got %+v", result)
+	}
+	if got := strings.TrimSpace(gitOutput(t, feature, "rev-parse", "HEAD")); got != head {
+		t.Errorf("expect HEAD left at %s after abort, got %s", head, got)
+	}
+	if status := gitOutput(t, feature, "status", "--porcelain"); status != "" {
+		t.Errorf("expect clean worktree after abort, got %q", status)
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	gitOutput(t, dir, args...)
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return string(output)
+}
+
+func configUser(t *testing.T, dir string) {
+	t.Helper()
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "config", "user.name", "Test User")
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -263,16 +263,42 @@ func HandleReplace(args []string) error {
 	return err
 }
 
+const updateHelp = `
+Usage: kool go update [OPTIONS] [DIR]
+
+Update go.mod dependencies on local modules to their latest tags.
+
+Options:
+  --all                            update all configured local modules
+  --replaced                       update modules currently replaced by local dirs
+  --plan                           print current->latest versions, commit subjects and
+                                   breaking API changes of --all updates, change nothing
+  --apply                          apply the updates reviewed with --plan, same as --all
+  --show                           show local modules config (with --all)
+  --dir <dir>                      module directory, default is current directory
+  -h,--help                        show help message
+
+Examples:
+  kool go update ../some-lib
+  kool go update --plan
+  kool go update --apply
+`
+
 func HandleUpdate(args []string) error {
 	var replaced bool
 	var all bool
 	var show bool
+	var plan bool
+	var apply bool
 	var dirFlag string
 	args, err := lessflags.
 		Bool("--all", &all).
 		Bool("--replaced", &replaced).
 		Bool("--show", &show).
+		Bool("--plan", &plan).
+		Bool("--apply", &apply).
 		String("--dir", &dirFlag).
+		Help("-h,--help", updateHelp).
 		Parse(args)
 	if err != nil {
 		return err
@@ -281,6 +307,22 @@ func HandleUpdate(args []string) error {
 	if all && replaced {
 		return fmt.Errorf("cannot use --all and --replaced together")
 	}
+	if plan && apply {
+		return fmt.Errorf("cannot use --plan and --apply together")
+	}
+	if (plan || apply) && replaced {
+		return fmt.Errorf("cannot use --plan or --apply with --replaced")
+	}
+
+	if plan {
+		if len(args) > 0 {
+			return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+		}
+		return go_update.PlanAll(dirFlag)
+	}
+	if apply {
+		all = true
+	}
 
 	if replaced {
 		if len(args) > 0 {
@@ -0,0 +1,275 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/less-flags"
+)
+
+const affectedHelp = `
+Usage: kool go modules affected [OPTIONS] <range>
+
+List modules whose owned files changed in the given git range, plus the local
+modules depending on them transitively. File ownership follows ls-files: a file
+belongs to the innermost module containing it.
+
+Options:
+  --dir <dir>        root directory, default is current directory
+  --run <cmd>        run <cmd> with sh -c in each affected module directory
+  --json             print affected modules as JSON
+  -h,--help          show help message
+
+Examples:
+  kool go modules affected origin/main...HEAD
+  kool go modules affected --run "go test ./..." origin/main...HEAD
+  kool go modules affected --json HEAD~1
+`
+
+type AffectedModule struct {
+	Dir          string   `json:"dir"`
+	Path         string   `json:"path"`
+	Changed      bool     `json:"changed"`
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	// DependsOn lists the affected local modules this module requires directly.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+func handleAffected(w io.Writer, dir string, args []string) error {
+	var runCmd string
+	var jsonOutput bool
+	args, err := lessflags.
+		String("--dir", &dir).
+		String("--run", &runCmd).
+		Bool("--json", &jsonOutput).
+		Help("-h,--help", affectedHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires <range>, e.g. origin/main...HEAD")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args[1:], " "))
+	}
+	if dir == "" {
+		dir = "."
+	}
+	if runCmd != "" && jsonOutput {
+		return fmt.Errorf("--run is not supported with --json")
+	}
+
+	affected, err := FindAffected(dir, args[0])
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		if affected == nil {
+			affected = []AffectedModule{}
+		}
+		data, err := json.MarshalIndent(affected, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	if runCmd != "" {
+		return runInAffected(w, dir, affected, runCmd)
+	}
+	return renderAffected(w, affected)
+}
+
+// FindAffected returns the modules under root owning a file changed in
+// diffRange, together with every local module depending on them transitively.
+// diffRange is passed to git diff as is, so both A..B and A...B work.
+func FindAffected(root string, diffRange string) ([]AffectedModule, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err = filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := requireGitRepo(absRoot); err != nil {
+		return nil, err
+	}
+
+	modules, err := FindWithOptions(absRoot, FindOptions{NoTags: true})
+	if err != nil {
+		return nil, err
+	}
+	files, err := gitChangedFiles(absRoot, diffRange)
+	if err != nil {
+		return nil, err
+	}
+	return computeAffected(modules, files), nil
+}
+
+func computeAffected(modules []Module, changedFiles []string) []AffectedModule {
+	changed := make(map[string][]string)
+	for _, file := range changedFiles {
+		owner, ok := owningModuleDir(file, modules)
+		if !ok {
+			continue
+		}
+		changed[owner] = append(changed[owner], file)
+	}
+
+	dependents := make(map[string][]string, len(modules))
+	for _, module := range modules {
+		for _, dep := range module.Depends {
+			dependents[dep] = append(dependents[dep], module.Dir)
+		}
+	}
+
+	affected := make(map[string]bool, len(modules))
+	var queue []string
+	for dir := range changed {
+		affected[dir] = true
+		queue = append(queue, dir)
+	}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[dir] {
+			if affected[dependent] {
+				continue
+			}
+			affected[dependent] = true
+			queue = append(queue, dependent)
+		}
+	}
+
+	var result []AffectedModule
+	for _, module := range modules {
+		if !affected[module.Dir] {
+			continue
+		}
+		files := changed[module.Dir]
+		sort.Strings(files)
+		item := AffectedModule{
+			Dir:          module.Dir,
+			Path:         module.Path,
+			Changed:      len(files) > 0,
+			ChangedFiles: files,
+		}
+		for _, dep := range module.Depends {
+			if affected[dep] {
+				item.DependsOn = append(item.DependsOn, dep)
+			}
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Dir < result[j].Dir
+	})
+	return result
+}
+
+// owningModuleDir picks the innermost module containing file, which is the
+// same as excluding nested modules from the outer one.
+func owningModuleDir(file string, modules []Module) (string, bool) {
+	var owner string
+	ownerLen := -1
+	for _, module := range modules {
+		if !isFileInModule(file, module.Dir) {
+			continue
+		}
+		dirLen := len(module.Dir)
+		if module.Dir == "." {
+			dirLen = 0
+		}
+		if dirLen > ownerLen {
+			owner = module.Dir
+			ownerLen = dirLen
+		}
+	}
+	return owner, ownerLen >= 0
+}
+
+func gitChangedFiles(root string, diffRange string) ([]string, error) {
+	// --no-renames reports both sides of a rename, so a file moved
+	// between modules affects both of them.
+	args := []string{"diff", "--name-only", "--no-renames", "--relative", "-z", diffRange, "--"}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	output, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		return nil, formatCmdError("git", args, err, stderr)
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file == "" {
+			continue
+		}
+		files = append(files, filepath.ToSlash(filepath.Clean(file)))
+	}
+	return files, nil
+}
+
+func renderAffected(w io.Writer, affected []AffectedModule) error {
+	for _, module := range affected {
+		line := module.Dir + " " + module.Path
+		var parts []string
+		if module.Changed {
+			fileWord := "file"
+			if len(module.ChangedFiles) != 1 {
+				fileWord = "files"
+			}
+			parts = append(parts, fmt.Sprintf("changed: %d %s", len(module.ChangedFiles), fileWord))
+		}
+		if len(module.DependsOn) > 0 {
+			parts = append(parts, "depends on: "+strings.Join(module.DependsOn, ", "))
+		}
+		if len(parts) > 0 {
+			line += " [" + strings.Join(parts, "; ") + "]"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runInAffected(w io.Writer, root string, affected []AffectedModule, command string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if len(affected) == 0 {
+		fmt.Fprintln(os.Stderr, "no affected modules")
+		return nil
+	}
+
+	var failed []string
+	for _, module := range affected {
+		moduleDir := absModuleDir(absRoot, module.Dir)
+		fmt.Fprintf(os.Stderr, "==> %s: %s\n", module.Dir, command)
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Dir = moduleDir
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "==> %s: %v\n", module.Dir, err)
+			failed = append(failed, module.Dir)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("command failed in %d of %d modules: %s", len(failed), len(affected), strings.Join(failed, ", "))
+	}
+	return nil
+}
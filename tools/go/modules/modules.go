@@ -21,6 +21,7 @@ Usage: kool go modules [OPTIONS] [COMMAND]
 
 Commands:
   ls-files           list files owned by a module
+  affected <range>   list modules affected by changes in a git range
   update-local-deps  tag local modules and update local dependency versions
 
 Options:
@@ -76,6 +77,11 @@ func handle(w io.Writer, args []string) error {
 				return fmt.Errorf("--list is not supported with ls-files")
 			}
 			return handleLsFiles(w, dir, args[1:])
+		case "affected":
+			if list {
+				return fmt.Errorf("--list is not supported with affected")
+			}
+			return handleAffected(w, dir, args[1:])
 		case "update-local-deps":
 			if noTags {
 				return fmt.Errorf("--no-tags is not supported with update-local-deps")
@@ -208,6 +208,48 @@ func TestListModuleFiles(t *testing.T) {
 	}
 }
 
+func TestComputeAffected(t *testing.T) {
+	modules := []Module{
+		{Dir: ".", Path: "example.com/root", Depends: []string{"app"}},
+		{Dir: "app", Path: "example.com/app", Depends: []string{"types"}},
+		{Dir: "tools", Path: "example.com/tools"},
+		{Dir: "types", Path: "example.com/types"},
+		{Dir: "types/inner", Path: "example.com/types/inner"},
+	}
+
+	got := computeAffected(modules, []string{"types/inner/inner.go", "types/types.go", "README.md"})
+	want := []AffectedModule{
+		{Dir: ".", Path: "example.com/root", Changed: true, ChangedFiles: []string{"README.md"}, DependsOn: []string{"app"}},
+		{Dir: "app", Path: "example.com/app", DependsOn: []string{"types"}},
+		{Dir: "types", Path: "example.com/types", Changed: true, ChangedFiles: []string{"types/types.go"}},
+		{Dir: "types/inner", Path: "example.com/types/inner", Changed: true, ChangedFiles: []string{"types/inner/inner.go"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("affected mismatch\nwant: %#v\n got: %#v", want, got)
+	}
+
+	got = computeAffected(modules, []string{"types/inner/inner.go"})
+	want = []AffectedModule{
+		{Dir: "types/inner", Path: "example.com/types/inner", Changed: true, ChangedFiles: []string{"types/inner/inner.go"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("nested module change should not affect its parent\nwant: %#v\n got: %#v", want, got)
+	}
+
+	var buf bytes.Buffer
+	if err := renderAffected(&buf, computeAffected(modules, []string{"types/types.go"})); err != nil {
+		t.Fatal(err)
+	}
+	wantOutput := strings.TrimLeft(`
+. example.com/root [depends on: app]
+app example.com/app [depends on: types]
+types example.com/types [changed: 1 file]
+`, "\n")
+	if buf.String() != wantOutput {
+		t.Fatalf("render mismatch\nwant:\n%s\ngot:\n%s", wantOutput, buf.String())
+	}
+}
+
 func TestUpdateLocalDepsOldFlagsAreRejected(t *testing.T) {
 	var buf bytes.Buffer
 	err := handle(&buf, []string{"--update-local-deps"})
@@ -1,11 +1,18 @@
 package run
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/xhd2015/kool/tools/dlv"
+	"github.com/xhd2015/kool/tools/watch"
 	"github.com/xhd2015/less-flags"
 	"github.com/xhd2015/xgo/cmd/xgo/pathsum"
 	"github.com/xhd2015/xgo/support/cmd"
@@ -46,6 +53,7 @@ kool debug go run <cmd> [OPTIONS]
 
 Debug options:
   --stdin                          pass stdin to the debugged program (default: false)
+  --restart-on-change              rebuild and relaunch under dlv on file changes, keeping the listen port
   --debug-cwd <dir>                set the debug working directory (default: current working directory)
   -debug,--debug                   enable debug mode (default: false)
   -debug-wd,--debug-wd             set the debug working directory (default: current working directory)
@@ -55,6 +63,7 @@ Debug options:
 Examples:
   kool debug go run ./
   kool debug go run --stdin ./
+  kool debug go run --restart-on-change ./
 `
 
 func HandleOpts(args []string, opts Options) error {
@@ -66,9 +75,11 @@ func HandleOpts(args []string, opts Options) error {
 	var debugCwd string
 	var gcflags []string
 	var passStdin bool
+	var restartOnChange bool
 
 	fb := lessflags.
 		Bool("--stdin", &passStdin).
+		Bool("--restart-on-change", &restartOnChange).
 		StringSlice("-gcflags,--gcflags", &gcflags).
 		Help("-h,--help", debugHelp)
 
@@ -114,10 +125,22 @@ func HandleOpts(args []string, opts Options) error {
 		buildArgs = append(buildArgs, "-gcflags=all=-N -l")
 	}
 	buildArgs = append(buildArgs, "-o", debugBin)
+	var pkg string
 	if len(remainArgs) > 0 {
-		buildArgs = append(buildArgs, remainArgs[0])
+		pkg = remainArgs[0]
+		buildArgs = append(buildArgs, pkg)
 		remainArgs = remainArgs[1:]
 	}
+	debugOpts := DebugOptions{
+		Cwd:       debugCwd,
+		PassStdin: passStdin,
+	}
+	if restartOnChange {
+		if !debugMode {
+			return fmt.Errorf("--restart-on-change requires debug mode")
+		}
+		return debugRestartOnChange(buildArgs, debugBin, pkg, remainArgs, debugOpts)
+	}
 	err = cmd.Debug().Run("go", buildArgs...)
 	if err != nil {
 		return err
@@ -125,10 +148,7 @@ func HandleOpts(args []string, opts Options) error {
 	if !debugMode {
 		return cmd.Debug().Dir(debugCwd).Run(debugBin, remainArgs...)
 	}
-	return DebugBinary(debugBin, remainArgs, DebugOptions{
-		Cwd:       debugCwd,
-		PassStdin: passStdin,
-	})
+	return DebugBinary(debugBin, remainArgs, debugOpts)
 }
 
 type DebugOptions struct {
@@ -166,3 +186,128 @@ func getConsistentBuildDir() (string, error) {
 	}
 	return filepath.Join(os.TempDir(), "kool-go-build", sum), nil
 }
+
+// debugRestartOnChange keeps a dlv session on one port: on each file
+// change under the main module it rebuilds, and only
+// when the build succeeds it stops the old session and starts a new one.
+func debugRestartOnChange(buildArgs []string, debugBin string, pkg string, args []string, opts DebugOptions) error {
+	port, err := netutil.FindListenablePort("localhost", 2345)
+	if err != nil {
+		return err
+	}
+	watchDir, err := watchRoot(pkg)
+	if err != nil {
+		return err
+	}
+
+	session := &debugSession{
+		build: func() error {
+			return cmd.Debug().Run("go", buildArgs...)
+		},
+		start: func() (*exec.Cmd, error) {
+			return dlv.Start(debugBin, dlv.DebugOptions{
+				Dir:       opts.Cwd,
+				Port:      port,
+				Args:      args,
+				PassStdin: opts.PassStdin,
+			})
+		},
+		stop: func(running *exec.Cmd) {
+			dlv.Stop(running)
+			waitPortReleased(port, 5*time.Second)
+		},
+	}
+	err = watch.Watch(watch.WatchOptions{
+		Dir:      watchDir,
+		Throttle: 1 * time.Second,
+		Include:  []string{"*.go", "go.mod", "go.sum"},
+	}, session.restart)
+	session.close()
+	return err
+}
+
+// debugSession is the dlv process restarted by debugRestartOnChange
+type debugSession struct {
+	build func() error
+	start func() (*exec.Cmd, error)
+	stop  func(running *exec.Cmd)
+
+	mutex   sync.Mutex
+	running *exec.Cmd
+}
+
+func (s *debugSession) restart(changedFiles []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.build()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "build failed, keep previous session: %v\n", err)
+		return
+	}
+	if s.running != nil {
+		s.stop(s.running)
+		s.running = nil
+	}
+	s.running, err = s.start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start dlv: %v\n", err)
+	}
+}
+
+func (s *debugSession) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running != nil {
+		s.stop(s.running)
+		s.running = nil
+	}
+}
+
+// watchRoot returns the root of the module containing the package built
+// by go build pkg, which may be a package path or .go files, so changes
+// in any package of the module it imports trigger a rebuild. Outside a
+// module it is the package directory.
+func watchRoot(pkg string) (string, error) {
+	if pkg == "" {
+		pkg = "."
+	}
+	dir, err := goOutput("", "list", "-f", "{{.Dir}}", pkg)
+	if err != nil {
+		return "", err
+	}
+	// .Module is not set for .go files, ask go env from the package dir instead
+	goMod, err := goOutput(dir, "env", "GOMOD")
+	if err != nil {
+		return "", err
+	}
+	if goMod == "" || goMod == os.DevNull {
+		return dir, nil
+	}
+	return filepath.Dir(goMod), nil
+}
+
+func goOutput(dir string, args ...string) (string, error) {
+	c := exec.Command("go", args...)
+	c.Dir = dir
+	output, err := c.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("go %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func waitPortReleased(port int, timeout time.Duration) {
+	addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		serving, err := netutil.IsTCPAddrServing(addr, 20*time.Millisecond)
+		if err != nil || !serving {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,92 @@
+package run
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDebugSessionRestart(t *testing.T) {
+	var events []string
+	buildErr := error(nil)
+	starts := 0
+	session := &debugSession{
+		build: func() error {
+			events = append(events, "build")
+			return buildErr
+		},
+		start: func() (*exec.Cmd, error) {
+			starts++
+			name := "session" + strconv.Itoa(starts)
+			events = append(events, "start "+name)
+			return exec.Command(name), nil
+		},
+		stop: func(running *exec.Cmd) {
+			events = append(events, "stop "+running.Args[0])
+		},
+	}
+
+	// the initial call of watch.Watch
+	session.restart(nil)
+	// a change that breaks the build keeps session1
+	buildErr = errors.New("syntax error")
+	session.restart([]string{"main.go"})
+	// the fix replaces session1 with session2
+	buildErr = nil
+	session.restart([]string{"main.go"})
+	session.close()
+	// closing twice does not stop again
+	session.close()
+
+	want := []string{
+		"build",
+		"start session1",
+		"build",
+		"build",
+		"stop session1",
+		"start session2",
+		"stop session2",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("events mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(events, "\n"))
+	}
+}
+
+func TestWatchRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.21\n")
+	writeFile(t, filepath.Join(dir, "cmd", "app", "main.go"), "package main\n\nimport _ \"example.com/app/lib\"\n\nfunc main() {}\n")
+	writeFile(t, filepath.Join(dir, "lib", "lib.go"), "package lib\n")
+	t.Chdir(dir)
+
+	wantDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range []string{"./cmd/app", "example.com/app/cmd/app", "./cmd/app/main.go"} {
+		got, err := watchRoot(pkg)
+		if err != nil {
+			t.Fatalf("watchRoot(%q): %v", pkg, err)
+		}
+		if got, _ = filepath.EvalSymlinks(got); got != wantDir {
+			t.Errorf("watchRoot(%q) = %s, want %s", pkg, got, wantDir)
+		}
+	}
+	if _, err := watchRoot("./missing"); err == nil {
+		t.Errorf("expect error for a missing package")
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
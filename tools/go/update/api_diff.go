@@ -0,0 +1,302 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"golang.org/x/tools/go/packages"
+)
+
+// APIChange describes one difference in the exported API of a module
+// between two versions. Object is "<pkg>.<name>" or "<pkg>.<type>.<member>",
+// where <pkg> is the package directory relative to the module root, empty
+// for the root package, e.g. ".New" or "conf.Config.Name".
+type APIChange struct {
+	Kind   string // "removed", "changed" or "added"
+	Object string
+	Old    string
+	New    string
+	// Incompatible is set for removals, changes and methods added to an
+	// existing interface, which break its implementations.
+	Incompatible bool
+}
+
+func (c APIChange) Breaking() bool {
+	return c.Incompatible
+}
+
+func (c APIChange) String() string {
+	switch c.Kind {
+	case "removed":
+		return fmt.Sprintf("removed %s: %s", c.Object, c.Old)
+	case "changed":
+		return fmt.Sprintf("changed %s: %s -> %s", c.Object, c.Old, c.New)
+	default:
+		return fmt.Sprintf("added %s: %s", c.Object, c.New)
+	}
+}
+
+// CompareModuleAPIAtRefs compares the exported API of the module in
+// moduleDir between two git refs, in the spirit of apidiff: removing
+// or changing an exported identifier is breaking, adding one is not.
+func CompareModuleAPIAtRefs(moduleDir string, oldRef string, newRef string) (*APIReport, error) {
+	oldDir, err := extractModuleAtRef(moduleDir, oldRef)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(oldDir)
+	newDir, err := extractModuleAtRef(moduleDir, newRef)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(newDir)
+	return CompareModuleAPI(oldDir, newDir)
+}
+
+// APIReport is the result of comparing the API of two versions of a module.
+type APIReport struct {
+	Changes []APIChange
+	// Unresolved lists the packages, on either side, whose imports could
+	// not all be resolved, so changes in their types may be missed.
+	Unresolved []string
+}
+
+// CompareModuleAPI compares the exported API of two checkouts of the same module.
+func CompareModuleAPI(oldDir string, newDir string) (*APIReport, error) {
+	oldAPI, oldUnresolved, err := loadModuleAPI(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newAPI, newUnresolved, err := loadModuleAPI(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []APIChange
+	for name, oldDesc := range oldAPI {
+		newDesc, ok := newAPI[name]
+		if !ok {
+			changes = append(changes, APIChange{Kind: "removed", Object: name, Old: oldDesc, Incompatible: true})
+			continue
+		}
+		if newDesc != oldDesc {
+			changes = append(changes, APIChange{Kind: "changed", Object: name, Old: oldDesc, New: newDesc, Incompatible: true})
+		}
+	}
+	for name, newDesc := range newAPI {
+		if _, ok := oldAPI[name]; ok {
+			continue
+		}
+		change := APIChange{Kind: "added", Object: name, New: newDesc}
+		if idx := strings.LastIndex(name, "."); idx >= 0 {
+			parent := oldAPI[name[:idx]]
+			change.Incompatible = strings.HasPrefix(parent, "type ") && strings.HasSuffix(parent, " interface")
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Breaking() != changes[j].Breaking() {
+			return changes[i].Breaking()
+		}
+		return changes[i].Object < changes[j].Object
+	})
+	return &APIReport{
+		Changes:    changes,
+		Unresolved: mergeSorted(oldUnresolved, newUnresolved),
+	}, nil
+}
+
+func mergeSorted(a []string, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var merged []string
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			merged = append(merged, s)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// extractModuleAtRef writes the module subtree of moduleDir at ref into a
+// temp dir, using git archive so the worktree is left untouched.
+func extractModuleAtRef(moduleDir string, ref string) (string, error) {
+	prefix, err := gitcmd.Output(moduleDir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	topLevel, err := gitcmd.Output(moduleDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	treeish := ref + ":" + strings.TrimSuffix(strings.TrimSpace(prefix), "/")
+	cmd := exec.Command("git", "archive", "--format=tar", treeish)
+	cmd.Dir = strings.TrimSpace(topLevel)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git archive %s: %w: %s", treeish, err, strings.TrimSpace(stderr.String()))
+	}
+
+	tmpDir, err := os.MkdirTemp("", "kool-go-update-api-")
+	if err != nil {
+		return "", err
+	}
+	if err := untar(bytes.NewReader(data), tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	return tmpDir, nil
+}
+
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// only regular files matter for type checking
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// loadModuleAPI type-checks each public package of the module rooted at
+// dir with go/packages and returns a description of every exported
+// identifier. Packages whose imports cannot be resolved, e.g. a dependency
+// missing from the module cache, are still described with their invalid
+// types and returned in unresolved, as their changes may be missed.
+func loadModuleAPI(dir string) (api map[string]string, unresolved []string, err error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedModule,
+		Dir:  dir,
+		Env:  append(os.Environ(), "GOWORK=off"),
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, nil, fmt.Errorf("load packages: %w", err)
+	}
+	api = make(map[string]string)
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" || pkg.Types == nil || pkg.Module == nil {
+			continue
+		}
+		relPkg := "."
+		if pkg.PkgPath != pkg.Module.Path {
+			relPkg = strings.TrimPrefix(pkg.PkgPath, pkg.Module.Path+"/")
+		}
+		if isInternalPkg(relPkg) {
+			continue
+		}
+		if len(pkg.Errors) > 0 {
+			unresolved = append(unresolved, relPkg)
+		}
+		collectPackageAPI(pkg.Types, relPkg, api)
+	}
+	sort.Strings(unresolved)
+	return api, unresolved, nil
+}
+
+func isInternalPkg(relPkg string) bool {
+	for _, elem := range strings.Split(relPkg, "/") {
+		if elem == "internal" {
+			return true
+		}
+	}
+	return false
+}
+
+func collectPackageAPI(pkg *types.Package, relPkg string, api map[string]string) {
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	// the root package is keyed as ".", its name may equal a subdirectory
+	prefix := relPkg
+	if prefix == "." {
+		prefix = ""
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		key := prefix + "." + name
+		api[key] = types.ObjectString(obj, qualifier)
+
+		typeName, ok := obj.(*types.TypeName)
+		if !ok {
+			continue
+		}
+		named, ok := typeName.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		// members are recorded one by one below, so adding a field
+		// does not count as changing the type itself
+		switch named.Underlying().(type) {
+		case *types.Struct:
+			api[key] = "type " + name + " struct"
+		case *types.Interface:
+			api[key] = "type " + name + " interface"
+		}
+		for i := 0; i < named.NumMethods(); i++ {
+			m := named.Method(i)
+			if m.Exported() {
+				api[key+"."+m.Name()] = types.ObjectString(m, qualifier)
+			}
+		}
+		switch under := named.Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < under.NumFields(); i++ {
+				f := under.Field(i)
+				if f.Exported() {
+					api[key+"."+f.Name()] = types.ObjectString(f, qualifier)
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < under.NumMethods(); i++ {
+				m := under.Method(i)
+				if m.Exported() {
+					api[key+"."+m.Name()] = types.ObjectString(m, qualifier)
+				}
+			}
+		}
+	}
+}
@@ -23,35 +23,50 @@ type ModuleUpdateInfo struct {
 
 // UpdateAll reads the config, gets the LocalModules list, and updates dependencies to latest local tags
 func UpdateAll(dir string) error {
-	config, err := goconfig.GetLocalModulesConfig()
+	// Phase 1: Check and collect all module update info
+	updateInfos, err := collectAllUpdateInfos(dir)
 	if err != nil {
 		return err
 	}
+	if len(updateInfos) == 0 {
+		return nil
+	}
+
+	// Phase 2: Execute updates
+	return executeModuleUpdates(dir, updateInfos)
+}
+
+// collectAllUpdateInfos collects update information for every configured local module
+// and local replacement that has a newer tag. It prints why nothing is returned.
+func collectAllUpdateInfos(dir string) ([]ModuleUpdateInfo, error) {
+	config, err := goconfig.GetLocalModulesConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	if len(config.LocalModules) == 0 {
 		fmt.Printf("No local modules configured\n")
-		return nil
+		return nil, nil
 	}
 
 	// Get current directory's go.mod info
 	currentModInfo, err := resolve.GetModuleInfo(dir)
 	if err != nil {
-		return fmt.Errorf("failed to get current module info: %w", err)
+		return nil, fmt.Errorf("failed to get current module info: %w", err)
 	}
 
 	// Collect from existing replacements
 	replaceInfos, err := collectReplacementUpdateInfos(currentModInfo)
 	if err != nil {
-		return fmt.Errorf("failed to collect replacement info: %w", err)
+		return nil, fmt.Errorf("failed to collect replacement info: %w", err)
 	}
 
-	// Phase 1: Check and collect all module update info
 	var updateInfos []ModuleUpdateInfo
 
 	// Resolve all local modules and their dependency status
 	_, resolvedModules, err := resolve.ResolveLocalModules(dir, config.LocalModules)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Collect update info from resolved modules
@@ -76,11 +91,9 @@ func UpdateAll(dir string) error {
 
 	if len(updateInfos) == 0 {
 		fmt.Printf("No modules to update\n")
-		return nil
+		return nil, nil
 	}
-
-	// Phase 2: Execute updates
-	return executeModuleUpdates(dir, updateInfos)
+	return updateInfos, nil
 }
 
 // buildModuleUpdateInfo builds update information from a resolved local module
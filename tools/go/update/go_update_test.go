@@ -192,6 +192,9 @@ func hasReplace(modInfo *resolve.ModuleInfo, modulePath string) bool {
 
 func writeFile(t *testing.T, path string, content string) {
 	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
 	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 		t.Fatal(err)
 	}
@@ -222,3 +225,167 @@ func withDir(t *testing.T, dir string, fn func()) {
 	}()
 	fn()
 }
+
+func TestCompareModuleAPI(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	writeFile(t, filepath.Join(oldDir, "go.mod"), "module example.com/lib\n")
+	writeFile(t, filepath.Join(newDir, "go.mod"), "module example.com/lib\n")
+	writeFile(t, filepath.Join(oldDir, "lib.go"), `package lib
+
+type Client struct {
+	Name string
+	Addr string
+}
+
+func (c *Client) Do(n int) error { return nil }
+
+type Doer interface {
+	Do(n int) error
+}
+
+func New(name string) *Client { return nil }
+
+func Remove() {}
+
+func internalHelper() {}
+`)
+	writeFile(t, filepath.Join(newDir, "lib.go"), `package lib
+
+type Client struct {
+	Name string
+	Port int
+}
+
+func (c *Client) Do(n int) error { return nil }
+
+type Doer interface {
+	Do(n int) error
+	Close() error
+}
+
+func New(name string, port int) *Client { return nil }
+
+func Added() {}
+
+func internalHelper(x int) {}
+`)
+
+	report, err := CompareModuleAPI(oldDir, newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range report.Changes {
+		got = append(got, change.Kind+" "+change.Object)
+	}
+	want := []string{
+		"removed .Client.Addr",
+		"added .Doer.Close",
+		"changed .New",
+		"removed .Remove",
+		"added .Added",
+		"added .Client.Port",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("API changes mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCompareModuleAPIResolvesModuleImports(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	for _, dir := range []string{oldDir, newDir} {
+		writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/lib\n\ngo 1.21\n")
+		writeFile(t, filepath.Join(dir, "lib.go"), `package lib
+
+import "example.com/lib/conf"
+
+var Default = conf.New()
+`)
+	}
+	writeFile(t, filepath.Join(oldDir, "conf", "conf.go"), `package conf
+
+type Config struct{}
+
+func New() *Config { return nil }
+`)
+	writeFile(t, filepath.Join(newDir, "conf", "conf.go"), `package conf
+
+type Config struct{}
+
+type Options struct{}
+
+func New() *Options { return nil }
+`)
+
+	report, err := CompareModuleAPI(oldDir, newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unresolved) > 0 {
+		t.Fatalf("expect no unresolved packages, got %v", report.Unresolved)
+	}
+	var got []string
+	for _, change := range report.Changes {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"changed conf.New: func New() *Config -> func New() *Options",
+		"changed .Default: var Default *conf.Config -> var Default *conf.Options",
+		"added conf.Options: type Options struct",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("API changes mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCompareModuleAPIRootPackageNamedLikeSubdir(t *testing.T) {
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	for _, dir := range []string{oldDir, newDir} {
+		writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/lib\n\ngo 1.21\n")
+		writeFile(t, filepath.Join(dir, "lib.go"), "package lib\n\nfunc New() {}\n")
+	}
+	writeFile(t, filepath.Join(oldDir, "lib", "lib.go"), "package lib\n\nfunc New() {}\n")
+	writeFile(t, filepath.Join(newDir, "lib", "lib.go"), "package lib\n\nfunc New(n int) {}\n")
+
+	report, err := CompareModuleAPI(oldDir, newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range report.Changes {
+		got = append(got, change.String())
+	}
+	want := "changed lib.New: func New() -> func New(n int)"
+	if strings.Join(got, "\n") != want {
+		t.Fatalf("expect only the subpackage to change\nwant:\n%s\ngot:\n%s", want, strings.Join(got, "\n"))
+	}
+}
+
+func TestCompareModuleAPIReportsUnresolved(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/lib\n\ngo 1.21\n")
+	writeFile(t, filepath.Join(dir, "lib.go"), `package lib
+
+import "example.com/missing/dep"
+
+var Default = dep.New()
+`)
+	writeFile(t, filepath.Join(dir, "util", "util.go"), `package util
+
+func Name() string { return "" }
+`)
+
+	report, err := CompareModuleAPI(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 0 {
+		t.Fatalf("expect no changes, got %v", report.Changes)
+	}
+	if strings.Join(report.Unresolved, ",") != "." {
+		t.Fatalf("expect unresolved [.], got %v", report.Unresolved)
+	}
+}
@@ -0,0 +1,162 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+	"golang.org/x/mod/module"
+)
+
+// ModuleUpdatePlan holds what a reviewer needs before bumping one module
+type ModuleUpdatePlan struct {
+	Info       ModuleUpdateInfo
+	FromRef    string      // git ref of the current version, empty if unknown
+	Commits    []string    // "<short hash> <subject>" from FromRef to LatestTag touching the module dir
+	APIChanges []APIChange // exported API differences between FromRef and LatestTag
+	APIChecked bool
+	Notes      []string // reasons some information could not be computed
+}
+
+// PlanAll prints, for every local module UpdateAll would bump, the version
+// change, the commit subjects in between and breaking API changes. Nothing
+// is modified.
+func PlanAll(dir string) error {
+	updateInfos, err := collectAllUpdateInfos(dir)
+	if err != nil {
+		return err
+	}
+	if len(updateInfos) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Planned updates for %d module(s):\n", len(updateInfos))
+	for _, info := range updateInfos {
+		plan := buildUpdatePlan(info)
+		fmt.Println()
+		if err := renderUpdatePlan(os.Stdout, plan); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("\nRun 'kool go update --apply' to apply these updates.\n")
+	return nil
+}
+
+func buildUpdatePlan(info ModuleUpdateInfo) ModuleUpdatePlan {
+	plan := ModuleUpdatePlan{Info: info}
+	if info.CurrentVersion == "" {
+		plan.Notes = append(plan.Notes, "no current version, skipping changelog and API check")
+		return plan
+	}
+
+	fromRef := currentVersionRef(info)
+	if !gitRefExists(info.LocalPath, fromRef) {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%s not found in %s, skipping changelog and API check", fromRef, info.LocalPath))
+		return plan
+	}
+	plan.FromRef = fromRef
+
+	commits, err := moduleCommitSubjects(info.LocalPath, fromRef, info.LatestTag)
+	if err != nil {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("changelog: %v", err))
+	}
+	plan.Commits = commits
+
+	report, err := CompareModuleAPIAtRefs(info.LocalPath, fromRef, info.LatestTag)
+	if err != nil {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("API check: %v", err))
+		return plan
+	}
+	plan.APIChecked = true
+	plan.APIChanges = report.Changes
+	if len(report.Unresolved) > 0 {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("API check: unresolved imports in %s, changes there may be missed", strings.Join(report.Unresolved, ", ")))
+	}
+	return plan
+}
+
+// currentVersionRef maps the version required in go.mod back to a ref in the
+// local repo: the commit of a pseudo-version, otherwise the prefixed tag.
+func currentVersionRef(info ModuleUpdateInfo) string {
+	version := strings.TrimSuffix(info.CurrentVersion, "+incompatible")
+	if module.IsPseudoVersion(version) {
+		if rev, err := module.PseudoVersionRev(version); err == nil {
+			return rev
+		}
+	}
+	prefix := strings.TrimSuffix(info.LatestTag, info.LatestVersion)
+	return prefix + version
+}
+
+func moduleCommitSubjects(moduleDir string, fromRef string, toRef string) ([]string, error) {
+	output, err := gitcmd.Output(moduleDir, "log", "--format=%h %s", fromRef+".."+toRef, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	var commits []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+func renderUpdatePlan(w io.Writer, plan ModuleUpdatePlan) error {
+	info := plan.Info
+	from := info.CurrentVersion
+	if from == "" {
+		from = "<none>"
+	}
+	header := fmt.Sprintf("%s %s -> %s", info.ModulePath, from, info.LatestVersion)
+	if info.IsReplacement {
+		header += " (drops local replace)"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, header)
+
+	if plan.FromRef != "" {
+		commitWord := "commit"
+		if len(plan.Commits) != 1 {
+			commitWord = "commits"
+		}
+		fmt.Fprintf(&buf, "  %d %s in %s..%s:\n", len(plan.Commits), commitWord, plan.FromRef, info.LatestTag)
+		for _, commit := range plan.Commits {
+			fmt.Fprintf(&buf, "    %s\n", commit)
+		}
+	}
+	if plan.APIChecked {
+		var breaking, added []APIChange
+		for _, change := range plan.APIChanges {
+			if change.Breaking() {
+				breaking = append(breaking, change)
+			} else {
+				added = append(added, change)
+			}
+		}
+		if len(breaking) > 0 {
+			fmt.Fprintf(&buf, "  API: %d BREAKING change(s), %d addition(s)\n", len(breaking), len(added))
+			for _, change := range breaking {
+				fmt.Fprintf(&buf, "    %s\n", change)
+			}
+		} else {
+			fmt.Fprintf(&buf, "  API: compatible, %d addition(s)\n", len(added))
+		}
+	}
+	for _, note := range plan.Notes {
+		fmt.Fprintf(&buf, "  note: %s\n", note)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func gitRefExists(dir string, ref string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
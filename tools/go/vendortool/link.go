@@ -20,6 +20,9 @@ Commands:
   link --all                           link all local modules from config
   unlink <target_dir>
   unlink --all                         unlink all local modules from config
+  status                               show linked, stale and missing local modules
+  verify                               check symlinked modules against vendor/modules.txt
+  repair                               restore __old backups left behind
 `
 
 // rename old path to {old path}__old, and create new symlink
@@ -40,6 +43,12 @@ func Handle(args []string) error {
 		return HandleLink(args)
 	case "unlink":
 		return HandleUnlink(args)
+	case "status":
+		return HandleStatus(args)
+	case "verify":
+		return HandleVerify(args)
+	case "repair":
+		return HandleRepair(args)
 	default:
 		return fmt.Errorf("unrecognized command: %s", cmd)
 	}
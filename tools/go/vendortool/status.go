@@ -0,0 +1,651 @@
+package vendortool
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	goconfig "github.com/xhd2015/kool/tools/go/config"
+	"github.com/xhd2015/kool/tools/go/resolve"
+	"github.com/xhd2015/less-flags"
+	"golang.org/x/mod/modfile"
+)
+
+const oldSuffix = "__old"
+
+// vendor states reported by status
+const (
+	StateLinked   = "linked"   // symlink to an existing local module
+	StateStale    = "stale"    // broken symlink, link to another dir, or a backup left behind
+	StateMissing  = "missing"  // configured dependency absent from vendor or modules.txt
+	StateVendored = "vendored" // regular vendored copy
+)
+
+// VendorModuleStatus describes one module under vendor/
+type VendorModuleStatus struct {
+	ModulePath string
+	State      string
+	Target     string // symlink target, if linked
+	HasBackup  bool   // vendor/<mod>__old exists
+	InModules  bool   // listed in vendor/modules.txt
+	Details    []string
+}
+
+const statusHelp = `
+Show which local modules are linked into the vendor directory.
+
+Each module is reported as:
+  linked     vendor/<mod> is a symlink to an existing directory
+  stale      broken symlink, symlink to another dir than configured,
+             or a __old backup left behind without symlink
+  missing    a configured local dependency absent from vendor/ or modules.txt
+  vendored   a regular vendored copy
+
+Usage: kool go vendor status [OPTIONS]
+
+Options:
+  -h,--help            show help message
+  --dir <dir>          set the directory containing vendor
+
+Examples:
+  kool go vendor status
+`
+
+func HandleStatus(args []string) error {
+	var dir string
+	args, err := lessflags.
+		String("--dir", &dir).
+		Help("-h,--help", statusHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	statuses, err := Status(dir)
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		fmt.Printf("No linked or configured local modules in vendor\n")
+		return nil
+	}
+	for _, st := range statuses {
+		line := fmt.Sprintf("%-9s %s", st.State, st.ModulePath)
+		if st.Target != "" {
+			line += " -> " + st.Target
+		}
+		fmt.Println(line)
+		for _, detail := range st.Details {
+			fmt.Printf("          %s\n", detail)
+		}
+	}
+	return nil
+}
+
+// Status reports every vendor symlink, every __old backup and every
+// configured local module that is a dependency.
+func Status(dir string) ([]*VendorModuleStatus, error) {
+	vendorDir := filepath.Join(dir, "vendor")
+	if err := validateVendorDir(vendorDir); err != nil {
+		return nil, err
+	}
+	modulesTxt, err := readModulesTxt(vendorDir)
+	if err != nil {
+		return nil, err
+	}
+	links, backups, err := scanVendor(vendorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	configured := make(map[string]string)
+	if config, err := goconfig.GetLocalModulesConfig(); err == nil && len(config.LocalModules) > 0 {
+		resolveDir := dir
+		if resolveDir == "" {
+			resolveDir = "."
+		}
+		_, resolvedModules, err := resolve.ResolveLocalModules(resolveDir, config.LocalModules)
+		if err != nil {
+			return nil, err
+		}
+		for _, resolved := range resolvedModules {
+			if resolved.IsDependency {
+				configured[resolved.ModuleInfo.Module.Path] = resolved.LocalPath
+			}
+		}
+	}
+
+	modulePaths := make(map[string]bool)
+	for _, modulePath := range links {
+		modulePaths[modulePath] = true
+	}
+	for _, modulePath := range backups {
+		modulePaths[modulePath] = true
+	}
+	for modulePath := range configured {
+		modulePaths[modulePath] = true
+	}
+
+	statuses := make([]*VendorModuleStatus, 0, len(modulePaths))
+	for modulePath := range modulePaths {
+		st, err := moduleStatus(vendorDir, modulePath, configured[modulePath], modulesTxt)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ModulePath < statuses[j].ModulePath
+	})
+	return statuses, nil
+}
+
+func moduleStatus(vendorDir string, modulePath string, configuredPath string, modulesTxt map[string][]string) (*VendorModuleStatus, error) {
+	localVendorDir := filepath.Join(vendorDir, modulePath)
+	st := &VendorModuleStatus{ModulePath: modulePath}
+	_, st.InModules = modulesTxt[modulePath]
+	if _, err := os.Lstat(localVendorDir + oldSuffix); err == nil {
+		st.HasBackup = true
+	}
+
+	info, err := os.Lstat(localVendorDir)
+	switch {
+	case os.IsNotExist(err):
+		if st.HasBackup {
+			st.State = StateStale
+			st.Details = append(st.Details, "backup left behind without symlink, run 'kool go vendor repair'")
+		} else {
+			st.State = StateMissing
+			st.Details = append(st.Details, "not present in vendor")
+		}
+	case err != nil:
+		return nil, err
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(localVendorDir)
+		if err != nil {
+			return nil, err
+		}
+		st.Target = target
+		st.State = StateLinked
+		if _, err := os.Stat(localVendorDir); err != nil {
+			st.State = StateStale
+			st.Details = append(st.Details, "symlink target does not exist")
+		} else if configuredPath != "" && !sameDir(resolveLinkTarget(localVendorDir, target), configuredPath) {
+			st.State = StateStale
+			st.Details = append(st.Details, "configured local path is "+configuredPath)
+		}
+		if !st.HasBackup {
+			st.Details = append(st.Details, "no __old backup, unlink will leave vendor/"+modulePath+" absent")
+		}
+	default:
+		st.State = StateVendored
+		if st.HasBackup {
+			st.State = StateStale
+			st.Details = append(st.Details, "obsolete backup "+modulePath+oldSuffix+" next to a vendored copy")
+		}
+	}
+	if !st.InModules {
+		if st.State == StateVendored || st.State == StateLinked {
+			st.State = StateMissing
+		}
+		st.Details = append(st.Details, "not listed in vendor/modules.txt, run 'go mod vendor'")
+	}
+	return st, nil
+}
+
+const verifyHelp = `
+Verify that every symlinked vendor module still provides the packages
+listed for it in vendor/modules.txt, and that every package imported by
+the main module or by a vendored package is listed there. Exits with
+error on mismatch.
+
+Usage: kool go vendor verify [OPTIONS]
+
+Options:
+  -h,--help            show help message
+  --dir <dir>          set the directory containing vendor
+
+Examples:
+  kool go vendor verify
+`
+
+func HandleVerify(args []string) error {
+	var dir string
+	args, err := lessflags.
+		String("--dir", &dir).
+		Help("-h,--help", verifyHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	problems, err := Verify(dir)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		return fmt.Errorf("vendor verify failed: %d problem(s)", len(problems))
+	}
+	fmt.Printf("All vendor symlinks and imports match vendor/modules.txt\n")
+	return nil
+}
+
+// Verify checks each vendor symlink against vendor/modules.txt, then the
+// imports of the main module and of the vendored packages, and returns
+// one message per problem found.
+func Verify(dir string) ([]string, error) {
+	vendorDir := filepath.Join(dir, "vendor")
+	if err := validateVendorDir(vendorDir); err != nil {
+		return nil, err
+	}
+	modulesTxt, err := readModulesTxt(vendorDir)
+	if err != nil {
+		return nil, err
+	}
+	links, _, err := scanVendor(vendorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, modulePath := range links {
+		localVendorDir := filepath.Join(vendorDir, modulePath)
+		if _, err := os.Stat(localVendorDir); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: symlink target does not exist", modulePath))
+			continue
+		}
+		pkgs, ok := modulesTxt[modulePath]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: not listed in vendor/modules.txt", modulePath))
+			continue
+		}
+		if modInfo, err := resolve.GetModuleInfo(localVendorDir); err == nil && modInfo != nil && modInfo.Module.Path != "" && modInfo.Module.Path != modulePath {
+			problems = append(problems, fmt.Sprintf("%s: symlink target is module %s", modulePath, modInfo.Module.Path))
+			continue
+		}
+		for _, pkg := range pkgs {
+			rel := strings.TrimPrefix(strings.TrimPrefix(pkg, modulePath), "/")
+			if !hasGoFiles(filepath.Join(localVendorDir, filepath.FromSlash(rel))) {
+				problems = append(problems, fmt.Sprintf("%s: package %s listed in vendor/modules.txt no longer exists", modulePath, pkg))
+			}
+		}
+	}
+	unlisted, err := unlistedImports(dir, vendorDir, modulesTxt)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, unlisted...), nil
+}
+
+// unlistedImports reports the packages imported by the main module or by
+// the packages listed in modules.txt that modules.txt does not list, as
+// happens when a linked local module starts using a new package.
+func unlistedImports(dir string, vendorDir string, modulesTxt map[string][]string) ([]string, error) {
+	var mainModule string
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		mainModule = modfile.ModulePath(data)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+	for _, pkgs := range modulesTxt {
+		for _, pkg := range pkgs {
+			listed[pkg] = true
+		}
+	}
+
+	// import path -> one importing package, for the message
+	imports := make(map[string]string)
+	if mainModule != "" {
+		err := walkMainModule(dir, func(pkgDir string) error {
+			rel, err := filepath.Rel(dir, pkgDir)
+			if err != nil {
+				return err
+			}
+			importer := mainModule
+			if rel != "." {
+				importer += "/" + filepath.ToSlash(rel)
+			}
+			return collectImports(pkgDir, importer, true, imports)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for pkg := range listed {
+		if err := collectImports(filepath.Join(vendorDir, filepath.FromSlash(pkg)), pkg, false, imports); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+	for importPath, importer := range imports {
+		if listed[importPath] || isStdImport(importPath) || hasPathPrefix(importPath, mainModule) {
+			continue
+		}
+		var owner string
+		for modulePath := range modulesTxt {
+			if hasPathPrefix(importPath, modulePath) && len(modulePath) > len(owner) {
+				owner = modulePath
+			}
+		}
+		if owner == "" {
+			problems = append(problems, fmt.Sprintf("package %s imported by %s is provided by no module in vendor/modules.txt", importPath, importer))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s: package %s imported by %s is not listed in vendor/modules.txt", owner, importPath, importer))
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// walkMainModule calls fn for each directory of the module rooted at dir,
+// skipping vendor, testdata, hidden dirs and nested modules like go build.
+func walkMainModule(dir string, fn func(pkgDir string) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir {
+			name := d.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		return fn(path)
+	})
+}
+
+// collectImports records the imports of the .go files in pkgDir. Test
+// files count only for the main module, as go mod vendor does.
+func collectImports(pkgDir string, importer string, withTests bool, imports map[string]string) error {
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		// missing or broken packages are reported by the symlink checks
+		return nil
+	}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if !withTests && strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(pkgDir, name), nil, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		if isIgnoredFile(file.Comments) {
+			continue
+		}
+		for _, spec := range file.Imports {
+			importPath := strings.Trim(spec.Path.Value, "`\"")
+			if _, ok := imports[importPath]; !ok {
+				imports[importPath] = importer
+			}
+		}
+	}
+	return nil
+}
+
+// isIgnoredFile tells files excluded from every build by //go:build ignore
+func isIgnoredFile(comments []*ast.CommentGroup) bool {
+	for _, group := range comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//go:build ") && strings.Contains(" "+c.Text[len("//go:build "):]+" ", " ignore ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isStdImport(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+func hasPathPrefix(importPath string, prefix string) bool {
+	return prefix != "" && (importPath == prefix || strings.HasPrefix(importPath, prefix+"/"))
+}
+
+const repairHelp = `
+Restore vendor/<mod>__old backups left behind by link, when the
+symlink is gone or broken.
+
+Usage: kool go vendor repair [OPTIONS]
+
+Options:
+  -h,--help            show help message
+  --dir <dir>          set the directory containing vendor
+  --dry-run            only print what would be restored
+
+Examples:
+  kool go vendor repair
+  kool go vendor repair --dry-run
+`
+
+func HandleRepair(args []string) error {
+	var dir string
+	var dryRun bool
+	args, err := lessflags.
+		String("--dir", &dir).
+		Bool("--dry-run", &dryRun).
+		Help("-h,--help", repairHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	return Repair(dir, dryRun)
+}
+
+// Repair renames each orphaned vendor/<mod>__old back to vendor/<mod>.
+// Backups of valid symlinks are kept, and backups next to a regular
+// vendored copy are only reported since either side may be wanted.
+func Repair(dir string, dryRun bool) error {
+	vendorDir := filepath.Join(dir, "vendor")
+	if err := validateVendorDir(vendorDir); err != nil {
+		return err
+	}
+	_, backups, err := scanVendor(vendorDir)
+	if err != nil {
+		return err
+	}
+
+	var restoredCount int
+	for _, modulePath := range backups {
+		localVendorDir := filepath.Join(vendorDir, modulePath)
+		oldPath := localVendorDir + oldSuffix
+
+		info, err := os.Lstat(localVendorDir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if info.Mode()&os.ModeSymlink == 0 {
+				fmt.Printf("Skipping %s: vendor dir exists, remove %s manually if obsolete\n", modulePath, oldPath)
+				continue
+			}
+			if _, err := os.Stat(localVendorDir); err == nil {
+				// valid link, the backup is still needed by unlink
+				continue
+			}
+		}
+
+		if dryRun {
+			fmt.Printf("Would restore %s\n", modulePath)
+			restoredCount++
+			continue
+		}
+		if err == nil {
+			// broken symlink
+			if err := os.Remove(localVendorDir); err != nil {
+				return fmt.Errorf("failed to remove broken symlink: %w", err)
+			}
+		}
+		if err := os.Rename(oldPath, localVendorDir); err != nil {
+			return fmt.Errorf("failed to restore backup %s: %w", oldPath, err)
+		}
+		fmt.Printf("Restored %s\n", modulePath)
+		restoredCount++
+	}
+	if restoredCount == 0 {
+		fmt.Printf("Nothing to repair\n")
+	}
+	return nil
+}
+
+func validateVendorDir(vendorDir string) error {
+	info, err := os.Stat(vendorDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("vendor directory does not exist: %s", vendorDir)
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", vendorDir)
+	}
+	return nil
+}
+
+// scanVendor returns the module paths of symlinks and of __old backups
+// under vendorDir. Symlinks are not followed.
+func scanVendor(vendorDir string) (links []string, backups []string, err error) {
+	err = filepath.WalkDir(vendorDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == vendorDir {
+			return nil
+		}
+		rel, err := filepath.Rel(vendorDir, path)
+		if err != nil {
+			return err
+		}
+		modulePath := filepath.ToSlash(rel)
+		if d.Type()&fs.ModeSymlink != 0 {
+			links = append(links, modulePath)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(modulePath, oldSuffix) {
+			backups = append(backups, strings.TrimSuffix(modulePath, oldSuffix))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return links, backups, nil
+}
+
+// readModulesTxt parses vendor/modules.txt into module path -> packages.
+//
+//	# github.com/a/b v1.0.0
+//	## explicit; go 1.18
+//	github.com/a/b/pkg
+func readModulesTxt(vendorDir string) (map[string][]string, error) {
+	f, err := os.Open(filepath.Join(vendorDir, "modules.txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]string{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	modules := make(map[string][]string)
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "##"):
+		case strings.HasPrefix(line, "# "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			if len(fields) == 0 {
+				continue
+			}
+			// "# old => new v1" lines describe replacements, the
+			// vendored dir is named after the original module
+			current = fields[0]
+			if _, ok := modules[current]; !ok {
+				modules[current] = nil
+			}
+		default:
+			if current != "" {
+				modules[current] = append(modules[current], line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return modules, nil
+}
+
+func hasGoFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveLinkTarget(link string, target string) string {
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(link), target)
+}
+
+func sameDir(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	if evalA, err := filepath.EvalSymlinks(absA); err == nil {
+		absA = evalA
+	}
+	if evalB, err := filepath.EvalSymlinks(absB); err == nil {
+		absB = evalB
+	}
+	return absA == absB
+}
@@ -0,0 +1,264 @@
+package vendortool
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testModulesTxt = `# example.com/linked v1.0.0
+## explicit; go 1.21
+example.com/linked
+example.com/linked/sub
+# example.com/broken v1.0.0
+## explicit
+example.com/broken
+# example.com/vendored v1.2.0
+## explicit
+example.com/vendored
+# example.com/old v1.0.0 => ../old
+## explicit
+example.com/old
+`
+
+// setupVendor creates a module whose vendor dir contains:
+//
+//	example.com/linked    symlink to a local module, with __old backup
+//	example.com/broken    symlink to a missing dir
+//	example.com/unlisted  symlink absent from modules.txt
+//	example.com/vendored  regular copy
+//	example.com/old__old  backup left behind without symlink
+func setupVendor(t *testing.T) (dir string, local string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	dir = filepath.Join(root, "app")
+	vendorDir := filepath.Join(dir, "vendor")
+	writeFile(t, filepath.Join(vendorDir, "modules.txt"), testModulesTxt)
+
+	local = filepath.Join(root, "linked")
+	writeFile(t, filepath.Join(local, "go.mod"), "module example.com/linked\n")
+	writeFile(t, filepath.Join(local, "linked.go"), "package linked\n")
+	writeFile(t, filepath.Join(local, "sub", "sub.go"), "package sub\n")
+	writeFile(t, filepath.Join(vendorDir, "example.com", "linked"+oldSuffix, "linked.go"), "package linked\n")
+	symlink(t, local, filepath.Join(vendorDir, "example.com", "linked"))
+
+	symlink(t, filepath.Join(root, "gone"), filepath.Join(vendorDir, "example.com", "broken"))
+
+	unlisted := filepath.Join(root, "unlisted")
+	writeFile(t, filepath.Join(unlisted, "unlisted.go"), "package unlisted\n")
+	symlink(t, unlisted, filepath.Join(vendorDir, "example.com", "unlisted"))
+
+	writeFile(t, filepath.Join(vendorDir, "example.com", "vendored", "vendored.go"), "package vendored\n")
+	writeFile(t, filepath.Join(vendorDir, "example.com", "old"+oldSuffix, "old.go"), "package old\n")
+	return dir, local
+}
+
+func TestStatus(t *testing.T) {
+	dir, local := setupVendor(t)
+
+	statuses, err := Status(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, st := range statuses {
+		line := st.State + " " + st.ModulePath
+		if st.Target != "" {
+			line += " -> " + st.Target
+		}
+		for _, detail := range st.Details {
+			line += "; " + detail
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"stale example.com/broken -> " + filepath.Join(filepath.Dir(local), "gone") + "; symlink target does not exist; no __old backup, unlink will leave vendor/example.com/broken absent",
+		"linked example.com/linked -> " + local,
+		"stale example.com/old; backup left behind without symlink, run 'kool go vendor repair'",
+		"missing example.com/unlisted -> " + filepath.Join(filepath.Dir(local), "unlisted") + "; no __old backup, unlink will leave vendor/example.com/unlisted absent; not listed in vendor/modules.txt, run 'go mod vendor'",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("status mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestModuleStatusConfigured(t *testing.T) {
+	dir, local := setupVendor(t)
+	vendorDir := filepath.Join(dir, "vendor")
+	modulesTxt, err := readModulesTxt(vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		modulePath string
+		configured string
+		state      string
+		details    string
+	}{
+		{"linked to configured path", "example.com/linked", local, StateLinked, ""},
+		{"linked elsewhere", "example.com/linked", filepath.Join(dir, "other"), StateStale, "configured local path is " + filepath.Join(dir, "other")},
+		{"configured but absent", "example.com/absent", filepath.Join(dir, "absent"), StateMissing, "not present in vendor; not listed in vendor/modules.txt, run 'go mod vendor'"},
+		{"configured and vendored", "example.com/vendored", local, StateVendored, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := moduleStatus(vendorDir, tt.modulePath, tt.configured, modulesTxt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.State != tt.state || strings.Join(st.Details, "; ") != tt.details {
+				t.Errorf("expect %s (%s), got %s (%s)", tt.state, tt.details, st.State, strings.Join(st.Details, "; "))
+			}
+		})
+	}
+}
+
+func TestVerifyDetectsModulesTxtDrift(t *testing.T) {
+	dir, local := setupVendor(t)
+
+	problems, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"example.com/broken: symlink target does not exist",
+		"example.com/unlisted: not listed in vendor/modules.txt",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("problems mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(problems, "\n"))
+	}
+
+	// the local module dropped a package that modules.txt still lists
+	if err := os.RemoveAll(filepath.Join(local, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	// a test file alone does not make a package
+	writeFile(t, filepath.Join(local, "sub", "sub_test.go"), "package sub\n")
+	problems, err = Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"example.com/broken: symlink target does not exist",
+		"example.com/linked: package example.com/linked/sub listed in vendor/modules.txt no longer exists",
+		"example.com/unlisted: not listed in vendor/modules.txt",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("problems mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(problems, "\n"))
+	}
+}
+
+func TestVerifyDetectsUnlistedImports(t *testing.T) {
+	dir, local := setupVendor(t)
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n")
+	writeFile(t, filepath.Join(dir, "main.go"), `package main
+
+import (
+	"fmt"
+
+	"example.com/app/util"
+	"example.com/linked/sub"
+)
+`)
+	writeFile(t, filepath.Join(dir, "util", "util_test.go"), "package util\n\nimport _ \"example.com/testonly\"\n")
+	writeFile(t, filepath.Join(dir, "tools", "gen.go"), "//go:build ignore\n\npackage main\n\nimport _ \"example.com/generator\"\n")
+	// the linked module started using a package of its own and a new dependency
+	writeFile(t, filepath.Join(local, "linked.go"), "package linked\n\nimport (\n\t_ \"example.com/linked/extra\"\n\t_ \"example.com/newdep\"\n)\n")
+	writeFile(t, filepath.Join(local, "extra", "extra.go"), "package extra\n")
+	// test files of dependencies are not vendored
+	writeFile(t, filepath.Join(local, "linked_test.go"), "package linked\n\nimport _ \"example.com/depstest\"\n")
+
+	problems, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"example.com/broken: symlink target does not exist",
+		"example.com/unlisted: not listed in vendor/modules.txt",
+		"example.com/linked: package example.com/linked/extra imported by example.com/linked is not listed in vendor/modules.txt",
+		"package example.com/newdep imported by example.com/linked is provided by no module in vendor/modules.txt",
+		"package example.com/testonly imported by example.com/app/util is provided by no module in vendor/modules.txt",
+	}
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("problems mismatch\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(problems, "\n"))
+	}
+}
+
+func TestReadModulesTxt(t *testing.T) {
+	vendorDir := t.TempDir()
+	writeFile(t, filepath.Join(vendorDir, "modules.txt"), testModulesTxt)
+	modules, err := readModulesTxt(vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		modulePath string
+		pkgs       string
+	}{
+		{"example.com/linked", "example.com/linked,example.com/linked/sub"},
+		{"example.com/broken", "example.com/broken"},
+		{"example.com/vendored", "example.com/vendored"},
+		// replaced modules are vendored under the original path
+		{"example.com/old", "example.com/old"},
+	}
+	if len(modules) != len(tests) {
+		t.Fatalf("expect %d modules, got %v", len(tests), modules)
+	}
+	for _, tt := range tests {
+		if got := strings.Join(modules[tt.modulePath], ","); got != tt.pkgs {
+			t.Errorf("%s: expect %s, got %s", tt.modulePath, tt.pkgs, got)
+		}
+	}
+
+	missing, err := readModulesTxt(t.TempDir())
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("expect no modules without modules.txt, got %v, %v", missing, err)
+	}
+}
+
+func TestRepairRestoresOrphanedBackups(t *testing.T) {
+	dir, _ := setupVendor(t)
+	vendorDir := filepath.Join(dir, "vendor")
+
+	if err := Repair(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(vendorDir, "example.com", "old"+oldSuffix)); err != nil {
+		t.Fatalf("dry run should keep the backup: %v", err)
+	}
+
+	if err := Repair(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(vendorDir, "example.com", "old", "old.go")); err != nil {
+		t.Fatalf("expect backup restored: %v", err)
+	}
+	// the backup of a valid link is still needed by unlink
+	if _, err := os.Stat(filepath.Join(vendorDir, "example.com", "linked"+oldSuffix)); err != nil {
+		t.Fatalf("expect backup of linked module kept: %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, target string, link string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
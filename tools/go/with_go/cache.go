@@ -0,0 +1,345 @@
+package with_go
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/version"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lessflags "github.com/xhd2015/less-flags"
+)
+
+const pruneHelp = `
+kool with-go prune removes installed Go versions, keeping the newest ones
+
+Usage: kool with-go prune [OPTIONS]
+
+Options:
+  --keep <N>                       number of newest versions to keep (default: 3)
+  --dry-run                        only print what would be removed
+  -h,--help                        show help message
+
+Examples:
+  kool with-go prune --keep 3
+  kool with-go prune --keep 1 --dry-run
+`
+
+const verifyHelp = `
+kool with-go verify checks installed Go versions against their SHA256 manifest
+
+Each install <dir>/goX.Y.Z has a manifest <dir>/goX.Y.Z.sha256sum in
+sha256sum format, listing the files of the go.dev archive it was
+extracted from. The archive is checked against the SHA256 published on
+go.dev. Installs made before manifests existed can be recorded with
+--write, which downloads the archive again.
+
+Usage: kool with-go verify [OPTIONS] [goX.Y.Z...]
+
+Options:
+  --write                          (re)write the manifest from the go.dev archive instead of checking
+  -h,--help                        show help message
+
+Examples:
+  kool with-go verify
+  kool with-go verify go1.22.12
+  kool with-go verify --write go1.22.12
+`
+
+const manifestSuffix = ".sha256sum"
+
+// InstalledGo is a Go version found in the install dir
+type InstalledGo struct {
+	Version string
+	Dir     string
+}
+
+// ListInstalled returns the Go versions in the install dir, newest first.
+// Entries that are not a goX.Y.Z directory containing bin/go are ignored.
+func ListInstalled() ([]InstalledGo, error) {
+	installDir, err := GetInstallDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(installDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var installs []InstalledGo
+	for _, entry := range entries {
+		if !entry.IsDir() || !version.IsValid(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(installDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, "bin", "go")); err != nil {
+			if _, err := os.Stat(filepath.Join(dir, "bin", "go.exe")); err != nil {
+				continue
+			}
+		}
+		installs = append(installs, InstalledGo{Version: entry.Name(), Dir: dir})
+	}
+	sort.Slice(installs, func(i, j int) bool {
+		return version.Compare(installs[i].Version, installs[j].Version) > 0
+	})
+	return installs, nil
+}
+
+func HandlePrune(args []string) error {
+	keep := 3
+	var dryRun bool
+	args, err := lessflags.
+		Int("--keep", &keep).
+		Bool("--dry-run", &dryRun).
+		Help("-h,--help", pruneHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	if keep < 0 {
+		return fmt.Errorf("--keep must not be negative: %d", keep)
+	}
+	installs, err := ListInstalled()
+	if err != nil {
+		return err
+	}
+	if len(installs) <= keep {
+		fmt.Fprintf(os.Stderr, "%d version(s) installed, nothing to prune\n", len(installs))
+		return nil
+	}
+	for _, install := range installs[:keep] {
+		fmt.Fprintf(os.Stderr, "keep %s\n", install.Version)
+	}
+	for _, install := range installs[keep:] {
+		if dryRun {
+			fmt.Fprintf(os.Stderr, "would remove %s\n", install.Dir)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "remove %s\n", install.Dir)
+		if err := removeInstall(install.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeInstall(dir string) error {
+	// module cache style installs may have read-only dirs
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(path, 0755)
+		}
+		return nil
+	})
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	err := os.Remove(dir + manifestSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func HandleVerify(args []string) error {
+	var write bool
+	args, err := lessflags.
+		Bool("--write", &write).
+		Help("-h,--help", verifyHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	installs, err := ListInstalled()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		byVersion := make(map[string]InstalledGo, len(installs))
+		for _, install := range installs {
+			byVersion[install.Version] = install
+		}
+		var selected []InstalledGo
+		for _, arg := range args {
+			goVersion := "go" + strings.TrimPrefix(arg, "go")
+			install, ok := byVersion[goVersion]
+			if !ok {
+				return fmt.Errorf("%s is not installed", goVersion)
+			}
+			selected = append(selected, install)
+		}
+		installs = selected
+	}
+	if len(installs) == 0 {
+		fmt.Fprintf(os.Stderr, "no Go versions installed\n")
+		return nil
+	}
+
+	var failed []string
+	for _, install := range installs {
+		if write {
+			if err := WriteManifest(install.Dir, install.Version); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%s: manifest written\n", install.Version)
+			continue
+		}
+		problems, err := VerifyManifest(install.Dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "%s: no manifest, run 'kool with-go verify --write %s' to record one\n", install.Version, install.Version)
+				failed = append(failed, install.Version)
+				continue
+			}
+			return err
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(os.Stderr, "%s: OK\n", install.Version)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: FAILED\n", install.Version)
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", problem)
+		}
+		failed = append(failed, install.Version)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("verify failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// WriteManifest records the SHA256 of every file of the go.dev archive of
+// goVersion into goroot + ".sha256sum", so that the manifest does not
+// trust the local install.
+func WriteManifest(goroot string, goVersion string) error {
+	sums, err := publishedGoSums(goVersion)
+	if err != nil {
+		return err
+	}
+	return writeManifestSums(goroot, sums)
+}
+
+func writeManifestSums(goroot string, sums map[string]string) error {
+	paths := make([]string, 0, len(sums))
+	for path := range sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", sums[path], path)
+	}
+	return os.WriteFile(goroot+manifestSuffix, []byte(b.String()), 0644)
+}
+
+// VerifyManifest compares goroot with its manifest and returns one line
+// per missing, modified or unexpected file. The error wraps os.ErrNotExist
+// when there is no manifest.
+func VerifyManifest(goroot string) ([]string, error) {
+	want, err := readManifest(goroot + manifestSuffix)
+	if err != nil {
+		return nil, err
+	}
+	got, err := hashTree(goroot)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for path, sum := range want {
+		gotSum, ok := got[path]
+		if !ok {
+			problems = append(problems, "missing: "+path)
+		} else if gotSum != sum {
+			problems = append(problems, "modified: "+path)
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			problems = append(problems, "extra: "+path)
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+func readManifest(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		sum, path, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s:%d: invalid line", file, lineNum)
+		}
+		sums[path] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// hashTree maps slash separated paths relative to root to their SHA256.
+func hashTree(root string) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
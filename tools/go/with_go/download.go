@@ -0,0 +1,315 @@
+package with_go
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/version"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// downloadBaseURL serves the release index (?mode=json&include=all) and
+// the archives, replaced by tests
+var downloadBaseURL = "https://go.dev/dl/"
+
+// goRelease is an entry of the go.dev download index
+type goRelease struct {
+	Version string          `json:"version"`
+	Stable  bool            `json:"stable"`
+	Files   []goReleaseFile `json:"files"`
+}
+
+type goReleaseFile struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	SHA256   string `json:"sha256"`
+	Kind     string `json:"kind"`
+}
+
+// fetchGoReleases reads every release listed in the go.dev download index
+func fetchGoReleases() ([]goRelease, error) {
+	resp, err := http.Get(downloadBaseURL + "?mode=json&include=all")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch Go release index: %s", resp.Status)
+	}
+	var releases []goRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("decode Go release index: %w", err)
+	}
+	return releases, nil
+}
+
+// latestGoPatch returns the newest stable release of the goX.Y line lang
+// in the go.dev download index, e.g. go1.26.0 for go1.26
+func latestGoPatch(lang string) (string, error) {
+	releases, err := fetchGoReleases()
+	if err != nil {
+		return "", err
+	}
+	var latest string
+	for _, release := range releases {
+		if !release.Stable || version.Lang(release.Version) != lang {
+			continue
+		}
+		if latest == "" || version.Compare(release.Version, latest) > 0 {
+			latest = release.Version
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no stable %s release found in the Go release index", lang)
+	}
+	return latest, nil
+}
+
+// findGoArchive looks up the archive of goVersion for the current
+// platform in the go.dev download index
+func findGoArchive(goVersion string) (*goReleaseFile, error) {
+	releases, err := fetchGoReleases()
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if release.Version != goVersion {
+			continue
+		}
+		for _, file := range release.Files {
+			if file.OS == runtime.GOOS && file.Arch == runtime.GOARCH && file.Kind == "archive" {
+				file := file
+				return &file, nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no archive for %s/%s", goVersion, runtime.GOOS, runtime.GOARCH)
+	}
+	return nil, fmt.Errorf("%s not found in the Go release index", goVersion)
+}
+
+// downloadGoArchive downloads the archive into dir and checks it against
+// the SHA256 published in the release index. The caller removes the
+// returned file.
+func downloadGoArchive(file *goReleaseFile, dir string) (string, error) {
+	resp, err := http.Get(downloadBaseURL + file.Filename)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: %s", file.Filename, resp.Status)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, file.Filename+".*.download")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("download %s: %w", file.Filename, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != file.SHA256 {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("checksum mismatch for %s: go.dev publishes %s, downloaded %s", file.Filename, file.SHA256, got)
+	}
+	return f.Name(), nil
+}
+
+// installGoArchive installs goVersion as installDir/goVersion from a checksum
+// verified go.dev archive, and returns the SHA256 of its files
+func installGoArchive(installDir string, goVersion string) (map[string]string, error) {
+	file, err := findGoArchive(goVersion)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "downloading %s\n", downloadBaseURL+file.Filename)
+	archive, err := downloadGoArchive(file, installDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archive)
+
+	goroot := filepath.Join(installDir, goVersion)
+	tmpDir := goroot + ".extracting"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, err
+	}
+	sums, err := extractGoArchive(archive, file.Filename, tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, goroot); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	return sums, nil
+}
+
+// publishedGoSums returns the SHA256 of the files of goVersion as
+// published on go.dev, without installing it
+func publishedGoSums(goVersion string) (map[string]string, error) {
+	file, err := findGoArchive(goVersion)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "downloading %s\n", downloadBaseURL+file.Filename)
+	tmpDir, err := os.MkdirTemp("", "kool-with-go")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	archive, err := downloadGoArchive(file, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	return extractGoArchive(archive, file.Filename, "")
+}
+
+// extractGoArchive extracts the go/ tree of a .tar.gz or .zip release
+// archive into goroot and returns the SHA256 of every regular file, keyed
+// by its slash separated path relative to goroot. With an empty goroot
+// the files are only hashed.
+func extractGoArchive(archive string, filename string, goroot string) (map[string]string, error) {
+	sums := make(map[string]string)
+	visit := func(name string, mode fs.FileMode, r io.Reader) error {
+		rel, ok := goArchivePath(name)
+		if !ok {
+			return fmt.Errorf("%s: unexpected entry %s", filename, name)
+		}
+		if rel == "" {
+			return nil
+		}
+		if mode.IsDir() {
+			if goroot == "" {
+				return nil
+			}
+			return os.MkdirAll(filepath.Join(goroot, filepath.FromSlash(rel)), 0755)
+		}
+		if !mode.IsRegular() {
+			return nil
+		}
+		h := sha256.New()
+		w := io.Writer(h)
+		var f *os.File
+		if goroot != "" {
+			target := filepath.Join(goroot, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			var err error
+			f, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+			if err != nil {
+				return err
+			}
+			w = io.MultiWriter(f, h)
+		}
+		_, err := io.Copy(w, r)
+		if f != nil {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+		sums[rel] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	}
+	var err error
+	switch {
+	case strings.HasSuffix(filename, ".tar.gz"):
+		err = walkTarGz(archive, visit)
+	case strings.HasSuffix(filename, ".zip"):
+		err = walkZip(archive, visit)
+	default:
+		err = fmt.Errorf("unsupported archive %s", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// goArchivePath maps an entry of a release archive, like go/bin/go, to
+// bin/go. ok is false for entries outside go/.
+func goArchivePath(name string) (rel string, ok bool) {
+	name = strings.TrimSuffix(name, "/")
+	if name == "go" {
+		return "", true
+	}
+	if !strings.HasPrefix(name, "go/") {
+		return "", false
+	}
+	rel = strings.TrimPrefix(name, "go/")
+	if path.IsAbs(rel) || path.Clean(rel) != rel || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+func walkTarGz(archive string, visit func(name string, mode fs.FileMode, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := visit(hdr.Name, hdr.FileInfo().Mode(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(archive string, visit func(name string, mode fs.FileMode, r io.Reader) error) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = visit(file.Name, file.Mode(), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
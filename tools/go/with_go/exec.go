@@ -1,6 +1,7 @@
 package with_go
 
 import (
+	"go/version"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,35 +11,38 @@ import (
 )
 
 func ResolveGoroot(goVersion string) (string, error) {
-	switch goVersion {
-	case "go1.25":
-		goVersion = "go1.25.0"
-	case "go1.24":
-		goVersion = "go1.24.1"
-	case "go1.23":
-		goVersion = "go1.23.6"
-	case "go1.22":
-		goVersion = "go1.22.12"
-	case "go1.21":
-		goVersion = "go1.21.13"
-	case "go1.20":
-		goVersion = "go1.20.14"
-	case "go1.19":
-		goVersion = "go1.19.13"
-	case "go1.18":
-		goVersion = "go1.18.10"
-	case "go1.17":
-		goVersion = "go1.17.13"
-	case "go1.16":
-		goVersion = "go1.16.15"
-	case "go1.15":
-		goVersion = "go1.15.15"
-	case "go1.14":
-		goVersion = "go1.14.15"
+	goVersion, err := resolveGoVersion(goVersion)
+	if err != nil {
+		return "", err
 	}
 	return InstallGo(goVersion, "")
 }
 
+// resolveGoVersion maps a bare goX.Y to a release: the newest installed
+// patch of that line, otherwise the newest stable one listed on go.dev.
+// Other versions are returned as is.
+func resolveGoVersion(goVersion string) (string, error) {
+	if !version.IsValid(goVersion) || version.Lang(goVersion) != goVersion {
+		return goVersion, nil
+	}
+	installs, err := ListInstalled()
+	if err != nil {
+		return "", err
+	}
+	// newest first
+	for _, install := range installs {
+		if version.Lang(install.Version) == goVersion && !isGoPrerelease(install.Version) {
+			return install.Version, nil
+		}
+	}
+	return latestGoPatch(goVersion)
+}
+
+// isGoPrerelease tells release candidates and betas, like go1.22rc1
+func isGoPrerelease(goVersion string) bool {
+	return strings.Contains(goVersion, "rc") || strings.Contains(goVersion, "beta")
+}
+
 func ExecGoroot(goroot string, args []string, extraEnvs []string) error {
 	absGoroot, err := filepath.Abs(goroot)
 	if err != nil {
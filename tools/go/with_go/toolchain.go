@@ -0,0 +1,134 @@
+package with_go
+
+import (
+	"errors"
+	"fmt"
+	"go/version"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// HandleAuto picks the Go version required by the nearest go.mod, preferring
+// its toolchain directive over the go directive, and executes args with it.
+func HandleAuto(args []string, envs []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	goModFile, goVersion, err := FindGoModVersion(cwd)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s requires %s\n", goModFile, goVersion)
+	goroot, err := ResolveGorootPreferCurrent(goVersion)
+	if err != nil {
+		return err
+	}
+	return ExecGoroot(goroot, args, envs)
+}
+
+// FindGoModVersion walks up from dir to the nearest go.mod and returns
+// its path together with the wanted version, like go1.22 or go1.22.3.
+func FindGoModVersion(dir string) (goModFile string, goVersion string, err error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		candidate := filepath.Join(absDir, "go.mod")
+		if _, statErr := os.Stat(candidate); statErr == nil {
+			goModFile = candidate
+			break
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return "", "", fmt.Errorf("no go.mod found in %s or any parent directory", dir)
+		}
+		absDir = parent
+	}
+
+	data, err := os.ReadFile(goModFile)
+	if err != nil {
+		return "", "", err
+	}
+	goVersion, err = goModRequiredVersion(goModFile, data)
+	if err != nil {
+		return "", "", err
+	}
+	return goModFile, goVersion, nil
+}
+
+func goModRequiredVersion(file string, data []byte) (string, error) {
+	mod, err := modfile.ParseLax(file, data, nil)
+	if err != nil {
+		return "", err
+	}
+	if mod.Toolchain != nil && mod.Toolchain.Name != "" && mod.Toolchain.Name != "default" {
+		return mod.Toolchain.Name, nil
+	}
+	if mod.Go != nil && mod.Go.Version != "" {
+		return "go" + mod.Go.Version, nil
+	}
+	return "", fmt.Errorf("%s has neither go nor toolchain directive", file)
+}
+
+// ResolveGorootPreferCurrent returns the GOROOT of the go command on PATH
+// when it already provides goVersion, otherwise installs goVersion.
+func ResolveGorootPreferCurrent(goVersion string) (string, error) {
+	goroot, ok := currentGorootMatching(goVersion)
+	if ok {
+		return goroot, nil
+	}
+	return ResolveGoroot(goVersion)
+}
+
+func currentGorootMatching(goVersion string) (string, bool) {
+	current, goroot, err := currentGo()
+	if err != nil {
+		return "", false
+	}
+	if !goVersionMatches(goVersion, current) {
+		return "", false
+	}
+	return goroot, true
+}
+
+// currentGo reports the version and GOROOT of the go command on PATH.
+func currentGo() (goVersion string, goroot string, err error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return "", "", err
+	}
+	cmd := exec.Command("go", "env", "GOVERSION", "GOROOT")
+	// GOTOOLCHAIN=local prevents the go command from switching itself
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 2 {
+		return "", "", errors.New("unexpected go env output")
+	}
+	// GOVERSION may carry experiments, e.g. "go1.22.3 X:rangefunc"
+	fields := strings.Fields(lines[0])
+	if len(fields) == 0 {
+		return "", "", errors.New("empty GOVERSION")
+	}
+	return fields[0], strings.TrimSpace(lines[1]), nil
+}
+
+// goVersionMatches tells whether current satisfies want. A want without
+// patch version (go1.22) accepts any patch release of that minor version.
+func goVersionMatches(want string, current string) bool {
+	if want == current {
+		return true
+	}
+	if !version.IsValid(want) || version.Lang(want) != want {
+		return false
+	}
+	return version.Lang(current) == want
+}
@@ -12,17 +12,52 @@ import (
 
 const downloadGo = "github.com/xhd2015/xgo/script/download-go@master"
 
+const help = `
+kool with-go executes a command with the given Go version, installing it if needed
+
+Usage: kool with-go <goX.Y | GOROOT=<X> | auto> [ENV=value...] <cmd> [args...]
+       kool with-go <subcommand> [OPTIONS]
+
+Subcommands:
+  list                             list Go versions available for download
+  auto <cmd> [args...]             use the toolchain or go directive of the nearest go.mod
+  prune [--keep N] [--dry-run]     remove installed versions except the newest N (default: 3)
+  verify [--write] [goX.Y.Z...]    check installed versions against their SHA256 manifest
+
+Go versions are installed in ~/installed from the go.dev archives, checked
+against the SHA256 published on go.dev.
+
+The current go on PATH is reused when it already provides the wanted version.
+Otherwise goX.Y picks the newest installed goX.Y.Z, or installs the newest
+stable one listed on go.dev.
+
+Examples:
+  kool with-go go1.22 go version
+  kool with-go auto go test ./...
+  kool with-go prune --keep 3
+`
+
 func Handle(args []string, envs []string) error {
 	if len(args) == 0 {
-		return errors.New("example: kool with-go [GOROOT=<X> | goX.Y] ...")
+		return errors.New("example: kool with-go [GOROOT=<X> | goX.Y | auto] ...")
 	}
 	var goroot string
 	var err error
 	arg0 := args[0]
-	if arg0 == "list" {
+	args = args[1:]
+	switch arg0 {
+	case "-h", "--help", "help":
+		fmt.Print(strings.TrimPrefix(help, "\n"))
+		return nil
+	case "list":
 		return List()
+	case "auto":
+		return HandleAuto(args, envs)
+	case "prune":
+		return HandlePrune(args)
+	case "verify":
+		return HandleVerify(args)
 	}
-	args = args[1:]
 	if strings.HasPrefix(arg0, "GOROOT=") {
 		goroot = strings.TrimSpace(strings.TrimPrefix(arg0, "GOROOT="))
 		if goroot == "" {
@@ -33,7 +68,7 @@ func Handle(args []string, envs []string) error {
 		if goVersion == "" {
 			return errors.New("example: kool with-go go1.18 ...")
 		}
-		goroot, err = ResolveGoroot(goVersion)
+		goroot, err = ResolveGorootPreferCurrent(goVersion)
 		if err != nil {
 			return err
 		}
@@ -73,15 +108,16 @@ func InstallGo(goVersion string, prompt string) (goRoot string, err error) {
 	if prompt != "" {
 		fmt.Fprint(os.Stderr, prompt)
 	}
-	// override GOOS and GOARCH
-	err = cmd.Debug().Env([]string{
-		"GOOS=",
-		"GOARCH=",
-	}).Run("go", "run", downloadGo, "download", "--dir", installDir, goVersion)
+	sums, err := installGoArchive(installDir, goVersion)
 	if err != nil {
 		return "", err
 	}
 
+	// record checksums so 'kool with-go verify' can detect later corruption
+	if err := writeManifestSums(goRoot, sums); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: write checksum manifest: %v\n", err)
+	}
+
 	fmt.Fprintf(os.Stderr, "downloaded: %s, try: \n", goRoot)
 	fmt.Fprintf(os.Stderr, "  %s/bin/go version\n", goRoot)
 	return goRoot, nil
@@ -0,0 +1,341 @@
+package with_go
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testGoVersion = "go1.99.1"
+
+var testGoFiles = map[string]string{
+	"go/VERSION":          testGoVersion + "\n",
+	"go/bin/go":           "#!/bin/sh\necho go\n",
+	"go/src/fmt/print.go": "package fmt\n",
+}
+
+func TestListInstalledLayout(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	installDir := filepath.Join(home, "installed")
+	writeFile(t, filepath.Join(installDir, "go1.21.0", "bin", "go"), "")
+	writeFile(t, filepath.Join(installDir, "go1.22.12", "bin", "go"), "")
+	writeFile(t, filepath.Join(installDir, "go1.9.2", "bin", "go"), "")
+	// no bin/go, not a version, a manifest
+	writeFile(t, filepath.Join(installDir, "go1.20.1", "src", "go.mod"), "")
+	writeFile(t, filepath.Join(installDir, "notes", "bin", "go"), "")
+	writeFile(t, filepath.Join(installDir, "go1.21.0"+manifestSuffix), "")
+
+	installs, err := ListInstalled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, install := range installs {
+		got = append(got, install.Version)
+	}
+	want := "go1.22.12,go1.21.0,go1.9.2"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("expect %s, got %s", want, strings.Join(got, ","))
+	}
+
+	if err := HandlePrune([]string{"--keep", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"go1.21.0", "go1.21.0" + manifestSuffix, "go1.9.2"} {
+		if _, err := os.Stat(filepath.Join(installDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expect %s to be pruned, stat: %v", name, err)
+		}
+	}
+	for _, name := range []string{"go1.22.12", "go1.20.1", "notes"} {
+		if _, err := os.Stat(filepath.Join(installDir, name)); err != nil {
+			t.Errorf("expect %s to be kept: %v", name, err)
+		}
+	}
+}
+
+func TestInstallGoVerifiesDownload(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	archive := goArchive(t, testGoFiles)
+	serveGoRelease(t, archive, sha256Hex(archive))
+
+	goroot, err := InstallGo(testGoVersion, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goroot != filepath.Join(home, "installed", testGoVersion) {
+		t.Fatalf("unexpected goroot: %s", goroot)
+	}
+	data, err := os.ReadFile(filepath.Join(goroot, "bin", "go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testGoFiles["go/bin/go"] {
+		t.Fatalf("unexpected bin/go: %q", data)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(goroot, "bin", "go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Fatalf("expect bin/go to be executable, mode: %v", info.Mode())
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(home, "installed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := testGoVersion + "," + testGoVersion + manifestSuffix
+	if strings.Join(names, ",") != want {
+		t.Fatalf("expect install dir to contain %s, got %s", want, strings.Join(names, ","))
+	}
+
+	problems, err := VerifyManifest(goroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expect fresh install to verify, got %v", problems)
+	}
+
+	writeFile(t, filepath.Join(goroot, "bin", "go"), "tampered")
+	writeFile(t, filepath.Join(goroot, "bin", "extra"), "")
+	if err := os.Remove(filepath.Join(goroot, "VERSION")); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = VerifyManifest(goroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProblems := "extra: bin/extra,missing: VERSION,modified: bin/go"
+	if strings.Join(problems, ",") != wantProblems {
+		t.Fatalf("expect %s, got %s", wantProblems, strings.Join(problems, ","))
+	}
+	if err := HandleVerify([]string{testGoVersion}); err == nil {
+		t.Fatalf("expect verify to fail")
+	}
+}
+
+func TestInstallGoRejectsChecksumMismatch(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	archive := goArchive(t, testGoFiles)
+	serveGoRelease(t, archive, sha256Hex([]byte("another archive")))
+
+	_, err := InstallGo(testGoVersion, "")
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expect checksum mismatch, got: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(home, "installed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expect nothing left in the install dir, found %s", entries[0].Name())
+	}
+}
+
+func TestVerifyWriteUsesPublishedArchive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	archive := goArchive(t, testGoFiles)
+	serveGoRelease(t, archive, sha256Hex(archive))
+
+	// an install made before manifests existed, modified since
+	goroot := filepath.Join(home, "installed", testGoVersion)
+	writeFile(t, filepath.Join(goroot, "VERSION"), testGoFiles["go/VERSION"])
+	writeFile(t, filepath.Join(goroot, "bin", "go"), "tampered")
+	writeFile(t, filepath.Join(goroot, "src", "fmt", "print.go"), testGoFiles["go/src/fmt/print.go"])
+
+	if err := HandleVerify([]string{testGoVersion}); err == nil {
+		t.Fatalf("expect verify without manifest to fail")
+	}
+	if err := HandleVerify([]string{"--write", testGoVersion}); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := VerifyManifest(goroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(problems, ",") != "modified: bin/go" {
+		t.Fatalf("expect modified: bin/go, got %v", problems)
+	}
+}
+
+func TestResolveGoVersion(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	serveGoIndex(t, []goRelease{
+		{Version: "go1.99rc1"},
+		{Version: "go1.99.2", Stable: true},
+		{Version: "go1.99.10", Stable: true},
+		{Version: "go1.99.0", Stable: true},
+		{Version: "go1.98", Stable: true},
+		{Version: "go1.98.1", Stable: true},
+		{Version: "go1.100rc2"},
+	}, nil)
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"go1.99", "go1.99.10"},
+		{"go1.98", "go1.98.1"},
+		{"go1.99.2", "go1.99.2"},
+		{"go1.99rc1", "go1.99rc1"},
+	}
+	for _, tt := range tests {
+		got, err := resolveGoVersion(tt.version)
+		if err != nil {
+			t.Fatalf("resolveGoVersion(%s): %v", tt.version, err)
+		}
+		if got != tt.want {
+			t.Errorf("resolveGoVersion(%s) = %s, want %s", tt.version, got, tt.want)
+		}
+	}
+	if _, err := resolveGoVersion("go1.100"); err == nil || !strings.Contains(err.Error(), "no stable go1.100 release") {
+		t.Errorf("expect no stable go1.100 release, got %v", err)
+	}
+
+	// an installed patch is used without looking at go.dev, prereleases are not
+	writeFile(t, filepath.Join(home, "installed", "go1.99.2", "bin", "go"), "")
+	writeFile(t, filepath.Join(home, "installed", "go1.98rc1", "bin", "go"), "")
+	downloadBaseURL = "http://127.0.0.1:1/dl/"
+	got, err := resolveGoVersion("go1.99")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "go1.99.2" {
+		t.Errorf("expect installed go1.99.2, got %s", got)
+	}
+	if _, err := resolveGoVersion("go1.98"); err == nil {
+		t.Errorf("expect go1.98 to need the index, the installed go1.98rc1 is a prerelease")
+	}
+}
+
+func TestGoArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		rel  string
+		ok   bool
+	}{
+		{"go/", "", true},
+		{"go/bin/go", "bin/go", true},
+		{"go/src/", "src", true},
+		{"bin/go", "", false},
+		{"go/../etc/passwd", "", false},
+		{"go//etc/passwd", "", false},
+		{"gopher/x", "", false},
+	}
+	for _, tt := range tests {
+		rel, ok := goArchivePath(tt.name)
+		if rel != tt.rel || ok != tt.ok {
+			t.Errorf("goArchivePath(%q) = %q, %v, want %q, %v", tt.name, rel, ok, tt.rel, tt.ok)
+		}
+	}
+}
+
+// serveGoRelease serves a download index listing testGoVersion with the
+// given archive and published checksum
+func serveGoRelease(t *testing.T, archive []byte, sum string) {
+	t.Helper()
+	filename := testGoVersion + "." + runtime.GOOS + "-" + runtime.GOARCH + ".tar.gz"
+	serveGoIndex(t, []goRelease{{
+		Version: testGoVersion,
+		Stable:  true,
+		Files: []goReleaseFile{
+			{Filename: testGoVersion + ".src.tar.gz", Kind: "source", SHA256: sum},
+			{Filename: filename, OS: runtime.GOOS, Arch: runtime.GOARCH, Version: testGoVersion, Kind: "archive", SHA256: sum},
+		},
+	}}, map[string][]byte{filename: archive})
+}
+
+// serveGoIndex serves releases as the go.dev download index, and the
+// archives by file name
+func serveGoIndex(t *testing.T, releases []goRelease, archives map[string][]byte) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dl/" {
+			if r.URL.Query().Get("mode") != "json" || r.URL.Query().Get("include") != "all" {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(releases)
+			return
+		}
+		archive, ok := archives[strings.TrimPrefix(r.URL.Path, "/dl/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+	old := downloadBaseURL
+	downloadBaseURL = server.URL + "/dl/"
+	t.Cleanup(func() { downloadBaseURL = old })
+}
+
+func goArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	dirs := []string{"go/", "go/bin/", "go/src/", "go/src/fmt/"}
+	for _, dir := range dirs {
+		if err := tw.WriteHeader(&tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"go/VERSION", "go/bin/go", "go/src/fmt/print.go"} {
+		mode := int64(0644)
+		if strings.HasPrefix(name, "go/bin/") {
+			mode = 0755
+		}
+		content := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: mode, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,285 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultCaptureMaxBody is the size up to which bodies are captured
+const DefaultCaptureMaxBody = 1 << 20
+
+// CaptureEntry is a request/response pair, one JSON line of a capture
+// file. The fields follow the entries of HAR 1.2 so the lines can be
+// assembled into a HAR log for other tools.
+type CaptureEntry struct {
+	StartedDateTime time.Time        `json:"startedDateTime"`
+	Time            float64          `json:"time"` // milliseconds
+	Request         *CaptureRequest  `json:"request"`
+	Response        *CaptureResponse `json:"response"`
+}
+
+type CaptureRequest struct {
+	Method      string           `json:"method"`
+	URL         string           `json:"url"` // as sent by the client
+	HTTPVersion string           `json:"httpVersion"`
+	Headers     []*CaptureHeader `json:"headers"`
+	PostData    *CapturePostData `json:"postData,omitempty"`
+	// ForwardedURI is the path and query the proxy sent to the route
+	// target, relative to its URL, e.g. without the prefix removed by
+	// --strip-prefix
+	ForwardedURI string `json:"_forwardedUri,omitempty"`
+}
+
+// forwardedURIKey is the context key of the *string the proxy sets to
+// the forwarded path and query
+type forwardedURIKey struct{}
+
+// recordForwardedURI tells the capture of r, if any, the request URI
+// the proxy forwards
+func recordForwardedURI(r *http.Request, uri string) {
+	if p, ok := r.Context().Value(forwardedURIKey{}).(*string); ok {
+		*p = uri
+	}
+}
+
+// ReplayURI is the path and query to send to the target on replay
+func (r *CaptureRequest) ReplayURI() (string, error) {
+	if r.ForwardedURI != "" {
+		return r.ForwardedURI, nil
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid captured url %q: %v", r.URL, err)
+	}
+	return u.RequestURI(), nil
+}
+
+type CaptureResponse struct {
+	Status     int              `json:"status"`
+	StatusText string           `json:"statusText"`
+	Headers    []*CaptureHeader `json:"headers"`
+	Content    *CaptureContent  `json:"content"`
+}
+
+type CaptureHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type CapturePostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Encoding is base64 for binary bodies
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+type CaptureContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Encoding is base64 for binary bodies
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+// Body decodes the captured request body
+func (p *CapturePostData) Body() ([]byte, error) {
+	return decodeCapturedBody(p.Text, p.Encoding)
+}
+
+// Body decodes the captured response body
+func (c *CaptureContent) Body() ([]byte, error) {
+	return decodeCapturedBody(c.Text, c.Encoding)
+}
+
+func decodeCapturedBody(text string, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// Header returns the first value of the header
+func (r *CaptureResponse) Header(name string) string {
+	return captureHeaderValue(r.Headers, name)
+}
+
+func captureHeaderValue(headers []*CaptureHeader, name string) string {
+	for _, h := range headers {
+		if http.CanonicalHeaderKey(h.Name) == http.CanonicalHeaderKey(name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func captureHeaders(h http.Header) []*CaptureHeader {
+	headers := []*CaptureHeader{}
+	for name, values := range h {
+		for _, value := range values {
+			headers = append(headers, &CaptureHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// encodeCapturedBody returns the body as text, or base64 if it is not
+// valid UTF-8
+func encodeCapturedBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// Capture appends the request/response pairs passing through a handler
+// to a JSONL file
+type Capture struct {
+	maxBody int
+
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// OpenCapture opens the capture file for appending
+func OpenCapture(file string, maxBody int) (*Capture, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %v", err)
+	}
+	return &Capture{maxBody: maxBody, file: f}, nil
+}
+
+func (c *Capture) Close() error {
+	return c.file.Close()
+}
+
+func (c *Capture) write(entry *CaptureEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "capture: %v\n", err)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "capture: %v\n", err)
+	}
+}
+
+// Wrap records the requests served by the handler. Bodies are kept up to
+// maxBody bytes, upgraded connections such as WebSockets are recorded
+// without their traffic.
+func (c *Capture) Wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var reqBody *limitedBuffer
+		if r.Body != nil && r.Body != http.NoBody {
+			reqBody = &limitedBuffer{max: c.maxBody}
+			r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+		}
+		// the proxy rewrites the request, keep what the client sent
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		request := &CaptureRequest{
+			Method:      r.Method,
+			URL:         scheme + "://" + r.Host + r.URL.RequestURI(),
+			HTTPVersion: r.Proto,
+			Headers:     captureHeaders(r.Header),
+		}
+
+		var forwardedURI string
+		r = r.WithContext(context.WithValue(r.Context(), forwardedURIKey{}, &forwardedURI))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK, body: &limitedBuffer{max: c.maxBody}}
+		handler.ServeHTTP(rec, r)
+		request.ForwardedURI = forwardedURI
+
+		if reqBody != nil && reqBody.Len() > 0 {
+			text, encoding := encodeCapturedBody(reqBody.Bytes())
+			request.PostData = &CapturePostData{
+				MimeType:  r.Header.Get("Content-Type"),
+				Text:      text,
+				Encoding:  encoding,
+				Truncated: reqBody.truncated,
+			}
+		}
+		text, encoding := encodeCapturedBody(rec.body.Bytes())
+		c.write(&CaptureEntry{
+			StartedDateTime: start,
+			Time:            float64(time.Since(start).Microseconds()) / 1000,
+			Request:         request,
+			Response: &CaptureResponse{
+				Status:     rec.status,
+				StatusText: http.StatusText(rec.status),
+				Headers:    captureHeaders(rec.Header()),
+				Content: &CaptureContent{
+					Size:      rec.size,
+					MimeType:  rec.Header().Get("Content-Type"),
+					Text:      text,
+					Encoding:  encoding,
+					Truncated: rec.body.truncated,
+				},
+			},
+		})
+	})
+}
+
+// ReadCapture reads the entries of a capture file
+func ReadCapture(file string) ([]*CaptureEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CaptureEntry
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var entry CaptureEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, i+1, err)
+		}
+		if entry.Request == nil || entry.Response == nil {
+			return nil, fmt.Errorf("%s:%d: missing request or response", file, i+1)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
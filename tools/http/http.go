@@ -1,87 +1,106 @@
 package http
 
 import (
+	"bufio"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"strconv"
-
-	"github.com/xhd2015/kool/pkgs/flag"
+	"strings"
+	"time"
 )
 
+const help = `
+kool http provides HTTP tools for development
+
+Usage: kool http <command> [OPTIONS]
+
+Commands:
+  serve [DIR]                      static file server with SPA fallback, CORS, compression and uploads
+  proxy --route PREFIX=URL...      reverse proxy routing by path prefix, with WebSockets and capture
+  replay FILE --target URL         replay captured requests and compare the responses
+  mock ROUTES_FILE                 fake backend from a yaml routes file, reloaded on change
+  request FILE.http|[METHOD] URL   run the requests of a .http file with assertions, or a single one
+
+Run 'kool http <command> --help' for the options of a command.
+`
+
 // Handle is the entry point for the HTTP tools
 func Handle(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("available commands: serve")
+		return fmt.Errorf("available commands: serve, proxy, replay, mock, request")
 	}
 
 	switch args[0] {
 	case "serve":
 		return handleServe(args[1:])
+	case "proxy":
+		return handleProxy(args[1:])
+	case "replay":
+		return handleReplay(args[1:])
+	case "mock":
+		return handleMock(args[1:])
+	case "request":
+		return handleRequest(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(strings.TrimPrefix(help, "\n"))
+		return nil
 	default:
 		return fmt.Errorf("unknown command: %s", args[0])
 	}
 }
 
-// handleServe implements a static file server
-func handleServe(args []string) error {
-	// Default port
-	port := 8080
+// logRequest is a middleware that logs HTTP requests with their status,
+// size and duration
+func logRequest(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		handler.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %dB %v", r.Method, r.URL.RequestURI(), rec.status, rec.size, time.Since(start).Round(time.Millisecond))
+	})
+}
 
-	// Parse flags
-	var remainArgs []string
-	n := len(args)
-	for i := 0; i < n; i++ {
-		flag, value := flag.ParseFlag(args, &i)
-		if flag == "" {
-			remainArgs = append(remainArgs, args[i])
-			continue
-		}
-		switch flag {
-		case "--port":
-			value, ok := value()
-			if !ok {
-				return fmt.Errorf("%s requires a port number", flag)
-			}
-			p, err := strconv.Atoi(value)
-			if err != nil {
-				return fmt.Errorf("invalid port number: %s", value)
-			}
-			if p < 1 || p > 65535 {
-				return fmt.Errorf("port number must be between 1 and 65535")
-			}
-			port = p
-		default:
-			return fmt.Errorf("unrecognized: %s", flag)
-		}
-	}
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+	// body keeps a copy of the response when set, for capture
+	body *limitedBuffer
+}
 
-	if len(remainArgs) > 1 {
-		return fmt.Errorf("unexpected argument: %v", remainArgs[1:])
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
 	}
+	r.ResponseWriter.WriteHeader(status)
+}
 
-	var dir string
-	if len(remainArgs) > 0 {
-		dir = remainArgs[0]
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.size += int64(n)
+	if r.body != nil {
+		r.body.Write(p[:n])
 	}
+	return n, err
+}
 
-	// Create a file server handler
-	fs := http.FileServer(http.Dir(dir))
-
-	// Set up the HTTP server
-	addr := fmt.Sprintf(":%d", port)
-	fmt.Printf("Starting HTTP server on http://localhost%s\n", addr)
-	fmt.Printf("Serving files from: %s\n", dir)
-	fmt.Println("Press Ctrl+C to stop")
-
-	// Start the server
-	return http.ListenAndServe(addr, logRequest(fs))
+// Hijack records the switch of protocols, the proxy writes the 101
+// response to the hijacked connection itself
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, brw, err
 }
 
-// logRequest is a middleware that logs HTTP requests
-func logRequest(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
-		handler.ServeHTTP(w, r)
-	})
+// Unwrap lets http.ResponseController reach the underlying writer, for
+// flushing streamed responses
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
@@ -0,0 +1,255 @@
+package http
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HTTPFile is a parsed .http file, as used by the VS Code REST Client and
+// the JetBrains HTTP client
+type HTTPFile struct {
+	// Variables are the @name = value lines, in order
+	Variables []*HTTPVariable
+	Requests  []*HTTPRequest
+}
+
+type HTTPVariable struct {
+	Name  string
+	Value string
+}
+
+// HTTPRequest is a request of a .http file, its fields still contain the
+// {{variable}} references
+type HTTPRequest struct {
+	// Name is set by # @name, referenced as {{name.response.body.$.path}}
+	Name string
+	// Title is the text after ###
+	Title   string
+	Line    int
+	Method  string
+	URL     string
+	Headers []*HTTPHeader
+	Body    string
+	// BodyFile is set by a body of < path, relative to the .http file
+	BodyFile string
+	// NoRedirect is set by # @no-redirect
+	NoRedirect bool
+	Assertions []*Assertion
+}
+
+type HTTPHeader struct {
+	Name  string
+	Value string
+}
+
+// Assertion is a ?? line, like ?? status == 200 or ?? body $.name == alice
+type Assertion struct {
+	Line   int
+	Source string
+	// Subject is status, header, body or duration
+	Subject string
+	// Arg is the header name or the JSONPath of the body
+	Arg      string
+	Operator string
+	Value    string
+}
+
+var (
+	fileVariableRegex = regexp.MustCompile(`^@([A-Za-z_][A-Za-z0-9_.-]*)\s*=\s*(.*)$`)
+	metaRegex         = regexp.MustCompile(`^(?:#|//)\s*@([A-Za-z-]+)\s*(.*)$`)
+	requestLineRegex  = regexp.MustCompile(`^(GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS|TRACE|CONNECT)\s+(\S+)(?:\s+HTTP/[0-9.]+)?$`)
+	headerRegex       = regexp.MustCompile(`^([!#$%&'*+.^_` + "`" + `|~0-9A-Za-z-]+)\s*:\s*(.*)$`)
+)
+
+var assertionOperators = []string{"==", "!=", "<=", ">=", "<", ">", "contains", "startsWith", "endsWith", "matches", "exists"}
+
+// ParseHTTPFile parses the requests separated by ### lines
+func ParseHTTPFile(content string) (*HTTPFile, error) {
+	file := &HTTPFile{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var block []string
+	blockStart := 1
+	title := ""
+	flush := func() error {
+		req, err := parseHTTPBlock(file, block, blockStart, title)
+		if err != nil {
+			return err
+		}
+		if req != nil {
+			file.Requests = append(file.Requests, req)
+		}
+		return nil
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, "###") {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			block = nil
+			blockStart = i + 2
+			title = strings.TrimSpace(strings.TrimPrefix(line, "###"))
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// parseHTTPBlock parses the lines between two ###, returning nil if there
+// is no request line, e.g. a block of variables only
+func parseHTTPBlock(file *HTTPFile, lines []string, firstLine int, title string) (*HTTPRequest, error) {
+	req := &HTTPRequest{Title: title}
+	i := 0
+	// variables, comments and meta before the request line
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if m := fileVariableRegex.FindStringSubmatch(line); m != nil {
+			file.Variables = append(file.Variables, &HTTPVariable{Name: m[1], Value: strings.TrimSpace(m[2])})
+			continue
+		}
+		if m := metaRegex.FindStringSubmatch(line); m != nil {
+			switch m[1] {
+			case "name":
+				req.Name = strings.TrimSpace(m[2])
+			case "no-redirect":
+				req.NoRedirect = true
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		break
+	}
+	if i >= len(lines) {
+		return nil, nil
+	}
+
+	req.Line = firstLine + i
+	requestLine := strings.TrimSpace(lines[i])
+	if m := requestLineRegex.FindStringSubmatch(requestLine); m != nil {
+		req.Method, req.URL = m[1], m[2]
+	} else if !strings.ContainsAny(requestLine, " \t") {
+		req.Method, req.URL = "GET", requestLine
+	} else {
+		return nil, fmt.Errorf("line %d: expects a request line like GET URL, found: %s", req.Line, requestLine)
+	}
+	i++
+	// multi-line query: lines starting with ? or &
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "?") && !strings.HasPrefix(line, "&") || strings.HasPrefix(line, "??") {
+			break
+		}
+		req.URL += line
+	}
+	// headers until the first empty line
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			i++
+			break
+		}
+		if strings.HasPrefix(line, "??") || strings.HasPrefix(line, ">") {
+			break
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		m := headerRegex.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expects a header like Name: value, found: %s", firstLine+i, line)
+		}
+		req.Headers = append(req.Headers, &HTTPHeader{Name: m[1], Value: m[2]})
+	}
+	// the body, with the assertions taken out
+	var body []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "??"):
+			assertion, err := parseAssertion(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", firstLine+i, err)
+			}
+			assertion.Line = firstLine + i
+			req.Assertions = append(req.Assertions, assertion)
+		case strings.HasPrefix(trimmed, "> ") || strings.HasPrefix(trimmed, ">>") || strings.HasPrefix(trimmed, "<> "):
+			// response handler scripts and response references are
+			// JetBrains features not supported here, skip them
+			if strings.HasPrefix(trimmed, "> {%") {
+				for ; i < len(lines) && !strings.Contains(lines[i], "%}"); i++ {
+				}
+			}
+		default:
+			body = append(body, line)
+		}
+	}
+	for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+	req.Body = strings.Join(body, "\n")
+	if len(body) == 1 && strings.HasPrefix(strings.TrimSpace(body[0]), "< ") {
+		req.BodyFile = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(body[0]), "< "))
+		req.Body = ""
+	}
+	return req, nil
+}
+
+// parseAssertion parses ?? SUBJECT [ARG] OPERATOR [VALUE]
+func parseAssertion(line string) (*Assertion, error) {
+	source := strings.TrimSpace(strings.TrimPrefix(line, "??"))
+	fields := strings.Fields(source)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty assertion")
+	}
+	assertion := &Assertion{Source: source, Subject: fields[0]}
+	rest := fields[1:]
+	switch assertion.Subject {
+	case "status", "duration":
+	case "header", "body":
+		// the argument is optional for body, meaning the whole body
+		if len(rest) > 0 && !isAssertionOperator(rest[0]) {
+			assertion.Arg = rest[0]
+			rest = rest[1:]
+		}
+		if assertion.Subject == "header" && assertion.Arg == "" {
+			return nil, fmt.Errorf("expects ?? header NAME OPERATOR VALUE: %s", source)
+		}
+	default:
+		return nil, fmt.Errorf("unknown assertion subject %q, expects status, header, body or duration", assertion.Subject)
+	}
+	if len(rest) == 0 || !isAssertionOperator(rest[0]) {
+		return nil, fmt.Errorf("expects an operator (%s): %s", strings.Join(assertionOperators, ", "), source)
+	}
+	assertion.Operator = rest[0]
+	// the value is the rest of the line, keeping its spaces
+	pos := len(assertion.Subject)
+	if assertion.Arg != "" {
+		pos += strings.Index(source[pos:], assertion.Arg) + len(assertion.Arg)
+	}
+	pos += strings.Index(source[pos:], assertion.Operator) + len(assertion.Operator)
+	assertion.Value = strings.TrimSpace(source[pos:])
+	if assertion.Operator != "exists" && assertion.Value == "" {
+		return nil, fmt.Errorf("expects a value after %s: %s", assertion.Operator, source)
+	}
+	return assertion, nil
+}
+
+func isAssertionOperator(s string) bool {
+	for _, op := range assertionOperators {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is a key, an index or the * wildcard
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the JSONPath subset of $.a.b, $['a'], $[0], $.a[*]
+// and $.*. The leading $ is optional.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	s := strings.TrimSpace(path)
+	s = strings.TrimPrefix(s, "$")
+	var steps []jsonPathStep
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			key := s[:end]
+			if key == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty key", path)
+			}
+			if key == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{key: key})
+			}
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: missing ]", path)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSONPath %q: bad index %q", path, inner)
+				}
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			// a path without the leading $. like name.first
+			if len(steps) == 0 {
+				s = "." + s
+				continue
+			}
+			return nil, fmt.Errorf("invalid JSONPath %q at %q", path, s)
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns the value at the path. With a wildcard the result
+// is the list of matches. ok is false if nothing matches.
+func evalJSONPath(v interface{}, path string) (result interface{}, ok bool, err error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	values := []interface{}{v}
+	hasWildcard := false
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range values {
+			switch {
+			case step.wildcard:
+				hasWildcard = true
+				switch value := value.(type) {
+				case []interface{}:
+					next = append(next, value...)
+				case map[string]interface{}:
+					for _, item := range value {
+						next = append(next, item)
+					}
+				}
+			case step.isIndex:
+				list, isList := value.([]interface{})
+				if !isList {
+					continue
+				}
+				index := step.index
+				if index < 0 {
+					index += len(list)
+				}
+				if index >= 0 && index < len(list) {
+					next = append(next, list[index])
+				}
+			default:
+				object, isObject := value.(map[string]interface{})
+				if !isObject {
+					continue
+				}
+				if item, exists := object[step.key]; exists {
+					next = append(next, item)
+				}
+			}
+		}
+		values = next
+	}
+	if hasWildcard {
+		return values, len(values) > 0, nil
+	}
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	return values[0], true, nil
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListingEntry is an entry of a directory listing
+type ListingEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"size": formatSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; min-width: 50%; }
+th, td { text-align: left; padding: 4px 16px 4px 0; }
+td.size, th.size { text-align: right; }
+a { color: #0969da; text-decoration: none; }
+a:hover { text-decoration: underline; }
+.muted { color: #6e7781; }
+form { margin: 1em 0; }
+</style>
+</head>
+<body>
+<h2>Index of {{.Path}}</h2>
+{{if .Upload}}<form method="post" enctype="multipart/form-data">
+<input type="file" name="file" multiple required> <button type="submit">Upload</button>
+</form>{{end}}
+<table>
+<tr><th>Name</th><th class="size">Size</th><th>Modified</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr>
+<td><a href="{{.Path}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td>
+<td class="size muted">{{if not .IsDir}}{{size .Size}}{{end}}</td>
+<td class="muted">{{.ModTime.Format "2006-01-02 15:04"}}</td>
+</tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+// serveListing lists the directory as html, or as json when asked by
+// ?format=json or Accept: application/json
+func (s *fileServer) serveListing(w http.ResponseWriter, r *http.Request, urlPath string, dirPath string) {
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	entries := make([]*ListingEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		entryPath := path.Join(urlPath, dirEntry.Name())
+		if info.IsDir() {
+			entryPath += "/"
+		}
+		entries = append(entries, &ListingEntry{
+			Name:    dirEntry.Name(),
+			Path:    entryPath,
+			IsDir:   info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	// directories first, then by name
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	listingTemplate.Execute(w, map[string]interface{}{
+		"Path":    urlPath,
+		"Entries": entries,
+		"Upload":  s.opts.Upload,
+	})
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,489 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xhd2015/kool/tools/watch"
+	"github.com/xhd2015/less-flags"
+	"gopkg.in/yaml.v3"
+)
+
+const mockHelp = `
+kool http mock serves a fake backend from a routes file
+
+Usage: kool http mock [OPTIONS] ROUTES_FILE
+
+The routes file is reloaded when it changes, a broken edit keeps the
+previous routes.
+
+Options:
+  --port PORT              port to listen on, default is 8080
+  --host ADDR              address to listen on, default is 127.0.0.1
+  --cors                   allow cross-origin requests, including preflight
+  --delay D                latency of the routes without their own delay, e.g. 200ms or 100ms-1s
+  --failure-rate F         fraction of requests failing, from 0 to 1, for the routes without
+                           their own failureRate
+  --no-watch               do not reload the routes file on change
+  -h,--help                show help message
+
+Routes file:
+
+  delay: 50ms                       # defaults for all routes, optional
+  failureRate: 0.05
+  failureStatus: 503
+  routes:
+    - method: GET                   # any method if omitted
+      path: /api/users/{id}         # {name} matches a segment, {name...} the rest
+      status: 200                   # default is 200
+      headers:
+        X-Mock: "true"
+      json: {"id": 1, "name": "alice"}
+    - path: /api/users/{id}/avatar
+      file: avatar.png              # relative to the routes file
+    - method: POST
+      path: /api/echo/{id}
+      delay: 100ms-500ms
+      failureRate: 0.5
+      template: |
+        {"id": "{{.Params.id}}", "q": "{{.Query.Get "q"}}", "got": {{json .JSON}}, "at": "{{now}}"}
+
+Each route has one of json, body (plain text), file or template. Templates
+are Go text/template with .Method, .Path, .Params, .Query, .Headers, .Body,
+.JSON (the parsed request body) and the functions json, now and uuid.
+`
+
+// MockConfig is the routes file of kool http mock
+type MockConfig struct {
+	Delay         string       `yaml:"delay"`
+	FailureRate   float64      `yaml:"failureRate"`
+	FailureStatus int          `yaml:"failureStatus"`
+	Routes        []*MockRoute `yaml:"routes"`
+}
+
+// MockRoute is a route of the routes file
+type MockRoute struct {
+	Method        string            `yaml:"method"`
+	Path          string            `yaml:"path"`
+	Status        int               `yaml:"status"`
+	Headers       map[string]string `yaml:"headers"`
+	JSON          interface{}       `yaml:"json"`
+	Body          *string           `yaml:"body"`
+	File          string            `yaml:"file"`
+	Template      string            `yaml:"template"`
+	Delay         string            `yaml:"delay"`
+	FailureRate   *float64          `yaml:"failureRate"`
+	FailureStatus int               `yaml:"failureStatus"`
+}
+
+// delayRange is a fixed latency, or a random one between min and max
+type delayRange struct {
+	min time.Duration
+	max time.Duration
+}
+
+func parseDelay(s string) (delayRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return delayRange{}, nil
+	}
+	minStr, maxStr, isRange := strings.Cut(s, "-")
+	min, err := time.ParseDuration(strings.TrimSpace(minStr))
+	if err != nil {
+		return delayRange{}, fmt.Errorf("invalid delay %q: %v", s, err)
+	}
+	max := min
+	if isRange {
+		max, err = time.ParseDuration(strings.TrimSpace(maxStr))
+		if err != nil {
+			return delayRange{}, fmt.Errorf("invalid delay %q: %v", s, err)
+		}
+		if max < min {
+			return delayRange{}, fmt.Errorf("invalid delay %q, max is less than min", s)
+		}
+	}
+	return delayRange{min: min, max: max}, nil
+}
+
+func (d delayRange) duration() time.Duration {
+	if d.max <= d.min {
+		return d.min
+	}
+	return d.min + time.Duration(rand.Int63n(int64(d.max-d.min)))
+}
+
+// mockDefaults are the command line settings, overriding the routes file
+type mockDefaults struct {
+	delay       string
+	failureRate string
+}
+
+// mockServer serves the routes of the last successfully loaded file
+type mockServer struct {
+	file     string
+	defaults mockDefaults
+	mux      atomic.Pointer[http.ServeMux]
+}
+
+func (s *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Load().ServeHTTP(w, r)
+}
+
+// load parses the routes file and swaps in its routes
+func (s *mockServer) load() (int, error) {
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return 0, err
+	}
+	var config MockConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return 0, fmt.Errorf("parse %s: %v", s.file, err)
+	}
+	if s.defaults.delay != "" {
+		config.Delay = s.defaults.delay
+	}
+	if s.defaults.failureRate != "" {
+		rate, err := strconv.ParseFloat(s.defaults.failureRate, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid --failure-rate: %v", err)
+		}
+		config.FailureRate = rate
+	}
+	mux, err := buildMockMux(&config, filepath.Dir(s.file))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", s.file, err)
+	}
+	s.mux.Store(mux)
+	return len(config.Routes), nil
+}
+
+var paramRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(\.\.\.)?\}`)
+
+var registeredAtRegex = regexp.MustCompile(` \(registered at [^)]*\)`)
+
+func buildMockMux(config *MockConfig, baseDir string) (*http.ServeMux, error) {
+	defaultDelay, err := parseDelay(config.Delay)
+	if err != nil {
+		return nil, err
+	}
+	if config.FailureRate < 0 || config.FailureRate > 1 {
+		return nil, fmt.Errorf("failureRate must be between 0 and 1")
+	}
+	mux := http.NewServeMux()
+	for i, route := range config.Routes {
+		handler, pattern, err := newMockRouteHandler(route, config, defaultDelay, baseDir)
+		if err == nil {
+			err = handleMockPattern(mux, pattern, handler)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("route %d (%s): %v", i+1, route.Path, err)
+		}
+	}
+	return mux, nil
+}
+
+// handleMockPattern reports invalid and conflicting patterns, which panic
+// in ServeMux
+func handleMockPattern(mux *http.ServeMux, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%s", registeredAtRegex.ReplaceAllString(fmt.Sprint(e), ""))
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+func newMockRouteHandler(route *MockRoute, config *MockConfig, defaultDelay delayRange, baseDir string) (http.Handler, string, error) {
+	if !strings.HasPrefix(route.Path, "/") {
+		return nil, "", fmt.Errorf("path must start with /")
+	}
+	sources := 0
+	for _, set := range []bool{route.JSON != nil, route.Body != nil, route.File != "", route.Template != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, "", fmt.Errorf("expects only one of json, body, file or template")
+	}
+
+	delay := defaultDelay
+	if route.Delay != "" {
+		var err error
+		delay, err = parseDelay(route.Delay)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	failureRate := config.FailureRate
+	if route.FailureRate != nil {
+		failureRate = *route.FailureRate
+	}
+	if failureRate < 0 || failureRate > 1 {
+		return nil, "", fmt.Errorf("failureRate must be between 0 and 1")
+	}
+	failureStatus := route.FailureStatus
+	if failureStatus == 0 {
+		failureStatus = config.FailureStatus
+	}
+	if failureStatus == 0 {
+		failureStatus = http.StatusInternalServerError
+	}
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var params []string
+	for _, m := range paramRegex.FindAllStringSubmatch(route.Path, -1) {
+		params = append(params, m[1])
+	}
+
+	var body func(r *http.Request, h http.Header) ([]byte, error)
+	switch {
+	case route.JSON != nil:
+		data, err := mockJSON(route.JSON)
+		if err != nil {
+			return nil, "", err
+		}
+		body = func(r *http.Request, h http.Header) ([]byte, error) {
+			setDefaultHeader(h, "Content-Type", "application/json")
+			return data, nil
+		}
+	case route.Body != nil:
+		data := []byte(*route.Body)
+		body = func(r *http.Request, h http.Header) ([]byte, error) {
+			setDefaultHeader(h, "Content-Type", "text/plain; charset=utf-8")
+			return data, nil
+		}
+	case route.File != "":
+		file := route.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(baseDir, file)
+		}
+		// read on each request, so editing the file needs no reload
+		body = func(r *http.Request, h http.Header) ([]byte, error) {
+			if contentType := mime.TypeByExtension(filepath.Ext(file)); contentType != "" {
+				setDefaultHeader(h, "Content-Type", contentType)
+			}
+			return os.ReadFile(file)
+		}
+	case route.Template != "":
+		tmpl, err := template.New(route.Path).Funcs(mockTemplateFuncs).Parse(route.Template)
+		if err != nil {
+			return nil, "", err
+		}
+		body = func(r *http.Request, h http.Header) ([]byte, error) {
+			data, err := newMockRequestData(r, params)
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return nil, err
+			}
+			if json.Valid(buf.Bytes()) {
+				setDefaultHeader(h, "Content-Type", "application/json")
+			} else {
+				setDefaultHeader(h, "Content-Type", "text/plain; charset=utf-8")
+			}
+			return buf.Bytes(), nil
+		}
+	default:
+		body = func(r *http.Request, h http.Header) ([]byte, error) {
+			return nil, nil
+		}
+	}
+
+	pattern := route.Path
+	if route.Method != "" {
+		pattern = strings.ToUpper(route.Method) + " " + route.Path
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d := delay.duration(); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if failureRate > 0 && rand.Float64() < failureRate {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Mock-Failure", "injected")
+			w.WriteHeader(failureStatus)
+			fmt.Fprintf(w, `{"error":"injected failure"}`)
+			return
+		}
+		header := make(http.Header)
+		for name, value := range route.Headers {
+			header.Set(name, value)
+		}
+		data, err := body(r, header)
+		if err != nil {
+			http.Error(w, "mock: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(status)
+		w.Write(data)
+	})
+	return handler, pattern, nil
+}
+
+// mockJSON encodes the yaml value as JSON, a string holding JSON is used
+// as is
+func mockJSON(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok && json.Valid([]byte(s)) {
+		return []byte(s), nil
+	}
+	return json.MarshalIndent(value, "", "  ")
+}
+
+func setDefaultHeader(h http.Header, name string, value string) {
+	if h.Get(name) == "" {
+		h.Set(name, value)
+	}
+}
+
+var mockTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"now": func() string {
+		return time.Now().Format(time.RFC3339)
+	},
+	"uuid": func() string {
+		return uuid.NewString()
+	},
+}
+
+// MockRequestData is the data of a route template
+type MockRequestData struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   url.Values
+	Headers http.Header
+	Body    string
+	// JSON is the parsed body, nil if it is not JSON
+	JSON interface{}
+}
+
+func newMockRequestData(r *http.Request, params []string) (*MockRequestData, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	data := &MockRequestData{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Params:  make(map[string]string, len(params)),
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+		Body:    string(body),
+	}
+	for _, name := range params {
+		data.Params[name] = r.PathValue(name)
+	}
+	if len(body) > 0 {
+		json.Unmarshal(body, &data.JSON)
+	}
+	return data, nil
+}
+
+func handleMock(args []string) error {
+	port := 8080
+	host := "127.0.0.1"
+	var enableCORS bool
+	var noWatch bool
+	var defaults mockDefaults
+	args, err := lessflags.Int("--port", &port).
+		String("--host", &host).
+		Bool("--cors", &enableCORS).
+		String("--delay", &defaults.delay).
+		String("--failure-rate", &defaults.failureRate).
+		Bool("--no-watch", &noWatch).
+		Help("-h,--help", mockHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires ROUTES_FILE, see --help")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unexpected argument: %v", args[1:])
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port number must be between 1 and 65535")
+	}
+	file, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	server := &mockServer{file: file, defaults: defaults}
+	n, err := server.load()
+	if err != nil {
+		return err
+	}
+
+	var handler http.Handler = server
+	if enableCORS {
+		handler = cors(handler, false)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mock server on http://%s with %d routes from %s\n", addr, n, args[0])
+	fmt.Println("Press Ctrl+C to stop")
+
+	httpServer := &http.Server{Handler: logRequest(handler)}
+	if noWatch {
+		return httpServer.Serve(listener)
+	}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}()
+	return watch.Watch(watch.WatchOptions{
+		Dir:      filepath.Dir(file),
+		Throttle: 200 * time.Millisecond,
+		Include:  []string{filepath.Base(file)},
+	}, func(changedFiles []string) {
+		// the first call is at start, the routes are already loaded
+		if len(changedFiles) == 0 {
+			return
+		}
+		n, err := server.load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to reload, keeping the previous routes: %v\n", err)
+			return
+		}
+		fmt.Printf("Reloaded %d routes\n", n)
+	})
+}
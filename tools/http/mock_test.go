@@ -0,0 +1,178 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRoutes = `
+routes:
+  - method: GET
+    path: /api/users/{id}
+    headers:
+      X-Mock: "true"
+    json: {"id": 1, "name": "alice"}
+  - method: DELETE
+    path: /api/users/{id}
+    status: 204
+  - path: /files/{rest...}
+    file: data.txt
+  - method: POST
+    path: /api/echo/{id}
+    template: '{"id": "{{.Params.id}}", "q": "{{.Query.Get "q"}}", "got": {{json .JSON}}}'
+  - path: /api/flaky
+    failureRate: 1
+    failureStatus: 503
+    body: ok
+  - path: /api/stable
+    failureRate: 0
+    body: ok
+`
+
+func newTestMockServer(t *testing.T, routes string, defaults mockDefaults) (*mockServer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "routes.yaml")
+	writeTestFile(t, file, routes)
+	writeTestFile(t, filepath.Join(dir, "data.txt"), "file content")
+	s := &mockServer{file: file, defaults: defaults}
+	if _, err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server.URL
+}
+
+func TestMockRoutes(t *testing.T) {
+	_, url := newTestMockServer(t, testRoutes, mockDefaults{})
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"GET", "/api/users/7", "", 200, `"name": "alice"`},
+		{"DELETE", "/api/users/7", "", 204, ""},
+		{"PUT", "/api/users/7", "", 405, ""},
+		{"GET", "/api/users/7/extra", "", 404, ""},
+		{"GET", "/files/a/b/c", "", 200, "file content"},
+		{"POST", "/api/echo/42?q=x", `{"a":1}`, 200, `{"id": "42", "q": "x", "got": {"a":1}}`},
+		{"GET", "/api/flaky", "", 503, "injected failure"},
+		{"GET", "/api/stable", "", 200, "ok"},
+	}
+	for _, tt := range tests {
+		resp := doRequest(t, tt.method, url+tt.path, tt.body, nil)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expect %d, got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+			continue
+		}
+		if body := readBody(t, resp); !strings.Contains(body, tt.want) {
+			t.Errorf("%s %s: expect body to contain %q, got %q", tt.method, tt.path, tt.want, body)
+		}
+	}
+
+	resp := doRequest(t, "GET", url+"/api/users/1", "", nil)
+	if resp.Header.Get("X-Mock") != "true" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers: %v", resp.Header)
+	}
+	resp = doRequest(t, "POST", url+"/api/echo/1", "{}", nil)
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expect template producing JSON to be application/json, got %q", resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestMockDefaults(t *testing.T) {
+	routes := `
+failureRate: 0
+routes:
+  - path: /a
+    body: a
+  - path: /b
+    delay: 0s
+    failureRate: 0
+    body: b
+`
+	// the command line overrides the routes file, the routes keep their own
+	_, url := newTestMockServer(t, routes, mockDefaults{delay: "100ms", failureRate: "1"})
+
+	start := time.Now()
+	resp := doRequest(t, "GET", url+"/a", "", nil)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expect /a to be delayed by 100ms, took %v", elapsed)
+	}
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("X-Mock-Failure") != "injected" {
+		t.Errorf("expect /a to fail with 500, got %d", resp.StatusCode)
+	}
+
+	start = time.Now()
+	resp = doRequest(t, "GET", url+"/b", "", nil)
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("expect /b not to be delayed, took %v", elapsed)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expect /b to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockReloadKeepsRoutesOnError(t *testing.T) {
+	s, url := newTestMockServer(t, testRoutes, mockDefaults{})
+
+	writeTestFile(t, s.file, "routes:\n  - path: /api/users/{id}\n    body: reloaded\n")
+	if _, err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, doRequest(t, "GET", url+"/api/users/1", "", nil)); body != "reloaded" {
+		t.Fatalf("expect reloaded routes, got %q", body)
+	}
+
+	broken := []string{
+		"routes: [",
+		"routes:\n  - path: /a\n    body: a\n    json: 1\n",
+		"routes:\n  - path: /a\n    failureRate: 2\n",
+		"routes:\n  - path: /a\n    delay: 2s-1s\n",
+		"routes:\n  - path: /a\n  - path: /a\n",
+		"routes:\n  - path: a\n",
+	}
+	for _, routes := range broken {
+		writeTestFile(t, s.file, routes)
+		if _, err := s.load(); err == nil {
+			t.Errorf("expect error loading %q", routes)
+		}
+	}
+	if body := readBody(t, doRequest(t, "GET", url+"/api/users/1", "", nil)); body != "reloaded" {
+		t.Fatalf("expect previous routes to be kept, got %q", body)
+	}
+}
+
+func TestParseDelay(t *testing.T) {
+	tests := []struct {
+		s   string
+		min time.Duration
+		max time.Duration
+		err bool
+	}{
+		{"", 0, 0, false},
+		{"200ms", 200 * time.Millisecond, 200 * time.Millisecond, false},
+		{"100ms - 1s", 100 * time.Millisecond, time.Second, false},
+		{"1s-100ms", 0, 0, true},
+		{"soon", 0, 0, true},
+	}
+	for _, tt := range tests {
+		d, err := parseDelay(tt.s)
+		if (err != nil) != tt.err || d.min != tt.min || d.max != tt.max {
+			t.Errorf("parseDelay(%q) = %v, %v, want %v-%v, err %v", tt.s, d, err, tt.min, tt.max, tt.err)
+		}
+		if err == nil {
+			if got := d.duration(); got < tt.min || got > tt.max {
+				t.Errorf("parseDelay(%q).duration() = %v, out of range", tt.s, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/less-flags"
+)
+
+const proxyHelp = `
+kool http proxy puts one origin in front of several dev servers
+
+Usage: kool http proxy --route PREFIX=URL [--route PREFIX=URL...] [OPTIONS]
+
+Requests are routed by the longest matching path prefix, the path is
+forwarded unchanged. WebSocket upgrades are passed through, e.g. for
+hot module reload.
+
+Options:
+  --route PREFIX=URL       route the paths under PREFIX to URL, repeatable
+  --port PORT              port to listen on, default is 8080
+  --host ADDR              address to listen on, default is 127.0.0.1
+  --strip-prefix           remove the route prefix from the forwarded path
+  --capture FILE           append the request/response pairs to FILE, one JSON line each,
+                           in the shape of HAR entries, see 'kool http replay'
+  --capture-max-body SIZE  bytes of a body to capture, default is 1048576
+  -h,--help                show help message
+
+Examples:
+  kool http proxy --route /api=http://127.0.0.1:8081 --route /=http://127.0.0.1:5173
+  kool http proxy --route /api=http://127.0.0.1:8081 --route /=http://127.0.0.1:5173 --capture capture.jsonl
+`
+
+// ProxyRoute routes the paths under Prefix to Target
+type ProxyRoute struct {
+	Prefix string
+	Target *url.URL
+}
+
+// ParseProxyRoute parses PREFIX=URL
+func ParseProxyRoute(s string) (*ProxyRoute, error) {
+	prefix, target, ok := strings.Cut(s, "=")
+	if !ok || prefix == "" || target == "" {
+		return nil, fmt.Errorf("invalid route %q, expects PREFIX=URL", s)
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("invalid route %q, prefix must start with /", s)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route %q: %v", s, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid route %q, expects an http or https URL", s)
+	}
+	return &ProxyRoute{Prefix: prefix, Target: u}, nil
+}
+
+func handleProxy(args []string) error {
+	var routeArgs []string
+	port := 8080
+	host := "127.0.0.1"
+	var stripPrefix bool
+	var captureFile string
+	captureMaxBody := DefaultCaptureMaxBody
+	args, err := lessflags.StringSlice("--route", &routeArgs).
+		Int("--port", &port).
+		String("--host", &host).
+		Bool("--strip-prefix", &stripPrefix).
+		String("--capture", &captureFile).
+		Int("--capture-max-body", &captureMaxBody).
+		Help("-h,--help", proxyHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected argument: %v", args)
+	}
+	if len(routeArgs) == 0 {
+		return fmt.Errorf("requires --route PREFIX=URL, see --help")
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port number must be between 1 and 65535")
+	}
+	routes := make([]*ProxyRoute, 0, len(routeArgs))
+	for _, arg := range routeArgs {
+		route, err := ParseProxyRoute(arg)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
+
+	handler := NewProxyHandler(routes, stripPrefix)
+	if captureFile != "" {
+		capture, err := OpenCapture(captureFile, captureMaxBody)
+		if err != nil {
+			return err
+		}
+		defer capture.Close()
+		handler = capture.Wrap(handler)
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	fmt.Printf("Starting proxy on http://%s\n", addr)
+	for _, route := range sortRoutes(routes) {
+		fmt.Printf("  %-20s -> %s\n", route.Prefix, route.Target)
+	}
+	if captureFile != "" {
+		fmt.Printf("Capturing to %s\n", captureFile)
+	}
+	fmt.Println("Press Ctrl+C to stop")
+	server := &http.Server{
+		Addr:    addr,
+		Handler: logRequest(handler),
+	}
+	return server.ListenAndServe()
+}
+
+// sortRoutes orders the routes by prefix length, longest first
+func sortRoutes(routes []*ProxyRoute) []*ProxyRoute {
+	sorted := append([]*ProxyRoute(nil), routes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	return sorted
+}
+
+// matchPrefix reports whether the path is under the prefix, at a
+// path segment boundary: /api matches /api and /api/users, not /apis
+func matchPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// NewProxyHandler forwards each request to the route with the longest
+// matching prefix. The Host header is set to the target's, as dev
+// servers like vite check it.
+func NewProxyHandler(routes []*ProxyRoute, stripPrefix bool) http.Handler {
+	sorted := sortRoutes(routes)
+	proxies := make([]*httputil.ReverseProxy, len(sorted))
+	for i, route := range sorted {
+		route := route
+		proxies[i] = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				if stripPrefix {
+					trimPrefix(pr.Out.URL, strings.TrimSuffix(route.Prefix, "/"))
+				}
+				recordForwardedURI(pr.In, pr.Out.URL.RequestURI())
+				pr.SetURL(route.Target)
+				pr.SetXForwarded()
+			},
+			// stream responses such as server-sent events as they come
+			FlushInterval: -1,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				http.Error(w, fmt.Sprintf("proxy %s: %v", route.Target, err), http.StatusBadGateway)
+			},
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i, route := range sorted {
+			if matchPrefix(r.URL.Path, route.Prefix) {
+				proxies[i].ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "no route for "+r.URL.Path, http.StatusNotFound)
+	})
+}
+
+func trimPrefix(u *url.URL, prefix string) {
+	u.Path = strings.TrimPrefix(u.Path, prefix)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+		if u.RawPath == "" {
+			u.RawPath = "/"
+		}
+	}
+}
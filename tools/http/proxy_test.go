@@ -0,0 +1,132 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProxyRouting(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s host=%s", name, r.URL.RequestURI(), r.Host)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	api := newBackend("api")
+	web := newBackend("web")
+	apiURL, _ := url.Parse(api.URL)
+	webURL, _ := url.Parse(web.URL)
+	routes := []*ProxyRoute{
+		{Prefix: "/", Target: webURL},
+		{Prefix: "/api", Target: apiURL},
+	}
+
+	proxy := httptest.NewServer(NewProxyHandler(routes, false))
+	defer proxy.Close()
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api", "api /api host=" + apiURL.Host},
+		{"/api/users?id=1", "api /api/users?id=1 host=" + apiURL.Host},
+		{"/apis", "web /apis host=" + webURL.Host},
+		{"/index.html", "web /index.html host=" + webURL.Host},
+	}
+	for _, tt := range tests {
+		if got := readBody(t, doRequest(t, "GET", proxy.URL+tt.path, "", nil)); got != tt.want {
+			t.Errorf("%s: expect %q, got %q", tt.path, tt.want, got)
+		}
+	}
+
+	stripped := httptest.NewServer(NewProxyHandler(routes, true))
+	defer stripped.Close()
+	if got := readBody(t, doRequest(t, "GET", stripped.URL+"/api/users", "", nil)); got != "api /users host="+apiURL.Host {
+		t.Errorf("expect /api to be stripped, got %q", got)
+	}
+	if got := readBody(t, doRequest(t, "GET", stripped.URL+"/api", "", nil)); got != "api / host="+apiURL.Host {
+		t.Errorf("expect /api to become /, got %q", got)
+	}
+}
+
+func TestProxyNoRouteAndBadGateway(t *testing.T) {
+	down, _ := url.Parse("http://127.0.0.1:1")
+	proxy := httptest.NewServer(NewProxyHandler([]*ProxyRoute{{Prefix: "/api", Target: down}}, false))
+	defer proxy.Close()
+
+	if resp := doRequest(t, "GET", proxy.URL+"/web", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expect 404 without a route, got %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, "GET", proxy.URL+"/api/x", "", nil); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expect 502 for a down target, got %d", resp.StatusCode)
+	}
+}
+
+func TestParseProxyRoute(t *testing.T) {
+	route, err := ParseProxyRoute("/api=http://127.0.0.1:8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.Prefix != "/api" || route.Target.String() != "http://127.0.0.1:8081" {
+		t.Errorf("unexpected route: %+v", route)
+	}
+	for _, s := range []string{"/api", "api=http://a", "/api=", "/api=ftp://a", "/api=127.0.0.1:8081"} {
+		if _, err := ParseProxyRoute(s); err == nil {
+			t.Errorf("ParseProxyRoute(%q): expect error", s)
+		}
+	}
+}
+
+func TestCaptureRecordsForwardedURI(t *testing.T) {
+	var paths []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		if r.URL.Path != "/users" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "users")
+	}))
+	defer api.Close()
+	apiURL, _ := url.Parse(api.URL)
+
+	file := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture, err := OpenCapture(file, DefaultCaptureMaxBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(capture.Wrap(NewProxyHandler([]*ProxyRoute{{Prefix: "/api", Target: apiURL}}, true)))
+	defer proxy.Close()
+	if got := readBody(t, doRequest(t, "GET", proxy.URL+"/api/users?id=1", "", nil)); got != "users" {
+		t.Fatalf("expect users, got %q", got)
+	}
+	capture.Close()
+
+	entries, err := ReadCapture(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expect 1 entry, got %d", len(entries))
+	}
+	request := entries[0].Request
+	if !strings.HasSuffix(request.URL, "/api/users?id=1") || request.ForwardedURI != "/users?id=1" {
+		t.Errorf("expect client /api/users?id=1 forwarded as /users?id=1, got %s and %s", request.URL, request.ForwardedURI)
+	}
+	if content := entries[0].Response.Content; entries[0].Response.Status != 200 || content.Text != "users" || content.Size != 5 {
+		t.Errorf("unexpected captured response: %d %+v", entries[0].Response.Status, content)
+	}
+
+	// replay sends the forwarded path, --only matches what the client sent
+	if err := handleReplay([]string{file, "--target", api.URL, "--only", "/api"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[1] != "/users?id=1" {
+		t.Errorf("expect replay of /users?id=1, got %v", paths)
+	}
+}
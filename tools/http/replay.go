@@ -0,0 +1,250 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/less-flags"
+)
+
+const replayHelp = `
+kool http replay sends the requests of a capture file again and compares the responses
+
+Usage: kool http replay CAPTURE_FILE --target URL [OPTIONS]
+
+CAPTURE_FILE is written by 'kool http proxy --capture'. Each request is sent
+to the target in order, keeping its path, query, headers and body. The path is
+the one the proxy forwarded, i.e. without the prefix removed by --strip-prefix. A response
+whose status differs from the captured one is a failure, the command exits
+non-zero if there is any.
+
+Options:
+  --target URL             the server to send the requests to, required
+  --compare-body           also compare the bodies, JSON is compared by value
+  --only PREFIX            replay only the requests the client sent under the path PREFIX
+  --timeout DURATION       timeout of each request, default is 30s
+  -h,--help                show help message
+
+Examples:
+  kool http replay capture.jsonl --target http://127.0.0.1:8081
+  kool http replay capture.jsonl --target http://127.0.0.1:8081 --only /api --compare-body
+`
+
+// hop-by-hop and per connection headers are not replayed. Accept-Encoding
+// is left to the client, which then decompresses the response.
+var replaySkipHeaders = map[string]bool{
+	"Host":                true,
+	"Content-Length":      true,
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Connection":    true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Accept-Encoding":     true,
+}
+
+func handleReplay(args []string) error {
+	var target string
+	var compareBody bool
+	var only string
+	timeout := 30 * time.Second
+	args, err := lessflags.String("--target", &target).
+		Bool("--compare-body", &compareBody).
+		String("--only", &only).
+		Duration("--timeout", &timeout).
+		Help("-h,--help", replayHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires CAPTURE_FILE, see --help")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unexpected argument: %v", args[1:])
+	}
+	if target == "" {
+		return fmt.Errorf("requires --target URL")
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid --target: %v", err)
+	}
+	if (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+		return fmt.Errorf("invalid --target %q, expects an http or https URL", target)
+	}
+
+	entries, err := ReadCapture(args[0])
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		// compare the captured redirects, not where they lead
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var passed, failed, skipped int
+	for _, entry := range entries {
+		if only != "" {
+			clientURL, err := url.Parse(entry.Request.URL)
+			if err != nil {
+				return fmt.Errorf("invalid captured url %q: %v", entry.Request.URL, err)
+			}
+			if !matchPrefix(clientURL.Path, only) {
+				continue
+			}
+		}
+		uri, err := entry.Request.ReplayURI()
+		if err != nil {
+			return err
+		}
+		reqURL, err := replayURL(targetURL, uri)
+		if err != nil {
+			return err
+		}
+		label := entry.Request.Method + " " + reqURL.RequestURI()
+		if entry.Response.Status == http.StatusSwitchingProtocols {
+			fmt.Printf("SKIP %s: upgraded connection\n", label)
+			skipped++
+			continue
+		}
+		start := time.Now()
+		problems, err := replayEntry(client, reqURL, entry, compareBody)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		if len(problems) > 0 {
+			fmt.Printf("FAIL %s (%v)\n", label, elapsed)
+			for _, problem := range problems {
+				fmt.Printf("       %s\n", problem)
+			}
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s %d (%v)\n", label, entry.Response.Status, elapsed)
+		passed++
+	}
+	fmt.Printf("\n%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d requests differ from the capture", failed, passed+failed)
+	}
+	return nil
+}
+
+// replayURL moves the captured request URI to the target, prepending
+// the target's path
+func replayURL(target *url.URL, uri string) (*url.URL, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid captured url %q: %v", uri, err)
+	}
+	out := *target
+	out.Path = strings.TrimSuffix(target.Path, "/") + u.Path
+	out.RawPath = ""
+	out.RawQuery = u.RawQuery
+	return &out, nil
+}
+
+// replayEntry sends the captured request, returning how the response
+// differs from the captured one
+func replayEntry(client *http.Client, reqURL *url.URL, entry *CaptureEntry, compareBody bool) ([]string, error) {
+	var body io.Reader
+	if entry.Request.PostData != nil {
+		if entry.Request.PostData.Truncated {
+			return nil, fmt.Errorf("request body was truncated in the capture")
+		}
+		data, err := entry.Request.PostData.Body()
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(entry.Request.Method, reqURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range entry.Request.Headers {
+		if replaySkipHeaders[http.CanonicalHeaderKey(h.Name)] {
+			continue
+		}
+		req.Header.Add(h.Name, h.Value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	actual, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	if resp.StatusCode != entry.Response.Status {
+		problems = append(problems, fmt.Sprintf("status %d, captured %d", resp.StatusCode, entry.Response.Status))
+	}
+	if compareBody && entry.Response.Content != nil && !entry.Response.Content.Truncated {
+		expected, err := capturedResponseBody(entry.Response)
+		if err != nil {
+			return problems, err
+		}
+		if !sameBody(expected, actual) {
+			problems = append(problems, fmt.Sprintf("body differs: %s, captured %s", bodyPreview(actual), bodyPreview(expected)))
+		}
+	}
+	return problems, nil
+}
+
+// capturedResponseBody returns the captured body, decompressed if the
+// upstream sent it gzipped
+func capturedResponseBody(resp *CaptureResponse) ([]byte, error) {
+	data, err := resp.Content.Body()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(resp.Header("Content-Encoding"), "gzip") {
+		return data, nil
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("captured body: %v", err)
+	}
+	return io.ReadAll(gr)
+}
+
+// sameBody compares JSON by value, so formatting and key order do not
+// matter, anything else byte by byte
+func sameBody(expected []byte, actual []byte) bool {
+	if bytes.Equal(expected, actual) {
+		return true
+	}
+	var expectedValue, actualValue interface{}
+	if json.Unmarshal(expected, &expectedValue) != nil || json.Unmarshal(actual, &actualValue) != nil {
+		return false
+	}
+	return reflect.DeepEqual(expectedValue, actualValue)
+}
+
+func bodyPreview(body []byte) string {
+	const max = 80
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return fmt.Sprintf("%q", s)
+}
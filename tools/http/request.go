@@ -0,0 +1,917 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/xhd2015/kool/pkgs/errs"
+	"github.com/xhd2015/kool/tools/jsontool"
+	"github.com/xhd2015/less-flags"
+	"golang.org/x/term"
+)
+
+const requestHelp = `
+kool http request runs the requests of a .http file, or a single request like curl
+
+Usage: kool http request [OPTIONS] FILE.http
+       kool http request [OPTIONS] [METHOD] URL
+
+Options:
+  --env NAME               use the environment NAME of http-client.env.json and
+                           http-client.private.env.json next to the .http file
+  --env-file FILE          read the environments from FILE instead, a .json file like
+                           http-client.env.json, or a .env file of NAME=value lines
+  --var NAME=VALUE         set a variable, overriding the file and the env, repeatable
+  --name NAME              run only the request NAME, repeatable, requests it references run too
+  -H,--header 'K: V'       add a header, for a single request
+  -d,--data BODY           the body of a single request, @FILE reads it from FILE
+  --assert 'EXPR'          an assertion like 'status == 200' for a single request, repeatable
+  -i,--include             print the response headers
+  -v,--verbose             print the request headers and body too
+  -k,--insecure            skip TLS certificate verification
+  --timeout DURATION       timeout of each request, default is 30s
+  --fail-fast              stop at the first failed request or assertion
+  --no-color               disable colors, also disabled by NO_COLOR or when not a terminal
+  -h,--help                show help message
+
+.http file:
+
+  @host = http://localhost:8080
+
+  ### login
+  # @name login
+  POST {{host}}/api/login
+  Content-Type: application/json
+
+  {"user": "alice", "password": "{{password}}"}
+
+  ?? status == 200
+  ?? body $.token exists
+
+  ### profile
+  GET {{host}}/api/me
+  Authorization: Bearer {{login.response.body.$.token}}
+
+  ?? header Content-Type contains json
+  ?? body $.name == alice
+  ?? duration < 500
+
+Requests are separated by ###. Variables come from --var, @name = value
+lines, and the env, in that order. {{NAME.response.body.JSONPATH}} and
+{{NAME.response.headers.HEADER}} capture from the response of the request
+named NAME. {{$uuid}}, {{$timestamp}}, {{$isoTimestamp}}, {{$randomInt MIN MAX}}
+and {{$processEnv NAME}} are built in.
+
+Assertions are ?? status|duration|header NAME|body [JSONPATH] OPERATOR VALUE,
+the operators are ==, !=, <, <=, >, >=, contains, startsWith, endsWith,
+matches and exists. The exit code is non-zero if a request or an assertion
+fails.
+
+Examples:
+  kool http request api.http --env dev
+  kool http request api.http --env dev --name login
+  kool http request POST localhost:8080/api/echo -d '{"a": 1}' --assert 'status == 200'
+`
+
+// httpFileSuffixes are the extensions of request files, anything else is
+// taken as a URL
+var httpFileSuffixes = []string{".http", ".rest"}
+
+var httpMethods = map[string]bool{
+	"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+	"HEAD": true, "OPTIONS": true, "TRACE": true, "CONNECT": true,
+}
+
+func handleRequest(args []string) error {
+	var envName string
+	var envFile string
+	var varArgs []string
+	var names []string
+	var headerArgs []string
+	var data string
+	var assertArgs []string
+	var include bool
+	var verbose bool
+	var insecure bool
+	timeout := 30 * time.Second
+	var failFast bool
+	var noColor bool
+	args, err := lessflags.String("--env", &envName).
+		String("--env-file", &envFile).
+		StringSlice("--var", &varArgs).
+		StringSlice("--name", &names).
+		StringSlice("-H,--header", &headerArgs).
+		String("-d,--data", &data).
+		StringSlice("--assert", &assertArgs).
+		Bool("-i,--include", &include).
+		Bool("-v,--verbose", &verbose).
+		Bool("-k,--insecure", &insecure).
+		Duration("--timeout", &timeout).
+		Bool("--fail-fast", &failFast).
+		Bool("--no-color", &noColor).
+		Help("-h,--help", requestHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires FILE.http or URL, see --help")
+	}
+
+	vars := make(map[string]string, len(varArgs))
+	for _, arg := range varArgs {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --var %q, expects NAME=VALUE", arg)
+		}
+		vars[name] = value
+	}
+
+	var file *HTTPFile
+	baseDir := "."
+	if len(args) == 1 && isHTTPFile(args[0]) {
+		if len(headerArgs) > 0 || data != "" || len(assertArgs) > 0 {
+			return fmt.Errorf("--header, --data and --assert are for a single request, put them in the .http file")
+		}
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		file, err = ParseHTTPFile(string(content))
+		if err != nil {
+			return fmt.Errorf("%s:%v", args[0], err)
+		}
+		baseDir = filepath.Dir(args[0])
+	} else {
+		req, err := newSingleRequest(args, headerArgs, data, assertArgs)
+		if err != nil {
+			return err
+		}
+		file = &HTTPFile{Requests: []*HTTPRequest{req}}
+	}
+
+	env, err := loadRequestEnv(baseDir, envName, envFile)
+	if err != nil {
+		return err
+	}
+
+	runner := newRequestRunner(file, baseDir, vars, env, timeout, insecure)
+	runner.include = include || verbose
+	runner.verbose = verbose
+	runner.failFast = failFast
+	runner.color = !noColor && os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+
+	requests := file.Requests
+	if len(names) > 0 {
+		requests = nil
+		for _, name := range names {
+			req := file.find(name)
+			if req == nil {
+				return fmt.Errorf("no request named %s", name)
+			}
+			requests = append(requests, req)
+		}
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("no requests found")
+	}
+	return runner.runAll(requests)
+}
+
+func isHTTPFile(arg string) bool {
+	for _, suffix := range httpFileSuffixes {
+		if strings.HasSuffix(arg, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSingleRequest builds the request of [METHOD] URL and the curl-like
+// flags
+func newSingleRequest(args []string, headerArgs []string, data string, assertArgs []string) (*HTTPRequest, error) {
+	req := &HTTPRequest{Method: "GET"}
+	switch {
+	case len(args) == 1:
+		req.URL = args[0]
+	case len(args) == 2 && httpMethods[strings.ToUpper(args[0])]:
+		req.Method, req.URL = strings.ToUpper(args[0]), args[1]
+	default:
+		return nil, fmt.Errorf("expects [METHOD] URL, found: %s", strings.Join(args, " "))
+	}
+	if data != "" {
+		if len(args) == 1 {
+			req.Method = "POST"
+		}
+		if strings.HasPrefix(data, "@") {
+			req.BodyFile = data[1:]
+		} else {
+			req.Body = data
+		}
+	}
+	for _, arg := range headerArgs {
+		m := headerRegex.FindStringSubmatch(strings.TrimSpace(arg))
+		if m == nil {
+			return nil, fmt.Errorf("invalid --header %q, expects 'Name: value'", arg)
+		}
+		req.Headers = append(req.Headers, &HTTPHeader{Name: m[1], Value: m[2]})
+	}
+	if data != "" && req.header("Content-Type") == "" && json.Valid([]byte(data)) {
+		req.Headers = append(req.Headers, &HTTPHeader{Name: "Content-Type", Value: "application/json"})
+	}
+	for _, arg := range assertArgs {
+		assertion, err := parseAssertion(arg)
+		if err != nil {
+			return nil, fmt.Errorf("--assert: %v", err)
+		}
+		req.Assertions = append(req.Assertions, assertion)
+	}
+	return req, nil
+}
+
+func (f *HTTPFile) find(name string) *HTTPRequest {
+	for _, req := range f.Requests {
+		if req.Name == name || (req.Name == "" && req.Title == name) {
+			return req
+		}
+	}
+	return nil
+}
+
+func (r *HTTPRequest) header(name string) string {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// loadRequestEnv reads the variables of the env. Without --env-file, the
+// JetBrains http-client.env.json and http-client.private.env.json next to
+// the .http file are merged, each with its $shared env applied first.
+func loadRequestEnv(baseDir string, envName string, envFile string) (map[string]string, error) {
+	env := make(map[string]string)
+	if envFile != "" && !strings.HasSuffix(envFile, ".json") {
+		content, err := os.ReadFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: expects NAME=value", envFile, i+1)
+			}
+			value = strings.TrimSpace(value)
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = value[1 : len(value)-1]
+			}
+			env[strings.TrimSpace(name)] = value
+		}
+		return env, nil
+	}
+
+	files := []string{envFile}
+	if envFile == "" {
+		if envName == "" {
+			return env, nil
+		}
+		files = []string{
+			filepath.Join(baseDir, "http-client.env.json"),
+			filepath.Join(baseDir, "http-client.private.env.json"),
+		}
+	}
+	found := false
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) && envFile == "" {
+				continue
+			}
+			return nil, err
+		}
+		var envs map[string]map[string]interface{}
+		if err := json.Unmarshal(content, &envs); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", file, err)
+		}
+		for _, name := range []string{"$shared", envName} {
+			values, ok := envs[name]
+			if !ok {
+				continue
+			}
+			if name == envName {
+				found = true
+			}
+			for k, v := range values {
+				env[k] = jsonValueString(v)
+			}
+		}
+	}
+	if envName != "" && !found {
+		return nil, fmt.Errorf("env %s not found in %s", envName, strings.Join(files, ", "))
+	}
+	return env, nil
+}
+
+// requestResult is a response, kept for the captures of later requests
+type requestResult struct {
+	status   int
+	proto    string
+	header   http.Header
+	body     []byte
+	duration time.Duration
+
+	reqHeader http.Header
+	reqBody   []byte
+
+	parsed  bool
+	json    interface{}
+	jsonErr error
+}
+
+// bodyJSON parses the body once
+func (res *requestResult) bodyJSON() (interface{}, error) {
+	if !res.parsed {
+		res.parsed = true
+		res.jsonErr = json.Unmarshal(res.body, &res.json)
+		if res.jsonErr != nil {
+			res.jsonErr = fmt.Errorf("body is not JSON: %v", res.jsonErr)
+		}
+	}
+	return res.json, res.jsonErr
+}
+
+type requestRunner struct {
+	file     *HTTPFile
+	baseDir  string
+	vars     map[string]string
+	fileVars map[string]string
+	env      map[string]string
+
+	client     *http.Client
+	noRedirect *http.Client
+
+	include  bool
+	verbose  bool
+	color    bool
+	failFast bool
+	out      io.Writer
+
+	results map[string]*requestResult
+	// failed holds the error of the named requests that got no response,
+	// so that they are not sent again
+	failed  map[string]error
+	running map[*HTTPRequest]bool
+
+	requests, failedRequests     int
+	passedAsserts, failedAsserts int
+}
+
+func newRequestRunner(file *HTTPFile, baseDir string, vars map[string]string, env map[string]string, timeout time.Duration, insecure bool) *requestRunner {
+	fileVars := make(map[string]string, len(file.Variables))
+	for _, v := range file.Variables {
+		fileVars[v.Name] = v.Value
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &requestRunner{
+		file:     file,
+		baseDir:  baseDir,
+		vars:     vars,
+		fileVars: fileVars,
+		env:      env,
+		client:   &http.Client{Transport: transport, Timeout: timeout},
+		noRedirect: &http.Client{Transport: transport, Timeout: timeout, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+		out:     os.Stdout,
+		results: make(map[string]*requestResult),
+		failed:  make(map[string]error),
+		running: make(map[*HTTPRequest]bool),
+	}
+}
+
+func (r *requestRunner) runAll(requests []*HTTPRequest) error {
+	for _, req := range requests {
+		if req.Name != "" && (r.results[req.Name] != nil || r.failed[req.Name] != nil) {
+			// already run for a capture of an earlier request
+			continue
+		}
+		_, err := r.run(req)
+		if err != nil && r.failFast {
+			break
+		}
+	}
+	if r.requests > 1 || r.passedAsserts+r.failedAsserts > 0 {
+		summary := plural(r.requests, "request")
+		if r.failedRequests > 0 {
+			summary += fmt.Sprintf(", %d failed", r.failedRequests)
+		}
+		if r.passedAsserts+r.failedAsserts > 0 {
+			summary += fmt.Sprintf(", %s passed, %d failed", plural(r.passedAsserts, "assertion"), r.failedAsserts)
+		}
+		fmt.Fprintln(r.out, r.paint(colorDim, summary))
+	}
+	if r.failedRequests > 0 || r.failedAsserts > 0 {
+		return errs.NewSilenceExitCode(1)
+	}
+	return nil
+}
+
+// run sends the request, prints the response and checks the assertions
+func (r *requestRunner) run(req *HTTPRequest) (*requestResult, error) {
+	r.running[req] = true
+	defer delete(r.running, req)
+	r.requests++
+
+	title := req.Title
+	if title == "" {
+		title = req.Name
+	}
+	// resolving the variables may run the referenced requests, print
+	// this one after them
+	httpReq, body, err := r.prepare(req)
+	if title != "" {
+		fmt.Fprintln(r.out, r.paint(colorDim, "### "+title))
+	}
+	var res *requestResult
+	if err == nil {
+		res, err = r.send(req, httpReq, body)
+	}
+	if err != nil {
+		r.failedRequests++
+		if req.Name != "" {
+			r.failed[req.Name] = err
+		}
+		fmt.Fprintf(r.out, "%s %s\n\n", r.paint(colorRed, "error:"), err)
+		return nil, err
+	}
+	if req.Name != "" {
+		r.results[req.Name] = res
+	}
+	r.printResponse(res)
+
+	failed := 0
+	for _, assertion := range req.Assertions {
+		ok, detail := r.check(assertion, res)
+		if ok {
+			r.passedAsserts++
+			fmt.Fprintf(r.out, "  %s %s\n", r.paint(colorGreen, "✓"), assertion.Source)
+			continue
+		}
+		failed++
+		r.failedAsserts++
+		fmt.Fprintf(r.out, "  %s %s %s\n", r.paint(colorRed, "✗"), assertion.Source, r.paint(colorRed, "("+detail+")"))
+	}
+	fmt.Fprintln(r.out)
+	if failed > 0 {
+		return res, fmt.Errorf("%d assertions failed", failed)
+	}
+	return res, nil
+}
+
+// prepare resolves the variables of the request
+func (r *requestRunner) prepare(req *HTTPRequest) (*http.Request, []byte, error) {
+	rawURL, err := r.resolve(req.URL, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	var body []byte
+	if req.BodyFile != "" {
+		bodyFile := req.BodyFile
+		if !filepath.IsAbs(bodyFile) {
+			bodyFile = filepath.Join(r.baseDir, bodyFile)
+		}
+		body, err = os.ReadFile(bodyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if req.Body != "" {
+		resolved, err := r.resolve(req.Body, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = []byte(resolved)
+	}
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequest(req.Method, rawURL, bodyReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, h := range req.Headers {
+		value, err := r.resolve(h.Value, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.EqualFold(h.Name, "Host") {
+			httpReq.Host = value
+			continue
+		}
+		httpReq.Header.Add(h.Name, value)
+	}
+	return httpReq, body, nil
+}
+
+func (r *requestRunner) send(req *HTTPRequest, httpReq *http.Request, body []byte) (*requestResult, error) {
+	fmt.Fprintf(r.out, "%s %s\n", r.paint(colorBold, req.Method), httpReq.URL)
+	if r.verbose {
+		r.printHeaders(httpReq.Header)
+		if len(body) > 0 {
+			fmt.Fprintln(r.out)
+			r.printBody(httpReq.Header.Get("Content-Type"), body)
+		}
+		fmt.Fprintln(r.out)
+	}
+
+	client := r.client
+	if req.NoRedirect {
+		client = r.noRedirect
+	}
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &requestResult{
+		status:    resp.StatusCode,
+		proto:     resp.Proto,
+		header:    resp.Header,
+		body:      respBody,
+		duration:  time.Since(start),
+		reqHeader: httpReq.Header,
+		reqBody:   body,
+	}, nil
+}
+
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorDim    = "\033[90m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+)
+
+func (r *requestRunner) paint(color string, s string) string {
+	if !r.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (r *requestRunner) printResponse(res *requestResult) {
+	statusColor := colorGreen
+	switch {
+	case res.status >= 400:
+		statusColor = colorRed
+	case res.status >= 300:
+		statusColor = colorYellow
+	}
+	status := fmt.Sprintf("%s %d %s", res.proto, res.status, http.StatusText(res.status))
+	fmt.Fprintf(r.out, "%s %s\n", r.paint(statusColor, status), r.paint(colorDim, fmt.Sprintf("%v, %s", res.duration.Round(time.Millisecond), formatSize(int64(len(res.body))))))
+	if r.include {
+		r.printHeaders(res.header)
+	}
+	if len(res.body) > 0 {
+		fmt.Fprintln(r.out)
+		r.printBody(res.header.Get("Content-Type"), res.body)
+	}
+}
+
+func (r *requestRunner) printHeaders(header http.Header) {
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			fmt.Fprintf(r.out, "%s %s\n", r.paint(colorCyan, name+":"), value)
+		}
+	}
+}
+
+// printBody pretty prints JSON, prints text as is and only the size of
+// anything else
+func (r *requestRunner) printBody(contentType string, body []byte) {
+	if strings.Contains(contentType, "json") || json.Valid(body) {
+		if pretty, err := jsontool.Pretty(body); err == nil {
+			if r.color {
+				fmt.Fprint(r.out, jsontool.Colorize(pretty))
+			} else {
+				r.out.Write(pretty)
+			}
+			return
+		}
+	}
+	if !utf8.Valid(body) {
+		fmt.Fprintln(r.out, r.paint(colorDim, fmt.Sprintf("<binary body, %s>", formatSize(int64(len(body))))))
+		return
+	}
+	r.out.Write(body)
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		fmt.Fprintln(r.out)
+	}
+}
+
+func sortedKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var variableRegex = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+
+// requestRefRegex matches NAME.response.body.PATH and
+// NAME.response.headers.NAME, and the same of the request
+var requestRefRegex = regexp.MustCompile(`^([A-Za-z_][\w-]*)\.(request|response)\.(body|headers)(?:\.(.*))?$`)
+
+// resolve replaces the {{...}} references of s
+func (r *requestRunner) resolve(s string, depth int) (string, error) {
+	if depth > 10 {
+		return "", fmt.Errorf("variables nested too deep, is there a cycle? %s", s)
+	}
+	var firstErr error
+	result := variableRegex.ReplaceAllStringFunc(s, func(m string) string {
+		expr := variableRegex.FindStringSubmatch(m)[1]
+		value, err := r.lookup(expr, depth)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return m
+		}
+		return value
+	})
+	return result, firstErr
+}
+
+func (r *requestRunner) lookup(expr string, depth int) (string, error) {
+	if strings.HasPrefix(expr, "$") {
+		return systemVariable(expr)
+	}
+	if m := requestRefRegex.FindStringSubmatch(expr); m != nil {
+		return r.requestReference(m[1], m[2], m[3], m[4])
+	}
+	if value, ok := r.vars[expr]; ok {
+		return value, nil
+	}
+	if value, ok := r.fileVars[expr]; ok {
+		return r.resolve(value, depth+1)
+	}
+	if value, ok := r.env[expr]; ok {
+		return r.resolve(value, depth+1)
+	}
+	return "", fmt.Errorf("undefined variable %s", expr)
+}
+
+// requestReference returns a part of the request named name, running it
+// first if it has not run yet
+func (r *requestRunner) requestReference(name string, side string, part string, path string) (string, error) {
+	if err := r.failed[name]; err != nil {
+		return "", fmt.Errorf("request %s failed: %v", name, err)
+	}
+	res := r.results[name]
+	if res == nil {
+		req := r.file.find(name)
+		if req == nil {
+			return "", fmt.Errorf("no request named %s", name)
+		}
+		if r.running[req] {
+			return "", fmt.Errorf("request %s references itself", name)
+		}
+		var err error
+		res, err = r.run(req)
+		if res == nil {
+			return "", fmt.Errorf("request %s failed: %v", name, err)
+		}
+	}
+	header, body := res.header, res.body
+	if side == "request" {
+		header, body = res.reqHeader, res.reqBody
+	}
+	if part == "headers" {
+		if path == "" {
+			return "", fmt.Errorf("expects %s.%s.headers.NAME", name, side)
+		}
+		return header.Get(path), nil
+	}
+	if path == "" || path == "*" {
+		return string(body), nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", fmt.Errorf("%s.%s.body is not JSON", name, side)
+	}
+	value, ok, err := evalJSONPath(v, path)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s.%s.body: nothing at %s", name, side, path)
+	}
+	return jsonValueString(value), nil
+}
+
+// systemVariable evaluates the built in {{$...}} variables
+func systemVariable(expr string) (string, error) {
+	fields := strings.Fields(expr)
+	switch fields[0] {
+	case "$uuid", "$guid", "$random.uuid":
+		return uuid.NewString(), nil
+	case "$timestamp":
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+	case "$isoTimestamp":
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case "$datetime":
+		if len(fields) > 1 && fields[1] == "rfc1123" {
+			return time.Now().UTC().Format(time.RFC1123), nil
+		}
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case "$randomInt", "$random.integer":
+		min, max := 0, 1000
+		if len(fields) == 3 {
+			var err1, err2 error
+			min, err1 = strconv.Atoi(fields[1])
+			max, err2 = strconv.Atoi(fields[2])
+			if err1 != nil || err2 != nil || max <= min {
+				return "", fmt.Errorf("expects {{$randomInt MIN MAX}}: %s", expr)
+			}
+		}
+		return strconv.Itoa(min + rand.Intn(max-min)), nil
+	case "$processEnv":
+		if len(fields) != 2 {
+			return "", fmt.Errorf("expects {{$processEnv NAME}}: %s", expr)
+		}
+		return os.Getenv(fields[1]), nil
+	}
+	return "", fmt.Errorf("unknown system variable %s", fields[0])
+}
+
+// jsonValueString returns strings as is and other values as JSON
+func jsonValueString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// check evaluates the assertion, returning what was found if it fails
+func (r *requestRunner) check(a *Assertion, res *requestResult) (bool, string) {
+	expected, err := r.resolve(a.Value, 0)
+	if err != nil {
+		return false, err.Error()
+	}
+	var actual string
+	exists := true
+	switch a.Subject {
+	case "status":
+		actual = strconv.Itoa(res.status)
+	case "duration":
+		actual = strconv.FormatInt(res.duration.Milliseconds(), 10)
+		// the value is in milliseconds, or a duration like 1s
+		if d, err := time.ParseDuration(expected); err == nil {
+			expected = strconv.FormatInt(d.Milliseconds(), 10)
+		}
+	case "header":
+		values, ok := res.header[http.CanonicalHeaderKey(a.Arg)]
+		exists = ok
+		actual = strings.Join(values, ", ")
+	case "body":
+		if a.Arg == "" {
+			actual = string(res.body)
+			break
+		}
+		v, err := res.bodyJSON()
+		if err != nil {
+			return false, err.Error()
+		}
+		value, ok, err := evalJSONPath(v, a.Arg)
+		if err != nil {
+			return false, err.Error()
+		}
+		exists = ok
+		actual = jsonValueString(value)
+	}
+	if a.Operator == "exists" {
+		if !exists {
+			return false, "not found"
+		}
+		return true, ""
+	}
+	if !exists {
+		return false, "not found"
+	}
+	ok, err := compareAssertion(actual, a.Operator, unquoteValue(expected))
+	if err != nil {
+		return false, err.Error()
+	}
+	if !ok {
+		return false, "got " + previewValue(actual)
+	}
+	return true, ""
+}
+
+func compareAssertion(actual string, op string, expected string) (bool, error) {
+	actualNum, actualErr := strconv.ParseFloat(actual, 64)
+	expectedNum, expectedErr := strconv.ParseFloat(expected, 64)
+	numeric := actualErr == nil && expectedErr == nil
+	switch op {
+	case "==":
+		if numeric {
+			return actualNum == expectedNum, nil
+		}
+		return actual == expected, nil
+	case "!=":
+		if numeric {
+			return actualNum != expectedNum, nil
+		}
+		return actual != expected, nil
+	case "<", "<=", ">", ">=":
+		if !numeric {
+			return false, fmt.Errorf("%s compares numbers, got %s", op, previewValue(actual))
+		}
+		switch op {
+		case "<":
+			return actualNum < expectedNum, nil
+		case "<=":
+			return actualNum <= expectedNum, nil
+		case ">":
+			return actualNum > expectedNum, nil
+		default:
+			return actualNum >= expectedNum, nil
+		}
+	case "contains":
+		return strings.Contains(actual, expected), nil
+	case "startsWith":
+		return strings.HasPrefix(actual, expected), nil
+	case "endsWith":
+		return strings.HasSuffix(actual, expected), nil
+	case "matches":
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(actual), nil
+	}
+	return false, fmt.Errorf("unknown operator %s", op)
+}
+
+// unquoteValue allows quoting values with spaces at the ends, "a " or 'a '
+func unquoteValue(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func previewValue(s string) string {
+	const max = 80
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return strconv.Quote(s)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,326 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/kool/pkgs/errs"
+)
+
+const testHTTPFile = `@host = http://unused.invalid
+@user = alice
+
+### login
+# @name login
+POST {{host}}/api/login
+Content-Type: application/json
+
+{"user": "{{user}}", "password": "{{password}}"}
+
+?? status == 200
+?? body $.token exists
+
+### profile
+GET {{host}}/api/me
+  ?verbose=1
+Authorization: Bearer {{login.response.body.$.token}}
+# a comment between headers
+X-Session: {{login.response.headers.X-Session}}
+
+?? header Content-Type contains json
+?? body $.name == alice
+?? body $.tags[*] == ["a","b"]
+?? body $.tags[-1] != a
+?? duration < 10s
+`
+
+func TestParseHTTPFile(t *testing.T) {
+	file, err := ParseHTTPFile(testHTTPFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars []string
+	for _, v := range file.Variables {
+		vars = append(vars, v.Name+"="+v.Value)
+	}
+	if strings.Join(vars, ",") != "host=http://unused.invalid,user=alice" {
+		t.Errorf("unexpected variables: %v", vars)
+	}
+	if len(file.Requests) != 2 {
+		t.Fatalf("expect 2 requests, got %d", len(file.Requests))
+	}
+
+	login := file.Requests[0]
+	if login.Name != "login" || login.Title != "login" || login.Method != "POST" || login.URL != "{{host}}/api/login" || login.Line != 6 {
+		t.Errorf("unexpected login request: %+v", login)
+	}
+	if login.Body != `{"user": "{{user}}", "password": "{{password}}"}` {
+		t.Errorf("unexpected login body: %q", login.Body)
+	}
+	if len(login.Assertions) != 2 || login.Assertions[1].Line != 12 {
+		t.Errorf("unexpected login assertions: %+v", login.Assertions)
+	}
+
+	profile := file.Requests[1]
+	if profile.Title != "profile" || profile.Method != "GET" || profile.URL != "{{host}}/api/me?verbose=1" {
+		t.Errorf("unexpected profile request: %+v", profile)
+	}
+	var headers []string
+	for _, h := range profile.Headers {
+		headers = append(headers, h.Name+": "+h.Value)
+	}
+	wantHeaders := "Authorization: Bearer {{login.response.body.$.token}},X-Session: {{login.response.headers.X-Session}}"
+	if strings.Join(headers, ",") != wantHeaders {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+	if profile.Body != "" {
+		t.Errorf("expect no body, got %q", profile.Body)
+	}
+
+	var assertions []Assertion
+	for _, a := range profile.Assertions {
+		assertions = append(assertions, Assertion{Subject: a.Subject, Arg: a.Arg, Operator: a.Operator, Value: a.Value})
+	}
+	wantAssertions := []Assertion{
+		{Subject: "header", Arg: "Content-Type", Operator: "contains", Value: "json"},
+		{Subject: "body", Arg: "$.name", Operator: "==", Value: "alice"},
+		{Subject: "body", Arg: "$.tags[*]", Operator: "==", Value: `["a","b"]`},
+		{Subject: "body", Arg: "$.tags[-1]", Operator: "!=", Value: "a"},
+		{Subject: "duration", Operator: "<", Value: "10s"},
+	}
+	if !reflect.DeepEqual(assertions, wantAssertions) {
+		t.Errorf("expect assertions %+v, got %+v", wantAssertions, assertions)
+	}
+}
+
+func TestParseHTTPFileErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"GET http://a\nnot a header\n", "line 2: expects a header"},
+		{"### a\nGET http://a\n\n?? status\n", "line 4: expects an operator"},
+		{"GET http://a\n\n?? header == 1\n", "expects ?? header NAME"},
+		{"GET http://a\n\n?? cookie x == 1\n", "unknown assertion subject"},
+		{"GET http://a\n\n?? body $.a ==\n", "expects a value after =="},
+		{"FETCH http://a b\n", "line 1: expects a request line"},
+	}
+	for _, tt := range tests {
+		_, err := ParseHTTPFile(tt.content)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseHTTPFile(%q): expect error %q, got %v", tt.content, tt.err, err)
+		}
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(`{"a": {"b": [1, {"c": "x"}]}, "k y": true, "list": [{"n": 1}, {"n": 2}]}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"$", `{"a":{"b":[1,{"c":"x"}]},"k y":true,"list":[{"n":1},{"n":2}]}`, true},
+		{"$.a.b[0]", "1", true},
+		{"$.a.b[1].c", "x", true},
+		{"a.b[-1].c", "x", true},
+		{"$['k y']", "true", true},
+		{`$["a"]["b"][0]`, "1", true},
+		{"$.list[*].n", "[1,2]", true},
+		{"$.a.b[5]", "", false},
+		{"$.a.missing", "", false},
+		{"$.a.b.c", "", false},
+		{"$.missing[*]", "", false},
+	}
+	for _, tt := range tests {
+		got, ok, err := evalJSONPath(v, tt.path)
+		if err != nil {
+			t.Errorf("evalJSONPath(%q): %v", tt.path, err)
+			continue
+		}
+		if ok != tt.ok {
+			t.Errorf("evalJSONPath(%q): expect ok %v, got %v", tt.path, tt.ok, ok)
+			continue
+		}
+		if ok && jsonValueString(got) != tt.want {
+			t.Errorf("evalJSONPath(%q) = %s, want %s", tt.path, jsonValueString(got), tt.want)
+		}
+	}
+
+	for _, path := range []string{"$.", "$[0", "$[x]", "$.a..b"} {
+		if _, _, err := evalJSONPath(v, path); err == nil {
+			t.Errorf("evalJSONPath(%q): expect error", path)
+		}
+	}
+}
+
+func TestRunHTTPFile(t *testing.T) {
+	server := newTestAPIServer(t)
+	file, err := ParseHTTPFile(testHTTPFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// --var overrides @host, @user overrides the env, the env fills in password
+	vars := map[string]string{"host": server.URL}
+	env := map[string]string{"password": "secret", "user": "bob"}
+	runner := newRequestRunner(file, t.TempDir(), vars, env, 5*time.Second, false)
+	var out bytes.Buffer
+	runner.out = &out
+
+	if err := runner.runAll(file.Requests); err != nil {
+		t.Fatalf("expect all assertions to pass, got %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "2 requests, 7 assertions passed, 0 failed") {
+		t.Errorf("unexpected summary:\n%s", out.String())
+	}
+}
+
+func TestRunHTTPFileFailingAssertion(t *testing.T) {
+	server := newTestAPIServer(t)
+	file, err := ParseHTTPFile(`### profile
+GET {{host}}/api/me
+
+?? status == 200
+?? body $.name == bob
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := newRequestRunner(file, t.TempDir(), map[string]string{"host": server.URL}, nil, 5*time.Second, false)
+	var out bytes.Buffer
+	runner.out = &out
+
+	err = runner.runAll(file.Requests)
+	exitErr, ok := errs.IsSilenceExitCode(err)
+	if !ok || exitErr.SilenceExitCode() != 1 {
+		t.Fatalf("expect exit code 1, got %v", err)
+	}
+	// status is 401 without the token
+	if !strings.Contains(out.String(), `status == 200 (got "401")`) || !strings.Contains(out.String(), "0 assertions passed, 2 failed") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestRunHTTPFileCaptureOfFailedRequest(t *testing.T) {
+	file, err := ParseHTTPFile(`# @name login
+POST http://127.0.0.1:1/api/login
+
+###
+GET http://127.0.0.1:1/api/me
+Authorization: Bearer {{login.response.body.$.token}}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := newRequestRunner(file, t.TempDir(), nil, nil, time.Second, false)
+	var out bytes.Buffer
+	runner.out = &out
+	if _, ok := errs.IsSilenceExitCode(runner.runAll(file.Requests)); !ok {
+		t.Fatalf("expect failed requests to exit non-zero")
+	}
+	if !strings.Contains(out.String(), "request login failed") {
+		t.Errorf("expect the capture to report the failed request:\n%s", out.String())
+	}
+}
+
+func TestRunHTTPFileSendsFailedRequestOnce(t *testing.T) {
+	var logins int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/login" {
+			logins++
+			// drop the connection, the request gets no response
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	for _, content := range []string{
+		// referenced before it is reached
+		`GET {{host}}/api/me
+Authorization: Bearer {{login.response.body.$.token}}
+
+###
+# @name login
+POST {{host}}/api/login
+
+###
+GET {{host}}/api/other
+X-Token: {{login.response.body.$.token}}
+`,
+		// reached before it is referenced
+		`# @name login
+POST {{host}}/api/login
+
+###
+GET {{host}}/api/me
+Authorization: Bearer {{login.response.body.$.token}}
+`,
+	} {
+		logins = 0
+		file, err := ParseHTTPFile(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner := newRequestRunner(file, t.TempDir(), map[string]string{"host": server.URL}, nil, time.Second, false)
+		var out bytes.Buffer
+		runner.out = &out
+		if _, ok := errs.IsSilenceExitCode(runner.runAll(file.Requests)); !ok {
+			t.Fatalf("expect failed requests to exit non-zero")
+		}
+		if logins != 1 {
+			t.Errorf("expect login to be sent once, got %d:\n%s", logins, out.String())
+		}
+		if !strings.Contains(out.String(), "request login failed") {
+			t.Errorf("expect the capture to report the failed request:\n%s", out.String())
+		}
+	}
+}
+
+// newTestAPIServer serves /api/login, checking alice's password, and
+// /api/me, checking the token from login
+func newTestAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/login":
+			var body struct {
+				User     string `json:"user"`
+				Password string `json:"password"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if r.Method != http.MethodPost || body.User != "alice" || body.Password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "bad credentials"}`))
+				return
+			}
+			w.Header().Set("X-Session", "s-1")
+			w.Write([]byte(`{"token": "t-123"}`))
+		case "/api/me":
+			if r.Header.Get("Authorization") != "Bearer t-123" || r.Header.Get("X-Session") != "s-1" || r.URL.Query().Get("verbose") != "1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "unauthorized"}`))
+				return
+			}
+			w.Write([]byte(`{"name": "alice", "tags": ["a", "b"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
@@ -0,0 +1,443 @@
+package http
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/less-flags"
+)
+
+const serveHelp = `
+kool http serve starts a static file server for development
+
+Usage: kool http serve [OPTIONS] [DIR]
+
+DIR is the directory to serve, default is the current directory.
+
+Options:
+  --port PORT              port to listen on, default is 8080
+  --host ADDR              address to listen on, default is all interfaces, or
+                           127.0.0.1 with --upload
+  --spa                    serve index.html for unknown paths, for client side routing
+  --cors                   allow cross-origin requests, including preflight
+  --no-cache               send Cache-Control: no-store instead of ETag and Last-Modified
+  --no-compress            disable compression
+  --no-list                disable directory listing
+  --tls                    serve https with a self-signed certificate for localhost, generated on start
+  --basic-auth USER:PASS   require HTTP basic auth
+  --upload                 accept uploads: PUT <path> with the content as body, or POST <dir>
+                           with multipart/form-data, the listing shows an upload form.
+                           Listening on other interfaces requires --basic-auth
+  -h,--help                show help message
+
+Text files are gzip compressed on the fly. Precompressed siblings, e.g.
+app.js.br and app.js.gz, are served instead when the client accepts them.
+Brotli is only served from such .br files, there is no brotli encoder.
+
+Directory listings are html, or json with ?format=json or Accept: application/json.
+
+Examples:
+  kool http serve
+  kool http serve --spa --cors dist
+  kool http serve --tls --basic-auth admin:secret --upload --host 0.0.0.0 ./share
+`
+
+// ServeOptions configures the static file server
+type ServeOptions struct {
+	SPA        bool
+	CORS       bool
+	NoCache    bool
+	NoCompress bool
+	NoList     bool
+	Upload     bool
+	// BasicAuth is user:pass, empty for no auth
+	BasicAuth string
+}
+
+// handleServe implements a static file server
+func handleServe(args []string) error {
+	port := 8080
+	var host string
+	var opts ServeOptions
+	var useTLS bool
+	args, err := lessflags.Int("--port", &port).
+		String("--host", &host).
+		Bool("--spa", &opts.SPA).
+		Bool("--cors", &opts.CORS).
+		Bool("--no-cache", &opts.NoCache).
+		Bool("--no-compress", &opts.NoCompress).
+		Bool("--no-list", &opts.NoList).
+		Bool("--tls", &useTLS).
+		String("--basic-auth", &opts.BasicAuth).
+		Bool("--upload", &opts.Upload).
+		Help("-h,--help", serveHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port number must be between 1 and 65535")
+	}
+	if opts.BasicAuth != "" && !strings.Contains(opts.BasicAuth, ":") {
+		return fmt.Errorf("--basic-auth expects user:pass")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unexpected argument: %v", args[1:])
+	}
+	host, err = serveHost(host, opts)
+	if err != nil {
+		return err
+	}
+
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	stat, err := os.Stat(absDir)
+	if err != nil {
+		return fmt.Errorf("directory does not exist: %s", dir)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(host, strconv.Itoa(port)),
+		Handler: logRequest(NewServeHandler(absDir, opts)),
+	}
+	scheme := "http"
+	if useTLS {
+		cert, fingerprint, err := selfSignedCert()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		scheme = "https"
+		fmt.Printf("Self-signed certificate SHA-256 fingerprint: %s\n", fingerprint)
+	}
+
+	displayHost := host
+	if displayHost == "" || displayHost == "0.0.0.0" || displayHost == "::" {
+		displayHost = "localhost"
+	}
+	fmt.Printf("Starting HTTP server on %s://%s\n", scheme, net.JoinHostPort(displayHost, strconv.Itoa(port)))
+	fmt.Printf("Serving files from: %s\n", absDir)
+	if opts.Upload {
+		fmt.Println("Uploads are enabled")
+	}
+	fmt.Println("Press Ctrl+C to stop")
+
+	if useTLS {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// serveHost returns the address to listen on. Uploads let anyone who can
+// reach the server write files, so they only listen on loopback by default
+// and need --basic-auth to listen on other interfaces.
+func serveHost(host string, opts ServeOptions) (string, error) {
+	if !opts.Upload {
+		return host, nil
+	}
+	if host == "" {
+		return "127.0.0.1", nil
+	}
+	if opts.BasicAuth == "" && !isLoopbackHost(host) {
+		return "", fmt.Errorf("--upload on %s requires --basic-auth, or listen on 127.0.0.1", host)
+	}
+	return host, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// NewServeHandler serves the files under root
+func NewServeHandler(root string, opts ServeOptions) http.Handler {
+	var handler http.Handler = &fileServer{root: root, opts: opts}
+	if !opts.NoCompress {
+		handler = compress(handler)
+	}
+	if opts.BasicAuth != "" {
+		handler = basicAuth(handler, opts.BasicAuth)
+	}
+	if opts.CORS {
+		handler = cors(handler, opts.BasicAuth != "")
+	}
+	return handler
+}
+
+type fileServer struct {
+	root string
+	opts ServeOptions
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlPath := path.Clean("/" + r.URL.Path)
+	filePath := filepath.Join(s.root, filepath.FromSlash(urlPath))
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodPost:
+		if !s.opts.Upload {
+			http.Error(w, "uploads are disabled, restart with --upload", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Method == http.MethodPut {
+			s.handlePut(w, r, filePath)
+		} else {
+			s.handlePost(w, r, urlPath, filePath)
+		}
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) && s.opts.SPA && wantsSPAFallback(r, urlPath) {
+			s.serveSPAIndex(w, r)
+			return
+		}
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if stat.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		index := filepath.Join(filePath, "index.html")
+		if indexStat, err := os.Stat(index); err == nil && !indexStat.IsDir() {
+			s.serveFile(w, r, index, indexStat)
+			return
+		}
+		if s.opts.NoList {
+			http.Error(w, "directory listing is disabled", http.StatusForbidden)
+			return
+		}
+		s.serveListing(w, r, urlPath, filePath)
+		return
+	}
+	s.serveFile(w, r, filePath, stat)
+}
+
+// wantsSPAFallback reports whether a missing path is a client side route:
+// a page navigation or a path without a file extension. Missing assets
+// still get 404.
+func wantsSPAFallback(r *http.Request, urlPath string) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return true
+	}
+	return path.Ext(urlPath) == ""
+}
+
+func (s *fileServer) serveSPAIndex(w http.ResponseWriter, r *http.Request) {
+	index := filepath.Join(s.root, "index.html")
+	stat, err := os.Stat(index)
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveFile(w, r, index, stat)
+}
+
+// serveFile serves the file with range and conditional request support,
+// or one of its precompressed siblings
+func (s *fileServer) serveFile(w http.ResponseWriter, r *http.Request, filePath string, stat os.FileInfo) {
+	if contentType := mime.TypeByExtension(filepath.Ext(filePath)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	servePath, encoding := precompressed(r, filePath)
+	if encoding != "" {
+		if encStat, err := os.Stat(servePath); err == nil {
+			stat = encStat
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	f, err := os.Open(servePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer f.Close()
+
+	modTime := stat.ModTime()
+	if s.opts.NoCache {
+		w.Header().Set("Cache-Control", "no-store")
+		// without validators nothing can be answered with 304
+		r.Header.Del("If-None-Match")
+		r.Header.Del("If-Modified-Since")
+		modTime = time.Time{}
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x%s"`, stat.Size(), stat.ModTime().UnixNano(), encoding))
+	}
+	http.ServeContent(w, r, filepath.Base(filePath), modTime, f)
+}
+
+// handlePut stores the body at the path, replacing an existing file
+func (s *fileServer) handlePut(w http.ResponseWriter, r *http.Request, filePath string) {
+	if filePath == s.root || strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "PUT expects a file path", http.StatusBadRequest)
+		return
+	}
+	_, existed := os.Stat(filePath)
+	if err := writeUpload(filePath, r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if existed == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handlePost stores the files of a multipart/form-data body in the
+// directory
+func (s *fileServer) handlePost(w http.ResponseWriter, r *http.Request, urlPath string, dirPath string) {
+	if stat, err := os.Stat(dirPath); err != nil || !stat.IsDir() {
+		http.Error(w, "POST expects a directory, use PUT for a file", http.StatusBadRequest)
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expects multipart/form-data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var saved []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := filepath.Base(part.FileName())
+		if part.FileName() == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+			part.Close()
+			continue
+		}
+		err = writeUpload(filepath.Join(dirPath, name), part)
+		part.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saved = append(saved, path.Join(urlPath, name))
+	}
+	if len(saved) == 0 {
+		http.Error(w, "no files in the request", http.StatusBadRequest)
+		return
+	}
+	// the upload form of the listing expects to get back to it
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"files": saved})
+}
+
+// writeUpload writes to a temporary file renamed into place, so a failed
+// upload does not leave a truncated file
+func writeUpload(filePath string, body io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write upload: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func basicAuth(handler http.Handler, userPass string) http.Handler {
+	user, pass, _ := strings.Cut(userPass, ":")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(pass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="kool http serve", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// cors allows any origin. With credentials, i.e. basic auth, the origin is
+// echoed since browsers reject * then. Preflight requests are answered
+// before auth, as browsers send them without credentials.
+func cors(handler http.Handler, credentials bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			h := w.Header()
+			if credentials {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Set("Access-Control-Allow-Credentials", "true")
+				h.Add("Vary", "Origin")
+			} else {
+				h.Set("Access-Control-Allow-Origin", "*")
+			}
+			h.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Content-Encoding, ETag")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", "GET, HEAD, PUT, POST, OPTIONS")
+				if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", reqHeaders)
+				}
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
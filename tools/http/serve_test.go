@@ -0,0 +1,317 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeUpload(t *testing.T) {
+	root := t.TempDir()
+	parent := filepath.Dir(root)
+	server := httptest.NewServer(NewServeHandler(root, ServeOptions{Upload: true}))
+	defer server.Close()
+
+	resp := doRequest(t, http.MethodPut, server.URL+"/docs/a.txt", "hello", nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expect 201 on create, got %d", resp.StatusCode)
+	}
+	resp = doRequest(t, http.MethodPut, server.URL+"/docs/a.txt", "replaced", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expect 204 on replace, got %d", resp.StatusCode)
+	}
+	assertFile(t, filepath.Join(root, "docs", "a.txt"), "replaced")
+
+	// .. is cleaned against the root
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/x", strings.NewReader("escaped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.URL.Opaque = "/../../escape.txt"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expect 201, got %d", resp.StatusCode)
+	}
+	assertFile(t, filepath.Join(root, "escape.txt"), "escaped")
+	if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expect nothing written outside the root, stat: %v", err)
+	}
+
+	if resp := doRequest(t, http.MethodPut, server.URL+"/docs/", "x", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 for PUT on a directory, got %d", resp.StatusCode)
+	}
+
+	body, contentType := multipartBody(t, map[string]string{
+		"../b.txt": "b",
+		"c.txt":    "c",
+	})
+	resp = doRequest(t, http.MethodPost, server.URL+"/docs/", body, map[string]string{"Content-Type": contentType})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expect 201, got %d", resp.StatusCode)
+	}
+	assertFile(t, filepath.Join(root, "docs", "b.txt"), "b")
+	assertFile(t, filepath.Join(root, "docs", "c.txt"), "c")
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expect ../b.txt to stay in docs, stat: %v", err)
+	}
+
+	body, contentType = multipartBody(t, map[string]string{"/": "root", "..": "up"})
+	resp = doRequest(t, http.MethodPost, server.URL+"/docs/", body, map[string]string{"Content-Type": contentType})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 for unusable names, got %d", resp.StatusCode)
+	}
+
+	body, contentType = multipartBody(t, map[string]string{"d.txt": "d"})
+	resp = doRequest(t, http.MethodPost, server.URL+"/docs/a.txt", body, map[string]string{"Content-Type": contentType})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 for POST on a file, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeUploadDisabled(t *testing.T) {
+	root := t.TempDir()
+	server := httptest.NewServer(NewServeHandler(root, ServeOptions{}))
+	defer server.Close()
+
+	resp := doRequest(t, http.MethodPut, server.URL+"/a.txt", "hello", nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expect 405, got %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expect no file, stat: %v", err)
+	}
+}
+
+func TestServeHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		opts    ServeOptions
+		want    string
+		wantErr bool
+	}{
+		{"", ServeOptions{}, "", false},
+		{"0.0.0.0", ServeOptions{}, "0.0.0.0", false},
+		{"", ServeOptions{Upload: true}, "127.0.0.1", false},
+		{"localhost", ServeOptions{Upload: true}, "localhost", false},
+		{"::1", ServeOptions{Upload: true}, "::1", false},
+		{"0.0.0.0", ServeOptions{Upload: true}, "", true},
+		{"192.168.1.2", ServeOptions{Upload: true}, "", true},
+		{"0.0.0.0", ServeOptions{Upload: true, BasicAuth: "admin:secret"}, "0.0.0.0", false},
+	}
+	for _, tt := range tests {
+		got, err := serveHost(tt.host, tt.opts)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("serveHost(%q, %+v) = %q, %v, want %q, error: %v", tt.host, tt.opts, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestServeBasicAuthCORS(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"), "hello")
+	server := httptest.NewServer(NewServeHandler(root, ServeOptions{CORS: true, BasicAuth: "admin:secret"}))
+	defer server.Close()
+
+	resp := doRequest(t, http.MethodGet, server.URL+"/a.txt", "", nil)
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("expect 401 with WWW-Authenticate, got %d", resp.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/a.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("admin", "wrong")
+	if resp := send(t, req); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401 for a wrong password, got %d", resp.StatusCode)
+	}
+
+	req.SetBasicAuth("admin", "secret")
+	req.Header.Set("Origin", "http://example.com")
+	resp = send(t, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect 200, got %d", resp.StatusCode)
+	}
+	// credentials require the origin to be echoed instead of *
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "http://example.com" {
+		t.Errorf("expect origin to be echoed, got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("expect credentials to be allowed, got %q", got)
+	}
+
+	// preflight is answered without credentials
+	resp = doRequest(t, http.MethodOptions, server.URL+"/a.txt", "", map[string]string{
+		"Origin":                         "http://example.com",
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "Authorization",
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expect 204 for preflight, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Headers"); got != "Authorization" {
+		t.Errorf("expect requested headers to be allowed, got %q", got)
+	}
+}
+
+func TestServeCORSWithoutCredentials(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"), "hello")
+	server := httptest.NewServer(NewServeHandler(root, ServeOptions{CORS: true}))
+	defer server.Close()
+
+	resp := doRequest(t, http.MethodGet, server.URL+"/a.txt", "", map[string]string{"Origin": "http://example.com"})
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expect *, got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("expect no credentials, got %q", got)
+	}
+}
+
+func TestServeSPAFallback(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "index.html"), "<html>app</html>")
+	writeTestFile(t, filepath.Join(root, "app.js"), "console.log(1)")
+	server := httptest.NewServer(NewServeHandler(root, ServeOptions{SPA: true}))
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		accept string
+		status int
+		body   string
+	}{
+		{"/app.js", "", http.StatusOK, "console.log(1)"},
+		{"/users/1", "", http.StatusOK, "<html>app</html>"},
+		{"/users/1.5", "text/html", http.StatusOK, "<html>app</html>"},
+		{"/missing.js", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{"Accept": tt.accept}
+		resp := doRequest(t, http.MethodGet, server.URL+tt.path, "", headers)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expect %d, got %d", tt.path, tt.status, resp.StatusCode)
+			continue
+		}
+		if tt.body != "" && readBody(t, resp) != tt.body {
+			t.Errorf("%s: expect %q", tt.path, tt.body)
+		}
+	}
+
+	noSPA := httptest.NewServer(NewServeHandler(root, ServeOptions{}))
+	defer noSPA.Close()
+	if resp := doRequest(t, http.MethodGet, noSPA.URL+"/users/1", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expect 404 without --spa, got %d", resp.StatusCode)
+	}
+}
+
+func TestServePrecompressed(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "app.js"), "plain")
+	writeTestFile(t, filepath.Join(root, "app.js.br"), "brotli")
+	server := httptest.NewServer(NewServeHandler(root, ServeOptions{}))
+	defer server.Close()
+
+	resp := doRequest(t, http.MethodGet, server.URL+"/app.js", "", map[string]string{"Accept-Encoding": "br"})
+	if resp.Header.Get("Content-Encoding") != "br" || readBody(t, resp) != "brotli" {
+		t.Fatalf("expect app.js.br to be served")
+	}
+	resp = doRequest(t, http.MethodGet, server.URL+"/app.js", "", map[string]string{"Accept-Encoding": "identity"})
+	if resp.Header.Get("Content-Encoding") != "" || readBody(t, resp) != "plain" {
+		t.Fatalf("expect app.js to be served")
+	}
+}
+
+// doRequest sends a request with body and headers, the body of the
+// response is kept readable by readBody
+func doRequest(t *testing.T, method string, url string, body string, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return send(t, req)
+}
+
+func send(t *testing.T, req *http.Request) *http.Response {
+	t.Helper()
+	// disable transparent gzip to see the encoding as served
+	client := &http.Client{
+		Transport:     &http.Transport{DisableCompression: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func multipartBody(t *testing.T, files map[string]string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, content := range files {
+		w, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), mw.FormDataContentType()
+}
+
+func assertFile(t *testing.T, file string, content string) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("expect %s to contain %q, got %q", file, content, data)
+	}
+}
+
+func writeTestFile(t *testing.T, file string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
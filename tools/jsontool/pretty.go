@@ -1,30 +1,115 @@
 package jsontool
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
+	"strings"
 
 	"github.com/xhd2015/kool/pkgs/jsondecode"
 	"github.com/xhd2015/kool/pkgs/terminal"
 )
 
+const (
+	colorReset   = "\033[0m"
+	colorKey     = "\033[1;34m"
+	colorString  = "\033[32m"
+	colorNumber  = "\033[36m"
+	colorKeyword = "\033[33m"
+	colorNull    = "\033[90m"
+)
+
 func HandlePretty(args []string) error {
 	data, err := terminal.ReadOrTerminalData(args)
 	if err != nil {
 		return err
 	}
 
-	v, err := jsondecode.UnmarshalSafeAny([]byte(data))
+	pretty, err := Pretty([]byte(data))
 	if err != nil {
 		return err
 	}
+	_, err = os.Stdout.Write(pretty)
+	return err
+}
+
+// Pretty indents the JSON with two spaces, keeping large numbers and
+// the characters html escaping would replace. The result ends with a
+// newline.
+func Pretty(data []byte) ([]byte, error) {
+	v, err := jsondecode.UnmarshalSafeAny(data)
+	if err != nil {
+		return nil, err
+	}
 
-	encoder := json.NewEncoder(os.Stdout)
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
 	encoder.SetEscapeHTML(false)
 	encoder.SetIndent("", "  ")
 	err = encoder.Encode(v)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Colorize adds terminal colors to JSON, as output by Pretty: keys,
+// strings, numbers and keywords each get their color
+func Colorize(data []byte) string {
+	var b strings.Builder
+	n := len(data)
+	for i := 0; i < n; {
+		c := data[i]
+		switch {
+		case c == '"':
+			j := i + 1
+			for j < n && data[j] != '"' {
+				if data[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < n {
+				j++
+			}
+			k := j
+			for k < n && isSpace(data[k]) {
+				k++
+			}
+			color := colorString
+			if k < n && data[k] == ':' {
+				color = colorKey
+			}
+			b.WriteString(color)
+			b.Write(data[i:j])
+			b.WriteString(colorReset)
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < n && strings.IndexByte("0123456789.eE+-", data[j]) >= 0 {
+				j++
+			}
+			b.WriteString(colorNumber)
+			b.Write(data[i:j])
+			b.WriteString(colorReset)
+			i = j
+		case c == 't' || c == 'f' || c == 'n':
+			j := i + 1
+			for j < n && data[j] >= 'a' && data[j] <= 'z' {
+				j++
+			}
+			color := colorKeyword
+			if c == 'n' {
+				color = colorNull
+			}
+			b.WriteString(color)
+			b.Write(data[i:j])
+			b.WriteString(colorReset)
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
 	}
-	return nil
+	return b.String()
 }
@@ -25,23 +25,31 @@ func HandleKill(args []string) error {
 	if len(args) > 0 {
 		return fmt.Errorf("unrecognized extra argument: %s", strings.Join(args, " "))
 	}
-	pidOutput, err := exec.Command("lsof", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-t").Output()
+	pids, err := ListeningPIDs(port)
 	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
-			fmt.Fprintf(os.Stderr, "no process on port %d\n", port)
-			return nil
-		}
 		return err
 	}
-	pid := strings.TrimSpace(string(pidOutput))
-	if pid == "" {
+	if len(pids) == 0 {
 		fmt.Fprintf(os.Stderr, "no process on port %d\n", port)
 		return nil
 	}
-	fmt.Printf("kill -9 %s\n", pid)
-	killCmd := exec.Command("kill", "-9", pid)
+	fmt.Printf("kill -9 %s\n", strings.Join(pids, " "))
+	killCmd := exec.Command("kill", append([]string{"-9"}, pids...)...)
 	killCmd.Stdout = os.Stdout
 	killCmd.Stderr = os.Stderr
 	return killCmd.Run()
 }
+
+// ListeningPIDs returns the pids of processes listening on the given TCP port,
+// or nil if there is none.
+func ListeningPIDs(port int) ([]string, error) {
+	pidOutput, err := exec.Command("lsof", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-t").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return strings.Fields(string(pidOutput)), nil
+}
@@ -11,13 +11,66 @@ import (
 )
 
 const help = `
+kool preview serves a directory or file in an interactive web UI
+
+Usage: kool preview [OPTIONS] [<path>]
+       kool preview --diff <ref> [<path>]
+       kool preview export <path> [-o <output>]
 
 Options:
   --plant-uml-server ADDR    plantuml server url, default is https://www.plantuml.com/plantuml, can be http://localhost:8080
   --no-watch                 disable file watching and live reload
+  --host ADDR                address to listen on, default is 127.0.0.1, use 0.0.0.0 to share on the network
+  --read-only                disable saving files and the terminal
+  --token TOKEN              session token required by the UI and APIs, default is random
+  --renderer server|local    how PlantUML is rendered, default is server, local runs plantuml.jar
+                             (or the plantuml command) with java and graphviz, without docker or network
+  --terminal-scrollback KB   terminal output kept per session and replayed on reconnect, default is 256
+  --terminal-idle-timeout D  close terminal sessions without a connected page after D, default is 30m, 0 never
+  --diff REF                 review mode: mark the files changed against REF (compared from the merge base
+                             with HEAD, including uncommitted and untracked files) and show before/after diffs
+
+The opened URL carries the session token, every API and WebSocket requires
+it, share the URL only with people allowed to read the files, and without
+--read-only, to run commands on this machine.
 
 Example plantuml server:
   docker run --rm -p 8080:8080 plantuml/plantuml-server:jetty
+
+Terminal sessions run $SHELL and survive page reloads, each terminal tab
+reattaches to its session, and other browser tabs can join it.
+
+In review mode, comments added in the UI are saved to .kool-review.json in the
+served directory.
+
+The local renderer looks for plantuml.jar in $PLANTUML_JAR, ~/.kool/plantuml.jar
+and the usual install locations, renders are cached by content hash.
+`
+
+const exportHelp = `
+kool preview export renders markdown and diagrams without the web UI
+
+Usage: kool preview export <path> [OPTIONS]
+
+A file is exported to a single self-contained html page, with the diagrams
+of markdown inlined as SVG and local images embedded. Diagram files (.uml,
+.puml, .dot, .mmd) can also be exported to .svg, .png or .pdf, as supported
+by the renderer. A directory is exported to a directory of html pages and
+svg diagrams, keeping relative links, other files are copied.
+
+Renderers: PlantUML uses the PlantUML server and its local cache, DOT needs
+dot (graphviz) and mermaid needs mmdc (npm install -g @mermaid-js/mermaid-cli),
+without mmdc mermaid in markdown is left for the browser to render.
+
+Options:
+  -o,--output FILE|DIR       output file or directory, default is <name>.html in the current directory
+  --plant-uml-server ADDR    plantuml server url, default is https://www.plantuml.com/plantuml
+  --renderer server|local    local renders PlantUML with a local plantuml.jar, see kool preview --help
+
+Examples:
+  kool preview export design.md
+  kool preview export flow.dot -o flow.png
+  kool preview export docs -o docs-html
 `
 
 // TODO:
@@ -25,7 +78,7 @@ Example plantuml server:
 // - [ ] use websocket to sync the backend and frontend content change
 // - [ ] only show save retry button when save failed, no other status needed
 // - [ ] split the html into multiple files and components
-// - [ ] use user's default shell
+// - [x] use user's default shell
 // - [x] terminal line wrap working test
 // - [x] allow edit arbitrary txt files
 // - [x] markdown: open link in new tab
@@ -35,19 +88,47 @@ Example plantuml server:
 // - [ ] mermaid preview react support
 // - [ ] remember per-file zoom state
 func Handle(args []string) error {
+	if len(args) > 0 && args[0] == "export" {
+		return handleExport(args[1:])
+	}
 	var plantumlServer string
 	var noWatch bool
+	var host string
+	var readOnly bool
+	var token string
+	var renderer string
+	var diffRef string
+	var terminalScrollbackKB int
+	terminalIdleTimeout := viewer.DefaultTerminalIdleTimeout
 
 	args, err := lessflags.String("--plant-uml-server", &plantumlServer).
 		Bool("--no-watch", &noWatch).
+		String("--host", &host).
+		Bool("--read-only", &readOnly).
+		String("--token", &token).
+		String("--renderer", &renderer).
+		String("--diff", &diffRef).
+		Int("--terminal-scrollback", &terminalScrollbackKB).
+		Duration("--terminal-idle-timeout", &terminalIdleTimeout).
 		Help("-h,--help", help).
 		Parse(args)
 	if err != nil {
 		return err
 	}
+	if err := checkRenderer(renderer); err != nil {
+		return err
+	}
 	opts := viewer.ServeOptions{
 		PlantUMLServer: plantumlServer,
 		NoWatch:        noWatch,
+		Host:           host,
+		ReadOnly:       readOnly,
+		Token:          token,
+		Renderer:       renderer,
+		DiffRef:        diffRef,
+
+		TerminalScrollbackKB: terminalScrollbackKB,
+		TerminalIdleTimeout:  terminalIdleTimeout,
 	}
 
 	path := "."
@@ -82,3 +163,56 @@ func Handle(args []string) error {
 	}
 	return viewer.ServeWithInitialFile(rootDir, opts, absPath)
 }
+
+func handleExport(args []string) error {
+	var output string
+	var plantumlServer string
+	var renderer string
+	args, err := lessflags.String("-o,--output", &output).
+		String("--plant-uml-server", &plantumlServer).
+		String("--renderer", &renderer).
+		Help("-h,--help", exportHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := checkRenderer(renderer); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires path, usage: kool preview export <path> [-o <output>]")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args[1:], " "))
+	}
+	input := args[0]
+	stat, err := os.Stat(input)
+	if err != nil {
+		return fmt.Errorf("path does not exist: %s", input)
+	}
+	if output == "" {
+		if stat.IsDir() {
+			return fmt.Errorf("requires -o <dir> to export a directory")
+		}
+		base := filepath.Base(input)
+		output = strings.TrimSuffix(base, filepath.Ext(base)) + ".html"
+	}
+	err = viewer.Export(input, output, viewer.ExportOptions{
+		RenderOptions: viewer.RenderOptions{PlantUMLServer: plantumlServer, Renderer: renderer},
+	})
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		fmt.Printf("Exported %s\n", output)
+	}
+	return nil
+}
+
+func checkRenderer(renderer string) error {
+	switch renderer {
+	case "", viewer.RendererServer, viewer.RendererLocal:
+		return nil
+	}
+	return fmt.Errorf("unknown renderer %q, expects server or local", renderer)
+}
@@ -59,7 +59,7 @@ Some text before.
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	previewCmd := exec.CommandContext(ctx, koolBin, "preview", "--no-watch", tmpDir)
+	previewCmd := exec.CommandContext(ctx, koolBin, "preview", "--no-watch", "--token", "e2e-token", tmpDir)
 	previewCmd.Dir = tmpDir
 
 	stdoutPipe, err := previewCmd.StdoutPipe()
@@ -123,7 +123,14 @@ Some text before.
 	// Poll until server is ready
 	ready := false
 	for i := 0; i < 30; i++ {
-		resp, err := http.Get(serverURL + "/api/tree")
+		// serverURL carries the token for the browser, the API takes the header
+		baseURL, _, _ := strings.Cut(serverURL, "?")
+		req, err := http.NewRequest("GET", strings.TrimSuffix(baseURL, "/")+"/api/tree", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Kool-Token", "e2e-token")
+		resp, err := http.DefaultClient.Do(req)
 		if err == nil && resp.StatusCode == 200 {
 			resp.Body.Close()
 			ready = true
@@ -0,0 +1,120 @@
+package viewer
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// tokenHeader carries the session token for clients that do not use the
+// cookie, e.g. scripts.
+const tokenHeader = "X-Kool-Token"
+
+// readOnlyPaths are the APIs that change files or run commands
+var readOnlyPaths = []string{
+	"/api/save",
+	"/api/terminal/",
+	"/api/start-plantuml",
+	"/api/stop-plantuml",
+}
+
+// accessGuard requires the session token on every API and the index page,
+// rejects cross-origin requests and, in read-only mode, the APIs that
+// change anything. The token from the opened URL is exchanged for a
+// cookie, so the UI itself does not need to know it.
+type accessGuard struct {
+	token      string
+	cookieName string
+	readOnly   bool
+}
+
+func newAccessGuard(token string, port int, readOnly bool) *accessGuard {
+	return &accessGuard{
+		token: token,
+		// cookies are not isolated by port
+		cookieName: fmt.Sprintf("kool_preview_token_%d", port),
+		readOnly:   readOnly,
+	}
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (g *accessGuard) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the static build of the UI holds nothing to protect
+		if strings.HasPrefix(r.URL.Path, "/assets/") || r.URL.Path == "/kool.svg" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request denied", http.StatusForbidden)
+			return
+		}
+		if queryToken := r.URL.Query().Get("token"); queryToken != "" && !strings.HasPrefix(r.URL.Path, "/api/") && g.validToken(queryToken) {
+			// exchange the token for a cookie and drop it from the address bar
+			http.SetCookie(w, &http.Cookie{
+				Name:     g.cookieName,
+				Value:    g.token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			query := r.URL.Query()
+			query.Del("token")
+			redirect := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+			http.Redirect(w, r, redirect.String(), http.StatusFound)
+			return
+		}
+		if !g.authorized(r) {
+			http.Error(w, "missing or invalid token, open the URL printed by kool preview", http.StatusUnauthorized)
+			return
+		}
+		if g.readOnly {
+			for _, path := range readOnlyPaths {
+				if r.URL.Path == path || strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path) {
+					http.Error(w, "not allowed in read-only mode", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *accessGuard) authorized(r *http.Request) bool {
+	if cookie, err := r.Cookie(g.cookieName); err == nil && g.validToken(cookie.Value) {
+		return true
+	}
+	if g.validToken(r.Header.Get(tokenHeader)) {
+		return true
+	}
+	return g.validToken(r.URL.Query().Get("token"))
+}
+
+func (g *accessGuard) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1
+}
+
+// sameOrigin accepts requests without Origin, like plain navigations and
+// non-browser clients, and those whose Origin matches the Host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
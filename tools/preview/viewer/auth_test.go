@@ -0,0 +1,71 @@
+package viewer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessGuard(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	guard := newAccessGuard("secret", 8080, true)
+	handler := guard.wrap(mux)
+
+	do := func(method string, target string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.Host = "localhost:8080"
+		if setup != nil {
+			setup(r)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	withCookie := func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: guard.cookieName, Value: "secret"})
+	}
+
+	// the token in the URL is exchanged for a cookie
+	w := do("GET", "/?token=secret&file=a.md", nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/?file=a.md" {
+		t.Errorf("expect redirect without token, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != "secret" || !cookies[0].HttpOnly {
+		t.Errorf("unexpected cookies: %v", cookies)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		target string
+		setup  func(r *http.Request)
+		code   int
+	}{
+		{"assets are public", "GET", "/assets/index.js", nil, http.StatusOK},
+		{"index without token", "GET", "/", nil, http.StatusUnauthorized},
+		{"api without token", "GET", "/api/tree", nil, http.StatusUnauthorized},
+		{"api with wrong token", "GET", "/api/tree?token=wrong", nil, http.StatusUnauthorized},
+		{"api with cookie", "GET", "/api/tree", withCookie, http.StatusOK},
+		{"api with header", "GET", "/api/tree", func(r *http.Request) { r.Header.Set(tokenHeader, "secret") }, http.StatusOK},
+		{"cross origin", "GET", "/api/tree", func(r *http.Request) {
+			withCookie(r)
+			r.Header.Set("Origin", "http://evil.example.com")
+		}, http.StatusForbidden},
+		{"same origin", "GET", "/api/tree", func(r *http.Request) {
+			withCookie(r)
+			r.Header.Set("Origin", "http://localhost:8080")
+		}, http.StatusOK},
+		{"read-only save", "POST", "/api/save", withCookie, http.StatusForbidden},
+		{"read-only terminal", "GET", "/api/terminal/stream", withCookie, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w := do(c.method, c.target, c.setup); w.Code != c.code {
+				t.Errorf("expect %d, got %d: %s", c.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
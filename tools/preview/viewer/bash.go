@@ -1,37 +1,67 @@
 package viewer
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/creack/pty"
 )
 
+// BashSession is a shell running in a PTY. Its output is broadcast to every
+// attached client and the tail of it kept as scrollback, replayed to
+// clients attaching later, e.g. after a page reload.
 type BashSession struct {
-	cmd           *exec.Cmd
-	pty           *os.File
-	outputChannel chan string
-	errorChannel  chan string
-	ctx           context.Context
-	cancel        context.CancelFunc
-	mutex         sync.Mutex
+	id        string
+	cmd       *exec.Cmd
+	pty       *os.File
+	createdAt time.Time
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mutex     sync.Mutex
+	closeOnce sync.Once
+
+	// guarded by outputMutex
+	outputMutex   sync.Mutex
+	scrollback    []byte
+	maxScrollback int
+	clients       map[chan string]struct{}
+	lastActive    time.Time
+	exited        bool
 }
 
-func initBashSession(workingDir string) (*BashSession, error) {
+// userShell returns $SHELL, falling back to bash
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		if _, err := exec.LookPath(shell); err == nil {
+			return shell
+		}
+	}
+	if _, err := exec.LookPath("bash"); err == nil {
+		return "bash"
+	}
+	return "/bin/sh"
+}
+
+func initBashSession(id string, workingDir string, maxScrollback int) (*BashSession, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Start bash in interactive mode
-	cmd := exec.CommandContext(ctx, "bash", "--login", "-i")
+	// Start the user's shell as an interactive login shell, -l and -i are
+	// understood by bash, zsh, fish and most others
+	shell := userShell()
+	cmd := exec.CommandContext(ctx, shell, "-l", "-i")
 	cmd.Dir = workingDir
 
 	// Set environment variables for proper terminal behavior
 	cmd.Env = append(os.Environ(),
 		"TERM=xterm-256color",
-		"SHELL=/bin/bash",
+		"SHELL="+shell,
 	)
 
 	// Start the command with a PTY
@@ -41,14 +71,19 @@ func initBashSession(workingDir string) (*BashSession, error) {
 		return nil, err
 	}
 
+	now := time.Now()
 	session := &BashSession{
+		id:            id,
 		cmd:           cmd,
 		pty:           ptmx,
-		outputChannel: make(chan string, 100),
-		errorChannel:  make(chan string, 100),
+		createdAt:     now,
 		ctx:           ctx,
 		cancel:        cancel,
+		maxScrollback: maxScrollback,
+		clients:       make(map[chan string]struct{}),
+		lastActive:    now,
 	}
+	fmt.Printf("Started terminal session %s: %s\n", id, filepath.Base(shell))
 
 	// Start goroutine to read from PTY
 	go session.readPTY()
@@ -57,52 +92,118 @@ func initBashSession(workingDir string) (*BashSession, error) {
 }
 
 func (bs *BashSession) readPTY() {
-	fmt.Println("Starting readPTY goroutine")
-	buf := make([]byte, 1024)
+	defer bs.markExited()
+	buf := make([]byte, 4096)
 	for {
-		select {
-		case <-bs.ctx.Done():
-			fmt.Println("readPTY context done")
-			return
-		default:
-			n, err := bs.pty.Read(buf)
-			if err != nil {
-				if err != io.EOF {
-					fmt.Printf("PTY read error: %v\n", err)
-				}
-				return
+		n, err := bs.pty.Read(buf)
+		if n > 0 {
+			bs.broadcast(buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF && bs.ctx.Err() == nil {
+				fmt.Printf("PTY read error in session %s: %v\n", bs.id, err)
 			}
+			return
+		}
+	}
+}
 
-			if n > 0 {
-				output := string(buf[:n])
-				fmt.Printf("Read from PTY: %q\n", output)
-				select {
-				case bs.outputChannel <- output:
-					fmt.Printf("Sent to output channel: %q\n", output)
-				case <-bs.ctx.Done():
-					return
-				}
-			}
+func (bs *BashSession) broadcast(data []byte) {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	bs.scrollback = append(bs.scrollback, data...)
+	if over := len(bs.scrollback) - bs.maxScrollback; over > 0 {
+		// start the replay at a line, not inside a character or an
+		// escape sequence
+		if i := bytes.IndexByte(bs.scrollback[over:], '\n'); i >= 0 && i < 4096 {
+			over += i + 1
+		}
+		bs.scrollback = append([]byte(nil), bs.scrollback[over:]...)
+	}
+	output := string(data)
+	for client := range bs.clients {
+		select {
+		case client <- output:
+		default:
+			// a client too slow to keep up is dropped rather than
+			// blocking the shell, it reattaches with the scrollback
+			delete(bs.clients, client)
+			close(client)
 		}
 	}
 }
 
+// attach registers a client, returning the scrollback to replay and the
+// channel of the output that follows it. The channel is closed when the
+// shell exits or the client is dropped.
+func (bs *BashSession) attach() (string, chan string) {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	client := make(chan string, 256)
+	if bs.exited {
+		close(client)
+	} else {
+		bs.clients[client] = struct{}{}
+	}
+	bs.lastActive = time.Now()
+	return string(bs.scrollback), client
+}
+
+func (bs *BashSession) detach(client chan string) {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	if _, ok := bs.clients[client]; ok {
+		delete(bs.clients, client)
+		close(client)
+	}
+	bs.lastActive = time.Now()
+}
+
+func (bs *BashSession) markExited() {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	bs.exited = true
+	for client := range bs.clients {
+		delete(bs.clients, client)
+		close(client)
+	}
+}
+
+func (bs *BashSession) hasExited() bool {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	return bs.exited
+}
+
+// idleSince reports when the last client detached, or false while
+// clients are attached
+func (bs *BashSession) idleSince() (time.Time, bool) {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	if len(bs.clients) > 0 {
+		return time.Time{}, false
+	}
+	return bs.lastActive, true
+}
+
+func (bs *BashSession) clientCount() int {
+	bs.outputMutex.Lock()
+	defer bs.outputMutex.Unlock()
+	return len(bs.clients)
+}
+
 func (bs *BashSession) sendInput(input string) error {
-	fmt.Printf("sendInput called with: %q\n", input)
 	bs.mutex.Lock()
 	defer bs.mutex.Unlock()
 
 	_, err := bs.pty.Write([]byte(input))
 	if err != nil {
 		fmt.Printf("Error writing to PTY: %v\n", err)
-	} else {
-		fmt.Printf("Successfully wrote to PTY: %q\n", input)
 	}
 	return err
 }
 
 func (bs *BashSession) setSize(cols, rows int) error {
-	fmt.Printf("setSize called with cols=%d, rows=%d\n", cols, rows)
 	bs.mutex.Lock()
 	defer bs.mutex.Unlock()
 
@@ -114,18 +215,20 @@ func (bs *BashSession) setSize(cols, rows int) error {
 	err := pty.Setsize(bs.pty, winsize)
 	if err != nil {
 		fmt.Printf("Error setting PTY size: %v\n", err)
-	} else {
-		fmt.Printf("Successfully set PTY size to %dx%d\n", cols, rows)
 	}
 	return err
 }
 
 func (bs *BashSession) close() {
-	bs.cancel()
-	if bs.pty != nil {
-		bs.pty.Close()
-	}
-	if bs.cmd != nil && bs.cmd.Process != nil {
-		bs.cmd.Process.Kill()
-	}
+	bs.closeOnce.Do(func() {
+		bs.cancel()
+		if bs.pty != nil {
+			bs.pty.Close()
+		}
+		if bs.cmd != nil && bs.cmd.Process != nil {
+			bs.cmd.Process.Kill()
+			// reap the process, the error of a killed shell is expected
+			go bs.cmd.Wait()
+		}
+	})
 }
@@ -0,0 +1,358 @@
+package viewer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ExportOptions configures Export
+type ExportOptions struct {
+	RenderOptions
+}
+
+const mermaidScript = `<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@11/dist/mermaid.esm.min.mjs";
+mermaid.initialize({ startOnLoad: true });
+</script>`
+
+const exportCSS = `
+body { margin: 0; background: #fff; color: #1f2328; font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; line-height: 1.6; }
+.markdown-body { max-width: 980px; margin: 0 auto; padding: 32px; }
+h1, h2 { border-bottom: 1px solid #d1d9e0; padding-bottom: .3em; }
+a { color: #0969da; }
+code { background: #eff1f3; border-radius: 4px; padding: .2em .4em; font-size: 85%; font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+pre { background: #f6f8fa; border-radius: 6px; padding: 16px; overflow: auto; }
+pre code { background: none; padding: 0; }
+blockquote { margin: 0; padding: 0 1em; color: #59636e; border-left: .25em solid #d1d9e0; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d1d9e0; padding: 6px 13px; }
+tr:nth-child(2n) { background: #f6f8fa; }
+img { max-width: 100%; }
+.diagram { text-align: center; margin: 16px 0; overflow: auto; }
+.diagram svg { max-width: 100%; height: auto; }
+.export-error { color: #d1242f; font-size: 90%; }
+`
+
+// exporter renders the files of one export, diagram errors are reported
+// as warnings and fall back to the source.
+type exporter struct {
+	opts ExportOptions
+	// dirMode rewrites links to exported files instead of inlining images
+	dirMode  bool
+	warnings int
+}
+
+// Export renders input to output. A single file is exported to a self
+// contained html page with the diagrams inlined as SVG, or to svg, png or
+// pdf for diagram files. A directory is exported to a directory of html
+// pages and svg diagrams keeping relative links, other files are copied.
+func Export(input string, output string, opts ExportOptions) error {
+	stat, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		e := &exporter{opts: opts, dirMode: true}
+		return e.exportDir(input, output)
+	}
+	e := &exporter{opts: opts}
+	return e.exportFile(input, output)
+}
+
+func (e *exporter) exportFile(input string, output string) error {
+	content, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	kind := detectFileType(strings.ToLower(filepath.Ext(input)))
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+	switch format {
+	case "svg", "png", "pdf":
+		if kind != diagramUML && kind != diagramDOT && kind != diagramMermaid {
+			return fmt.Errorf("only diagrams can be exported to %s, export %s to .html instead", format, filepath.Base(input))
+		}
+		data, err := RenderDiagram(kind, string(content), format, e.opts.RenderOptions)
+		if err != nil {
+			return err
+		}
+		return writeExport(output, data)
+	case "html", "htm":
+		page, err := e.renderPage(input, kind, string(content))
+		if err != nil {
+			return err
+		}
+		return writeExport(output, []byte(page))
+	default:
+		return fmt.Errorf("unsupported output format: %s, expecting .html, .svg, .png or .pdf", filepath.Ext(output))
+	}
+}
+
+func (e *exporter) exportDir(input string, output string) error {
+	absInput, err := filepath.Abs(input)
+	if err != nil {
+		return err
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	var pages []string
+	var failed int
+	err = filepath.WalkDir(absInput, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != absInput && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			// do not export the output into itself
+			if path == absOutput {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(absInput, path)
+		if err != nil {
+			return err
+		}
+		kind := detectFileType(strings.ToLower(filepath.Ext(path)))
+		target := filepath.Join(absOutput, exportedName(rel))
+		switch kind {
+		case "markdown":
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			page, err := e.renderPage(path, kind, string(content))
+			if err != nil {
+				return err
+			}
+			pages = append(pages, exportedName(rel))
+			return writeExport(target, []byte(page))
+		case diagramUML, diagramDOT, diagramMermaid:
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			svg, err := RenderDiagram(kind, string(content), "svg", e.opts.RenderOptions)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", rel, err)
+				failed++
+				return nil
+			}
+			return writeExport(target, svg)
+		default:
+			return copyExportFile(path, target)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(absOutput, "index.html")); os.IsNotExist(err) && len(pages) > 0 {
+		if err := writeExport(filepath.Join(absOutput, "index.html"), []byte(indexPage(filepath.Base(absInput), pages))); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Exported %d pages to %s\n", len(pages), output)
+	if failed > 0 {
+		return fmt.Errorf("%d diagrams failed to render", failed)
+	}
+	if e.warnings > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d embedded diagrams were not rendered\n", e.warnings)
+	}
+	return nil
+}
+
+// renderPage renders a whole html page for the file
+func (e *exporter) renderPage(file string, kind string, content string) (string, error) {
+	title := filepath.Base(file)
+	var body string
+	var needMermaid bool
+	switch kind {
+	case "markdown":
+		baseDir := filepath.Dir(file)
+		renderer := &markdownRenderer{
+			code: func(lang string, code string) (string, bool) {
+				diagram := diagramKind(lang)
+				if diagram == "" {
+					return "", false
+				}
+				out, clientSide := e.renderEmbedded(file, diagram, code)
+				needMermaid = needMermaid || clientSide
+				return out, true
+			},
+			link: e.rewriteLink,
+			image: func(src string) string {
+				if e.dirMode {
+					return e.rewriteLink(src)
+				}
+				return embedImage(baseDir, src, e.opts.RenderOptions)
+			},
+		}
+		body = renderer.render(content)
+		if heading := firstHeadingRegex.FindStringSubmatch(body); heading != nil {
+			title = html.UnescapeString(tagRegex.ReplaceAllString(heading[1], ""))
+		}
+	case diagramUML, diagramDOT, diagramMermaid:
+		svg, err := RenderDiagram(kind, content, "svg", e.opts.RenderOptions)
+		if err != nil {
+			return "", err
+		}
+		body = fmt.Sprintf("<div class=\"diagram\">%s</div>", inlineSVG(svg))
+	default:
+		body = fmt.Sprintf("<pre><code>%s</code></pre>", html.EscapeString(content))
+	}
+	script := ""
+	if needMermaid {
+		script = mermaidScript
+	}
+	return fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n<article class=\"markdown-body\">\n%s</article>\n%s</body>\n</html>\n",
+		html.EscapeString(title), exportCSS, body, script), nil
+}
+
+var (
+	firstHeadingRegex = regexp.MustCompile(`<h[1-6][^>]*>(.*?)</h[1-6]>`)
+	tagRegex          = regexp.MustCompile(`<[^>]*>`)
+)
+
+// renderEmbedded renders a diagram code block of a markdown file. Mermaid
+// is left to the browser when mmdc is not installed.
+func (e *exporter) renderEmbedded(file string, kind string, code string) (out string, clientSide bool) {
+	svg, err := RenderDiagram(kind, code, "svg", e.opts.RenderOptions)
+	if err == nil {
+		return fmt.Sprintf("<div class=\"diagram\">%s</div>", inlineSVG(svg)), false
+	}
+	if kind == diagramMermaid {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v, mermaid will be rendered by the browser\n", file, err)
+		return fmt.Sprintf("<pre class=\"mermaid\">%s</pre>", html.EscapeString(code)), true
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", file, err)
+	e.warnings++
+	return fmt.Sprintf("<div class=\"export-error\">Failed to render %s diagram: %s</div>\n<pre><code class=\"language-%s\">%s</code></pre>",
+		kind, html.EscapeString(err.Error()), kind, html.EscapeString(code)), false
+}
+
+// rewriteLink points relative links to markdown and diagram files at
+// their exported names in directory mode.
+func (e *exporter) rewriteLink(href string) string {
+	if !e.dirMode || !isRelativeLink(href) {
+		return href
+	}
+	path, suffix := href, ""
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		path, suffix = href[:i], href[i:]
+	}
+	if path == "" {
+		return href
+	}
+	return exportedName(path) + suffix
+}
+
+// exportedName maps a source file name to its name in the export
+func exportedName(name string) string {
+	ext := filepath.Ext(name)
+	switch detectFileType(strings.ToLower(ext)) {
+	case "markdown":
+		return strings.TrimSuffix(name, ext) + ".html"
+	case diagramUML, diagramDOT, diagramMermaid:
+		return strings.TrimSuffix(name, ext) + ".svg"
+	}
+	return name
+}
+
+func isRelativeLink(href string) bool {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return false
+	}
+	if i := strings.Index(href, ":"); i >= 0 && !strings.ContainsAny(href[:i], "/?#") {
+		// a scheme like https: or mailto:
+		return false
+	}
+	return true
+}
+
+// embedImage inlines a local image as a data uri, diagram files are
+// rendered to svg first. Remote and missing images are kept as is.
+func embedImage(baseDir string, src string, opts RenderOptions) string {
+	if !isRelativeLink(src) {
+		return src
+	}
+	path := src
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	file := filepath.Join(baseDir, filepath.FromSlash(path))
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return src
+	}
+	ext := strings.ToLower(filepath.Ext(file))
+	mimeType := mime.TypeByExtension(ext)
+	switch kind := detectFileType(ext); kind {
+	case diagramUML, diagramDOT, diagramMermaid:
+		svg, err := RenderDiagram(kind, string(data), "svg", opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", file, err)
+			return src
+		}
+		data = svg
+		mimeType = "image/svg+xml"
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func indexPage(title string, pages []string) string {
+	sort.Strings(pages)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n<ul>\n", html.EscapeString(title))
+	for _, page := range pages {
+		href := filepath.ToSlash(page)
+		fmt.Fprintf(&sb, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(strings.TrimSuffix(href, ".html")))
+	}
+	sb.WriteString("</ul>\n")
+	return fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n<article class=\"markdown-body\">\n%s</article>\n</body>\n</html>\n",
+		html.EscapeString(title), exportCSS, sb.String())
+}
+
+func writeExport(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func copyExportFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
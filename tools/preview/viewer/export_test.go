@@ -0,0 +1,111 @@
+package viewer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownRender(t *testing.T) {
+	m := &markdownRenderer{}
+	got := m.render("# Hello *World*\n\nsome `a<b>` **bold** snake_case ~~old~~ [link](a.md)\nnext\n\n- a\n  - b\n- [x] done\n\n| x | y |\n|---|--:|\n| 1 | 2 |\n\n<details>raw</details>\n\n## Hello World\n")
+	for _, want := range []string{
+		`<h1 id="hello-world">Hello <em>World</em></h1>`,
+		"<code>a&lt;b&gt;</code> <strong>bold</strong> snake_case <del>old</del> <a href=\"a.md\">link</a><br>\nnext",
+		"<li>a\n<ul>\n<li>b</li>\n</ul>\n</li>",
+		`<input checked="" disabled="" type="checkbox"> done`,
+		`<td style="text-align:right">2</td>`,
+		`<details>raw</details>`,
+		`<h2 id="hello-world-1">Hello World</h2>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expect %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestMarkdownRenderHooks(t *testing.T) {
+	m := &markdownRenderer{
+		code: func(lang string, code string) (string, bool) {
+			if lang != "mermaid" {
+				return "", false
+			}
+			return "<div class=\"diagram\">" + code + "</div>", true
+		},
+		link:  func(href string) string { return strings.TrimSuffix(href, ".md") + ".html" },
+		image: func(src string) string { return "data:" + src },
+	}
+	got := m.render("[doc](a.md) ![img](b.png)\n\n```Mermaid\ngraph TD\n```\n\n```go\nif a < b {}\n```\n\n    indented\n")
+	for _, want := range []string{
+		`<a href="a.html">doc</a> <img src="data:b.png" alt="img">`,
+		"<div class=\"diagram\">graph TD</div>\n",
+		"<pre><code class=\"language-go\">if a &lt; b {}</code></pre>\n",
+		"<pre><code>indented\n</code></pre>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expect %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestExportDir(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "docs")
+	write := func(file string, content string) {
+		t.Helper()
+		file = filepath.Join(src, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("README.md", "# Docs\n\nSee [design](sub/design.md#goals), [site](https://example.com) and ![logo](logo.png)\n")
+	write("sub/design.md", "# Design\n\n## Goals\n\n[back](../README.md)\n")
+	write("logo.png", "png")
+	write(".hidden/x.md", "# hidden\n")
+
+	out := filepath.Join(dir, "out")
+	if err := Export(src, out, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	readme, err := os.ReadFile(filepath.Join(out, "README.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<title>Docs</title>`, `href="sub/design.html#goals"`, `href="https://example.com"`, `src="logo.png"`} {
+		if !strings.Contains(string(readme), want) {
+			t.Errorf("expect %q in README.html", want)
+		}
+	}
+	design, err := os.ReadFile(filepath.Join(out, "sub", "design.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(design), `<h2 id="goals">`) || !strings.Contains(string(design), `href="../README.html"`) {
+		t.Errorf("unexpected design.html:\n%s", design)
+	}
+	for _, file := range []string{"logo.png", "index.html"} {
+		if _, err := os.Stat(filepath.Join(out, file)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, ".hidden")); err == nil {
+		t.Error("hidden directories should not be exported")
+	}
+
+	// a single file embeds the local images
+	single := filepath.Join(dir, "readme.html")
+	if err := Export(filepath.Join(src, "README.md"), single, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `src="data:image/png;base64,`) || !strings.Contains(string(page), `href="sub/design.md#goals"`) {
+		t.Errorf("unexpected single page:\n%s", page)
+	}
+}
@@ -0,0 +1,175 @@
+package viewer
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	RendererServer = "server"
+	RendererLocal  = "local"
+)
+
+// LocalCapabilities reports the tools found for --renderer local
+type LocalCapabilities struct {
+	Java            string   `json:"java,omitempty"`
+	PlantUMLJar     string   `json:"plantumlJar,omitempty"`
+	PlantUMLCommand string   `json:"plantumlCommand,omitempty"`
+	Dot             string   `json:"dot,omitempty"`
+	PlantUML        bool     `json:"plantuml"` // PlantUML diagrams can be rendered
+	DOT             bool     `json:"dotAvailable"`
+	Problems        []string `json:"problems,omitempty"`
+}
+
+var (
+	localCapsOnce sync.Once
+	localCaps     *LocalCapabilities
+)
+
+// plantUMLJarCandidates are the usual install locations of plantuml.jar,
+// PLANTUML_JAR takes precedence.
+var plantUMLJarCandidates = []string{
+	"/usr/share/plantuml/plantuml.jar",
+	"/usr/share/java/plantuml.jar",
+	"/usr/local/share/plantuml/plantuml.jar",
+	"/opt/plantuml/plantuml.jar",
+	"/opt/homebrew/opt/plantuml/libexec/plantuml.jar",
+	"/usr/local/opt/plantuml/libexec/plantuml.jar",
+}
+
+// DetectLocalCapabilities looks for java with plantuml.jar, a plantuml
+// command and dot, once per process.
+func DetectLocalCapabilities() *LocalCapabilities {
+	localCapsOnce.Do(func() {
+		localCaps = detectLocalCapabilities()
+	})
+	return localCaps
+}
+
+func detectLocalCapabilities() *LocalCapabilities {
+	caps := &LocalCapabilities{}
+	if path, err := exec.LookPath("dot"); err == nil {
+		caps.Dot = path
+		caps.DOT = true
+	}
+	if path, err := exec.LookPath("java"); err == nil {
+		caps.Java = path
+	}
+	candidates := plantUMLJarCandidates
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".kool", "plantuml.jar"))
+	}
+	if jar := os.Getenv("PLANTUML_JAR"); jar != "" {
+		candidates = append([]string{jar}, candidates...)
+	}
+	for _, jar := range candidates {
+		if stat, err := os.Stat(jar); err == nil && !stat.IsDir() {
+			caps.PlantUMLJar = jar
+			break
+		}
+	}
+	if path, err := exec.LookPath("plantuml"); err == nil {
+		caps.PlantUMLCommand = path
+	}
+	caps.PlantUML = caps.PlantUMLCommand != "" || (caps.Java != "" && caps.PlantUMLJar != "")
+
+	if !caps.PlantUML {
+		switch {
+		case caps.PlantUMLJar != "":
+			caps.Problems = append(caps.Problems, "PlantUML: found "+caps.PlantUMLJar+" but no java in PATH")
+		case caps.Java != "":
+			caps.Problems = append(caps.Problems, "PlantUML: no plantuml.jar found, set PLANTUML_JAR or copy it to ~/.kool/plantuml.jar")
+		default:
+			caps.Problems = append(caps.Problems, "PlantUML: neither a plantuml command nor java with plantuml.jar found")
+		}
+	}
+	if !caps.DOT {
+		caps.Problems = append(caps.Problems, "Graphviz: dot not found, it renders DOT and all PlantUML diagrams except sequence diagrams")
+	}
+	return caps
+}
+
+// renderPlantUMLLocal runs plantuml in pipe mode
+func renderPlantUMLLocal(source string, format string) ([]byte, error) {
+	caps := DetectLocalCapabilities()
+	if !caps.PlantUML {
+		return nil, fmt.Errorf("cannot render PlantUML locally: %s", strings.Join(caps.Problems, "; "))
+	}
+	var cmd *exec.Cmd
+	if caps.PlantUMLCommand != "" {
+		cmd = exec.Command(caps.PlantUMLCommand, "-t"+format, "-pipe", "-charset", "UTF-8")
+	} else {
+		cmd = exec.Command(caps.Java, "-Djava.awt.headless=true", "-jar", caps.PlantUMLJar, "-t"+format, "-pipe", "-charset", "UTF-8")
+	}
+	cmd.Env = os.Environ()
+	if caps.Dot != "" {
+		cmd.Env = append(cmd.Env, "GRAPHVIZ_DOT="+caps.Dot)
+	}
+	cmd.Stdin = strings.NewReader(source)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	// on syntax errors plantuml exits non-zero but still draws the error
+	// as an image, which is more helpful than a broken image
+	if len(output) == 0 || (format == "svg" && !bytes.Contains(output, []byte("<svg"))) {
+		if err == nil {
+			err = fmt.Errorf("empty output")
+		}
+		return nil, fmt.Errorf("plantuml: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// cachedRender keeps the local renders in plantUMLCacheDir, keyed by the
+// hash of the kind, format and source.
+func cachedRender(kind string, format string, source string, render func(source string, format string) ([]byte, error)) ([]byte, error) {
+	hash := sha256.Sum256([]byte(kind + "\x00" + format + "\x00" + source))
+	cacheFile := filepath.Join(plantUMLCacheDir, "local-"+kind+"-"+hex.EncodeToString(hash[:])+"."+format)
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		return data, nil
+	}
+	data, err := render(source, format)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(plantUMLCacheDir, 0755); err == nil {
+		if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+			fmt.Printf("Warning: Failed to cache %s %s: %v\n", kind, format, err)
+		}
+	}
+	return data, nil
+}
+
+// decodePlantUML reverses encodePlantUML, for the images the UI requests
+// by encoded source.
+func decodePlantUML(encoded string) (string, error) {
+	var data []byte
+	for i := 0; i < len(encoded); i += 4 {
+		var group [4]byte
+		for j := 0; j < 4; j++ {
+			if i+j >= len(encoded) {
+				break
+			}
+			v := strings.IndexByte(plantUMLAlphabet, encoded[i+j])
+			if v < 0 {
+				return "", fmt.Errorf("invalid character %q in encoded diagram", encoded[i+j])
+			}
+			group[j] = byte(v)
+		}
+		data = append(data, group[0]<<2|group[1]>>4, group[1]<<4|group[2]>>2, group[2]<<6|group[3])
+	}
+	text, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil && len(text) == 0 {
+		return "", fmt.Errorf("failed to inflate encoded diagram: %v", err)
+	}
+	return string(text), nil
+}
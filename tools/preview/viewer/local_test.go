@@ -0,0 +1,26 @@
+package viewer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodePlantUML(t *testing.T) {
+	sources := []string{
+		"@startuml\nAlice -> Bob: hello\n@enduml\n",
+		"a",
+		strings.Repeat("digraph { a -> b }\n", 50),
+	}
+	for _, source := range sources {
+		decoded, err := decodePlantUML(encodePlantUML(source))
+		if err != nil {
+			t.Fatalf("decode %q: %v", source, err)
+		}
+		if decoded != source {
+			t.Errorf("round trip: expected %q, got %q", source, decoded)
+		}
+	}
+	if _, err := decodePlantUML("not~valid"); err == nil {
+		t.Errorf("expected error for invalid character")
+	}
+}
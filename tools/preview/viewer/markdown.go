@@ -0,0 +1,141 @@
+package viewer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// markdownRenderer converts GitHub flavored markdown to html for export
+// with goldmark, the web UI renders with marked instead. Like the UI,
+// single line breaks are kept as <br>.
+type markdownRenderer struct {
+	// code renders a fenced code block, returning false for the default
+	code func(lang string, code string) (string, bool)
+	// link and image rewrite the link and image targets
+	link  func(href string) string
+	image func(src string) string
+}
+
+func (m *markdownRenderer) render(src string) string {
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithASTTransformers(util.Prioritized(&linkTransformer{m}, 100)),
+		),
+		goldmark.WithRendererOptions(
+			goldmarkhtml.WithHardWraps(),
+			goldmarkhtml.WithUnsafe(),
+			renderer.WithNodeRenderers(util.Prioritized(&fencedCodeRenderer{m}, 100)),
+		),
+	)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{seen: make(map[string]int)}))
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf, parser.WithContext(ctx)); err != nil {
+		// goldmark only fails on write errors, never for a bytes.Buffer
+		return fmt.Sprintf("<pre>%s</pre>\n", html.EscapeString(src))
+	}
+	return buf.String()
+}
+
+// linkTransformer applies the link and image rewrites
+type linkTransformer struct {
+	m *markdownRenderer
+}
+
+func (t *linkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			if t.m.link != nil {
+				n.Destination = []byte(t.m.link(string(n.Destination)))
+			}
+		case *ast.Image:
+			if t.m.image != nil {
+				n.Destination = []byte(t.m.image(string(n.Destination)))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// fencedCodeRenderer lets markdownRenderer.code render fenced code
+// blocks, diagrams in particular, before the default rendering
+type fencedCodeRenderer struct {
+	m *markdownRenderer
+}
+
+func (r *fencedCodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCode)
+}
+
+func (r *fencedCodeRenderer) renderFencedCode(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+	lang := strings.ToLower(string(n.Language(source)))
+	var code strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+	text := strings.TrimSuffix(code.String(), "\n")
+	if r.m.code != nil {
+		if out, ok := r.m.code(lang, text); ok {
+			w.WriteString(out)
+			w.WriteString("\n")
+			return ast.WalkSkipChildren, nil
+		}
+	}
+	class := ""
+	if lang != "" {
+		class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(lang))
+	}
+	fmt.Fprintf(w, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(text))
+	return ast.WalkSkipChildren, nil
+}
+
+var (
+	slugLinkRegex   = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	slugMarkupRegex = regexp.MustCompile("<[^>]*>|[*~`]")
+	slugDropRegex   = regexp.MustCompile(`[^\p{L}\p{N}\s_-]`)
+)
+
+// headingIDs follows GitHub's anchors: lower case, punctuation dropped,
+// spaces to dashes and -1, -2... for duplicates.
+type headingIDs struct {
+	seen map[string]int
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	plain := slugLinkRegex.ReplaceAllString(string(value), "$1")
+	plain = slugMarkupRegex.ReplaceAllString(plain, "")
+	slug := strings.ReplaceAll(slugDropRegex.ReplaceAllString(strings.ToLower(strings.TrimSpace(plain)), ""), " ", "-")
+	n := ids.seen[slug]
+	ids.seen[slug] = n + 1
+	if n > 0 {
+		slug = fmt.Sprintf("%s-%d", slug, n)
+	}
+	return []byte(slug)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.seen[string(value)]++
+}
@@ -4,8 +4,13 @@ import Layout from './components/layout/Layout';
 import Preview from './components/preview/Preview';
 import MultiTabTerminal, { type MultiTabTerminalHandle } from './components/terminal/MultiTabTerminal';
 import { type FileTreeHandle } from './components/tree/FileTree';
+import FileFinder from './components/search/FileFinder';
+import ContentSearch from './components/search/ContentSearch';
+import ReviewPanel from './components/review/ReviewPanel';
 import { useResize } from './hooks/useResize';
 import { useFileWatcher } from './hooks/useFileWatcher';
+import { useServerConfig } from './hooks/useServerConfig';
+import { useReviewChanges } from './hooks/useReviewChanges';
 import './styles/globals.css';
 
 function App() {
@@ -13,6 +18,12 @@ function App() {
   const [selectedFile, setSelectedFile] = useState<string | null>(null);
   const [terminalVisible, setTerminalVisible] = useState<boolean>(false);
   const [fileNeedsReload, setFileNeedsReload] = useState<string | null>(null);
+  const { readOnly, diffRef } = useServerConfig();
+  const [searchMode, setSearchMode] = useState<'files' | 'content' | null>(null);
+  const review = useReviewChanges(diffRef);
+  // in review mode, changed files show the diff unless switched to the file
+  const [showDiff, setShowDiff] = useState<boolean>(true);
+  const [reviewReloadKey, setReviewReloadKey] = useState<number>(0);
 
   // Refs for vertical resizing
   const appContainerRef = useRef<HTMLDivElement>(null);
@@ -65,6 +76,30 @@ function App() {
     setSearchParams(newParams, { replace: true });
   };
 
+  // Ctrl+P opens the file finder, Ctrl+Shift+F the content search
+  useEffect(() => {
+    const handleKeyDown = (e: KeyboardEvent) => {
+      if (!(e.ctrlKey || e.metaKey)) {
+        return;
+      }
+      const key = e.key.toLowerCase();
+      if (key === 'p' && !e.shiftKey) {
+        e.preventDefault();
+        setSearchMode('files');
+      } else if (key === 'f' && e.shiftKey) {
+        e.preventDefault();
+        setSearchMode('content');
+      }
+    };
+    window.addEventListener('keydown', handleKeyDown);
+    return () => window.removeEventListener('keydown', handleKeyDown);
+  }, []);
+
+  const handleSearchSelect = (filePath: string) => {
+    setSearchMode(null);
+    handleFileSelect(filePath);
+  };
+
   // Handle terminal command execution
   const handleExecuteTerminalCommand = (command: string) => {
     if (terminalRef.current) {
@@ -79,18 +114,23 @@ function App() {
       if (fileTreeRef.current) {
         fileTreeRef.current.refresh();
       }
+      review.refresh();
     },
     onFileModified: (filePath) => {
       console.log('File modified:', filePath);
       // Show reload button for the modified file
       setFileNeedsReload(filePath);
+      review.refresh();
+      setReviewReloadKey(key => key + 1);
     }
   });
 
+  const changeStatus = selectedFile ? review.statusByPath[selectedFile] : undefined;
+
   return (
     <div className="app" ref={appContainerRef}>
       <div style={{
-        height: terminalVisible ? `${contentSize}%` : `calc(100% - 50px)`,
+        height: readOnly ? '100%' : terminalVisible ? `${contentSize}%` : `calc(100% - 50px)`,
         minHeight: '300px',
         display: 'flex',
         flexDirection: 'column',
@@ -101,43 +141,68 @@ function App() {
           selectedFile={selectedFile}
           onFileSelect={handleFileSelect}
           onExecuteTerminalCommand={handleExecuteTerminalCommand}
+          review={review}
         >
           <div className="preview-section">
             <div className="preview-container-wrapper">
+              {changeStatus && changeStatus !== 'deleted' && (
+                <div className="review-switch">
+                  <button className={showDiff ? 'active' : ''} onClick={() => setShowDiff(true)}>Diff</button>
+                  <button className={!showDiff ? 'active' : ''} onClick={() => setShowDiff(false)}>File</button>
+                </div>
+              )}
               <div className="preview-container">
-                <Preview
-                  selectedFile={selectedFile}
-                  fileNeedsReload={fileNeedsReload}
-                  onReloadComplete={() => setFileNeedsReload(null)}
-                />
+                {selectedFile && changeStatus && (showDiff || changeStatus === 'deleted') ? (
+                  <ReviewPanel
+                    filePath={selectedFile}
+                    diffRef={review.ref}
+                    readOnly={readOnly}
+                    reloadKey={reviewReloadKey}
+                  />
+                ) : (
+                  <Preview
+                    selectedFile={selectedFile}
+                    fileNeedsReload={fileNeedsReload}
+                    onReloadComplete={() => setFileNeedsReload(null)}
+                  />
+                )}
               </div>
             </div>
           </div>
         </Layout>
       </div>
 
-      <div
-        className="vertical-resizer"
-        ref={verticalResizerRef}
-        onMouseDown={handleVerticalMouseDown}
-        style={{
-          display: terminalVisible ? 'block' : 'none'
-        }}
-      ></div>
+      {!readOnly && <>
+        <div
+          className="vertical-resizer"
+          ref={verticalResizerRef}
+          onMouseDown={handleVerticalMouseDown}
+          style={{
+            display: terminalVisible ? 'block' : 'none'
+          }}
+        ></div>
 
-      <div style={{
-        height: terminalVisible ? `${100 - contentSize}%` : '50px',
-        minHeight: terminalVisible ? '200px' : '50px',
-        display: 'flex',
-        flexDirection: 'column',
-        overflow: 'hidden'
-      }}>
-        <MultiTabTerminal
-          ref={terminalRef}
-          isVisible={terminalVisible}
-          onToggle={() => setTerminalVisible(!terminalVisible)}
-        />
-      </div>
+        <div style={{
+          height: terminalVisible ? `${100 - contentSize}%` : '50px',
+          minHeight: terminalVisible ? '200px' : '50px',
+          display: 'flex',
+          flexDirection: 'column',
+          overflow: 'hidden'
+        }}>
+          <MultiTabTerminal
+            ref={terminalRef}
+            isVisible={terminalVisible}
+            onToggle={() => setTerminalVisible(!terminalVisible)}
+          />
+        </div>
+      </>}
+
+      {searchMode === 'files' && (
+        <FileFinder onSelect={handleSearchSelect} onClose={() => setSearchMode(null)} />
+      )}
+      {searchMode === 'content' && (
+        <ContentSearch onSelect={handleSearchSelect} onClose={() => setSearchMode(null)} />
+      )}
     </div>
   );
 }
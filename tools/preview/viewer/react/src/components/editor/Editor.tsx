@@ -1,5 +1,6 @@
 import { useState, useEffect, useCallback } from 'react';
 import DiffModal from './DiffModal';
+import { useServerConfig } from '../../hooks/useServerConfig';
 import './Editor.css';
 
 interface EditorProps {
@@ -20,6 +21,7 @@ const Editor = ({ filePath, content, onChange, onSave, fileModifiedExternally, o
     const [showDiffModal, setShowDiffModal] = useState(false);
     const [isReloading, setIsReloading] = useState(false);
     const [isManualSaving, setIsManualSaving] = useState(false);
+    const { readOnly } = useServerConfig();
     const [conflictData, setConflictData] = useState<{
         currentContent: string;
         userDiff: string;
@@ -190,7 +192,7 @@ const Editor = ({ filePath, content, onChange, onSave, fileModifiedExternally, o
         <>
             <div className="editor-section">
                 <div className="editor-header">
-                    <span>Editor</span>
+                    <span>{readOnly ? 'Editor (read-only)' : 'Editor'}</span>
                     <div className="save-controls">
                         <span className={`save-status ${saveStatus ? 'visible' : ''} ${saveStatus.includes('failed') ? 'error' : ''} ${saveStatus.includes('saved') || saveStatus.includes('Auto-saved') ? 'success' : ''}`}>
                             {saveStatus}
@@ -228,6 +230,7 @@ const Editor = ({ filePath, content, onChange, onSave, fileModifiedExternally, o
                     className="editor-textarea"
                     value={currentContent}
                     onChange={handleContentChange}
+                    readOnly={readOnly}
                     placeholder="Start editing..."
                     style={{
                         flex: 1,
@@ -4,6 +4,9 @@ interface GitDiffViewerProps {
     diff: string;
     title: string;
     fullHeight?: boolean;
+    // called with the line of the new version, e.g. to comment on it
+    onLineClick?: (newLine: number) => void;
+    commentedLines?: Set<number>;
 }
 
 interface DiffLine {
@@ -15,7 +18,7 @@ interface DiffLine {
     };
 }
 
-const GitDiffViewer = ({ diff, title, fullHeight }: GitDiffViewerProps) => {
+const GitDiffViewer = ({ diff, title, fullHeight, onLineClick, commentedLines }: GitDiffViewerProps) => {
     const parseDiff = (diffText: string): DiffLine[] => {
         const lines = diffText.split('\n');
         const parsedLines: DiffLine[] = [];
@@ -87,13 +90,20 @@ const GitDiffViewer = ({ diff, title, fullHeight }: GitDiffViewerProps) => {
             <h4>{title}</h4>
             <div className="diff-content">
                 {diffLines.map((line, index) => (
-                    <div key={index} className={`diff-line diff-line-${line.type}`}>
+                    <div
+                        key={index}
+                        className={`diff-line diff-line-${line.type}${line.lineNumber?.new && commentedLines?.has(line.lineNumber.new) ? ' diff-line-commented' : ''}`}
+                    >
                         {line.type !== 'file' && line.type !== 'header' && line.type !== 'hunk' && (
                             <div className="line-numbers">
                                 <span className="old-line-number">
                                     {line.lineNumber?.old || ''}
                                 </span>
-                                <span className="new-line-number">
+                                <span
+                                    className={`new-line-number${onLineClick && line.lineNumber?.new ? ' clickable' : ''}`}
+                                    onClick={() => line.lineNumber?.new && onLineClick?.(line.lineNumber.new)}
+                                    title={onLineClick && line.lineNumber?.new ? 'Comment on this line' : undefined}
+                                >
                                     {line.lineNumber?.new || ''}
                                 </span>
                             </div>
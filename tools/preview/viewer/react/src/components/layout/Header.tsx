@@ -1,6 +1,21 @@
 import { useState, useEffect } from 'react';
 import './Header.css';
 
+interface LocalCapabilities {
+    plantuml: boolean;
+    dotAvailable: boolean;
+    plantumlJar?: string;
+    plantumlCommand?: string;
+    problems?: string[];
+}
+
+interface PlantumlStatus {
+    isRunning: boolean;
+    port: number;
+    renderer?: string;
+    local?: LocalCapabilities;
+}
+
 interface HeaderProps {
     onExecuteTerminalCommand?: (command: string) => void;
 }
@@ -8,7 +23,7 @@ interface HeaderProps {
 const Header: React.FC<HeaderProps> = ({ onExecuteTerminalCommand }) => {
     const [isDarkTheme, setIsDarkTheme] = useState(false);
     const [isStartingPlantuml, setIsStartingPlantuml] = useState(false);
-    const [plantumlStatus, setPlantumlStatus] = useState({ isRunning: false, port: 0 });
+    const [plantumlStatus, setPlantumlStatus] = useState<PlantumlStatus>({ isRunning: false, port: 0 });
 
     // Initialize theme from localStorage on mount
     useEffect(() => {
@@ -80,7 +95,7 @@ const Header: React.FC<HeaderProps> = ({ onExecuteTerminalCommand }) => {
                 }
 
                 // Update status
-                setPlantumlStatus({ isRunning: true, port: data.port });
+                setPlantumlStatus(prev => ({ ...prev, isRunning: true, port: data.port }));
             }
         } catch (error) {
             console.error('Failed to start PlantUML server:', error);
@@ -110,7 +125,7 @@ const Header: React.FC<HeaderProps> = ({ onExecuteTerminalCommand }) => {
 
             if (data.success) {
                 // Update status - backend handles the Docker command directly
-                setPlantumlStatus({ isRunning: false, port: 0 });
+                setPlantumlStatus(prev => ({ ...prev, isRunning: false, port: 0 }));
             }
         } catch (error) {
             console.error('Failed to stop PlantUML server:', error);
@@ -131,16 +146,26 @@ const Header: React.FC<HeaderProps> = ({ onExecuteTerminalCommand }) => {
         <div className="header">
             <span>Directory Preview</span>
             <div className="header-actions">
-                <button
-                    className={`plantuml-button ${plantumlStatus.isRunning ? 'stop' : 'start'}`}
-                    onClick={handlePlantumlButtonClick}
-                    disabled={isStartingPlantuml}
-                >
-                    {isStartingPlantuml
-                        ? (plantumlStatus.isRunning ? 'Stopping...' : 'Starting...')
-                        : (plantumlStatus.isRunning ? `Stop PlantUML (${plantumlStatus.port})` : 'Start PlantUML')
-                    }
-                </button>
+                {plantumlStatus.renderer === 'local' ? (
+                    <span
+                        className={`renderer-badge ${plantumlStatus.local?.plantuml ? 'ok' : 'missing'}`}
+                        title={plantumlStatus.local?.problems?.join('\n') || plantumlStatus.local?.plantumlCommand || plantumlStatus.local?.plantumlJar}
+                    >
+                        {plantumlStatus.local?.plantuml ? 'PlantUML: local' : 'PlantUML: not installed'}
+                        {plantumlStatus.local && !plantumlStatus.local.dotAvailable ? ' (no graphviz)' : ''}
+                    </span>
+                ) : (
+                    <button
+                        className={`plantuml-button ${plantumlStatus.isRunning ? 'stop' : 'start'}`}
+                        onClick={handlePlantumlButtonClick}
+                        disabled={isStartingPlantuml}
+                    >
+                        {isStartingPlantuml
+                            ? (plantumlStatus.isRunning ? 'Stopping...' : 'Starting...')
+                            : (plantumlStatus.isRunning ? `Stop PlantUML (${plantumlStatus.port})` : 'Start PlantUML')
+                        }
+                    </button>
+                )}
                 <div className="theme-switcher">
                     <span>Theme:</span>
                     <button className="theme-toggle" onClick={toggleTheme}>
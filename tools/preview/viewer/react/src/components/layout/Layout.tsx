@@ -2,6 +2,7 @@ import { forwardRef } from 'react';
 import Header from './Header';
 import Sidebar from './Sidebar';
 import { type FileTreeHandle } from '../tree/FileTree';
+import { type ReviewChanges } from '../../hooks/useReviewChanges';
 import './Layout.css';
 
 interface LayoutProps {
@@ -9,9 +10,10 @@ interface LayoutProps {
     selectedFile: string | null;
     onFileSelect: (filePath: string | null) => void;
     onExecuteTerminalCommand?: (command: string) => void;
+    review?: ReviewChanges;
 }
 
-const Layout = forwardRef<FileTreeHandle, LayoutProps>(({ children, selectedFile, onFileSelect, onExecuteTerminalCommand }, ref) => {
+const Layout = forwardRef<FileTreeHandle, LayoutProps>(({ children, selectedFile, onFileSelect, onExecuteTerminalCommand, review }, ref) => {
     return (
         <div className="app">
             <Header onExecuteTerminalCommand={onExecuteTerminalCommand} />
@@ -20,6 +22,7 @@ const Layout = forwardRef<FileTreeHandle, LayoutProps>(({ children, selectedFile
                     ref={ref}
                     selectedFile={selectedFile}
                     onFileSelect={onFileSelect}
+                    review={review}
                 />
                 <div className="content">
                     <div className="content-header">
@@ -1,20 +1,32 @@
 import { forwardRef } from 'react';
 import FileTree, { type FileTreeHandle } from '../tree/FileTree';
+import ChangedFiles from '../review/ChangedFiles';
+import { type ReviewChanges } from '../../hooks/useReviewChanges';
 import './Sidebar.css';
 
 interface SidebarProps {
     selectedFile: string | null;
     onFileSelect: (filePath: string | null) => void;
+    review?: ReviewChanges;
 }
 
-const Sidebar = forwardRef<FileTreeHandle, SidebarProps>(({ selectedFile, onFileSelect }, ref) => {
+const Sidebar = forwardRef<FileTreeHandle, SidebarProps>(({ selectedFile, onFileSelect, review }, ref) => {
     return (
         <div className="sidebar">
             <div className="sidebar-header">Explorer</div>
+            {review?.ref && (
+                <ChangedFiles
+                    diffRef={review.ref}
+                    changes={review.changes}
+                    selectedFile={selectedFile}
+                    onFileSelect={onFileSelect}
+                />
+            )}
             <FileTree
                 ref={ref}
                 selectedFile={selectedFile}
                 onFileSelect={onFileSelect}
+                changeStatus={review?.statusByPath}
             />
         </div>
     );
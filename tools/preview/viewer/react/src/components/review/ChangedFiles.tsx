@@ -0,0 +1,35 @@
+import { type ReviewChange, statusLetter } from '../../hooks/useReviewChanges';
+import './Review.css';
+
+interface ChangedFilesProps {
+    diffRef: string;
+    changes: ReviewChange[];
+    selectedFile: string | null;
+    onFileSelect: (filePath: string | null) => void;
+}
+
+// ChangedFiles lists the files changed against the review ref, including
+// deleted files which are not in the tree
+const ChangedFiles = ({ diffRef, changes, selectedFile, onFileSelect }: ChangedFilesProps) => {
+    return (
+        <div className="changed-files">
+            <div className="changed-files-header">
+                Changes against {diffRef} ({changes.length})
+            </div>
+            {changes.length === 0 && <div className="changed-files-empty">No changes</div>}
+            {changes.map(change => (
+                <div
+                    key={change.path}
+                    className={`changed-file ${selectedFile === change.path ? 'selected' : ''}`}
+                    onClick={() => onFileSelect(change.path)}
+                    title={change.oldPath ? `${change.oldPath} → ${change.path}` : change.path}
+                >
+                    <span className={`change-badge change-${change.status}`}>{statusLetter[change.status]}</span>
+                    <span className="changed-file-path">{change.path}</span>
+                </div>
+            ))}
+        </div>
+    );
+};
+
+export default ChangedFiles;
@@ -0,0 +1,114 @@
+import { useState } from 'react';
+import './Review.css';
+
+export interface ReviewComment {
+    id: string;
+    path: string;
+    line?: number;
+    body: string;
+    createdAt: string;
+}
+
+interface ReviewCommentsProps {
+    filePath: string;
+    comments: ReviewComment[];
+    onCommentsChange: (comments: ReviewComment[]) => void;
+    // the line to comment on, null for the whole file
+    line: number | null;
+    onLineChange: (line: number | null) => void;
+    readOnly: boolean;
+}
+
+const ReviewComments = ({ filePath, comments, onCommentsChange, line, onLineChange, readOnly }: ReviewCommentsProps) => {
+    const [body, setBody] = useState('');
+    const [saving, setSaving] = useState(false);
+    const [error, setError] = useState<string | null>(null);
+
+    const addComment = async () => {
+        if (!body.trim() || saving) return;
+        setSaving(true);
+        setError(null);
+        try {
+            const response = await fetch('/api/review/comments', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ path: filePath, line: line || 0, body }),
+            });
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            const comment = await response.json();
+            onCommentsChange([...comments, comment]);
+            setBody('');
+            onLineChange(null);
+        } catch (err) {
+            setError(err instanceof Error ? err.message : 'Failed to save comment');
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const deleteComment = async (id: string) => {
+        try {
+            const response = await fetch(`/api/review/comments?id=${encodeURIComponent(id)}`, { method: 'DELETE' });
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            onCommentsChange(comments.filter(c => c.id !== id));
+        } catch (err) {
+            setError(err instanceof Error ? err.message : 'Failed to delete comment');
+        }
+    };
+
+    const sorted = [...comments].sort((a, b) => (a.line || 0) - (b.line || 0));
+
+    return (
+        <div className="review-comments">
+            <div className="review-comments-header">Comments ({comments.length})</div>
+            {sorted.map(comment => (
+                <div key={comment.id} className="review-comment">
+                    <div className="review-comment-meta">
+                        <span>{comment.line ? `Line ${comment.line}` : 'File'}</span>
+                        <span>{new Date(comment.createdAt).toLocaleString()}</span>
+                        {!readOnly && (
+                            <button className="review-comment-delete" onClick={() => deleteComment(comment.id)}>Delete</button>
+                        )}
+                    </div>
+                    <div className="review-comment-body">{comment.body}</div>
+                </div>
+            ))}
+            {error && <div className="error">{error}</div>}
+            {!readOnly && (
+                <div className="review-comment-form">
+                    <div className="review-comment-target">
+                        {line ? (
+                            <>
+                                Commenting on line {line}
+                                <button onClick={() => onLineChange(null)}>Whole file</button>
+                            </>
+                        ) : 'Commenting on the file, click a line number in the source diff to comment on a line'}
+                    </div>
+                    <textarea
+                        value={body}
+                        onChange={e => setBody(e.target.value)}
+                        onKeyDown={e => {
+                            if (e.key === 'Enter' && (e.ctrlKey || e.metaKey)) {
+                                e.preventDefault();
+                                addComment();
+                            }
+                        }}
+                        placeholder="Leave a comment (Ctrl+Enter to save)"
+                        rows={3}
+                    />
+                    <button onClick={addComment} disabled={saving || !body.trim()}>
+                        {saving ? 'Saving...' : 'Comment'}
+                    </button>
+                </div>
+            )}
+        </div>
+    );
+};
+
+export default ReviewComments;
@@ -0,0 +1,168 @@
+import { useState, useEffect } from 'react';
+import UMLPreview from '../preview/UMLPreview';
+import MermaidPreview from '../preview/MermaidPreview';
+import DOTPreview from '../preview/DOTPreview';
+import MarkdownPreview from '../preview/MarkdownPreview';
+import MarkdownPreviewV2 from '../preview/MarkdownPreviewV2';
+import GitDiffViewer from '../editor/GitDiffViewer';
+import ReviewComments, { type ReviewComment } from './ReviewComments';
+import { useV2 } from '../../utils/config';
+import { type ChangeStatus } from '../../hooks/useReviewChanges';
+import './Review.css';
+
+interface ReviewPanelProps {
+    filePath: string;
+    diffRef: string;
+    readOnly: boolean;
+    // bumped by the parent when the file changes on disk
+    reloadKey?: number;
+}
+
+interface ReviewFile {
+    path: string;
+    oldPath?: string;
+    status: ChangeStatus;
+    type: string;
+    before: string;
+    after: string;
+    diff: string;
+    binary?: boolean;
+}
+
+// rendered side by side, other types only as a source diff
+const renderedTypes = ['markdown', 'uml', 'mermaid', 'dot'];
+
+const renderContent = (type: string, content: string) => {
+    switch (type) {
+        case 'uml':
+            return <UMLPreview content={content} />;
+        case 'mermaid':
+            return <MermaidPreview content={content} />;
+        case 'dot':
+            return <DOTPreview content={content} />;
+        case 'markdown':
+        default:
+            return useV2 ?
+                <MarkdownPreviewV2 content={content} /> :
+                <MarkdownPreview content={content} />;
+    }
+};
+
+const ReviewPanel = ({ filePath, diffRef, readOnly, reloadKey }: ReviewPanelProps) => {
+    const [file, setFile] = useState<ReviewFile | null>(null);
+    const [error, setError] = useState<string | null>(null);
+    const [mode, setMode] = useState<'rendered' | 'source'>('rendered');
+    const [comments, setComments] = useState<ReviewComment[]>([]);
+    const [commentLine, setCommentLine] = useState<number | null>(null);
+
+    useEffect(() => {
+        let cancelled = false;
+        const load = async () => {
+            try {
+                setError(null);
+                const response = await fetch(`/api/review/file?path=${encodeURIComponent(filePath)}`);
+                if (!response.ok) {
+                    throw new Error(await response.text());
+                }
+                const data = await response.json();
+                if (!cancelled) {
+                    setFile(data);
+                }
+            } catch (err) {
+                if (!cancelled) {
+                    setError(err instanceof Error ? err.message : 'Failed to load diff');
+                }
+            }
+        };
+        load();
+        return () => {
+            cancelled = true;
+        };
+    }, [filePath, reloadKey]);
+
+    useEffect(() => {
+        setCommentLine(null);
+        fetch(`/api/review/comments?path=${encodeURIComponent(filePath)}`)
+            .then(response => response.ok ? response.json() : [])
+            .then(setComments)
+            .catch(err => console.error('Failed to load comments:', err));
+    }, [filePath]);
+
+    if (error) {
+        return <div className="error">Failed to load diff: {error}</div>;
+    }
+    if (!file) {
+        return (
+            <div className="loading">
+                <div className="loading-spinner"></div>
+                <div className="loading-text">Loading diff...</div>
+            </div>
+        );
+    }
+
+    const rendered = renderedTypes.includes(file.type) && !file.binary;
+    const showRendered = rendered && mode === 'rendered';
+    const commentedLines = new Set(comments.filter(c => c.line).map(c => c.line as number));
+
+    return (
+        <div className="review-panel">
+            <div className="review-toolbar">
+                <span className={`review-status review-status-${file.status}`}>{file.status}</span>
+                <span className="review-title">
+                    {file.oldPath ? `${file.oldPath} → ${file.path}` : file.path}
+                    <span className="review-ref"> against {diffRef}</span>
+                </span>
+                {rendered && (
+                    <div className="review-mode">
+                        <button className={mode === 'rendered' ? 'active' : ''} onClick={() => setMode('rendered')}>Rendered</button>
+                        <button className={mode === 'source' ? 'active' : ''} onClick={() => setMode('source')}>Source</button>
+                    </div>
+                )}
+            </div>
+
+            <div className="review-body">
+                {file.binary ? (
+                    <div className="review-empty">Binary file, no diff shown</div>
+                ) : showRendered ? (
+                    <div className="review-side-by-side">
+                        <div className="review-side">
+                            <div className="review-side-header">Before</div>
+                            <div className="review-side-content">
+                                {file.status === 'added'
+                                    ? <div className="review-empty">Added in this change</div>
+                                    : renderContent(file.type, file.before)}
+                            </div>
+                        </div>
+                        <div className="review-side">
+                            <div className="review-side-header">After</div>
+                            <div className="review-side-content">
+                                {file.status === 'deleted'
+                                    ? <div className="review-empty">Deleted in this change</div>
+                                    : renderContent(file.type, file.after)}
+                            </div>
+                        </div>
+                    </div>
+                ) : (
+                    <GitDiffViewer
+                        diff={file.diff}
+                        title={file.path}
+                        fullHeight={true}
+                        onLineClick={readOnly ? undefined : setCommentLine}
+                        commentedLines={commentedLines}
+                    />
+                )}
+            </div>
+
+            <ReviewComments
+                filePath={filePath}
+                comments={comments}
+                onCommentsChange={setComments}
+                line={commentLine}
+                onLineChange={setCommentLine}
+                readOnly={readOnly}
+            />
+        </div>
+    );
+};
+
+export default ReviewPanel;
@@ -0,0 +1,127 @@
+import { useState, useEffect, useRef } from 'react';
+import './Search.css';
+
+interface SearchMatch {
+    line: number;
+    text: string;
+}
+
+interface SearchResult {
+    path: string;
+    score: number;
+    matches: SearchMatch[];
+}
+
+interface ContentSearchProps {
+    onSelect: (filePath: string) => void;
+    onClose: () => void;
+}
+
+const ContentSearch: React.FC<ContentSearchProps> = ({ onSelect, onClose }) => {
+    const [query, setQuery] = useState('');
+    const [regex, setRegex] = useState(false);
+    const [results, setResults] = useState<SearchResult[]>([]);
+    const [error, setError] = useState<string | null>(null);
+    const [active, setActive] = useState(0);
+    const inputRef = useRef<HTMLInputElement>(null);
+
+    useEffect(() => {
+        inputRef.current?.focus();
+    }, []);
+
+    // search as you type, debounced
+    useEffect(() => {
+        if (!query.trim()) {
+            setResults([]);
+            setError(null);
+            return;
+        }
+        const controller = new AbortController();
+        const timer = setTimeout(async () => {
+            try {
+                const params = new URLSearchParams({ q: query });
+                if (regex) {
+                    params.set('regex', '1');
+                }
+                const response = await fetch(`/api/search?${params}`, { signal: controller.signal });
+                if (!response.ok) {
+                    setError(await response.text());
+                    setResults([]);
+                    return;
+                }
+                const data = await response.json();
+                setResults(data.results || []);
+                setError(null);
+                setActive(0);
+            } catch (err) {
+                if (!controller.signal.aborted) {
+                    setError(err instanceof Error ? err.message : 'Search failed');
+                }
+            }
+        }, 200);
+        return () => {
+            clearTimeout(timer);
+            controller.abort();
+        };
+    }, [query, regex]);
+
+    const handleKeyDown = (e: React.KeyboardEvent) => {
+        if (e.key === 'Escape') {
+            onClose();
+        } else if (e.key === 'ArrowDown') {
+            e.preventDefault();
+            setActive(i => Math.min(i + 1, results.length - 1));
+        } else if (e.key === 'ArrowUp') {
+            e.preventDefault();
+            setActive(i => Math.max(i - 1, 0));
+        } else if (e.key === 'Enter' && results[active]) {
+            onSelect(results[active].path);
+        }
+    };
+
+    return (
+        <div className="search-overlay" onClick={onClose}>
+            <div className="search-modal search-modal-wide" onClick={e => e.stopPropagation()}>
+                <div className="search-input-row">
+                    <input
+                        ref={inputRef}
+                        className="search-input"
+                        placeholder={regex ? 'Search with regex...' : 'Search in files...'}
+                        value={query}
+                        onChange={e => setQuery(e.target.value)}
+                        onKeyDown={handleKeyDown}
+                    />
+                    <button
+                        className={`search-toggle ${regex ? 'active' : ''}`}
+                        title="Use regular expression"
+                        onClick={() => setRegex(!regex)}
+                    >
+                        .*
+                    </button>
+                </div>
+                <div className="search-results">
+                    {error && <div className="search-error">{error}</div>}
+                    {results.map((result, i) => (
+                        <div
+                            key={result.path}
+                            className={`search-result search-result-block ${i === active ? 'active' : ''}`}
+                            onMouseEnter={() => setActive(i)}
+                            onClick={() => onSelect(result.path)}
+                        >
+                            <span className="search-result-path">{result.path}</span>
+                            {result.matches.map(match => (
+                                <div key={match.line} className="search-snippet">
+                                    <span className="search-snippet-line">{match.line}</span>
+                                    <span>{match.text}</span>
+                                </div>
+                            ))}
+                        </div>
+                    ))}
+                    {query.trim() && !error && results.length === 0 && <div className="search-empty">No results</div>}
+                </div>
+            </div>
+        </div>
+    );
+};
+
+export default ContentSearch;
@@ -0,0 +1,128 @@
+import { useState, useEffect, useRef, useMemo } from 'react';
+import './Search.css';
+
+interface FileNode {
+    name: string;
+    path: string;
+    isDir: boolean;
+    children?: FileNode[];
+}
+
+interface FileFinderProps {
+    onSelect: (filePath: string) => void;
+    onClose: () => void;
+}
+
+const maxResults = 50;
+
+function flattenFiles(node: FileNode, files: string[]) {
+    if (!node.isDir) {
+        files.push(node.path);
+        return;
+    }
+    for (const child of node.children || []) {
+        flattenFiles(child, files);
+    }
+}
+
+// fuzzyScore matches the query as a subsequence of the path, preferring
+// consecutive characters and matches in the file name, -1 if no match
+function fuzzyScore(path: string, query: string): number {
+    const lowerPath = path.toLowerCase();
+    const nameStart = lowerPath.lastIndexOf('/') + 1;
+    let score = 0;
+    let last = -1;
+    for (const ch of query.toLowerCase()) {
+        const index = lowerPath.indexOf(ch, last + 1);
+        if (index < 0) {
+            return -1;
+        }
+        score += index === last + 1 ? 3 : 1;
+        if (index >= nameStart) {
+            score += 2;
+        }
+        last = index;
+    }
+    // shorter paths first among equal matches
+    return score - path.length / 1000;
+}
+
+const FileFinder: React.FC<FileFinderProps> = ({ onSelect, onClose }) => {
+    const [files, setFiles] = useState<string[]>([]);
+    const [query, setQuery] = useState('');
+    const [active, setActive] = useState(0);
+    const inputRef = useRef<HTMLInputElement>(null);
+
+    useEffect(() => {
+        inputRef.current?.focus();
+        fetch('/api/tree')
+            .then(response => response.json())
+            .then((tree: FileNode) => {
+                const all: string[] = [];
+                flattenFiles(tree, all);
+                setFiles(all);
+            })
+            .catch(err => console.error('Failed to load files:', err));
+    }, []);
+
+    const results = useMemo(() => {
+        if (!query) {
+            return files.slice(0, maxResults);
+        }
+        return files
+            .map(path => ({ path, score: fuzzyScore(path, query) }))
+            .filter(r => r.score >= 0)
+            .sort((a, b) => b.score - a.score)
+            .slice(0, maxResults)
+            .map(r => r.path);
+    }, [files, query]);
+
+    useEffect(() => {
+        setActive(0);
+    }, [query]);
+
+    const handleKeyDown = (e: React.KeyboardEvent) => {
+        if (e.key === 'Escape') {
+            onClose();
+        } else if (e.key === 'ArrowDown') {
+            e.preventDefault();
+            setActive(i => Math.min(i + 1, results.length - 1));
+        } else if (e.key === 'ArrowUp') {
+            e.preventDefault();
+            setActive(i => Math.max(i - 1, 0));
+        } else if (e.key === 'Enter' && results[active]) {
+            onSelect(results[active]);
+        }
+    };
+
+    return (
+        <div className="search-overlay" onClick={onClose}>
+            <div className="search-modal" onClick={e => e.stopPropagation()}>
+                <input
+                    ref={inputRef}
+                    className="search-input"
+                    placeholder="Go to file..."
+                    value={query}
+                    onChange={e => setQuery(e.target.value)}
+                    onKeyDown={handleKeyDown}
+                />
+                <div className="search-results">
+                    {results.map((path, i) => (
+                        <div
+                            key={path}
+                            className={`search-result ${i === active ? 'active' : ''}`}
+                            onMouseEnter={() => setActive(i)}
+                            onClick={() => onSelect(path)}
+                        >
+                            <span className="search-result-name">{path.split('/').pop()}</span>
+                            <span className="search-result-path">{path}</span>
+                        </div>
+                    ))}
+                    {results.length === 0 && <div className="search-empty">No matching files</div>}
+                </div>
+            </div>
+        </div>
+    );
+};
+
+export default FileFinder;
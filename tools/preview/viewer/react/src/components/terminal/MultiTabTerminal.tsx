@@ -1,4 +1,4 @@
-import { useState, useCallback, useImperativeHandle, forwardRef } from 'react';
+import { useState, useCallback, useEffect, useImperativeHandle, forwardRef } from 'react';
 import TerminalTab from './TerminalTab';
 import './MultiTabTerminal.css';
 
@@ -9,32 +9,99 @@ interface MultiTabTerminalProps {
 
 interface TabData {
     id: string;
-    title: string;
+    // the server side session, the title of the tab
+    sessionId: string;
     isActive: boolean;
 }
 
+interface SessionInfo {
+    id: string;
+    clients: number;
+}
+
+// the sessions of the open tabs are remembered, so a reloaded page
+// reattaches to its shells
+const storageKey = 'kool-terminal-sessions';
+
+const loadStoredSessions = (): string[] => {
+    try {
+        const stored = JSON.parse(localStorage.getItem(storageKey) || '[]');
+        return Array.isArray(stored) ? stored.filter(id => typeof id === 'string') : [];
+    } catch {
+        return [];
+    }
+};
+
+// nextSessionId picks shell-N, N above any known session
+const nextSessionId = (known: string[]): string => {
+    let max = 0;
+    for (const id of known) {
+        const match = id.match(/^shell-(\d+)$/);
+        if (match) {
+            max = Math.max(max, parseInt(match[1], 10));
+        }
+    }
+    return `shell-${max + 1}`;
+};
+
+const initialTabs = (): TabData[] => {
+    const sessions = loadStoredSessions();
+    if (sessions.length === 0) {
+        sessions.push(nextSessionId([]));
+    }
+    return sessions.map((sessionId, index) => ({
+        id: `tab-${index + 1}`,
+        sessionId,
+        isActive: index === 0,
+    }));
+};
+
 export interface MultiTabTerminalHandle {
     executeCommand: (command: string) => void;
 }
 
 const MultiTabTerminal = forwardRef<MultiTabTerminalHandle, MultiTabTerminalProps>(
     ({ isVisible, onToggle }, ref) => {
-        const [tabs, setTabs] = useState<TabData[]>([
-            { id: 'tab-1', title: 'Terminal 1', isActive: true }
-        ]);
-        const [nextTabId, setNextTabId] = useState(2);
+        const [tabs, setTabs] = useState<TabData[]>(initialTabs);
+        const [nextTabId, setNextTabId] = useState(() => tabs.length + 1);
         const [pendingCommand, setPendingCommand] = useState<string | null>(null);
+        const [liveSessions, setLiveSessions] = useState<SessionInfo[]>([]);
+
+        useEffect(() => {
+            localStorage.setItem(storageKey, JSON.stringify(tabs.map(tab => tab.sessionId)));
+        }, [tabs]);
+
+        // sessions started by other pages can be attached from the tab bar
+        const loadSessions = useCallback(() => {
+            fetch('/api/terminal/sessions')
+                .then(response => response.ok ? response.json() : [])
+                .then(setLiveSessions)
+                .catch(error => console.error('Failed to list terminal sessions:', error));
+        }, []);
 
-        const addNewTab = useCallback(() => {
+        useEffect(() => {
+            if (isVisible) {
+                loadSessions();
+            }
+        }, [isVisible, loadSessions]);
+
+        const openSession = useCallback((sessionId: string) => {
             const newTabId = `tab-${nextTabId}`;
             setTabs(prevTabs => [
                 ...prevTabs.map(tab => ({ ...tab, isActive: false })),
-                { id: newTabId, title: `Terminal ${nextTabId}`, isActive: true }
+                { id: newTabId, sessionId, isActive: true }
             ]);
             setNextTabId(prev => prev + 1);
             return newTabId;
         }, [nextTabId]);
 
+        const addNewTab = useCallback(() => {
+            return openSession(nextSessionId([
+                ...tabs.map(tab => tab.sessionId),
+                ...liveSessions.map(session => session.id),
+            ]));
+        }, [openSession, tabs, liveSessions]);
+
         const switchTab = useCallback((tabId: string) => {
             setTabs(prevTabs =>
                 prevTabs.map(tab => ({ ...tab, isActive: tab.id === tabId }))
@@ -42,6 +109,12 @@ const MultiTabTerminal = forwardRef<MultiTabTerminalHandle, MultiTabTerminalProp
         }, []);
 
         const closeTab = useCallback((tabId: string) => {
+            // closing the tab ends its shell, also for other pages attached to it
+            const closed = tabs.find(tab => tab.id === tabId);
+            if (closed) {
+                fetch(`/api/terminal/sessions?session=${encodeURIComponent(closed.sessionId)}`, { method: 'DELETE' })
+                    .catch(error => console.error('Failed to close terminal session:', error));
+            }
             setTabs(prevTabs => {
                 const filteredTabs = prevTabs.filter(tab => tab.id !== tabId);
 
@@ -55,7 +128,9 @@ const MultiTabTerminal = forwardRef<MultiTabTerminalHandle, MultiTabTerminalProp
 
                 return filteredTabs;
             });
-        }, []);
+        }, [tabs]);
+
+        const detachedSessions = liveSessions.filter(session => !tabs.some(tab => tab.sessionId === session.id));
 
         const executeCommand = useCallback((command: string) => {
             // If terminal is collapsed, toggle it on
@@ -87,7 +162,7 @@ const MultiTabTerminal = forwardRef<MultiTabTerminalHandle, MultiTabTerminalProp
                                             className={`terminal-tab ${tab.isActive ? 'active' : ''}`}
                                             onClick={() => switchTab(tab.id)}
                                         >
-                                            <span className="tab-title">{tab.title}</span>
+                                            <span className="tab-title">{tab.sessionId}</span>
                                             {tabs.length > 1 && (
                                                 <button
                                                     className="tab-close"
@@ -104,6 +179,22 @@ const MultiTabTerminal = forwardRef<MultiTabTerminalHandle, MultiTabTerminalProp
                                     <button className="add-tab-button" onClick={addNewTab} title="Add new terminal">
                                         +
                                     </button>
+                                    {detachedSessions.length > 0 && (
+                                        <select
+                                            className="attach-session"
+                                            value=""
+                                            onFocus={loadSessions}
+                                            onChange={(e) => e.target.value && openSession(e.target.value)}
+                                            title="Attach to a session opened elsewhere"
+                                        >
+                                            <option value="">Attach...</option>
+                                            {detachedSessions.map(session => (
+                                                <option key={session.id} value={session.id}>
+                                                    {session.id} ({session.clients} attached)
+                                                </option>
+                                            ))}
+                                        </select>
+                                    )}
                                 </div>
                             </div>
                             <div className="terminal-toggle-container">
@@ -126,6 +217,7 @@ const MultiTabTerminal = forwardRef<MultiTabTerminalHandle, MultiTabTerminalProp
                         <TerminalTab
                             key={tab.id}
                             tabId={tab.id}
+                            sessionId={tab.sessionId}
                             isActive={tab.isActive}
                             isVisible={isVisible}
                             pendingCommand={tab.isActive ? pendingCommand : null}
@@ -6,6 +6,8 @@ import './TerminalTab.css';
 
 interface TerminalTabProps {
     tabId: string;
+    // the server side session, shared by every tab attached to it
+    sessionId: string;
     isActive: boolean;
     isVisible: boolean;
     pendingCommand?: string | null;
@@ -17,6 +19,8 @@ interface TerminalSession {
     fitAddon: FitAddon;
     websocket: WebSocket | null;
     connectionStatus: 'connecting' | 'connected' | 'disconnected';
+    // the shell exited, the next key press starts a new one
+    exited: boolean;
 }
 
 interface WebSocketCallbacks {
@@ -25,7 +29,7 @@ interface WebSocketCallbacks {
     onReconnect: () => void;
 }
 
-const TerminalTab: React.FC<TerminalTabProps> = ({ tabId, isActive, isVisible, pendingCommand, onCommandExecuted }) => {
+const TerminalTab: React.FC<TerminalTabProps> = ({ tabId, sessionId, isActive, isVisible, pendingCommand, onCommandExecuted }) => {
     const terminalRef = useRef<HTMLDivElement>(null);
     const sessionRef = useRef<TerminalSession | null>(null);
     const [connectionStatus, setConnectionStatus] = useState<'connecting' | 'connected' | 'disconnected'>('disconnected');
@@ -61,14 +65,19 @@ const TerminalTab: React.FC<TerminalTabProps> = ({ tabId, isActive, isVisible, p
             terminal,
             fitAddon,
             websocket: null,
-            connectionStatus: 'disconnected'
+            connectionStatus: 'disconnected',
+            exited: false
         };
 
         console.log(`Terminal session initialized for tab ${tabId}`);
 
         // Handle terminal input - send to backend
         terminal.onData((data) => {
-            console.log(`Terminal input data for tab ${tabId}:`, JSON.stringify(data));
+            if (sessionRef.current?.exited) {
+                sessionRef.current.exited = false;
+                connect();
+                return;
+            }
             sendInput(data);
         });
 
@@ -90,19 +99,24 @@ const TerminalTab: React.FC<TerminalTabProps> = ({ tabId, isActive, isVisible, p
         };
     }, [tabId]);
 
+    const connect = () => {
+        const callbacks: WebSocketCallbacks = {
+            onConnectionStatusChange: setConnectionStatus,
+            onSendTerminalSize: sendTerminalSize,
+            onReconnect: () => initializeWebSocket(sessionRef, tabId, sessionId, callbacks, isActive, isVisible)
+        };
+        initializeWebSocket(sessionRef, tabId, sessionId, callbacks, isActive, isVisible);
+    };
+
     // Handle WebSocket connection when tab becomes active and visible
     useEffect(() => {
         if (!sessionRef.current) return;
 
         if (isActive && isVisible) {
-            // Connect WebSocket for active tab
-            if (!sessionRef.current.websocket || sessionRef.current.websocket.readyState === WebSocket.CLOSED) {
-                const callbacks: WebSocketCallbacks = {
-                    onConnectionStatusChange: setConnectionStatus,
-                    onSendTerminalSize: sendTerminalSize,
-                    onReconnect: () => initializeWebSocket(sessionRef, tabId, callbacks, isActive, isVisible)
-                };
-                initializeWebSocket(sessionRef, tabId, callbacks, isActive, isVisible);
+            // Connect WebSocket for active tab, the server replays the
+            // scrollback of the session
+            if (!sessionRef.current.exited && (!sessionRef.current.websocket || sessionRef.current.websocket.readyState === WebSocket.CLOSED)) {
+                connect();
             }
             // Fit terminal when it becomes active
             setTimeout(() => {
@@ -112,7 +126,7 @@ const TerminalTab: React.FC<TerminalTabProps> = ({ tabId, isActive, isVisible, p
                 }
             }, 100);
         }
-    }, [isActive, isVisible, tabId]);
+    }, [isActive, isVisible, tabId, sessionId]);
 
     // Handle window resize for active tab
     useEffect(() => {
@@ -254,6 +268,7 @@ const TerminalTab: React.FC<TerminalTabProps> = ({ tabId, isActive, isVisible, p
 function initializeWebSocket(
     sessionRef: React.MutableRefObject<TerminalSession | null>,
     tabId: string,
+    sessionId: string,
     callbacks: WebSocketCallbacks,
     isActive: boolean,
     isVisible: boolean
@@ -266,7 +281,7 @@ function initializeWebSocket(
     }
 
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${window.location.host}/api/terminal/stream`;
+    const wsUrl = `${protocol}//${window.location.host}/api/terminal/stream?session=${encodeURIComponent(sessionId)}`;
 
     console.log(`Connecting to WebSocket for tab ${tabId}:`, wsUrl);
     callbacks.onConnectionStatusChange('connecting');
@@ -286,15 +301,24 @@ function initializeWebSocket(
     };
 
     ws.onmessage = (event) => {
-        console.log(`WebSocket message received for tab ${tabId}:`, event.data);
         try {
             const data = JSON.parse(event.data);
-            console.log(`Parsed WebSocket data for tab ${tabId}:`, data);
 
+            // the first message replays the scrollback of the session,
+            // replacing what this tab showed before reconnecting
+            if (data.session !== undefined && sessionRef.current?.terminal) {
+                sessionRef.current.terminal.reset();
+                if (data.replay) {
+                    sessionRef.current.terminal.write(data.replay);
+                }
+            }
             if (data.output && sessionRef.current?.terminal) {
-                console.log(`Writing output to terminal tab ${tabId}:`, JSON.stringify(data.output));
                 sessionRef.current.terminal.write(data.output);
             }
+            if (data.exit && sessionRef.current) {
+                sessionRef.current.exited = true;
+                sessionRef.current.terminal.write('\r\n\x1b[90m[process exited, press any key to start a new shell]\x1b[0m\r\n');
+            }
             if (data.error && sessionRef.current?.terminal) {
                 console.log(`Writing error to terminal tab ${tabId}:`, JSON.stringify(data.error));
                 sessionRef.current.terminal.write(`\x1b[31m${data.error}\x1b[0m`);
@@ -323,8 +347,9 @@ function initializeWebSocket(
             sessionRef.current.connectionStatus = 'disconnected';
         }
 
-        // Try to reconnect after a delay only if tab is still active and visible
-        if (isActive && isVisible) {
+        // Try to reconnect after a delay only if tab is still active and
+        // visible, and the shell did not exit
+        if (isActive && isVisible && !sessionRef.current?.exited && sessionRef.current?.websocket === ws) {
             setTimeout(() => {
                 console.log(`Attempting to reconnect WebSocket for tab ${tabId}...`);
                 callbacks.onReconnect();
@@ -12,13 +12,14 @@ interface FileNode {
 interface FileTreeProps {
     selectedFile: string | null;
     onFileSelect: (filePath: string | null) => void;
+    changeStatus?: Record<string, string>;
 }
 
 export interface FileTreeHandle {
     refresh: () => Promise<void>;
 }
 
-const FileTree = forwardRef<FileTreeHandle, FileTreeProps>(({ selectedFile, onFileSelect }, ref) => {
+const FileTree = forwardRef<FileTreeHandle, FileTreeProps>(({ selectedFile, onFileSelect, changeStatus }, ref) => {
     const [fileTree, setFileTree] = useState<FileNode | null>(null);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
@@ -70,6 +71,7 @@ const FileTree = forwardRef<FileTreeHandle, FileTreeProps>(({ selectedFile, onFi
                 node={fileTree}
                 selectedFile={selectedFile}
                 onFileSelect={onFileSelect}
+                changeStatus={changeStatus}
             />
         </div>
     );
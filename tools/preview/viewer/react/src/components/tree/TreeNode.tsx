@@ -1,5 +1,7 @@
 import { useState } from 'react';
+import { statusLetter } from '../../hooks/useReviewChanges';
 import './Tree.css';
+import '../review/Review.css';
 
 interface FileNode {
     name: string;
@@ -12,9 +14,11 @@ interface TreeNodeProps {
     node: FileNode;
     selectedFile: string | null;
     onFileSelect: (filePath: string | null) => void;
+    // review mode: the change status by path
+    changeStatus?: Record<string, string>;
 }
 
-const TreeNode = ({ node, selectedFile, onFileSelect }: TreeNodeProps) => {
+const TreeNode = ({ node, selectedFile, onFileSelect, changeStatus }: TreeNodeProps) => {
     const [isExpanded, setIsExpanded] = useState(true);
 
     // Use shared state for selection instead of local state
@@ -62,6 +66,11 @@ const TreeNode = ({ node, selectedFile, onFileSelect }: TreeNodeProps) => {
                     {node.isDir ? '📁' : '📄'}
                 </span>
                 <span className="name">{node.name}</span>
+                {changeStatus?.[node.path] && (
+                    <span className={`change-badge change-${changeStatus[node.path]}`}>
+                        {statusLetter[changeStatus[node.path]]}
+                    </span>
+                )}
             </div>
 
             {node.isDir && node.children && isExpanded && (
@@ -72,6 +81,7 @@ const TreeNode = ({ node, selectedFile, onFileSelect }: TreeNodeProps) => {
                             node={child}
                             selectedFile={selectedFile}
                             onFileSelect={onFileSelect}
+                            changeStatus={changeStatus}
                         />
                     ))}
                 </div>
@@ -0,0 +1,55 @@
+import { useCallback, useEffect, useState } from 'react';
+
+export type ChangeStatus = 'added' | 'modified' | 'deleted' | 'renamed';
+
+export const statusLetter: Record<string, string> = {
+    added: 'A',
+    modified: 'M',
+    deleted: 'D',
+    renamed: 'R',
+};
+
+export interface ReviewChange {
+    path: string;
+    oldPath?: string;
+    status: ChangeStatus;
+}
+
+export interface ReviewChanges {
+    ref: string;
+    changes: ReviewChange[];
+    // status by path, for annotating the tree
+    statusByPath: Record<string, ChangeStatus>;
+    refresh: () => void;
+}
+
+// useReviewChanges loads the files changed against the --diff ref, it does
+// nothing when the server is not in review mode
+export const useReviewChanges = (diffRef?: string): ReviewChanges => {
+    const [changes, setChanges] = useState<ReviewChange[]>([]);
+
+    const refresh = useCallback(() => {
+        if (!diffRef) {
+            return;
+        }
+        fetch('/api/review/changes')
+            .then(response => response.ok ? response.json() : null)
+            .then(data => {
+                if (data) {
+                    setChanges(data.changes || []);
+                }
+            })
+            .catch(error => console.error('Failed to load review changes:', error));
+    }, [diffRef]);
+
+    useEffect(() => {
+        refresh();
+    }, [refresh]);
+
+    const statusByPath: Record<string, ChangeStatus> = {};
+    for (const change of changes) {
+        statusByPath[change.path] = change.status;
+    }
+
+    return { ref: diffRef || '', changes, statusByPath, refresh };
+};
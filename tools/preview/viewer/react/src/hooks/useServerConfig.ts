@@ -0,0 +1,39 @@
+import { useEffect, useState } from 'react';
+
+export interface ServerConfig {
+    readOnly: boolean;
+    // the git ref of the review mode (--diff), empty when not reviewing
+    diffRef?: string;
+}
+
+const defaultConfig: ServerConfig = { readOnly: false, diffRef: '' };
+
+// the config does not change while the server runs, fetch it once
+let configPromise: Promise<ServerConfig> | null = null;
+
+function loadServerConfig(): Promise<ServerConfig> {
+    if (!configPromise) {
+        configPromise = fetch('/api/config')
+            .then(response => response.ok ? response.json() : defaultConfig)
+            .catch(() => defaultConfig);
+    }
+    return configPromise;
+}
+
+export const useServerConfig = (): ServerConfig => {
+    const [config, setConfig] = useState<ServerConfig>(defaultConfig);
+
+    useEffect(() => {
+        let cancelled = false;
+        loadServerConfig().then(c => {
+            if (!cancelled) {
+                setConfig(c);
+            }
+        });
+        return () => {
+            cancelled = true;
+        };
+    }, []);
+
+    return config;
+};
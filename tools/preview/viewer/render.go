@@ -0,0 +1,188 @@
+package viewer
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// diagram kinds, as returned by detectFileType
+const (
+	diagramUML     = "uml"
+	diagramDOT     = "dot"
+	diagramMermaid = "mermaid"
+)
+
+// RenderOptions configures the server side diagram rendering
+type RenderOptions struct {
+	PlantUMLServer string
+	Renderer       string // RendererServer (default) or RendererLocal
+}
+
+// diagramKind maps a markdown code block language to a diagram kind, or ""
+func diagramKind(lang string) string {
+	switch lang {
+	case "plantuml", "puml", "uml":
+		return diagramUML
+	case "dot", "graphviz":
+		return diagramDOT
+	case "mermaid":
+		return diagramMermaid
+	}
+	return ""
+}
+
+// RenderDiagram renders source of the given kind to format, one of svg,
+// png and pdf. PlantUML goes through the PlantUML server and the same
+// cache as the web UI, or a local plantuml with RendererLocal, DOT through
+// the dot binary and mermaid through mmdc (mermaid-cli).
+func RenderDiagram(kind string, source string, format string, opts RenderOptions) ([]byte, error) {
+	switch kind {
+	case diagramUML:
+		if opts.Renderer == RendererLocal {
+			return cachedRender(kind, format, source, renderPlantUMLLocal)
+		}
+		if format == "pdf" {
+			return nil, fmt.Errorf("plantuml server does not support pdf, export to svg or png")
+		}
+		return fetchPlantUML(plantUMLServerURL(opts.PlantUMLServer), format, encodePlantUML(source))
+	case diagramDOT:
+		return cachedRender(kind, format, source, renderDot)
+	case diagramMermaid:
+		return renderMermaid(source, format)
+	default:
+		return nil, fmt.Errorf("not a diagram: %s", kind)
+	}
+}
+
+// plantUMLServerURL prefers the local docker server started from the UI
+func plantUMLServerURL(configured string) string {
+	if plantumlContainer.isRunning && plantumlContainer.port > 0 {
+		return fmt.Sprintf("http://localhost:%d", plantumlContainer.port)
+	}
+	if configured == "" {
+		return "https://www.plantuml.com/plantuml"
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+// plantUMLCacheFile is keyed by the SHA256 of the encoded diagram
+func plantUMLCacheFile(encoded string, format string) string {
+	hash := sha256.Sum256([]byte(encoded))
+	return filepath.Join(plantUMLCacheDir, hex.EncodeToString(hash[:])+"."+format)
+}
+
+func fetchPlantUML(server string, format string, encoded string) ([]byte, error) {
+	cacheFilePath := plantUMLCacheFile(encoded, format)
+	if data, err := os.ReadFile(cacheFilePath); err == nil {
+		return data, nil
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Get(fmt.Sprintf("%s/%s/%s", server, format, encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch from PlantUML: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PlantUML service returned status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PlantUML response: %v", err)
+	}
+
+	// Only cache valid content (basic validation)
+	if len(data) > 0 && (format != "svg" || bytes.Contains(data, []byte("<svg"))) {
+		if err := os.MkdirAll(plantUMLCacheDir, 0755); err == nil {
+			if err := os.WriteFile(cacheFilePath, data, 0644); err != nil {
+				// Log error but don't fail the request
+				fmt.Printf("Warning: Failed to cache PlantUML %s: %v\n", format, err)
+			}
+		}
+	}
+	return data, nil
+}
+
+const plantUMLAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+// encodePlantUML encodes text like plantuml-encoder: raw deflate followed
+// by PlantUML's base64 variant.
+func encodePlantUML(text string) string {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write([]byte(text))
+	w.Close()
+	data := buf.Bytes()
+
+	var sb strings.Builder
+	for i := 0; i < len(data); i += 3 {
+		var b [3]byte
+		copy(b[:], data[i:])
+		sb.WriteByte(plantUMLAlphabet[b[0]>>2])
+		sb.WriteByte(plantUMLAlphabet[(b[0]&0x3)<<4|b[1]>>4])
+		sb.WriteByte(plantUMLAlphabet[(b[1]&0xF)<<2|b[2]>>6])
+		sb.WriteByte(plantUMLAlphabet[b[2]&0x3F])
+	}
+	return sb.String()
+}
+
+func renderDot(source string, format string) ([]byte, error) {
+	if _, err := exec.LookPath("dot"); err != nil {
+		return nil, fmt.Errorf("dot not found, install graphviz to render DOT")
+	}
+	cmd := exec.Command("dot", "-T"+format)
+	cmd.Stdin = strings.NewReader(source)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("dot: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+func renderMermaid(source string, format string) ([]byte, error) {
+	if _, err := exec.LookPath("mmdc"); err != nil {
+		return nil, fmt.Errorf("mmdc not found, install it with: npm install -g @mermaid-js/mermaid-cli")
+	}
+	tmpDir, err := os.MkdirTemp("", "kool-mermaid-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	input := filepath.Join(tmpDir, "input.mmd")
+	output := filepath.Join(tmpDir, "output."+format)
+	if err := os.WriteFile(input, []byte(source), 0644); err != nil {
+		return nil, err
+	}
+	// a distinct id keeps the styles of several inlined diagrams apart
+	hash := sha256.Sum256([]byte(source))
+	cmd := exec.Command("mmdc", "-q", "-i", input, "-o", output, "--svgId", "mermaid-"+hex.EncodeToString(hash[:6]))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("mmdc: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(output)
+}
+
+var svgPrologRegex = regexp.MustCompile(`(?s)^.*?(<svg[\s>])`)
+
+// inlineSVG strips the xml declaration, doctype and comments before <svg>
+// so the image can be embedded in html.
+func inlineSVG(svg []byte) string {
+	return svgPrologRegex.ReplaceAllString(string(svg), "$1")
+}
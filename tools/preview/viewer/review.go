@@ -0,0 +1,378 @@
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/kool/tools/git/gitcmd"
+)
+
+// reviewCommentsFile is the sidecar holding the review comments, in the
+// served directory. Being hidden, it is neither in the tree nor indexed.
+const reviewCommentsFile = ".kool-review.json"
+
+// change statuses of ReviewChange
+const (
+	changeAdded    = "added"
+	changeModified = "modified"
+	changeDeleted  = "deleted"
+	changeRenamed  = "renamed"
+)
+
+// reviewer compares the served directory against a git ref for --diff,
+// like a pull request: against the merge base of the ref and HEAD, with
+// uncommitted and untracked files included.
+type reviewer struct {
+	dir  string
+	ref  string
+	base string
+
+	mutex sync.Mutex // guards the comments file
+}
+
+// ReviewChange is a file changed against the base, paths are relative to
+// the served directory
+type ReviewChange struct {
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+	Status  string `json:"status"`
+}
+
+// ReviewFile is the before and after content of a changed file
+type ReviewFile struct {
+	ReviewChange
+	Type   string `json:"type"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Diff   string `json:"diff"`
+	Binary bool   `json:"binary,omitempty"`
+}
+
+type ReviewComment struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Line      int       `json:"line,omitempty"` // line of the new version, 0 for the whole file
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type reviewComments struct {
+	Ref      string           `json:"ref"`
+	Comments []*ReviewComment `json:"comments"`
+}
+
+func newReviewer(dir string, ref string) (*reviewer, error) {
+	if _, err := gitcmd.Output(dir, "rev-parse", "--show-toplevel"); err != nil {
+		return nil, fmt.Errorf("--diff requires a git repository: %s", dir)
+	}
+	refCommit, err := gitcmd.Output(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("unknown git ref: %s", ref)
+	}
+	base := strings.TrimSpace(refCommit)
+	if mergeBase, err := gitcmd.Output(dir, "merge-base", ref, "HEAD"); err == nil {
+		base = strings.TrimSpace(mergeBase)
+	}
+	return &reviewer{dir: dir, ref: ref, base: base}, nil
+}
+
+// changes lists the files changed under the served directory, sorted by path
+func (rv *reviewer) changes() ([]*ReviewChange, error) {
+	output, err := gitcmd.Output(rv.dir, "diff", "--name-status", "-z", "-M", "--relative", rv.base)
+	if err != nil {
+		return nil, err
+	}
+	changes := parseNameStatus(output)
+	untracked, err := gitcmd.Output(rv.dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(untracked, "\x00") {
+		if path != "" && path != reviewCommentsFile {
+			changes = append(changes, &ReviewChange{Path: path, Status: changeAdded})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// parseNameStatus parses `git diff --name-status -z`, where renames and
+// copies are followed by both the old and the new path
+func parseNameStatus(output string) []*ReviewChange {
+	fields := strings.Split(output, "\x00")
+	changes := []*ReviewChange{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		status := fields[i]
+		if status == "" {
+			break
+		}
+		change := &ReviewChange{Path: fields[i+1]}
+		switch status[0] {
+		case 'A':
+			change.Status = changeAdded
+		case 'D':
+			change.Status = changeDeleted
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return changes
+			}
+			change.Path = fields[i+2]
+			change.Status = changeAdded
+			// a copy keeps its source, only a rename has a before
+			if status[0] == 'R' {
+				change.OldPath = fields[i+1]
+				change.Status = changeRenamed
+			}
+			i++
+		default:
+			change.Status = changeModified
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func (rv *reviewer) file(path string) (*ReviewFile, error) {
+	changes, err := rv.changes()
+	if err != nil {
+		return nil, err
+	}
+	var change *ReviewChange
+	for _, c := range changes {
+		if c.Path == path {
+			change = c
+			break
+		}
+	}
+	if change == nil {
+		return nil, fmt.Errorf("not changed against %s: %s", rv.ref, path)
+	}
+
+	file := &ReviewFile{
+		ReviewChange: *change,
+		Type:         detectFileType(strings.ToLower(filepath.Ext(path))),
+	}
+	var before, after []byte
+	if change.Status != changeAdded {
+		oldPath := change.Path
+		if change.OldPath != "" {
+			oldPath = change.OldPath
+		}
+		// ./ makes the path relative to the served directory
+		content, err := gitcmd.Output(rv.dir, "show", rv.base+":./"+oldPath)
+		if err != nil {
+			return nil, err
+		}
+		before = []byte(content)
+	}
+	if change.Status != changeDeleted {
+		after, err = os.ReadFile(filepath.Join(rv.dir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if isBinary(before) || isBinary(after) {
+		file.Binary = true
+		return file, nil
+	}
+	file.Before = string(before)
+	file.After = string(after)
+
+	if change.Status == changeAdded && !rv.tracked(path) {
+		file.Diff, err = generateGitDiff("", file.After, filepath.Base(path))
+	} else {
+		args := []string{"diff", "--no-color", "-M", "--relative", rv.base, "--"}
+		if change.OldPath != "" {
+			args = append(args, change.OldPath)
+		}
+		file.Diff, err = gitcmd.Output(rv.dir, append(args, path)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (rv *reviewer) tracked(path string) bool {
+	_, err := gitcmd.Output(rv.dir, "ls-files", "--error-unmatch", "--", path)
+	return err == nil
+}
+
+func (rv *reviewer) commentsPath() string {
+	return filepath.Join(rv.dir, reviewCommentsFile)
+}
+
+func (rv *reviewer) loadComments() (*reviewComments, error) {
+	data, err := os.ReadFile(rv.commentsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &reviewComments{Ref: rv.ref, Comments: []*ReviewComment{}}, nil
+		}
+		return nil, err
+	}
+	var comments reviewComments
+	if err := json.Unmarshal(data, &comments); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", reviewCommentsFile, err)
+	}
+	if comments.Comments == nil {
+		comments.Comments = []*ReviewComment{}
+	}
+	return &comments, nil
+}
+
+func (rv *reviewer) saveComments(comments *reviewComments) error {
+	comments.Ref = rv.ref
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(rv.commentsPath(), append(data, '\n'), 0644)
+}
+
+func (rv *reviewer) addComment(path string, line int, body string) (*ReviewComment, error) {
+	rv.mutex.Lock()
+	defer rv.mutex.Unlock()
+	comments, err := rv.loadComments()
+	if err != nil {
+		return nil, err
+	}
+	comment := &ReviewComment{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		Path:      path,
+		Line:      line,
+		Body:      body,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	comments.Comments = append(comments.Comments, comment)
+	if err := rv.saveComments(comments); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (rv *reviewer) deleteComment(id string) (bool, error) {
+	rv.mutex.Lock()
+	defer rv.mutex.Unlock()
+	comments, err := rv.loadComments()
+	if err != nil {
+		return false, err
+	}
+	for i, comment := range comments.Comments {
+		if comment.ID == id {
+			comments.Comments = append(comments.Comments[:i], comments.Comments[i+1:]...)
+			return true, rv.saveComments(comments)
+		}
+	}
+	return false, nil
+}
+
+// registerReviewHandlers serves /api/review/changes, /api/review/file and
+// /api/review/comments. Comments can be read but not changed in read-only
+// mode.
+func registerReviewHandlers(mux *http.ServeMux, rv *reviewer, readOnly bool) {
+	mux.HandleFunc("/api/review/changes", func(w http.ResponseWriter, r *http.Request) {
+		changes, err := rv.changes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ref":     rv.ref,
+			"base":    rv.base,
+			"changes": changes,
+		})
+	})
+
+	mux.HandleFunc("/api/review/file", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			http.Error(w, "path parameter is required", http.StatusBadRequest)
+			return
+		}
+		file, err := rv.file(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(file)
+	})
+
+	mux.HandleFunc("/api/review/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && readOnly {
+			http.Error(w, "not allowed in read-only mode", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			rv.mutex.Lock()
+			comments, err := rv.loadComments()
+			rv.mutex.Unlock()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result := []*ReviewComment{}
+			path := r.URL.Query().Get("path")
+			for _, comment := range comments.Comments {
+				if path == "" || comment.Path == path {
+					result = append(result, comment)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+		case http.MethodPost:
+			var req struct {
+				Path string `json:"path"`
+				Line int    `json:"line"`
+				Body string `json:"body"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if req.Path == "" || strings.TrimSpace(req.Body) == "" {
+				http.Error(w, "path and body are required", http.StatusBadRequest)
+				return
+			}
+			comment, err := rv.addComment(req.Path, req.Line, strings.TrimSpace(req.Body))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(comment)
+		case http.MethodDelete:
+			found, err := rv.deleteComment(r.URL.Query().Get("id"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "comment not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
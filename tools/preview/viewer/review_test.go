@@ -0,0 +1,110 @@
+package viewer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReviewer(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	write := func(name string, content string) {
+		t.Helper()
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	write("docs/design.md", "# Design\n\nold text\n")
+	write("docs/old.md", "# Old\n\nsome content that stays the same\nacross the rename\n")
+	write("gone.txt", "bye\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	git("checkout", "-q", "-b", "feature")
+
+	write("docs/design.md", "# Design\n\nnew text\n")
+	git("mv", "docs/old.md", "docs/renamed.md")
+	git("rm", "-q", "gone.txt")
+	git("commit", "-q", "-m", "change")
+	write("flow.dot", "digraph { a -> b }\n")
+
+	rv, err := newReviewer(dir, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := rv.changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Status+" "+c.OldPath+">"+c.Path)
+	}
+	want := []string{"modified >docs/design.md", "renamed docs/old.md>docs/renamed.md", "added >flow.dot", "deleted >gone.txt"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("changes: expected %v, got %v", want, got)
+	}
+
+	file, err := rv.file("docs/design.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Type != "markdown" || !strings.Contains(file.Before, "old text") || !strings.Contains(file.After, "new text") || !strings.Contains(file.Diff, "+new text") {
+		t.Errorf("unexpected design.md diff: %+v", file)
+	}
+	file, err = rv.file("flow.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Before != "" || !strings.Contains(file.Diff, "+digraph") {
+		t.Errorf("unexpected untracked diff: %+v", file)
+	}
+	file, err = rv.file("gone.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Before != "bye\n" || file.After != "" {
+		t.Errorf("unexpected deleted file: %+v", file)
+	}
+	file, err = rv.file("docs/renamed.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Before != file.After || !strings.Contains(file.Diff, "rename from docs/old.md") {
+		t.Errorf("unexpected renamed file: %+v", file)
+	}
+	if _, err := rv.file("docs/unchanged.md"); err == nil {
+		t.Errorf("expected error for unchanged file")
+	}
+
+	comment, err := rv.addComment("docs/design.md", 3, "why?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := rv.loadComments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments.Ref != "main" || len(comments.Comments) != 1 || comments.Comments[0].Body != "why?" {
+		t.Errorf("unexpected comments: %+v", comments)
+	}
+	// the sidecar is not a change under review
+	changes, _ = rv.changes()
+	if len(changes) != len(want) {
+		t.Errorf("expected %d changes after commenting, got %d", len(want), len(changes))
+	}
+	if found, err := rv.deleteComment(comment.ID); err != nil || !found {
+		t.Errorf("delete comment: %v %v", found, err)
+	}
+}
@@ -0,0 +1,533 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+const (
+	maxIndexedFileSize  = 1 << 20
+	maxIndexedFiles     = 20000
+	maxSnippetsPerFile  = 3
+	maxSnippetLength    = 200
+	defaultSearchLimit  = 50
+	maxRegexScanResults = 1000
+
+	// minimum time between two rescans when refreshing on query
+	searchRefreshInterval = 2 * time.Second
+)
+
+// searchIdx is the index of the served directory, nil until started
+var searchIdx atomic.Pointer[searchIndex]
+
+// searchIndex is an in-memory inverted index of the text files under
+// baseDir, mapping lower-cased words to the files and their counts.
+type searchIndex struct {
+	baseDir string
+
+	mutex    sync.RWMutex
+	docs     map[string]*indexedDoc // by slash-separated relative path
+	inverted map[string]map[string]int
+	stamps   map[string]fileStamp // every file seen, indexed or not
+	skipped  int                  // files not indexed because of maxIndexedFiles
+
+	// file events received while the initial build runs, applied once
+	// it is done so they are not overwritten by the walk
+	pendingMutex sync.Mutex
+	ready        bool
+	pending      []fileEvent
+
+	// refreshOnQuery rescans the tree on search when no watcher keeps
+	// the index up to date
+	refreshOnQuery atomic.Bool
+	refreshMutex   sync.Mutex
+	lastRefresh    time.Time
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type fileEvent struct {
+	path    string
+	removed bool
+}
+
+type indexedDoc struct {
+	lines []string
+	words map[string]int
+}
+
+// SearchResult is one file matching a search
+type SearchResult struct {
+	Path    string        `json:"path"`
+	Score   float64       `json:"score"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+type SearchMatch struct {
+	Line int    `json:"line"` // 1-based
+	Text string `json:"text"`
+}
+
+func newSearchIndex(baseDir string) *searchIndex {
+	return &searchIndex{
+		baseDir:  baseDir,
+		docs:     make(map[string]*indexedDoc),
+		inverted: make(map[string]map[string]int),
+		stamps:   make(map[string]fileStamp),
+	}
+}
+
+// build indexes every text file, skipping hidden files like the tree
+// does, then applies the file events received meanwhile
+func (idx *searchIndex) build() {
+	idx.addDir(idx.baseDir)
+	for {
+		idx.pendingMutex.Lock()
+		events := idx.pending
+		idx.pending = nil
+		if len(events) == 0 {
+			idx.ready = true
+			idx.pendingMutex.Unlock()
+			return
+		}
+		idx.pendingMutex.Unlock()
+		for _, event := range events {
+			idx.apply(event)
+		}
+	}
+}
+
+func (idx *searchIndex) isReady() bool {
+	idx.pendingMutex.Lock()
+	defer idx.pendingMutex.Unlock()
+	return idx.ready
+}
+
+// handleEvent applies a file event, or queues it while building
+func (idx *searchIndex) handleEvent(path string, removed bool) {
+	event := fileEvent{path: path, removed: removed}
+	idx.pendingMutex.Lock()
+	if !idx.ready {
+		idx.pending = append(idx.pending, event)
+		idx.pendingMutex.Unlock()
+		return
+	}
+	idx.pendingMutex.Unlock()
+	idx.apply(event)
+}
+
+func (idx *searchIndex) apply(event fileEvent) {
+	if event.removed {
+		idx.remove(event.path)
+	} else {
+		idx.update(event.path)
+	}
+}
+
+// refreshIfStale rescans the tree at most every searchRefreshInterval,
+// re-indexing the files whose mtime or size changed and dropping the
+// files that are gone.
+func (idx *searchIndex) refreshIfStale() {
+	idx.refreshMutex.Lock()
+	defer idx.refreshMutex.Unlock()
+	if time.Since(idx.lastRefresh) < searchRefreshInterval {
+		return
+	}
+	seen := make(map[string]bool)
+	walkIndexable(idx.baseDir, func(path string, d os.DirEntry) {
+		rel, ok := idx.relPath(path)
+		if !ok {
+			return
+		}
+		seen[rel] = true
+		info, err := d.Info()
+		if err != nil {
+			return
+		}
+		idx.mutex.RLock()
+		stamp, ok := idx.stamps[rel]
+		idx.mutex.RUnlock()
+		if !ok || !stamp.modTime.Equal(info.ModTime()) || stamp.size != info.Size() {
+			idx.update(path)
+		}
+	})
+	idx.mutex.Lock()
+	for rel := range idx.stamps {
+		if !seen[rel] {
+			idx.removeLocked(rel)
+		}
+	}
+	idx.mutex.Unlock()
+	idx.lastRefresh = time.Now()
+}
+
+func (idx *searchIndex) addDir(dir string) {
+	walkIndexable(dir, func(path string, d os.DirEntry) {
+		idx.update(path)
+	})
+}
+
+// walkIndexable calls fn for the files under dir, skipping hidden files
+// and node_modules
+func walkIndexable(dir string, fn func(path string, d os.DirEntry)) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(path, d)
+		return nil
+	})
+}
+
+// update indexes or re-indexes the file, removing it if it is gone or
+// no longer a text file. A directory, e.g. moved into the tree, is indexed
+// as a whole.
+func (idx *searchIndex) update(absPath string) {
+	rel, ok := idx.relPath(absPath)
+	if !ok {
+		return
+	}
+	stat, err := os.Stat(absPath)
+	if err == nil && stat.IsDir() {
+		idx.addDir(absPath)
+		return
+	}
+	if err != nil {
+		idx.remove(absPath)
+		return
+	}
+	stamp := fileStamp{modTime: stat.ModTime(), size: stat.Size()}
+	if stat.Size() > maxIndexedFileSize {
+		idx.removeFile(rel, stamp)
+		return
+	}
+	content, err := os.ReadFile(absPath)
+	if err != nil || isBinary(content) {
+		idx.removeFile(rel, stamp)
+		return
+	}
+	doc := &indexedDoc{
+		lines: strings.Split(string(content), "\n"),
+		words: make(map[string]int),
+	}
+	for _, word := range tokenize(string(content)) {
+		doc.words[word]++
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	if _, exists := idx.docs[rel]; !exists && len(idx.docs) >= maxIndexedFiles {
+		idx.stamps[rel] = stamp
+		idx.skipped++
+		return
+	}
+	idx.removeLocked(rel)
+	idx.stamps[rel] = stamp
+	idx.docs[rel] = doc
+	for word, count := range doc.words {
+		postings := idx.inverted[word]
+		if postings == nil {
+			postings = make(map[string]int)
+			idx.inverted[word] = postings
+		}
+		postings[rel] = count
+	}
+}
+
+// remove drops the file, or every file under it for a directory
+func (idx *searchIndex) remove(absPath string) {
+	rel, ok := idx.relPath(absPath)
+	if !ok {
+		return
+	}
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.removeLocked(rel)
+	prefix := rel + "/"
+	for path := range idx.stamps {
+		if strings.HasPrefix(path, prefix) {
+			idx.removeLocked(path)
+		}
+	}
+}
+
+// removeFile drops a file that is no longer indexable, remembering its
+// stamp so a refresh does not read it again until it changes
+func (idx *searchIndex) removeFile(rel string, stamp fileStamp) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.removeLocked(rel)
+	idx.stamps[rel] = stamp
+}
+
+func (idx *searchIndex) removeLocked(rel string) {
+	delete(idx.stamps, rel)
+	doc := idx.docs[rel]
+	if doc == nil {
+		return
+	}
+	for word := range doc.words {
+		postings := idx.inverted[word]
+		delete(postings, rel)
+		if len(postings) == 0 {
+			delete(idx.inverted, word)
+		}
+	}
+	delete(idx.docs, rel)
+}
+
+func (idx *searchIndex) relPath(absPath string) (string, bool) {
+	rel, err := filepath.Rel(idx.baseDir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") || part == "node_modules" {
+			return "", false
+		}
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Search ranks the files containing every word of query by tf-idf, the
+// last word matching as a prefix since it may still be typed. A query
+// without words, e.g. only punctuation, falls back to a literal scan.
+func (idx *searchIndex) Search(query string, limit int) []*SearchResult {
+	words := tokenize(query)
+	if len(words) == 0 {
+		re, err := regexp.Compile(regexp.QuoteMeta(strings.TrimSpace(query)))
+		if err != nil || strings.TrimSpace(query) == "" {
+			return []*SearchResult{}
+		}
+		return idx.SearchRegex(re, limit)
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	total := float64(len(idx.docs))
+	scores := make(map[string]float64)
+	for i, word := range words {
+		// the files matching this word, with the term frequency
+		matched := make(map[string]int)
+		terms := []string{word}
+		if i == len(words)-1 {
+			terms = idx.prefixTermsLocked(word)
+		}
+		for _, term := range terms {
+			for path, count := range idx.inverted[term] {
+				matched[path] += count
+			}
+		}
+		idf := math.Log(1 + total/float64(len(matched)+1))
+		next := make(map[string]float64, len(matched))
+		for path, count := range matched {
+			if i > 0 {
+				if _, ok := scores[path]; !ok {
+					continue
+				}
+			}
+			score := scores[path] + (1+math.Log(float64(count)))*idf
+			// a word in the file name weighs more than in the content
+			if strings.Contains(strings.ToLower(path), word) {
+				score += 2 * idf
+			}
+			next[path] = score
+		}
+		scores = next
+		if len(scores) == 0 {
+			break
+		}
+	}
+
+	results := make([]*SearchResult, 0, len(scores))
+	for path, score := range scores {
+		results = append(results, &SearchResult{
+			Path:    path,
+			Score:   math.Round(score*1000) / 1000,
+			Matches: wordSnippets(idx.docs[path].lines, words),
+		})
+	}
+	sortResults(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// SearchRegex scans the indexed files like ripgrep, ranked by the number
+// of matching lines.
+func (idx *searchIndex) SearchRegex(re *regexp.Regexp, limit int) []*SearchResult {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	results := []*SearchResult{}
+	scanned := 0
+	for path, doc := range idx.docs {
+		var matches []SearchMatch
+		count := 0
+		for i, line := range doc.lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			count++
+			if len(matches) < maxSnippetsPerFile {
+				matches = append(matches, SearchMatch{Line: i + 1, Text: snippet(line)})
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		results = append(results, &SearchResult{Path: path, Score: float64(count), Matches: matches})
+		scanned++
+		if scanned >= maxRegexScanResults {
+			break
+		}
+	}
+	sortResults(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (idx *searchIndex) prefixTermsLocked(prefix string) []string {
+	var terms []string
+	for term := range idx.inverted {
+		if strings.HasPrefix(term, prefix) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (idx *searchIndex) stats() (files int, skipped int) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return len(idx.docs), idx.skipped
+}
+
+func sortResults(results []*SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+}
+
+// wordSnippets picks the first lines containing any of the words
+func wordSnippets(lines []string, words []string) []SearchMatch {
+	matches := []SearchMatch{}
+	for i, line := range lines {
+		lower := strings.ToLower(line)
+		for _, word := range words {
+			if strings.Contains(lower, word) {
+				matches = append(matches, SearchMatch{Line: i + 1, Text: snippet(line)})
+				break
+			}
+		}
+		if len(matches) >= maxSnippetsPerFile {
+			break
+		}
+	}
+	return matches
+}
+
+func snippet(line string) string {
+	line = strings.TrimSpace(line)
+	if len(line) > maxSnippetLength {
+		cut := maxSnippetLength
+		// do not split a multi-byte character
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		line = line[:cut] + "…"
+	}
+	return line
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// tokenize splits text into lower-cased words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+func isBinary(content []byte) bool {
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+// handleSearch serves /api/search?q=<query>[&regex=1][&limit=N]. Regex
+// queries use smart case like ripgrep: case-insensitive unless the
+// pattern has an upper case letter.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	index := searchIdx.Load()
+	if index == nil || !index.isReady() {
+		http.Error(w, "search index is not ready", http.StatusServiceUnavailable)
+		return
+	}
+	if index.refreshOnQuery.Load() {
+		index.refreshIfStale()
+	}
+	query := r.URL.Query().Get("q")
+	limit := defaultSearchLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	var results []*SearchResult
+	if r.URL.Query().Get("regex") == "1" || r.URL.Query().Get("regex") == "true" {
+		pattern := query
+		if strings.ToLower(pattern) == pattern {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid regex: %v", err), http.StatusBadRequest)
+			return
+		}
+		results = index.SearchRegex(re, limit)
+	} else {
+		results = index.Search(query, limit)
+	}
+	files, _ := index.stats()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":      results,
+		"indexedFiles": files,
+	})
+}
@@ -0,0 +1,134 @@
+package viewer
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	write := func(file string, content string) {
+		t.Helper()
+		file = filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("design/cache.md", "# Cache design\n\nThe cache evicts entries.\nCache hits are counted.\n")
+	write("notes.md", "Some notes about the cache.\nAnd the database.\n")
+	write("binary.bin", "cache\x00\x01")
+	write(".hidden/cache.md", "cache\n")
+
+	idx := newSearchIndex(dir)
+	idx.build()
+	if files, _ := idx.stats(); files != 2 {
+		t.Fatalf("expect 2 indexed files, got %d", files)
+	}
+
+	results := idx.Search("cache", 10)
+	if len(results) != 2 || results[0].Path != "design/cache.md" {
+		t.Fatalf("expect design/cache.md ranked first, got %+v", results)
+	}
+	if m := results[0].Matches; len(m) == 0 || m[0].Line != 1 {
+		t.Errorf("unexpected snippets: %+v", m)
+	}
+	// every word must match, the last one as a prefix
+	if results := idx.Search("cache datab", 10); len(results) != 1 || results[0].Path != "notes.md" {
+		t.Errorf("expect only notes.md, got %+v", results)
+	}
+
+	// incremental updates
+	write("notes.md", "nothing here\n")
+	idx.update(filepath.Join(dir, "notes.md"))
+	if results := idx.Search("database", 10); len(results) != 0 {
+		t.Errorf("expect no result after update, got %+v", results)
+	}
+	os.RemoveAll(filepath.Join(dir, "design"))
+	idx.remove(filepath.Join(dir, "design"))
+	if results := idx.Search("cache", 10); len(results) != 0 {
+		t.Errorf("expect no result after remove, got %+v", results)
+	}
+
+	write("new/a.txt", "func handleSearch(w, r)\n")
+	idx.update(filepath.Join(dir, "new"))
+	results = idx.SearchRegex(regexp.MustCompile(`handle\w+\(`), 10)
+	if len(results) != 1 || results[0].Path != "new/a.txt" || results[0].Matches[0].Line != 1 {
+		t.Errorf("unexpected regex results: %+v", results)
+	}
+}
+
+func TestSearchIndexQueuesEventsDuringBuild(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.md")
+	if err := os.WriteFile(file, []byte("alpha\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := newSearchIndex(dir)
+	idx.handleEvent(file, true)
+	if idx.isReady() {
+		t.Fatalf("expect index not ready before build")
+	}
+	if files, _ := idx.stats(); files != 0 {
+		t.Fatalf("expect the event to be queued, got %d indexed files", files)
+	}
+	// the queued removal is applied after the walk, not overwritten by it
+	idx.build()
+	if !idx.isReady() {
+		t.Fatalf("expect index ready after build")
+	}
+	if results := idx.Search("alpha", 10); len(results) != 0 {
+		t.Errorf("expect the queued removal to be applied, got %+v", results)
+	}
+
+	idx.handleEvent(file, false)
+	if results := idx.Search("alpha", 10); len(results) != 1 {
+		t.Errorf("expect events to be applied once ready, got %+v", results)
+	}
+}
+
+func TestSearchIndexRefreshOnQuery(t *testing.T) {
+	dir := t.TempDir()
+	write := func(file string, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.md", "alpha\n")
+	write("b.md", "beta\n")
+	idx := newSearchIndex(dir)
+	idx.build()
+
+	write("a.md", "gamma gamma\n")
+	write("c.md", "gamma\n")
+	os.Remove(filepath.Join(dir, "b.md"))
+	idx.refreshIfStale()
+	if results := idx.Search("gamma", 10); len(results) != 2 {
+		t.Errorf("expect a.md and c.md after refresh, got %+v", results)
+	}
+	if results := idx.Search("alpha", 10); len(results) != 0 {
+		t.Errorf("expect old content dropped, got %+v", results)
+	}
+	if results := idx.Search("beta", 10); len(results) != 0 {
+		t.Errorf("expect removed file dropped, got %+v", results)
+	}
+
+	// rescans are throttled
+	write("d.md", "delta\n")
+	idx.refreshIfStale()
+	if results := idx.Search("delta", 10); len(results) != 0 {
+		t.Errorf("expect no rescan within %v, got %+v", searchRefreshInterval, results)
+	}
+	idx.lastRefresh = time.Time{}
+	idx.refreshIfStale()
+	if results := idx.Search("delta", 10); len(results) != 1 {
+		t.Errorf("expect d.md after the interval, got %+v", results)
+	}
+}
@@ -0,0 +1,240 @@
+package viewer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DefaultTerminalScrollbackKB = 256
+	DefaultTerminalIdleTimeout  = 30 * time.Minute
+)
+
+var sessionIDRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// terminalManager keeps the named terminal sessions, so a session outlives
+// the WebSocket connection: a reloaded page or another browser tab attaches
+// to the same shell by its id. Sessions without clients are closed after
+// the idle timeout.
+type terminalManager struct {
+	workingDir    string
+	maxScrollback int
+	idleTimeout   time.Duration
+
+	mutex    sync.Mutex
+	sessions map[string]*BashSession
+}
+
+// TerminalSessionInfo describes a session for /api/terminal/sessions
+type TerminalSessionInfo struct {
+	ID        string    `json:"id"`
+	Clients   int       `json:"clients"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newTerminalManager(workingDir string, maxScrollback int, idleTimeout time.Duration) *terminalManager {
+	return &terminalManager{
+		workingDir:    workingDir,
+		maxScrollback: maxScrollback,
+		idleTimeout:   idleTimeout,
+		sessions:      make(map[string]*BashSession),
+	}
+}
+
+// get returns the session with the id, starting it if there is none or
+// its shell has exited
+func (m *terminalManager) get(id string) (*BashSession, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if session := m.sessions[id]; session != nil {
+		if !session.hasExited() {
+			return session, nil
+		}
+		session.close()
+		delete(m.sessions, id)
+	}
+	session, err := initBashSession(id, m.workingDir, m.maxScrollback)
+	if err != nil {
+		return nil, err
+	}
+	m.sessions[id] = session
+	return session, nil
+}
+
+func (m *terminalManager) kill(id string) bool {
+	m.mutex.Lock()
+	session := m.sessions[id]
+	delete(m.sessions, id)
+	m.mutex.Unlock()
+	if session == nil {
+		return false
+	}
+	session.close()
+	return true
+}
+
+func (m *terminalManager) list() []*TerminalSessionInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	infos := []*TerminalSessionInfo{}
+	for id, session := range m.sessions {
+		if session.hasExited() {
+			continue
+		}
+		infos = append(infos, &TerminalSessionInfo{
+			ID:        id,
+			Clients:   session.clientCount(),
+			CreatedAt: session.createdAt,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+	})
+	return infos
+}
+
+// reapIdle closes the sessions whose shell exited or which had no clients
+// for the idle timeout
+func (m *terminalManager) reapIdle(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, session := range m.sessions {
+		idle := false
+		if since, ok := session.idleSince(); ok && m.idleTimeout > 0 && now.Sub(since) > m.idleTimeout {
+			idle = true
+			fmt.Printf("Closing terminal session %s, idle for %v\n", id, m.idleTimeout)
+		}
+		if idle || session.hasExited() {
+			session.close()
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func (m *terminalManager) runReaper() {
+	interval := time.Minute
+	if m.idleTimeout > 0 && m.idleTimeout/4 < interval {
+		interval = m.idleTimeout / 4
+	}
+	for now := range time.Tick(interval) {
+		m.reapIdle(now)
+	}
+}
+
+// handleStream serves /api/terminal/stream?session=<id>. The first message
+// is {"session": id, "replay": scrollback}, followed by {"output": ...}
+// messages, and {"exit": true} when the shell exits. Clients send
+// {"input": ...} and {"resize": {"cols": N, "rows": N}}.
+func (m *terminalManager) handleStream(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if id == "" {
+		id = fmt.Sprintf("terminal-%d", time.Now().UnixNano())
+	}
+	if !sessionIDRegex.MatchString(id) {
+		http.Error(w, "invalid session id, expects letters, digits, '_', '.' or '-'", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Upgrade") != "websocket" {
+		http.Error(w, "Expected WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     sameOrigin,
+	}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Failed to upgrade to WebSocket: %v\n", err)
+		return
+	}
+	defer ws.Close()
+
+	session, err := m.get(id)
+	if err != nil {
+		fmt.Printf("Failed to create terminal session: %v\n", err)
+		ws.WriteJSON(map[string]string{"error": "Failed to create terminal session: " + err.Error()})
+		return
+	}
+	replay, output := session.attach()
+	defer session.detach(output)
+
+	if err := ws.WriteJSON(map[string]string{"session": id, "replay": replay}); err != nil {
+		return
+	}
+
+	// Handle incoming messages from WebSocket (user input)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg struct {
+				Input  *string `json:"input"`
+				Resize *struct {
+					Cols int `json:"cols"`
+					Rows int `json:"rows"`
+				} `json:"resize"`
+			}
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Input != nil {
+				if err := session.sendInput(*msg.Input); err != nil {
+					return
+				}
+			}
+			if msg.Resize != nil && msg.Resize.Cols > 0 && msg.Resize.Rows > 0 {
+				session.setSize(msg.Resize.Cols, msg.Resize.Rows)
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				if session.hasExited() {
+					ws.WriteJSON(map[string]bool{"exit": true})
+				}
+				// otherwise dropped for being slow, the client reconnects
+				return
+			}
+			if err := ws.WriteJSON(map[string]string{"output": data}); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := ws.WriteJSON(map[string]bool{"keepalive": true}); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// handleSessions serves /api/terminal/sessions: GET lists the sessions,
+// DELETE ?session=<id> kills one.
+func (m *terminalManager) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.list())
+	case http.MethodDelete:
+		if !m.kill(r.URL.Query().Get("session")) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
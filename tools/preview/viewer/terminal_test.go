@@ -0,0 +1,60 @@
+package viewer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalSessions(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	m := newTerminalManager(t.TempDir(), 4096, time.Minute)
+
+	session, err := m.get("build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.close()
+	_, output := session.attach()
+	if err := session.sendInput("echo hello-$((1+2))\n"); err != nil {
+		t.Fatal(err)
+	}
+	var received strings.Builder
+	timeout := time.After(5 * time.Second)
+	for !strings.Contains(received.String(), "hello-3") {
+		select {
+		case data := <-output:
+			received.WriteString(data)
+		case <-timeout:
+			t.Fatalf("timeout waiting for output, got %q", received.String())
+		}
+	}
+
+	// a second client shares the shell and gets the scrollback
+	same, err := m.get("build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != session {
+		t.Fatalf("expected the existing session")
+	}
+	replay, second := same.attach()
+	if !strings.Contains(replay, "hello-3") {
+		t.Errorf("expected replay to contain the output, got %q", replay)
+	}
+	if infos := m.list(); len(infos) != 1 || infos[0].ID != "build" || infos[0].Clients != 2 {
+		t.Errorf("unexpected sessions: %+v", infos)
+	}
+
+	// attached sessions are never idle
+	m.reapIdle(time.Now().Add(time.Hour))
+	if len(m.list()) != 1 {
+		t.Fatalf("expected attached session to be kept")
+	}
+	session.detach(output)
+	session.detach(second)
+	m.reapIdle(time.Now().Add(time.Hour))
+	if len(m.list()) != 0 {
+		t.Errorf("expected idle session to be closed")
+	}
+}
@@ -1,19 +1,17 @@
 package viewer
 
 import (
-	"context"
-	"crypto/sha256"
 	"embed"
 	_ "embed"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -81,6 +79,23 @@ type ServeOptions struct {
 	PlantUMLServer string
 	NoWatch        bool
 	MaxWatchedDirs int
+	// Host is the address to listen on, default is 127.0.0.1
+	Host string
+	// ReadOnly disables saving files, the terminal and the plantuml docker control
+	ReadOnly bool
+	// Token is required by the UI and every API, random if empty
+	Token string
+	// Renderer is RendererServer (default) or RendererLocal to render
+	// PlantUML with a local plantuml.jar instead of a server
+	Renderer string
+	// DiffRef enables the review mode, showing the changes against the ref
+	DiffRef string
+	// TerminalScrollbackKB is the output kept per terminal session for
+	// replay on reconnect, default is DefaultTerminalScrollbackKB
+	TerminalScrollbackKB int
+	// TerminalIdleTimeout closes terminal sessions without clients, 0 keeps
+	// them until the server exits
+	TerminalIdleTimeout time.Duration
 }
 
 type warningLimiter struct {
@@ -116,6 +131,15 @@ func normalizeServeOptions(opts ServeOptions) ServeOptions {
 	if opts.MaxWatchedDirs <= 0 {
 		opts.MaxWatchedDirs = defaultMaxWatchedDirs
 	}
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.Renderer == "" {
+		opts.Renderer = RendererServer
+	}
+	if opts.TerminalScrollbackKB <= 0 {
+		opts.TerminalScrollbackKB = DefaultTerminalScrollbackKB
+	}
 	return opts
 }
 
@@ -220,6 +244,14 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 	if err != nil {
 		return err
 	}
+	token := opts.Token
+	if token == "" {
+		token, err = generateToken()
+		if err != nil {
+			return err
+		}
+	}
+	guard := newAccessGuard(token, port, opts.ReadOnly)
 
 	err = Static(http.DefaultServeMux)
 	if err != nil {
@@ -232,6 +264,41 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 		plantumlContainer.containerID = fmt.Sprintf("plantuml-server-%d", PLANT_UTML_PORT)
 	}
 
+	var review *reviewer
+	if opts.DiffRef != "" {
+		review, err = newReviewer(absDir, opts.DiffRef)
+		if err != nil {
+			return err
+		}
+		registerReviewHandlers(http.DefaultServeMux, review, opts.ReadOnly)
+	}
+
+	// API to tell the UI what the server allows
+	http.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"readOnly": opts.ReadOnly,
+			"diffRef":  opts.DiffRef,
+		})
+	})
+
+	// Build the search index in the background, the file watcher keeps it
+	// up to date, or searches rescan the tree without watcher
+	index := newSearchIndex(absDir)
+	searchIdx.Store(index)
+	go func() {
+		index.build()
+		files, skipped := index.stats()
+		if skipped > 0 {
+			fmt.Printf("Warning: search index is limited to %d files, %d files not indexed\n", maxIndexedFiles, skipped)
+		} else {
+			fmt.Printf("Search index ready: %d files\n", files)
+		}
+	}()
+
+	// API to search file contents
+	http.HandleFunc("/api/search", handleSearch)
+
 	// API to get directory tree
 	http.HandleFunc("/api/tree", func(w http.ResponseWriter, r *http.Request) {
 		tree, err := buildFileTreeWithRelativePaths(absDir, absDir)
@@ -252,60 +319,28 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 			return
 		}
 
-		// Generate cache file path using SHA256 hash of the encoded string for safety
-		hash := sha256.Sum256([]byte(path))
-		cacheFileName := hex.EncodeToString(hash[:]) + ".svg"
-		cacheFilePath := filepath.Join(plantUMLCacheDir, cacheFileName)
-
-		// Check if file exists in cache
-		if _, err := os.Stat(cacheFilePath); err == nil {
-			// Serve from cache
-			http.ServeFile(w, r, cacheFilePath)
-			return
-		}
-
-		plantServer := strings.TrimSuffix(opts.PlantUMLServer, "/")
-
-		// If we have a running local PlantUML container, use that instead
-		if plantumlContainer.isRunning && plantumlContainer.port > 0 {
-			plantServer = fmt.Sprintf("http://localhost:%d", plantumlContainer.port)
-		} else if plantServer == "" {
-			plantServer = "https://www.plantuml.com/plantuml"
-		}
-
-		// File not in cache, fetch from PlantUML service
-		plantUMLURL := fmt.Sprintf("%s/svg/%s", plantServer, path)
-
-		// Create HTTP client with timeout
-		client := &http.Client{
-			Timeout: 30 * time.Second,
-		}
-
-		resp, err := client.Get(plantUMLURL)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch from PlantUML: %v", err), http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			http.Error(w, fmt.Sprintf("PlantUML service returned status: %d", resp.StatusCode), http.StatusBadGateway)
-			return
-		}
-
-		// Read the response body
-		svgData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to read PlantUML response: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		// Only cache if we have valid SVG content (basic validation)
-		if len(svgData) > 0 && strings.Contains(string(svgData), "<svg") {
-			// Save to cache
-			if err := os.WriteFile(cacheFilePath, svgData, 0644); err != nil {
-				// Log error but don't fail the request
-				fmt.Printf("Warning: Failed to cache PlantUML SVG: %v\n", err)
+		var svgData []byte
+		if opts.Renderer == RendererLocal {
+			source, err := decodePlantUML(path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !DetectLocalCapabilities().PlantUML {
+				http.Error(w, "local PlantUML renderer unavailable: "+strings.Join(DetectLocalCapabilities().Problems, "; "), http.StatusServiceUnavailable)
+				return
+			}
+			svgData, err = RenderDiagram(diagramUML, source, "svg", RenderOptions{Renderer: RendererLocal})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+		} else {
+			var err error
+			svgData, err = fetchPlantUML(plantUMLServerURL(opts.PlantUMLServer), "svg", path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
 			}
 		}
 
@@ -373,11 +408,13 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 
 	if opts.NoWatch {
 		fmt.Println("File watcher disabled by --no-watch; preview will continue without live reload")
+		index.refreshOnQuery.Store(true)
 	} else {
 		// Initialize file watcher on a best-effort basis. Preview should still work
 		// even when a large directory tree exceeds the process file descriptor limit.
 		if err := initFileWatcher(absDir, opts.MaxWatchedDirs); err != nil {
 			fmt.Printf("Warning: file watcher disabled: %v\n", err)
+			index.refreshOnQuery.Store(true)
 		}
 	}
 
@@ -386,9 +423,7 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 		upgrader := websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			CheckOrigin:     sameOrigin,
 		}
 
 		ws, err := upgrader.Upgrade(w, r, nil)
@@ -427,108 +462,10 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 	})
 
 	// API to execute terminal commands via WebSocket streaming
-	http.HandleFunc("/api/terminal/stream", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("WebSocket connection request received")
-
-		// Upgrade HTTP connection to WebSocket
-		upgrader := websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all connections for now
-			},
-		}
-
-		// Check if this is a WebSocket upgrade request
-		if r.Header.Get("Upgrade") != "websocket" {
-			fmt.Printf("Not a WebSocket upgrade request. Headers: %+v\n", r.Header)
-			http.Error(w, "Expected WebSocket upgrade", http.StatusBadRequest)
-			return
-		}
-
-		ws, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			fmt.Printf("Failed to upgrade to WebSocket: %v\n", err)
-			return
-		}
-		defer ws.Close()
-		fmt.Println("WebSocket connection established")
-
-		// Get or create bash session
-		session, err := initBashSession(absDir)
-		if err != nil {
-			fmt.Printf("Failed to create bash session: %v\n", err)
-			ws.WriteJSON(map[string]string{"error": "Failed to create bash session: " + err.Error()})
-			return
-		}
-		fmt.Println("Bash session obtained")
-
-		// Create a context for this connection
-		ctx, cancel := context.WithCancel(r.Context())
-		defer cancel()
-
-		// Handle incoming messages from WebSocket (user input)
-		go func() {
-			defer cancel()
-			for {
-				var msg map[string]interface{}
-				if err := ws.ReadJSON(&msg); err != nil {
-					fmt.Printf("Error reading WebSocket message: %v\n", err)
-					return
-				}
-
-				fmt.Printf("Received WebSocket message: %+v\n", msg)
-
-				if input, ok := msg["input"].(string); ok {
-					fmt.Printf("Sending input to bash: %q\n", input)
-					if err := session.sendInput(input); err != nil {
-						fmt.Printf("Error sending input to bash: %v\n", err)
-						return
-					}
-				}
-
-				if resize, ok := msg["resize"].(map[string]interface{}); ok {
-					if cols, colsOk := resize["cols"].(float64); colsOk {
-						if rows, rowsOk := resize["rows"].(float64); rowsOk {
-							fmt.Printf("Received resize request: cols=%d, rows=%d\n", int(cols), int(rows))
-							if err := session.setSize(int(cols), int(rows)); err != nil {
-								fmt.Printf("Error setting terminal size: %v\n", err)
-							}
-						}
-					}
-				}
-			}
-		}()
-
-		fmt.Println("Starting output loop")
-		// Listen for output from the bash session
-		for {
-			select {
-			case output := <-session.outputChannel:
-				fmt.Printf("Bash output: %q\n", output)
-				if err := ws.WriteJSON(map[string]string{"output": output}); err != nil {
-					fmt.Printf("Error writing output to WebSocket: %v\n", err)
-					return
-				}
-			case errOutput := <-session.errorChannel:
-				fmt.Printf("Bash error: %q\n", errOutput)
-				if err := ws.WriteJSON(map[string]string{"error": errOutput}); err != nil {
-					fmt.Printf("Error writing error to WebSocket: %v\n", err)
-					return
-				}
-			case <-ctx.Done():
-				fmt.Println("WebSocket context cancelled")
-				return
-			case <-time.After(30 * time.Second):
-				fmt.Println("Sending keepalive")
-				// Send keepalive
-				if err := ws.WriteJSON(map[string]bool{"keepalive": true}); err != nil {
-					fmt.Printf("Error sending keepalive: %v\n", err)
-					return
-				}
-			}
-		}
-	})
+	terminals := newTerminalManager(absDir, opts.TerminalScrollbackKB*1024, opts.TerminalIdleTimeout)
+	go terminals.runReaper()
+	http.HandleFunc("/api/terminal/stream", terminals.handleStream)
+	http.HandleFunc("/api/terminal/sessions", terminals.handleSessions)
 
 	// API to get file content for editing
 	http.HandleFunc("/api/content", func(w http.ResponseWriter, r *http.Request) {
@@ -760,6 +697,10 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 		response := map[string]interface{}{
 			"isRunning": plantumlContainer.isRunning,
 			"port":      plantumlContainer.port,
+			"renderer":  opts.Renderer,
+		}
+		if opts.Renderer == RendererLocal {
+			response["local"] = DetectLocalCapabilities()
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
@@ -768,12 +709,19 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 	// Remove the old /api/terminal/input endpoint since we're using WebSocket
 
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
+		Addr:         net.JoinHostPort(opts.Host, strconv.Itoa(port)),
+		Handler:      guard.wrap(http.DefaultServeMux),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	browserURL := fmt.Sprintf("http://localhost:%d", port)
+	browserHost := opts.Host
+	if browserHost == "0.0.0.0" || browserHost == "::" || browserHost == "127.0.0.1" {
+		browserHost = "localhost"
+	}
+	browserURL := fmt.Sprintf("http://%s/", net.JoinHostPort(browserHost, strconv.Itoa(port)))
+	params := url.Values{}
+	params.Set("token", token)
 	if initialFile != "" {
 		initialFilePath := initialFile
 		if !filepath.IsAbs(initialFilePath) {
@@ -789,13 +737,27 @@ func ServeWithInitialFile(dir string, opts ServeOptions, initialFile string) err
 			return fmt.Errorf("initial file is outside preview directory: %s", initialFilePath)
 		}
 
-		params := url.Values{}
 		params.Set("file", filepath.ToSlash(relInitialFile))
-		browserURL += "/?" + params.Encode()
 	}
+	browserURL += "?" + params.Encode()
 
 	fmt.Printf("Serving directory preview at %s\n", browserURL)
 	fmt.Printf("Directory: %s\n", absDir)
+	if opts.ReadOnly {
+		fmt.Println("Read-only: saving and the terminal are disabled")
+	}
+	if review != nil {
+		fmt.Printf("Reviewing changes against %s (%s), comments are saved to %s\n", review.ref, shortCommit(review.base), reviewCommentsFile)
+	}
+	if opts.Renderer == RendererLocal {
+		caps := DetectLocalCapabilities()
+		if caps.PlantUML {
+			fmt.Println("Renderer: local PlantUML", caps.PlantUMLCommand+caps.PlantUMLJar)
+		}
+		for _, problem := range caps.Problems {
+			fmt.Println("Warning:", problem)
+		}
+	}
 
 	go func() {
 		time.Sleep(1 * time.Second)
@@ -987,6 +949,10 @@ func watchFileEvents(baseDir string) {
 				continue // Skip other events
 			}
 
+			if index := searchIdx.Load(); index != nil {
+				index.handleEvent(event.Name, eventType == "delete" || eventType == "rename")
+			}
+
 			// Get relative path from base directory
 			relativePath, err := filepath.Rel(baseDir, event.Name)
 			if err != nil {
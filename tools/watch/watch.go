@@ -104,6 +104,14 @@ func executeCommand(command string, args []string) {
 	}
 }
 
+// Watch calls callback once at start and then after each throttled batch of
+// file changes, until interrupted. The first call is synchronous and
+// returns before changes are reported; the later calls run on a timer
+// goroutine each, so a slow callback may overlap the next one.
+func Watch(options WatchOptions, callback WatchCallback) error {
+	return watchAndRestart(options, callback)
+}
+
 func watchAndRestart(options WatchOptions, callback WatchCallback) error {
 	// Create file watcher
 	watcher, err := fsnotify.NewWatcher()